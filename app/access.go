@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Roles of admin API tokens
+const (
+	RoleReadOnly = "read-only" // inspect, without changing anything
+	RoleOperator = "operator"  // also run operations such as toggling plugins and resetting counters
+	RoleAdmin    = "admin"     // also replace or delete definitions and export the configuration
+)
+
+// AdminToken grants access to the admin API
+type AdminToken struct {
+	Name  string `json:"name"` // shown as the actor in the audit log
+	Token string `json:"token"`
+	Role  string `json:"role"` // "read-only", "operator" or "admin"
+}
+
+// validateAdminTokens checks the admin tokens of a configuration
+func validateAdminTokens(tokens []AdminToken) error {
+	seen := make(map[string]bool, len(tokens))
+	for i, token := range tokens {
+		if token.Name == "" || token.Token == "" {
+			return fmt.Errorf("invalid admin token %d: name and token are required", i)
+		}
+		switch token.Role {
+		case RoleReadOnly, RoleOperator, RoleAdmin:
+		default:
+			return fmt.Errorf("invalid admin token %s: unknown role %q", token.Name, token.Role)
+		}
+		if seen[token.Token] {
+			return fmt.Errorf("invalid admin token %s: token is used twice", token.Name)
+		}
+		seen[token.Token] = true
+	}
+	return nil
+}
+
+// requiredRole returns the role an admin API request needs
+func requiredRole(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case readsOnly(r):
+		// The export contains the whole configuration, tokens included
+		if path == "/_admin/export" {
+			return RoleAdmin
+		}
+		return RoleReadOnly
+	// Imports write definition files, as do changes with ?persist=true, and
+	// ?replace=true overwrites an existing definition
+	case path == "/_admin/import" || path == "/_admin/plugins/import":
+		return RoleAdmin
+	case r.URL.Query().Get("persist") == "true" || r.URL.Query().Get("replace") == "true":
+		return RoleAdmin
+	case r.Method == http.MethodDelete && (strings.HasPrefix(path, "/_admin/endpoints") || strings.HasPrefix(path, "/_admin/plugins")):
+		return RoleAdmin
+	}
+	return RoleOperator
+}
+
+// roleAllows reports whether a role includes another
+func roleAllows(role, required string) bool {
+	rank := map[string]int{RoleReadOnly: 1, RoleOperator: 2, RoleAdmin: 3}
+	return rank[role] >= rank[required]
+}
+
+// requestToken returns the admin token sent with a request as a bearer
+// token or in the X-Admin-Token header
+func requestToken(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-Admin-Token")
+}
+
+// adminToken returns the configured token sent with a request, if any
+func (ms *MockServer) adminToken(r *http.Request) (AdminToken, bool) {
+	ms.mutex.RLock()
+	var tokens []AdminToken
+	if ms.config != nil {
+		tokens = ms.config.AdminTokens
+	}
+	ms.mutex.RUnlock()
+
+	sent := requestToken(r)
+	for _, token := range tokens {
+		if sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token.Token)) == 1 {
+			return token, true
+		}
+	}
+	return AdminToken{}, false
+}
+
+// authorizeAdmin checks the token of an admin API request. Without
+// configured tokens the admin API is open. It returns false if the request
+// was denied and the response has been written.
+func (ms *MockServer) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	ms.mutex.RLock()
+	open := ms.config == nil || len(ms.config.AdminTokens) == 0
+	ms.mutex.RUnlock()
+	if open {
+		return true
+	}
+
+	token, found := ms.adminToken(r)
+	status, message := 0, ""
+	switch {
+	case !found:
+		status, message = http.StatusUnauthorized, "Admin token required"
+		w.Header().Set("WWW-Authenticate", `Bearer realm="nmock admin"`)
+	case !roleAllows(token.Role, requiredRole(r)):
+		status, message = http.StatusForbidden, fmt.Sprintf("Role %s can't %s %s", token.Role, r.Method, r.URL.Path)
+	default:
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	return false
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxAuditEntries is the number of audit entries kept in memory; the audit
+// file keeps all of them
+const maxAuditEntries = 1000
+
+// maxAuditBody is the size up to which request bodies are stored in audit
+// entries
+const maxAuditBody = 16 << 10
+
+// AuditConfig configures the audit log of admin API changes
+type AuditConfig struct {
+	File string `json:"file"` // JSON lines file the entries are appended to
+}
+
+// auditEntry records a change made through the admin API
+type auditEntry struct {
+	Time     time.Time       `json:"time"`
+	Actor    string          `json:"actor"`
+	IP       string          `json:"ip"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Status   int             `json:"status"`
+	Body     json.RawMessage `json:"body,omitempty"`      // JSON request body describing the change
+	BodySize int             `json:"body_size,omitempty"` // size of other request bodies
+}
+
+// auditLog keeps the latest admin API changes and appends all of them to
+// an optional file
+type auditLog struct {
+	mutex   sync.Mutex
+	entries []auditEntry
+	file    *os.File
+}
+
+// newAuditLog creates an audit log kept in memory only
+func newAuditLog() *auditLog {
+	return &auditLog{}
+}
+
+// configure opens the audit file for appending. A nil config keeps entries
+// in memory only.
+func (a *auditLog) configure(config *AuditConfig) error {
+	var file *os.File
+	if config != nil && config.File != "" {
+		var err error
+		if file, err = os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return fmt.Errorf("failed to open audit file: %v", err)
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.file != nil {
+		a.file.Close()
+	}
+	a.file = file
+	return nil
+}
+
+// add records an entry
+func (a *auditLog) add(entry auditEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > maxAuditEntries {
+		a.entries = append(a.entries[:0], a.entries[len(a.entries)-maxAuditEntries:]...)
+	}
+
+	if a.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+// list returns the entries kept in memory, oldest first
+func (a *auditLog) list() []auditEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]auditEntry{}, a.entries...)
+}
+
+// adminActor identifies who made an admin API request: the name of its
+// admin token, the Basic auth user or the X-Admin-User header
+func (ms *MockServer) adminActor(r *http.Request) string {
+	if token, found := ms.adminToken(r); found {
+		return token.Name
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	if user := r.Header.Get("X-Admin-User"); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// statusWriter captures the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+// WriteHeader captures the status code
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	if sw.statusCode == 0 {
+		sw.statusCode = statusCode
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the implicit status code
+func (sw *statusWriter) Write(data []byte) (int, error) {
+	if sw.statusCode == 0 {
+		sw.statusCode = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(data)
+}
+
+// Flush passes flushes of streamed responses through
+func (sw *statusWriter) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// auditRequest serves an admin API request through next and records it in
+// the audit log if it may change something
+func (ms *MockServer) auditRequest(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if readsOnly(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sw := &statusWriter{ResponseWriter: w}
+	next.ServeHTTP(sw, r)
+	if sw.statusCode == 0 {
+		sw.statusCode = http.StatusOK
+	}
+
+	entry := auditEntry{
+		Time:   time.Now(),
+		Actor:  ms.adminActor(r),
+		IP:     clientIP(r),
+		Method: r.Method,
+		Path:   r.URL.RequestURI(),
+		Status: sw.statusCode,
+	}
+	if len(body) <= maxAuditBody && json.Valid(body) {
+		entry.Body = json.RawMessage(body)
+	} else {
+		entry.BodySize = len(body)
+	}
+	if err := ms.audit.add(entry); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// setupAuditAPI registers the audit log admin API
+func (ms *MockServer) setupAuditAPI() {
+	// Latest changes made through the admin API
+	ms.router.HandleFunc("/_admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ms.audit.list())
+	}).Methods("GET")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAuditLog tests recording admin API changes
+func TestAuditLog(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	if err := server.audit.configure(&AuditConfig{File: auditFile}); err != nil {
+		t.Fatalf("Failed to configure audit log: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string, headers map[string]string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.5:4321"
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	call("POST", "/_admin/endpoints", `{"path": "/api/new", "method": "GET", "response": "ok"}`, map[string]string{"X-Admin-User": "alice"})
+	call("GET", "/_admin/endpoints", "", nil)
+	call("POST", "/_admin/plugins/missing/toggle", "", map[string]string{"Authorization": "Basic Ym9iOnNlY3JldA=="})
+	call("POST", "/api/new", "", nil)
+
+	entries := server.audit.list()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Actor != "alice" || e.IP != "10.0.0.5" || e.Method != "POST" || e.Path != "/_admin/endpoints" || e.Status != 201 || !strings.Contains(string(e.Body), "/api/new") {
+		t.Errorf("Unexpected entry for the endpoint change: %+v", e)
+	}
+	if e := entries[1]; e.Actor != "bob" || e.Path != "/_admin/plugins/missing/toggle" || e.Status != 404 {
+		t.Errorf("Unexpected entry for the failed toggle: %+v", e)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/audit", nil))
+	var listed []auditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed) != 2 {
+		t.Errorf("Expected the audit API to list 2 entries, got %s", w.Body.String())
+	}
+
+	data, _ := os.ReadFile(auditFile)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"actor":"bob"`) {
+		t.Errorf("Expected 2 lines in the audit file, got %s", data)
+	}
+	server.audit.configure(nil)
+}
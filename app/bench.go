@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchTarget is a request sent by the load test
+type benchTarget struct {
+	method string
+	path   string
+}
+
+// benchResults collects the outcome of the requests of a load test
+type benchResults struct {
+	mutex     sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+	skipped   int // requests not sent because all workers were busy
+}
+
+// runBench implements the bench command and returns the exit code
+func runBench(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	target := flags.String("target", ":9000", "Address or URL of the server under test")
+	rps := flags.Int("rps", 100, "Requests per second")
+	duration := flags.Duration("duration", 10*time.Second, "Duration of the test")
+	concurrency := flags.Int("concurrency", 256, "Maximum number of requests in flight")
+	configPath := flags.String("config", "config.json", "Configuration file listing the endpoints to request")
+	token := adminTokenFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *rps <= 0 || *duration <= 0 || *concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "bench: --rps, --duration and --concurrency must be positive")
+		return 2
+	}
+
+	baseURL := benchURL(*target)
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency},
+	}
+
+	targets, err := benchTargets(*configPath, &replClient{baseURL: baseURL, token: *token, client: client, out: io.Discard})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+		return 2
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "bench: no endpoints to request")
+		return 2
+	}
+
+	fmt.Fprintf(stdout, "Sending %d requests/s to %d endpoints of %s for %s\n", *rps, len(targets), baseURL, *duration)
+	results := runLoad(client, baseURL, targets, *rps, *duration, *concurrency)
+	results.report(stdout, *duration)
+
+	if results.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// benchURL converts an address such as :9000 to a URL
+func benchURL(target string) string {
+	target = strings.TrimSuffix(target, "/")
+	if strings.HasPrefix(target, ":") {
+		return "http://localhost" + target
+	}
+	if !strings.Contains(target, "://") {
+		return "http://" + target
+	}
+	return target
+}
+
+// benchTargets lists the endpoints of the configuration, its enabled plugins
+// and the runtime endpoints of the server. Path variables are replaced by 1.
+func benchTargets(configPath string, rc *replClient) ([]benchTarget, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var config Config
+	if data, err = newSecretStore().resolve(data, ignoreSecret); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	endpoints := config.Endpoints
+
+	pluginsDir := config.PluginsDir
+	if pluginsDir == "" {
+		pluginsDir = "plugins"
+	}
+	matches, _ := filepath.Glob(filepath.Join(pluginsDir, "*.json"))
+	sort.Strings(matches)
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var plugin Plugin
+		data, _ = newSecretStore().resolve(data, ignoreSecret)
+		if json.Unmarshal(data, &plugin) == nil && plugin.Enabled {
+			endpoints = append(endpoints, plugin.allEndpoints()...)
+		}
+	}
+
+	var runtime []Endpoint
+	if err := rc.call("GET", "/_admin/endpoints", nil, &runtime); err != nil {
+		return nil, err
+	}
+	endpoints = append(endpoints, runtime...)
+
+	targets := make([]benchTarget, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		targets = append(targets, benchTarget{
+			method: strings.ToUpper(endpoint.Method),
+			path:   pathVariable.ReplaceAllString(endpoint.Path, "1"),
+		})
+	}
+	return targets, nil
+}
+
+// runLoad sends requests to the targets in turn at a fixed rate. Requests
+// are started on schedule regardless of how long earlier ones take; when
+// all workers are busy the request is skipped and counted.
+func runLoad(client *http.Client, baseURL string, targets []benchTarget, rps int, duration time.Duration, concurrency int) *benchResults {
+	results := &benchResults{statuses: make(map[int]int)}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// Start requests in batches, at most every millisecond
+	interval := time.Second / time.Duration(rps)
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	sent := 0
+	for now := start; now.Sub(start) < duration; now = <-ticker.C {
+		due := int(float64(rps) * now.Sub(start).Seconds())
+		for ; sent <= due && sent < int(float64(rps)*duration.Seconds()); sent++ {
+			select {
+			case slots <- struct{}{}:
+			default:
+				results.mutex.Lock()
+				results.skipped++
+				results.mutex.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func(target benchTarget) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				results.send(client, baseURL, target)
+			}(targets[sent%len(targets)])
+		}
+	}
+
+	wg.Wait()
+	return results
+}
+
+// send sends a single request and records its outcome
+func (br *benchResults) send(client *http.Client, baseURL string, target benchTarget) {
+	req, err := http.NewRequest(target.method, baseURL+target.path, nil)
+	if err != nil {
+		br.mutex.Lock()
+		br.errors++
+		br.mutex.Unlock()
+		return
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	latency := time.Since(start).Round(time.Microsecond)
+
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+	if err != nil {
+		br.errors++
+		return
+	}
+	br.latencies = append(br.latencies, latency)
+	br.statuses[resp.StatusCode]++
+}
+
+// report prints throughput, status codes and the latency distribution
+func (br *benchResults) report(out io.Writer, duration time.Duration) {
+	fmt.Fprintf(out, "Requests:    %d completed, %d errors, %d skipped\n", len(br.latencies), br.errors, br.skipped)
+	fmt.Fprintf(out, "Throughput:  %.1f requests/s\n", float64(len(br.latencies))/duration.Seconds())
+
+	statuses := make([]int, 0, len(br.statuses))
+	for status := range br.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	parts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		parts = append(parts, fmt.Sprintf("%d: %d", status, br.statuses[status]))
+	}
+	fmt.Fprintf(out, "Status:      %s\n", strings.Join(parts, ", "))
+
+	if len(br.latencies) == 0 {
+		return
+	}
+	sort.Slice(br.latencies, func(i, j int) bool { return br.latencies[i] < br.latencies[j] })
+	var total time.Duration
+	for _, latency := range br.latencies {
+		total += latency
+	}
+	percentile := func(p float64) time.Duration {
+		return br.latencies[int(p*float64(len(br.latencies)-1))]
+	}
+	fmt.Fprintf(out, "Latency:     min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		br.latencies[0], total/time.Duration(len(br.latencies)),
+		percentile(0.5), percentile(0.9), percentile(0.99), br.latencies[len(br.latencies)-1])
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBench tests a short load test against a running server
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	config := fmt.Sprintf(`{"plugins_dir": %q, "endpoints": [{"path": "/items/{id}", "method": "GET", "response": "item"}]}`, filepath.Join(dir, "plugins"))
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.runtimeEndpoints = []Endpoint{{Path: "/created", Method: "POST", StatusCode: 201}}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	code := runBench([]string{"--target", ts.URL, "--rps", "200", "--duration", "250ms", "--config", configPath}, &out)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d:\n%s", code, out.String())
+	}
+
+	for _, expected := range []string{"to 2 endpoints", "Requests:    50 completed, 0 errors", "200: 25, 201: 25", "p99"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q:\n%s", expected, out.String())
+		}
+	}
+
+	if url := benchURL(":9000"); url != "http://localhost:9000" {
+		t.Errorf("Expected http://localhost:9000, got %s", url)
+	}
+}
+
+// benchmarkServer creates a server with many endpoints using a router backend
+func benchmarkServer(router string, count int) *MockServer {
+	endpoints := make([]Endpoint, 0, count)
+	for i := 0; i < count; i++ {
+		endpoints = append(endpoints, Endpoint{
+			Path:     fmt.Sprintf("/api/resource%d/{id}", i),
+			Method:   "GET",
+			Response: map[string]interface{}{"id": i, "name": "resource", "tags": []string{"a", "b"}},
+		})
+	}
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins", Router: router, Endpoints: endpoints}
+	server.SetupRoutes()
+	return server
+}
+
+// BenchmarkRouting measures matching a request among many endpoints
+func BenchmarkRouting(b *testing.B) {
+	for _, router := range []string{routerMux, routerRadix} {
+		b.Run(router, func(b *testing.B) {
+			server := benchmarkServer(router, 5000)
+			req := httptest.NewRequest("GET", "/api/resource4999/1", nil)
+			snapshot := server.routes.snapshot.Load()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if handler, _, _ := snapshot.lookup(req); handler == nil {
+					b.Fatal("Expected a route to match")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSetupRoutes measures building the routes of many endpoints
+func BenchmarkSetupRoutes(b *testing.B) {
+	server := benchmarkServer(routerRadix, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.SetupRoutes()
+	}
+}
+
+// BenchmarkServeStatic measures serving and recording a static JSON response
+func BenchmarkServeStatic(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	server := benchmarkServer(routerMux, 10)
+	server.config.Endpoints[0].Method = "POST"
+	server.config.Endpoints[0].Headers = map[string]string{"x-request-source": "mock"}
+	server.SetupRoutes()
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		server.ServeHTTP(w, httptest.NewRequest("POST", "/api/resource0/1", strings.NewReader(`{"name": "resource"}`)))
+	}
+}
+
+// discardWriter is a response writer that drops the response
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header            { return w.header }
+func (w *discardWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (w *discardWriter) WriteHeader(statusCode int)     {}
+
+// BenchmarkEncodeResponse measures encoding a JSON response
+func BenchmarkEncodeResponse(b *testing.B) {
+	response := map[string]interface{}{"id": 1, "name": "resource", "tags": []string{"a", "b"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeResponse(response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker
+const (
+	CircuitClosed   = "closed"    // requests are served
+	CircuitOpen     = "open"      // requests are rejected until the cooldown ends
+	CircuitHalfOpen = "half-open" // the next request decides whether the circuit closes
+)
+
+// CircuitBreakerConfig makes an endpoint reject requests for a while after
+// it served several failures, like an upstream protected by a breaker
+type CircuitBreakerConfig struct {
+	Failures   int         `json:"failures,omitempty"`    // consecutive responses with status 5xx that open the circuit (default: 5)
+	Cooldown   int         `json:"cooldown,omitempty"`    // milliseconds the circuit stays open (default: 30000)
+	StatusCode int         `json:"status_code,omitempty"` // status while open (default: 503)
+	Response   interface{} `json:"response,omitempty"`    // body while open (default: an error object)
+}
+
+// validateCircuitBreaker checks the circuit breaker of an endpoint
+func validateCircuitBreaker(config *CircuitBreakerConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Failures < 0 || config.Cooldown < 0 {
+		return fmt.Errorf("failures and cooldown must not be negative")
+	}
+	return validateStatusCode(config.StatusCode)
+}
+
+// circuitBreaker counts the failures of an endpoint and rejects requests
+// while open
+type circuitBreaker struct {
+	config     CircuitBreakerConfig
+	failures   int
+	cooldown   time.Duration
+	statusCode int
+	body       []byte
+	now        func() time.Time
+
+	mutex    sync.Mutex
+	state    string
+	count    int       // consecutive failures
+	openedAt time.Time // when the circuit last opened
+	trial    bool      // a half-open trial request is being served
+	rejected int64
+	opened   int64
+}
+
+// newCircuitBreaker creates a closed breaker from a validated configuration
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	cb := &circuitBreaker{
+		config:     config,
+		failures:   config.Failures,
+		cooldown:   time.Duration(config.Cooldown) * time.Millisecond,
+		statusCode: config.StatusCode,
+		state:      CircuitClosed,
+		now:        time.Now,
+	}
+	if cb.failures == 0 {
+		cb.failures = 5
+	}
+	if config.Cooldown == 0 {
+		cb.cooldown = 30 * time.Second
+	}
+	if cb.statusCode == 0 {
+		cb.statusCode = http.StatusServiceUnavailable
+	}
+	response := config.Response
+	if response == nil {
+		response = map[string]string{"error": "Circuit open"}
+	}
+	cb.body, _ = encodeResponse(response)
+	return cb
+}
+
+// allow reports whether a request is served. After the cooldown, a single
+// trial request is let through while the circuit is half-open.
+func (cb *circuitBreaker) allow() (bool, time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == CircuitOpen {
+		remaining := cb.openedAt.Add(cb.cooldown).Sub(cb.now())
+		if remaining > 0 {
+			cb.rejected++
+			return false, remaining
+		}
+		cb.state = CircuitHalfOpen
+	}
+	if cb.state == CircuitHalfOpen {
+		if cb.trial {
+			cb.rejected++
+			return false, 0
+		}
+		cb.trial = true
+	}
+	return true, 0
+}
+
+// record counts the status of a served response. A failed trial opens the
+// circuit again and a successful one closes it.
+func (cb *circuitBreaker) record(statusCode int) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	failed := statusCode >= 500
+	if cb.state == CircuitHalfOpen {
+		cb.trial = false
+		if failed {
+			cb.open()
+		} else {
+			cb.state = CircuitClosed
+			cb.count = 0
+		}
+		return
+	}
+	if !failed {
+		cb.count = 0
+		return
+	}
+	if cb.count++; cb.count >= cb.failures && cb.state == CircuitClosed {
+		cb.open()
+	}
+}
+
+// open opens the circuit. The caller must hold the mutex.
+func (cb *circuitBreaker) open() {
+	cb.state = CircuitOpen
+	cb.openedAt = cb.now()
+	cb.count = 0
+	cb.opened++
+}
+
+// reset closes the circuit
+func (cb *circuitBreaker) reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.state = CircuitClosed
+	cb.count = 0
+	cb.trial = false
+}
+
+// writeOpen answers a rejected request. Retry-After tells clients when the
+// cooldown ends.
+func (cb *circuitBreaker) writeOpen(w http.ResponseWriter, remaining time.Duration) {
+	if len(w.Header()["Content-Type"]) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(cb.statusCode)
+	w.Write(cb.body)
+}
+
+// snapshot returns the state of the breaker for the admin API
+func (cb *circuitBreaker) snapshot() map[string]interface{} {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	snapshot := map[string]interface{}{
+		"state":    cb.state,
+		"failures": cb.count,
+		"opened":   cb.opened,
+		"rejected": cb.rejected,
+	}
+	if cb.state == CircuitOpen {
+		snapshot["closes_at"] = cb.openedAt.Add(cb.cooldown)
+	}
+	return snapshot
+}
+
+// circuitBreakerFor returns the breaker of a route. An unchanged breaker
+// keeps its state when routes are set up again, e.g. on reload.
+func (ms *MockServer) circuitBreakerFor(routeKey string, config CircuitBreakerConfig) *circuitBreaker {
+	if existing, ok := ms.breakers[routeKey]; ok && reflect.DeepEqual(existing.config, config) {
+		return existing
+	}
+	cb := newCircuitBreaker(config)
+	ms.breakers[routeKey] = cb
+	return cb
+}
+
+// pruneBreakers drops the breakers of endpoints that were removed or no
+// longer have a circuit breaker. Must be called with ms.mutex held.
+func (ms *MockServer) pruneBreakers() {
+	protected := ms.routeKeys(func(ep *Endpoint) bool { return ep.CircuitBreaker != nil })
+	for routeKey := range ms.breakers {
+		if !protected[routeKey] {
+			delete(ms.breakers, routeKey)
+		}
+	}
+}
+
+// setupCircuitBreakerAPI registers the admin API of circuit breakers
+func (ms *MockServer) setupCircuitBreakerAPI() {
+	// Show the state of every circuit breaker
+	ms.router.HandleFunc("/_admin/breakers", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		result := make(map[string]interface{}, len(ms.breakers))
+		for routeKey, cb := range ms.breakers {
+			result[routeKey] = cb.snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Close circuits, all of them or the one of a route
+	ms.router.HandleFunc("/_admin/breakers", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if route := r.URL.Query().Get("route"); route != "" {
+			cb, ok := ms.breakers[route]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("No circuit breaker for %s", route)})
+				return
+			}
+			cb.reset()
+		} else {
+			for _, cb := range ms.breakers {
+				cb.reset()
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Circuit breakers closed"})
+	}).Methods("DELETE")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker tests opening an endpoint's circuit after failures and
+// recovering after the cooldown
+func TestCircuitBreaker(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/payments", Method: "POST", CircuitBreaker: &CircuitBreakerConfig{Failures: 3, Cooldown: 10000}, Responses: []MappedResponse{
+				{StatusCode: 500, Response: "boom"},
+				{StatusCode: 502, Response: "boom"},
+				{StatusCode: 504, Response: "boom"},
+				{StatusCode: 500, Response: "still failing"},
+				{StatusCode: 200, Response: "ok"},
+			}},
+		},
+	}
+	server.SetupRoutes()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	breaker := server.breakers["POST /payments"]
+	breaker.now = func() time.Time { return now }
+
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("POST", "/payments", nil))
+		return w
+	}
+
+	for i, status := range []int{500, 502, 504} {
+		if w := call(); w.Code != status {
+			t.Errorf("Call %d: expected the served failure %d, got %d", i+1, status, w.Code)
+		}
+	}
+
+	// The circuit is open: requests are rejected without being served
+	w := call()
+	if w.Code != 503 || w.Header().Get("Retry-After") != "10" || w.Body.String() != `{"error":"Circuit open"}`+"\n" {
+		t.Errorf("Expected the circuit to be open, got %d %s %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	now = now.Add(4 * time.Second)
+	if w := call(); w.Code != 503 || w.Header().Get("Retry-After") != "6" {
+		t.Errorf("Expected 6 seconds of cooldown left, got %d %s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// A failed trial after the cooldown opens the circuit again
+	now = now.Add(6 * time.Second)
+	if w := call(); w.Code != 500 || w.Body.String() != "still failing" {
+		t.Errorf("Expected the trial request to be served, got %d %s", w.Code, w.Body.String())
+	}
+	if w := call(); w.Code != 503 {
+		t.Errorf("Expected the circuit to open again after a failed trial, got %d", w.Code)
+	}
+
+	// A successful trial closes it
+	now = now.Add(10 * time.Second)
+	if w := call(); w.Code != 200 {
+		t.Errorf("Expected the trial request to succeed, got %d", w.Code)
+	}
+	if w := call(); w.Code != 200 {
+		t.Errorf("Expected the circuit to be closed, got %d", w.Code)
+	}
+	if snapshot := breaker.snapshot(); snapshot["state"] != CircuitClosed || snapshot["opened"] != int64(2) || snapshot["rejected"] != int64(3) {
+		t.Errorf("Unexpected breaker state %v", snapshot)
+	}
+
+	// The admin API closes open circuits
+	breaker.mutex.Lock()
+	breaker.open()
+	breaker.mutex.Unlock()
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/_admin/breakers?route=POST%20/payments", nil))
+	if w.Code != 200 || breaker.snapshot()["state"] != CircuitClosed {
+		t.Errorf("Expected the circuit to be closed by the admin API, got %d %v", w.Code, breaker.snapshot())
+	}
+
+	// Renaming the endpoint drops its breaker
+	server.config.Endpoints[0].Path = "/payments/v2"
+	server.SetupRoutes()
+	if _, ok := server.breakers["POST /payments"]; ok || len(server.breakers) != 1 {
+		t.Errorf("Expected only the breaker of the renamed endpoint, got %v", server.breakers)
+	}
+}
+
+// TestCircuitBreakerHalfOpen tests letting a single trial request through
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreakerConfig{Failures: 1})
+	now := time.Now()
+	cb.now = func() time.Time { return now }
+
+	cb.record(500)
+	if allowed, remaining := cb.allow(); allowed || remaining != 30*time.Second {
+		t.Errorf("Expected the default cooldown of 30s, got %v %v", allowed, remaining)
+	}
+	now = now.Add(30 * time.Second)
+	if allowed, _ := cb.allow(); !allowed {
+		t.Error("Expected a trial request after the cooldown")
+	}
+	if allowed, _ := cb.allow(); allowed {
+		t.Error("Expected other requests to be rejected during the trial")
+	}
+	cb.record(200)
+	if allowed, _ := cb.allow(); !allowed {
+		t.Error("Expected the circuit to close after a successful trial")
+	}
+
+	if validateCircuitBreaker(&CircuitBreakerConfig{Failures: -1}) == nil || validateCircuitBreaker(&CircuitBreakerConfig{StatusCode: 42}) == nil {
+		t.Error("Expected invalid breakers to be rejected")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bulkResult is the outcome of one item of a bulk request
+type bulkResult struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	ID     interface{}  `json:"id,omitempty"`
+	Item   resourceItem `json:"item,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// readBulk reads the body of a request to a collection. It reports whether
+// the body is an array, and restores the body for a single item otherwise.
+func readBulk(r *http.Request) ([]json.RawMessage, bool, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return nil, false, nil
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, true, fmt.Errorf("invalid JSON array: %v", err)
+	}
+	return entries, true, nil
+}
+
+// decodeBulkItem decodes an entry of a bulk request as an item
+func decodeBulkItem(entry json.RawMessage) (resourceItem, error) {
+	var item resourceItem
+	if err := json.Unmarshal(entry, &item); err != nil || item == nil {
+		return nil, fmt.Errorf("invalid JSON object")
+	}
+	return item, nil
+}
+
+// serveBulk applies an operation to every entry of a bulk request and
+// writes the results: 200 if all succeeded and 207 otherwise. Entries are
+// applied in order and independently, so a failed entry doesn't undo the
+// others. It must be called with the store mutex held.
+func (c *collection) serveBulk(w http.ResponseWriter, entries []json.RawMessage, apply func(entry json.RawMessage) bulkResult) int {
+	if c.config.BulkLimit > 0 && len(entries) > c.config.BulkLimit {
+		c.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Bulk requests are limited to %d items", c.config.BulkLimit))
+		return http.StatusRequestEntityTooLarge
+	}
+
+	results := make([]bulkResult, 0, len(entries))
+	failed := 0
+	for i, entry := range entries {
+		result := apply(entry)
+		result.Index = i
+		if result.Status >= 300 {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeResourceJSON(w, status, map[string]interface{}{
+		"results":   results,
+		"succeeded": len(entries) - failed,
+		"failed":    failed,
+	})
+	return status
+}
+
+// bulkCreate creates the items of a bulk request. It must be called with
+// the store mutex held.
+func (rs *resourceStore) bulkCreate(w http.ResponseWriter, c *collection, entries []json.RawMessage) int {
+	return c.serveBulk(w, entries, func(entry json.RawMessage) bulkResult {
+		item, err := decodeBulkItem(entry)
+		if err != nil {
+			return bulkResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		id := item[c.config.idField()]
+		if !rs.hasParent(c, item) {
+			return bulkResult{Status: http.StatusUnprocessableEntity, ID: id, Error: "Parent item not found"}
+		}
+		if !c.insert(item) {
+			return bulkResult{Status: http.StatusConflict, ID: id, Error: "Item already exists"}
+		}
+		return bulkResult{Status: http.StatusCreated, ID: item[c.config.idField()], Item: item}
+	})
+}
+
+// bulkUpdate replaces or merges the items of a bulk request, which are
+// identified by their id field. It must be called with the store mutex
+// held.
+func (rs *resourceStore) bulkUpdate(w http.ResponseWriter, c *collection, entries []json.RawMessage, merge bool) int {
+	return c.serveBulk(w, entries, func(entry json.RawMessage) bulkResult {
+		changes, err := decodeBulkItem(entry)
+		if err != nil {
+			return bulkResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		id := changes[c.config.idField()]
+		if itemID(id) == "" {
+			return bulkResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("Field %s is required", c.config.idField())}
+		}
+		i := c.findVisible(itemID(id), false)
+		if i < 0 {
+			return bulkResult{Status: http.StatusNotFound, ID: id, Error: "Item not found"}
+		}
+		item, ok := rs.update(c, i, changes, merge)
+		if !ok {
+			return bulkResult{Status: http.StatusUnprocessableEntity, ID: id, Error: "Parent item not found"}
+		}
+		return bulkResult{Status: http.StatusOK, ID: id, Item: item}
+	})
+}
+
+// bulkDelete deletes the items of a bulk request, given as ids or as
+// objects with an id field. It must be called with the store mutex held.
+func (rs *resourceStore) bulkDelete(w http.ResponseWriter, c *collection, entries []json.RawMessage, permanent bool) int {
+	return c.serveBulk(w, entries, func(entry json.RawMessage) bulkResult {
+		var id interface{}
+		if err := json.Unmarshal(entry, &id); err != nil {
+			return bulkResult{Status: http.StatusBadRequest, Error: "invalid JSON value"}
+		}
+		if object, ok := id.(map[string]interface{}); ok {
+			id = object[c.config.idField()]
+		}
+		if _, nested := id.([]interface{}); nested || itemID(id) == "" {
+			return bulkResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("Expected an id or an object with field %s", c.config.idField())}
+		}
+		i := c.findVisible(itemID(id), permanent)
+		if i < 0 {
+			return bulkResult{Status: http.StatusNotFound, ID: id, Error: "Item not found"}
+		}
+		if c.config.SoftDelete && !permanent {
+			c.softDelete(i)
+		} else {
+			rs.remove(c, i)
+		}
+		return bulkResult{Status: http.StatusNoContent, ID: id}
+	})
+}
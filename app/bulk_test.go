@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResourceBulk tests creating, updating and deleting several items at once
+func TestResourceBulk(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	err := server.resources.configure([]Resource{
+		{Name: "users", Path: "/api/users", Bulk: true, BulkLimit: 3, Seed: []map[string]interface{}{{"id": float64(1), "name": "Alice"}}},
+		{Name: "orders", Path: "/api/orders", Bulk: true, SoftDelete: true, Parent: &ResourceParent{Resource: "users", Field: "user_id"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	type response struct {
+		Results   []bulkResult `json:"results"`
+		Succeeded int          `json:"succeeded"`
+		Failed    int          `json:"failed"`
+	}
+	call := func(method, path, body string) (int, response, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var result response
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result, strings.TrimSpace(w.Body.String())
+	}
+	statuses := func(result response) []int {
+		var codes []int
+		for _, item := range result.Results {
+			codes = append(codes, item.Status)
+		}
+		return codes
+	}
+
+	code, result, _ := call("POST", "/api/users", `[{"name": "Bob"}, {"id": 1, "name": "Again"}, "x"]`)
+	if code != 207 || result.Succeeded != 1 || result.Failed != 2 || !equalInts(statuses(result), []int{201, 409, 400}) {
+		t.Fatalf("Expected per-item results, got %d %+v", code, result)
+	}
+	if item := result.Results[0]; item.ID != float64(2) || item.Item["name"] != "Bob" || result.Results[1].Error != "Item already exists" {
+		t.Errorf("Unexpected results %+v", result.Results)
+	}
+	if code, _, body := call("POST", "/api/users", `{"name": "Carol"}`); code != 201 || body != `{"id":3,"name":"Carol"}` {
+		t.Errorf("Expected a single item to be created as before, got %d %s", code, body)
+	}
+	if code, _, _ := call("POST", "/api/users", `[{}, {}, {}, {}]`); code != 413 {
+		t.Errorf("Expected the bulk limit to apply, got %d", code)
+	}
+
+	code, result, _ = call("PATCH", "/api/users", `[{"id": 1, "role": "admin"}, {"id": 9, "role": "admin"}, {"role": "admin"}]`)
+	if code != 207 || !equalInts(statuses(result), []int{200, 404, 400}) || result.Results[0].Item["name"] != "Alice" {
+		t.Errorf("Unexpected bulk patch %d %+v", code, result)
+	}
+	code, result, _ = call("PUT", "/api/users", `[{"id": 2, "name": "Robert"}, {"id": 3, "name": "Caroline"}]`)
+	if code != 200 || result.Succeeded != 2 {
+		t.Errorf("Expected all replacements to succeed, got %d %+v", code, result)
+	}
+	if code, _, body := call("GET", "/api/users/2", ""); code != 200 || body != `{"id":2,"name":"Robert"}` {
+		t.Errorf("Expected the item to be replaced, got %s", body)
+	}
+
+	// Children check their parents, and deletion follows soft_delete
+	code, result, _ = call("POST", "/api/orders", `[{"user_id": 1}, {"user_id": 2}, {"user_id": 7}]`)
+	if code != 207 || !equalInts(statuses(result), []int{201, 201, 422}) {
+		t.Errorf("Unexpected bulk create of children %d %+v", code, result)
+	}
+	code, result, _ = call("DELETE", "/api/orders", `[1, {"id": 2}, 5]`)
+	if code != 207 || !equalInts(statuses(result), []int{204, 204, 404}) {
+		t.Errorf("Unexpected bulk delete %d %+v", code, result)
+	}
+	if _, _, body := call("GET", "/api/orders?include_deleted=true", ""); strings.Count(body, "deleted_at") != 2 {
+		t.Errorf("Expected the orders to be soft-deleted, got %s", body)
+	}
+	if code, result, _ := call("DELETE", "/api/orders?permanent=true", `[1, 2]`); code != 200 || result.Succeeded != 2 {
+		t.Errorf("Expected the orders to be removed, got %d %+v", code, result)
+	}
+	if code, _, _ := call("DELETE", "/api/users", `{"id": 1}`); code != 400 {
+		t.Errorf("Expected a bulk delete without array to be rejected, got %d", code)
+	}
+
+	if validateResources([]Resource{{Name: "a", Path: "/a", Bulk: true, Format: "jsonapi"}}) == nil {
+		t.Error("Expected bulk JSON:API resources to be rejected")
+	}
+}
+
+// equalInts reports whether two lists of numbers are equal
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBundleSize is the largest configuration bundle accepted by the import
+const maxBundleSize = 100 << 20
+
+// Layout of a configuration bundle:
+//
+//	config.json        main configuration file
+//	plugins/<name>     plugin files
+//	files/<path>       files referenced by the configuration, e.g. GraphQL schemas
+const (
+	bundleConfig     = "config.json"
+	bundlePluginsDir = "plugins/"
+	bundleFilesDir   = "files/"
+)
+
+// bundleFiles returns the files referenced by the configuration and plugins.
+// Must be called with ms.mutex held.
+func (ms *MockServer) bundleFiles() []string {
+	seen := make(map[string]bool)
+	var files []string
+
+	addEndpoints := func(endpoints []Endpoint) {
+		for _, endpoint := range endpoints {
+			if endpoint.GraphQL != nil && endpoint.GraphQL.Schema != "" && !seen[endpoint.GraphQL.Schema] {
+				seen[endpoint.GraphQL.Schema] = true
+				files = append(files, endpoint.GraphQL.Schema)
+			}
+			if templatedFile(endpoint.ResponseFile) {
+				// Bundle the files a path with variables can resolve to
+				matches, _ := filepath.Glob(responseFileGlob(endpoint.ResponseFile))
+				for _, match := range matches {
+					if !seen[match] {
+						seen[match] = true
+						files = append(files, match)
+					}
+				}
+			} else if endpoint.ResponseFile != "" && !seen[endpoint.ResponseFile] {
+				seen[endpoint.ResponseFile] = true
+				files = append(files, endpoint.ResponseFile)
+			}
+			if endpoint.Dataset != nil && endpoint.Dataset.File != "" && !seen[endpoint.Dataset.File] {
+				seen[endpoint.Dataset.File] = true
+				files = append(files, endpoint.Dataset.File)
+			}
+			if endpoint.Search != nil && endpoint.Search.File != "" && !seen[endpoint.Search.File] {
+				seen[endpoint.Search.File] = true
+				files = append(files, endpoint.Search.File)
+			}
+		}
+	}
+
+	addEndpoints(ms.config.Endpoints)
+	for _, plugin := range ms.plugins {
+		addEndpoints(plugin.allEndpoints())
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// bundlePath converts a referenced file path to its name inside a bundle.
+// Only relative paths inside the working directory can be bundled.
+func bundlePath(file string) (string, bool) {
+	clean := filepath.ToSlash(filepath.Clean(file))
+	if filepath.IsAbs(file) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return bundleFilesDir + clean, true
+}
+
+// writeBundle writes the configuration, plugins and referenced files as a zip archive
+func (ms *MockServer) writeBundle(w io.Writer) error {
+	ms.mutex.RLock()
+	configPath := ms.configPath
+	pluginsDir := ms.pluginsDir
+	files := ms.bundleFiles()
+	ms.mutex.RUnlock()
+
+	archive := zip.NewWriter(w)
+	addFile := func(name, source string) error {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", source, err)
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	}
+
+	if err := addFile(bundleConfig, configPath); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(pluginsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read plugins directory: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			if err := addFile(bundlePluginsDir+entry.Name(), filepath.Join(pluginsDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range files {
+		name, ok := bundlePath(file)
+		if !ok {
+			log.Printf("Skipping %s in bundle export: only relative paths can be bundled", file)
+			continue
+		}
+		if err := addFile(name, file); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// importBundle validates a bundle, writes its contents in place of the
+// current configuration and reloads. Nothing is written if any part of the
+// bundle is invalid, and file watcher reloads are paused while writing so
+// that a half-written setup is never served.
+func (ms *MockServer) importBundle(data []byte) (int, int, error) {
+	if ms.readOnly {
+		return 0, 0, errReadOnly
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid bundle: %v", err)
+	}
+
+	var configData []byte
+	plugins := make(map[string][]byte)
+	files := make(map[string][]byte)
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		reader, err := entry.Open()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read %s: %v", entry.Name, err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read %s: %v", entry.Name, err)
+		}
+
+		name := path.Clean(entry.Name)
+		switch {
+		case name == bundleConfig:
+			if errs := validateJSON(content, reflect.TypeOf(Config{})); len(errs) > 0 {
+				return 0, 0, schemaErrors(name, errs)
+			}
+			configData = content
+		case strings.HasPrefix(name, bundlePluginsDir) && path.Dir(name) == "plugins" && strings.HasSuffix(name, ".json"):
+			if errs := validateJSON(content, reflect.TypeOf(Plugin{})); len(errs) > 0 {
+				return 0, 0, schemaErrors(name, errs)
+			}
+			plugins[path.Base(name)] = content
+		case strings.HasPrefix(name, bundleFilesDir):
+			target := strings.TrimPrefix(name, bundleFilesDir)
+			if path.IsAbs(target) || target == ".." || strings.HasPrefix(target, "../") {
+				return 0, 0, fmt.Errorf("invalid file path in bundle: %s", entry.Name)
+			}
+			files[filepath.FromSlash(target)] = content
+		default:
+			return 0, 0, fmt.Errorf("unexpected entry in bundle: %s", entry.Name)
+		}
+	}
+
+	if configData == nil {
+		return 0, 0, fmt.Errorf("invalid bundle: %s is missing", bundleConfig)
+	}
+
+	var config Config
+	json.Unmarshal(configData, &config)
+	pluginsDir := config.PluginsDir
+	if pluginsDir == "" {
+		pluginsDir = "plugins"
+	}
+
+	ms.reloadPaused.Store(true)
+	defer ms.reloadPaused.Store(false)
+
+	if err := writeFileAtomic(ms.configPath, configData); err != nil {
+		return 0, 0, err
+	}
+
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create plugins directory: %v", err)
+	}
+	existing, _ := os.ReadDir(pluginsDir)
+	for _, entry := range existing {
+		if _, ok := plugins[entry.Name()]; !ok && !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			os.Remove(filepath.Join(pluginsDir, entry.Name()))
+		}
+	}
+	for name, content := range plugins {
+		if err := writeFileAtomic(filepath.Join(pluginsDir, name), content); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return 0, 0, fmt.Errorf("failed to create directory for %s: %v", name, err)
+		}
+		if err := writeFileAtomic(name, content); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := ms.LoadConfig(); err != nil {
+		return 0, 0, err
+	}
+	if err := ms.LoadPlugins(); err != nil {
+		return 0, 0, err
+	}
+	ms.SetupRoutes()
+	ms.reloadListener()
+
+	return len(plugins), len(files), nil
+}
+
+// writeFileAtomic replaces a file by writing a temporary file and renaming it
+func writeFileAtomic(name string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(name), ".nmock-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if err := os.Rename(temp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// setupBundleAPI registers the configuration bundle export and import
+func (ms *MockServer) setupBundleAPI() {
+	// Export the whole setup as a zip archive
+	ms.router.HandleFunc("/_admin/export", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := ms.writeBundle(&buf); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="nmock-bundle.zip"`)
+		w.Write(buf.Bytes())
+	}).Methods("GET")
+
+	// Restore a setup from a zip archive
+	ms.router.HandleFunc("/_admin/import", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBundleSize+1))
+		if err == nil && len(data) > maxBundleSize {
+			err = fmt.Errorf("bundle exceeds %d bytes", maxBundleSize)
+		}
+
+		var plugins, files int
+		if err == nil {
+			plugins, files, err = ms.importBundle(data)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Bundle imported successfully",
+			"plugins": plugins,
+			"files":   files,
+		})
+		log.Printf("Bundle imported via admin API (%d plugins, %d files)", plugins, files)
+	}).Methods("POST")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestBundleExportImport tests exporting a setup and restoring it
+func TestBundleExportImport(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	os.MkdirAll("plugins", 0755)
+	os.WriteFile("config.json", []byte(`{"port": "9000", "endpoints": [{"path": "/api/a", "method": "GET", "response": "a"},
+		{"path": "/api/products", "method": "GET", "search": {"file": "products.csv"}}]}`), 0644)
+	os.WriteFile("plugins/p.json", []byte(`{"name": "p", "enabled": true, "endpoints": [{"path": "/graphql", "method": "POST", "graphql": {"schema": "schema.graphql"}}]}`), 0644)
+	os.WriteFile("schema.graphql", []byte(`type Query { hello: String }`), 0644)
+	os.WriteFile("products.csv", []byte("id,name\n1,Red shoe\n"), 0644)
+
+	server := NewMockServer("config.json")
+	server.LoadConfig()
+	server.LoadPlugins()
+	server.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/export", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected zip export, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	bundle := w.Body.Bytes()
+
+	archive, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	if len(names) != 4 || names[0] != "config.json" || names[1] != "plugins/p.json" || names[2] != "files/products.csv" || names[3] != "files/schema.graphql" {
+		t.Errorf("Unexpected bundle contents: %v", names)
+	}
+
+	// Change the setup, then restore it from the bundle
+	os.Remove("schema.graphql")
+	os.Remove("products.csv")
+	os.WriteFile("plugins/extra.json", []byte(`{"name": "extra", "enabled": true, "endpoints": []}`), 0644)
+	os.WriteFile("config.json", []byte(`{"port": "9000", "endpoints": []}`), 0644)
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/_admin/import", bytes.NewReader(bundle)))
+	if w.Code != 200 {
+		t.Fatalf("Expected import to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/api/a", nil))
+	if w.Code != 200 || w.Body.String() != "a" {
+		t.Errorf("Expected restored endpoint, got %d %q", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat("plugins/extra.json"); !os.IsNotExist(err) {
+		t.Error("Expected plugins missing from the bundle to be removed")
+	}
+	if data, err := os.ReadFile("schema.graphql"); err != nil || string(data) != `type Query { hello: String }` {
+		t.Errorf("Expected referenced file to be restored, got %q (%v)", data, err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/api/products?q=shoe", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Red shoe") {
+		t.Errorf("Expected the search file to be restored, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Invalid bundles are rejected without touching the setup
+	var buf bytes.Buffer
+	invalid := zip.NewWriter(&buf)
+	entry, _ := invalid.Create("config.json")
+	entry.Write([]byte(`{"endpoints": []}`))
+	entry, _ = invalid.Create("plugins/broken.json")
+	entry.Write([]byte(`{not json`))
+	invalid.Close()
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/_admin/import", &buf))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid bundle, got %d", w.Code)
+	}
+	if _, err := os.Stat("plugins/p.json"); err != nil {
+		t.Error("Expected existing plugins to be kept after a failed import")
+	}
+}
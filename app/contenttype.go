@@ -0,0 +1,29 @@
+package main
+
+import "strings"
+
+// defaultContentType is used when neither the endpoint nor the server
+// configuration specifies a content type
+const defaultContentType = "application/json"
+
+// serverContentType returns the server-wide default content type
+func (ms *MockServer) serverContentType() string {
+	if ms.config != nil && ms.config.DefaultContentType != "" {
+		return ms.config.DefaultContentType
+	}
+	return defaultContentType
+}
+
+// contentTypeFor returns the Content-Type of an endpoint response. The value
+// is used verbatim; a charset parameter is only added when configured and not
+// already present.
+func (ms *MockServer) contentTypeFor(ep Endpoint) string {
+	contentType := ep.ContentType
+	if contentType == "" {
+		contentType = ms.serverContentType()
+	}
+	if ep.Charset != "" && !strings.Contains(strings.ToLower(contentType), "charset=") {
+		contentType += "; charset=" + ep.Charset
+	}
+	return contentType
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestContentType tests content type selection for endpoint responses
+func TestContentType(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:               "9000",
+		PluginsDir:         "plugins",
+		DefaultContentType: "text/plain",
+		Endpoints: []Endpoint{
+			{Path: "/default", Method: "GET", Response: "plain"},
+			{Path: "/vendor", Method: "GET", ContentType: "application/vnd.api+json", Response: map[string]string{}},
+			{Path: "/charset", Method: "GET", ContentType: "text/csv", Charset: "shift_jis", Response: "a,b"},
+			{Path: "/header", Method: "GET", Headers: map[string]string{"Content-Type": "application/xml"}, Charset: "utf-8", Response: "<a/>"},
+		},
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/default", expected: "text/plain"},
+		{path: "/vendor", expected: "application/vnd.api+json"},
+		{path: "/charset", expected: "text/csv; charset=shift_jis"},
+		{path: "/header", expected: "application/xml"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if contentType := w.Header().Get("Content-Type"); contentType != test.expected {
+			t.Errorf("Expected Content-Type '%s' for %s, got '%s'", test.expected, test.path, contentType)
+		}
+	}
+}
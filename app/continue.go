@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Modes of answering "Expect: 100-continue"
+const (
+	ContinueSend   = "send"   // send 100 Continue and receive the body before responding
+	ContinueSkip   = "skip"   // respond without asking for the body
+	ContinueReject = "reject" // respond with an error without asking for the body
+)
+
+// ContinueConfig controls how an endpoint answers requests whose body is
+// announced with "Expect: 100-continue"
+type ContinueConfig struct {
+	Mode       string `json:"mode,omitempty"`        // "send" (default), "skip" or "reject"
+	Delay      int    `json:"delay,omitempty"`       // delay before 100 Continue in milliseconds
+	StatusCode int    `json:"status_code,omitempty"` // status of rejected requests (default: 417)
+}
+
+// validateContinue checks the continue setting of an endpoint
+func validateContinue(config *ContinueConfig) error {
+	if config == nil {
+		return nil
+	}
+	switch config.Mode {
+	case "", ContinueSend, ContinueSkip, ContinueReject:
+		return nil
+	}
+	return fmt.Errorf("unknown continue mode %q, expected %q, %q or %q", config.Mode, ContinueSend, ContinueSkip, ContinueReject)
+}
+
+// expectsContinue reports whether a client waits for 100 Continue before
+// sending the request body
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue") && r.ProtoAtLeast(1, 1)
+}
+
+// continueBody is a request body that is read only when a handler asks for
+// it, recording what is read. net/http sends 100 Continue on the first read.
+type continueBody struct {
+	io.ReadCloser
+	recorded  *bytes.Buffer
+	limit     int // bytes recorded
+	truncated bool
+	started   bool
+}
+
+// Read reads from the body and records the data up to the limit
+func (cb *continueBody) Read(p []byte) (int, error) {
+	cb.started = true
+	n, err := cb.ReadCloser.Read(p)
+	cb.truncated = recordLimited(cb.recorded, p[:n], cb.limit) || cb.truncated
+	return n, err
+}
+
+// handleContinue answers the expectation of a request. By default it sends
+// 100 Continue, after the configured delay, and receives the whole body
+// before the response is written. It returns true if the request was
+// rejected and the response has been written.
+func handleContinue(w http.ResponseWriter, r *http.Request, config *ContinueConfig) (int, bool) {
+	if config == nil {
+		config = &ContinueConfig{}
+	}
+
+	switch config.Mode {
+	case ContinueReject:
+		status := config.StatusCode
+		if status == 0 {
+			status = http.StatusExpectationFailed
+		}
+		r.Body = http.NoBody
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Expectation rejected"})
+		return status, true
+
+	case ContinueSkip:
+		r.Body = http.NoBody
+		return 0, false
+	}
+
+	if config.Delay > 0 {
+		time.Sleep(time.Duration(config.Delay) * time.Millisecond)
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return 0, false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpectContinue tests sending, delaying and rejecting 100 Continue
+func TestExpectContinue(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/upload", Method: "POST", StatusCode: 201, Response: "stored"},
+			{Path: "/slow", Method: "POST", Response: "stored", Continue: &ContinueConfig{Delay: 200}},
+			{Path: "/reject", Method: "POST", Response: "stored", Continue: &ContinueConfig{Mode: ContinueReject, StatusCode: 413}},
+			{Path: "/skip", Method: "POST", Response: "early", Continue: &ContinueConfig{Mode: ContinueSkip}},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// send writes the request headers and returns the first response
+	send := func(path string) (net.Conn, *bufio.Reader, *http.Response, time.Duration) {
+		t.Helper()
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		started := time.Now()
+		conn.Write([]byte("POST " + path + " HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("Failed to read response for %s: %v", path, err)
+		}
+		return conn, reader, resp, time.Since(started)
+	}
+
+	conn, reader, resp, _ := send("/upload")
+	if resp.StatusCode != http.StatusContinue {
+		t.Fatalf("Expected 100 Continue, got %d", resp.StatusCode)
+	}
+	conn.Write([]byte("hello"))
+	if resp, err := http.ReadResponse(reader, nil); err != nil || resp.StatusCode != 201 {
+		t.Errorf("Expected 201 after the body, got %v %v", resp, err)
+	}
+	conn.Close()
+
+	// The request is recorded after the response has been sent
+	entries := server.history.list()
+	for deadline := time.Now().Add(time.Second); len(entries) == 0 && time.Now().Before(deadline); entries = server.history.list() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(entries) != 1 || string(entries[0].RequestBody) != "hello" {
+		t.Errorf("Expected the body to be recorded, got %+v", entries)
+	}
+
+	conn, reader, resp, elapsed := send("/slow")
+	if resp.StatusCode != http.StatusContinue || elapsed < 200*time.Millisecond {
+		t.Errorf("Expected 100 Continue after 200ms, got %d after %v", resp.StatusCode, elapsed)
+	}
+	conn.Write([]byte("hello"))
+	http.ReadResponse(reader, nil)
+	conn.Close()
+
+	for path, status := range map[string]int{"/reject": 413, "/skip": 200} {
+		conn, _, resp, _ = send(path)
+		if resp.StatusCode != status {
+			t.Errorf("Expected %s to respond %d without asking for the body, got %d", path, status, resp.StatusCode)
+		}
+		conn.Close()
+	}
+
+	if err := validateContinue(&ContinueConfig{Mode: "later"}); err == nil || !strings.Contains(err.Error(), "later") {
+		t.Errorf("Expected an error for an unknown mode, got %v", err)
+	}
+}
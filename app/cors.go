@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig lets browsers call the endpoints from other origins
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins,omitempty"`   // origins like "https://app.example.com" or "https://*.example.com" (default: any)
+	AllowedMethods   []string `json:"allowed_methods,omitempty"`   // methods allowed in preflights (default: those of the path)
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"`   // request headers allowed in preflights (default: those requested)
+	ExposedHeaders   []string `json:"exposed_headers,omitempty"`   // response headers that scripts may read
+	AllowCredentials bool     `json:"allow_credentials,omitempty"` // allow cookies and authorization headers
+	MaxAge           int      `json:"max_age,omitempty"`           // seconds browsers may cache preflight results
+}
+
+// corsPolicy is a compiled CORS setting
+type corsPolicy struct {
+	config    CORSConfig
+	anyOrigin bool
+	origins   []string // lowercase, possibly with one "*"
+}
+
+// newCORSPolicy checks a CORS setting and compiles it. It returns nil
+// without a setting.
+func newCORSPolicy(config *CORSConfig) (*corsPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+	policy := &corsPolicy{config: *config, anyOrigin: len(config.AllowedOrigins) == 0}
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			policy.anyOrigin = true
+		case strings.Count(origin, "*") > 1 || !strings.Contains(origin, "://") || strings.HasSuffix(origin, "/"):
+			return nil, fmt.Errorf("invalid allowed origin %q, expected a scheme and host like https://app.example.com", origin)
+		default:
+			policy.origins = append(policy.origins, origin)
+		}
+	}
+	policy.config.AllowedMethods = make([]string, 0, len(config.AllowedMethods))
+	for _, method := range config.AllowedMethods {
+		if !isHTTPToken(method) {
+			return nil, fmt.Errorf("invalid allowed method %q", method)
+		}
+		policy.config.AllowedMethods = append(policy.config.AllowedMethods, strings.ToUpper(method))
+	}
+	if config.MaxAge < 0 {
+		return nil, fmt.Errorf("max_age must not be negative")
+	}
+	return policy, nil
+}
+
+// isHTTPToken reports whether a value is a non-empty HTTP token, like a method
+func isHTTPToken(value string) bool {
+	return value != "" && !strings.ContainsFunc(value, func(c rune) bool {
+		return c <= ' ' || c >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c)
+	})
+}
+
+// allows reports whether requests from an origin are allowed
+func (p *corsPolicy) allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.origins {
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if origin == allowed || (wildcard && len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin sets the headers allowing the origin of a request. With
+// credentials, the origin is echoed, since browsers reject "*" then.
+func (p *corsPolicy) allowOrigin(w http.ResponseWriter, origin string) {
+	if p.anyOrigin && !p.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+	if p.config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// wrap adds the CORS headers to the responses of a handler for requests
+// from allowed origins
+func (p *corsPolicy) wrap(next http.Handler) http.Handler {
+	exposed := strings.Join(p.config.ExposedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if p.allows(origin) {
+				p.allowOrigin(w, origin)
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+			} else if !p.anyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight answers CORS preflight requests for a path with the allowed
+// methods. Requests from other origins get no CORS headers, so browsers
+// block the actual request.
+func (p *corsPolicy) preflight(allow []string) http.Handler {
+	allowHeader := strings.Join(allow, ", ")
+	methods := allowHeader
+	if len(p.config.AllowedMethods) > 0 {
+		methods = strings.Join(p.config.AllowedMethods, ", ")
+	}
+	headers := strings.Join(p.config.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allowHeader)
+		origin := r.Header.Get("Origin")
+		requested := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !p.allows(origin) || (len(p.config.AllowedMethods) > 0 && !slices.Contains(p.config.AllowedMethods, requested)) {
+			if !p.anyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("%s %s - %d (CORS preflight of %s from %s denied) [auto]", r.Method, r.URL.Path, http.StatusNoContent, requested, origin)
+			return
+		}
+
+		p.allowOrigin(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		} else if requestedHeaders := r.Header.Get("Access-Control-Request-Headers"); requestedHeaders != "" {
+			w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if p.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(p.config.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("%s %s - %d (CORS preflight) [auto]", r.Method, r.URL.Path, http.StatusNoContent)
+	})
+}
+
+// isPreflight reports whether a request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// corsPolicyFor returns the CORS policy of an endpoint: its own setting or
+// the one of the configuration. Must be called with ms.mutex held.
+func (ms *MockServer) corsPolicyFor(endpoint Endpoint, source string) *corsPolicy {
+	var global *corsPolicy
+	if ms.config != nil {
+		global, _ = newCORSPolicy(ms.config.CORS) // checked when the configuration is loaded
+	}
+	if endpoint.CORS == nil {
+		return global
+	}
+	policy, err := newCORSPolicy(endpoint.CORS)
+	if err != nil {
+		log.Printf("Invalid cors for %s %s [%s]: %v", endpoint.Method, endpoint.Path, source, err)
+		return global
+	}
+	return policy
+}
+
+// applyCORS sets the CORS policy of a route and wraps its handler
+func (route *endpointRoute) applyCORS(policy *corsPolicy) {
+	if policy == nil {
+		return
+	}
+	route.cors = policy
+	route.handler = policy.wrap(route.handler)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCORS tests CORS headers and automatic preflight responses
+func TestCORS(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		CORS: &CORSConfig{
+			AllowedOrigins: []string{"https://app.example.com", "https://*.preview.example.com"},
+			ExposedHeaders: []string{"X-Request-Id"},
+			MaxAge:         600,
+		},
+		Resources: []Resource{{Name: "notes", Path: "/notes"}},
+		Endpoints: []Endpoint{
+			{Path: "/users", Method: "GET", StatusCode: 200, Response: []interface{}{}},
+			{Path: "/users", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 1}},
+			{Path: "/session", Method: "POST", StatusCode: 200, Response: "ok", CORS: &CORSConfig{
+				AllowCredentials: true,
+				AllowedMethods:   []string{"post"},
+				AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+			}},
+			{Path: "/broken", Method: "GET", StatusCode: 200, Response: "ok", CORS: &CORSConfig{AllowedOrigins: []string{"example.com"}}},
+		},
+	}
+	if err := server.resources.configure(server.config.Resources); err != nil {
+		t.Fatal(err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Preflights are answered without an OPTIONS endpoint
+	w := call("OPTIONS", "/users", map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type",
+	})
+	if w.Code != 204 || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "OPTIONS, GET, POST" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "content-type" || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight response: %d %v", w.Code, w.Header())
+	}
+
+	// Actual requests get the headers from allowed origins only
+	w = call("GET", "/users", map[string]string{"Origin": "https://pr-12.preview.example.com"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://pr-12.preview.example.com" || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Errorf("Expected the wildcard origin to be allowed, got %v", w.Header())
+	}
+	for _, origin := range []string{"https://evil.example.com", "https://preview.example.com"} {
+		w = call("GET", "/users", map[string]string{"Origin": origin})
+		if w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+			t.Errorf("Expected no CORS headers for %s, got %d %v", origin, w.Code, w.Header())
+		}
+	}
+	w = call("OPTIONS", "/users", map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "GET"})
+	if w.Code != 204 || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected a denied preflight, got %d %v", w.Code, w.Header())
+	}
+
+	// Resources use the CORS setting of the configuration
+	w = call("OPTIONS", "/notes/1", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the resource preflight to be allowed, got %d %v", w.Code, w.Header())
+	}
+
+	// Endpoint settings replace the configuration's
+	w = call("OPTIONS", "/session", map[string]string{"Origin": "https://other.example.com", "Access-Control-Request-Method": "POST"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://other.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "POST" || w.Header().Get("Access-Control-Allow-Headers") != "Content-Type, X-CSRF-Token" {
+		t.Errorf("Unexpected credentialed preflight response: %v", w.Header())
+	}
+	w = call("POST", "/session", map[string]string{"Origin": "https://other.example.com"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://other.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the origin to be echoed with credentials, got %v", w.Header())
+	}
+
+	// Invalid endpoint settings fall back to the configuration's
+	w = call("GET", "/broken", map[string]string{"Origin": "https://app.example.com"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the configuration's setting, got %v", w.Header())
+	}
+
+	// Without an origin, OPTIONS is still unknown
+	if w = call("OPTIONS", "/users", nil); w.Code != 405 {
+		t.Errorf("Expected 405 for OPTIONS without auto_options, got %d", w.Code)
+	}
+
+	if _, err := newCORSPolicy(&CORSConfig{AllowedOrigins: []string{"https://*.*.example.com"}}); err == nil {
+		t.Error("Expected an origin with two wildcards to be rejected")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Dataset binds an endpoint to rows of a CSV or JSON file
+type Dataset struct {
+	File  string `json:"file"`            // CSV file with a header row, or JSON array of objects
+	Key   string `json:"key"`             // column the rows are looked up by
+	Param string `json:"param,omitempty"` // path variable or query parameter holding the value (default: key)
+}
+
+// datasetRows is the parsed content of a dataset file
+type datasetRows struct {
+	rows  []map[string]interface{}
+	index map[string]int // key value to the first row with that value
+}
+
+// dataset serves rows of a dataset file, reloading the file when it changes
+type dataset struct {
+	config Dataset
+
+	mutex   sync.Mutex
+	modTime time.Time
+	data    *datasetRows
+}
+
+// newDataset checks a dataset configuration and loads its file
+func newDataset(config Dataset) (*dataset, error) {
+	if config.Key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	if err := validateDatasetFile(config.File); err != nil {
+		return nil, err
+	}
+	if config.Param == "" {
+		config.Param = config.Key
+	}
+
+	ds := &dataset{config: config}
+	if _, err := ds.load(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// validateDatasetFile checks that a dataset file has a supported format
+func validateDatasetFile(file string) error {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv", ".json":
+		return nil
+	}
+	return fmt.Errorf("unsupported file %q, expected .csv or .json", file)
+}
+
+// load returns the rows of the file, parsing it again if it was modified
+func (ds *dataset) load() (*datasetRows, error) {
+	stat, err := os.Stat(ds.config.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %v", err)
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if ds.data != nil && stat.ModTime().Equal(ds.modTime) {
+		return ds.data, nil
+	}
+
+	content, err := os.ReadFile(ds.config.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %v", err)
+	}
+	var rows []map[string]interface{}
+	if strings.EqualFold(filepath.Ext(ds.config.File), ".csv") {
+		rows, err = parseCSVRows(content)
+	} else {
+		err = json.Unmarshal(content, &rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dataset %s: %v", ds.config.File, err)
+	}
+
+	data := &datasetRows{rows: rows, index: make(map[string]int, len(rows))}
+	for i, row := range rows {
+		value, exists := row[ds.config.Key]
+		if !exists || value == nil {
+			continue
+		}
+		key := fmt.Sprint(value)
+		if _, duplicate := data.index[key]; !duplicate {
+			data.index[key] = i
+		}
+	}
+	ds.data, ds.modTime = data, stat.ModTime()
+	return data, nil
+}
+
+// parseCSVRows converts CSV records to objects keyed by the header row
+func parseCSVRows(content []byte) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	header := records[0]
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			row[strings.TrimSpace(column)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// respond returns the encoded row selected by the request and its status.
+// Without a value in the request, all rows are returned, filtered and paged
+// by the OData query options of the request.
+func (ds *dataset) respond(r *http.Request) ([]byte, int) {
+	data, err := ds.load()
+	if err != nil {
+		body, _ := encodeResponse(map[string]string{"error": err.Error()})
+		return body, http.StatusInternalServerError
+	}
+
+	value, exists := mux.Vars(r)[ds.config.Param]
+	if !exists && r.URL.Query().Has(ds.config.Param) {
+		value, exists = r.URL.Query().Get(ds.config.Param), true
+	}
+
+	var response interface{} = data.rows
+	status := http.StatusOK
+	if !exists {
+		options, err := parseQueryOptions(r.URL.Query())
+		if err != nil {
+			body, _ := encodeResponse(map[string]string{"error": err.Error()})
+			return body, http.StatusBadRequest
+		}
+		if options != nil {
+			response = options.apply(data.rows)
+		}
+	} else {
+		if i, found := data.index[value]; found {
+			response = data.rows[i]
+		} else {
+			response = map[string]string{"error": "Not found"}
+			status = http.StatusNotFound
+		}
+	}
+
+	body, err := encodeResponse(response)
+	if err != nil {
+		body, _ = encodeResponse(map[string]string{"error": err.Error()})
+		return body, http.StatusInternalServerError
+	}
+	return body, status
+}
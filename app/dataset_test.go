@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDataset tests looking up rows of CSV and JSON datasets
+func TestDataset(t *testing.T) {
+	dir := t.TempDir()
+	usersFile := filepath.Join(dir, "users.csv")
+	if err := os.WriteFile(usersFile, []byte("id,name,role\n1,Alice,admin\n2,Bob,user\n"), 0644); err != nil {
+		t.Fatalf("Failed to write dataset: %v", err)
+	}
+	productsFile := filepath.Join(dir, "products.json")
+	if err := os.WriteFile(productsFile, []byte(`[{"sku": 100, "price": 9.5}, {"sku": 200, "price": 20}]`), 0644); err != nil {
+		t.Fatalf("Failed to write dataset: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users/{id}", Method: "GET", Dataset: &Dataset{File: usersFile, Key: "id"}},
+			{Path: "/api/users", Method: "GET", Dataset: &Dataset{File: usersFile, Key: "name"}},
+			{Path: "/api/products", Method: "GET", Dataset: &Dataset{File: productsFile, Key: "sku", Param: "code"}},
+		},
+	}
+	server.SetupRoutes()
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/api/users/2", 200, `{"id":"2","name":"Bob","role":"user"}` + "\n"},
+		{"/api/users/3", 404, `{"error":"Not found"}` + "\n"},
+		{"/api/users?name=Alice", 200, `{"id":"1","name":"Alice","role":"admin"}` + "\n"},
+		{"/api/users", 200, `[{"id":"1","name":"Alice","role":"admin"},{"id":"2","name":"Bob","role":"user"}]` + "\n"},
+		{"/api/products?code=200", 200, `{"price":20,"sku":200}` + "\n"},
+		{"/api/products?code=300", 404, `{"error":"Not found"}` + "\n"},
+	}
+	for _, test := range tests {
+		if status, body := get(test.path); status != test.status || body != test.body {
+			t.Errorf("Expected %s to respond %d %s, got %d %s", test.path, test.status, test.body, status, body)
+		}
+	}
+
+	// Changes to the file are picked up without a reload
+	if err := os.WriteFile(usersFile, []byte("id,name,role\n3,Carol,user\n"), 0644); err != nil {
+		t.Fatalf("Failed to write dataset: %v", err)
+	}
+	os.Chtimes(usersFile, time.Now(), time.Now().Add(time.Second))
+	if status, _ := get("/api/users/3"); status != 200 {
+		t.Errorf("Expected the changed dataset to be used, got %d", status)
+	}
+
+	if _, err := newDataset(Dataset{File: usersFile}); err == nil {
+		t.Error("Expected an error for a dataset without key")
+	}
+	if _, err := newDataset(Dataset{File: filepath.Join(dir, "users.xlsx"), Key: "id"}); err == nil {
+		t.Error("Expected an error for an unsupported file type")
+	}
+}
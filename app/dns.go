@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// DNSConfig represents the DNS resolver redirecting mocked hostnames to nmock
+type DNSConfig struct {
+	Port     string   `json:"port"`               // UDP port of the resolver
+	Hosts    []string `json:"hosts"`              // hostnames answered, "*.example.com" matches subdomains
+	Address  string   `json:"address,omitempty"`  // IP address answered for the hosts (default: 127.0.0.1)
+	Upstream string   `json:"upstream,omitempty"` // resolver for other names, e.g. 8.8.8.8:53 (default: refuse them)
+	TTL      int      `json:"ttl,omitempty"`      // seconds answers may be cached (default: 60)
+}
+
+// DNS message constants used by the resolver
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsTypeANY  = 255
+	dnsClassIN  = 1
+
+	dnsRcodeFormatError = 1
+	dnsRcodeNotImpl     = 4
+	dnsRcodeRefused     = 5
+
+	dnsHeaderSize = 12
+)
+
+// address returns the IP answered for the hosts
+func (c DNSConfig) address() net.IP {
+	if c.Address == "" {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return net.ParseIP(c.Address)
+}
+
+// ttl returns the TTL of answers in seconds
+func (c DNSConfig) ttl() uint32 {
+	if c.TTL <= 0 {
+		return 60
+	}
+	return uint32(c.TTL)
+}
+
+// matches reports whether a hostname is mocked
+func (c DNSConfig) matches(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, host := range c.Hosts {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if suffix, ok := strings.CutPrefix(host, "*."); ok {
+			if strings.HasSuffix(name, "."+suffix) {
+				return true
+			}
+		} else if name == host {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDNS checks the DNS resolver configuration
+func validateDNS(config *DNSConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Port == "" {
+		return fmt.Errorf("dns: port is required")
+	}
+	if config.address() == nil {
+		return fmt.Errorf("dns: invalid address %q", config.Address)
+	}
+	for _, host := range config.Hosts {
+		if strings.TrimPrefix(host, "*.") == "" || strings.ContainsAny(host, " /:") {
+			return fmt.Errorf("dns: invalid host %q", host)
+		}
+	}
+	if config.Upstream != "" {
+		if _, _, err := net.SplitHostPort(config.Upstream); err != nil {
+			return fmt.Errorf("dns: invalid upstream %q, expected host:port", config.Upstream)
+		}
+	}
+	return nil
+}
+
+// startDNS runs the DNS resolver until it fails
+func (ms *MockServer) startDNS(config DNSConfig) {
+	conn, err := net.ListenPacket("udp", ":"+config.Port)
+	if err != nil {
+		log.Printf("Failed to start DNS resolver: %v", err)
+		return
+	}
+	log.Printf("DNS resolver available at: localhost:%s/udp (%d hosts -> %s)", config.Port, len(config.Hosts), config.address())
+	serveDNS(conn, config)
+}
+
+// serveDNS answers DNS queries until the connection is closed
+func serveDNS(conn net.PacketConn, config DNSConfig) {
+	buffer := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		query := append([]byte{}, buffer[:n]...)
+		go func() {
+			if response := resolveDNS(query, config); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+// resolveDNS answers a query for a mocked hostname, forwards other queries
+// to the upstream resolver, or refuses them. It returns nil for messages
+// that can't be answered at all.
+func resolveDNS(query []byte, config DNSConfig) []byte {
+	if len(query) < dnsHeaderSize || query[2]&0x80 != 0 {
+		return nil
+	}
+
+	opcode := (query[2] >> 3) & 0x0f
+	questions := binary.BigEndian.Uint16(query[4:6])
+	if opcode != 0 || questions != 1 {
+		return dnsResponse(query, dnsHeaderSize, dnsRcodeNotImpl, nil)
+	}
+
+	name, end, ok := dnsQuestionName(query)
+	if !ok || end+4 > len(query) {
+		return dnsResponse(query, dnsHeaderSize, dnsRcodeFormatError, nil)
+	}
+	qtype := binary.BigEndian.Uint16(query[end : end+2])
+	questionEnd := end + 4
+
+	if !config.matches(name) {
+		if config.Upstream == "" {
+			return dnsResponse(query, questionEnd, dnsRcodeRefused, nil)
+		}
+		response, err := forwardDNS(query, config.Upstream)
+		if err != nil {
+			log.Printf("DNS %s - upstream failed: %v", name, err)
+			return dnsResponse(query, questionEnd, dnsRcodeRefused, nil)
+		}
+		return response
+	}
+
+	// Mocked names answer with the configured address, and with no records
+	// for the other address family
+	ip := config.address()
+	rtype, rdata := uint16(dnsTypeAAAA), ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		rtype, rdata = dnsTypeA, ip4
+	}
+	var answer []byte
+	if qtype == rtype || qtype == dnsTypeANY {
+		answer = []byte{0xc0, dnsHeaderSize} // pointer to the question name
+		answer = binary.BigEndian.AppendUint16(answer, rtype)
+		answer = binary.BigEndian.AppendUint16(answer, dnsClassIN)
+		answer = binary.BigEndian.AppendUint32(answer, config.ttl())
+		answer = binary.BigEndian.AppendUint16(answer, uint16(len(rdata)))
+		answer = append(answer, rdata...)
+	}
+	log.Printf("DNS %s - %s [dns]", name, ip)
+	return dnsResponse(query, questionEnd, 0, answer)
+}
+
+// dnsQuestionName reads the name of the first question and returns the
+// offset following it
+func dnsQuestionName(message []byte) (string, int, bool) {
+	var labels []string
+	offset := dnsHeaderSize
+	for {
+		if offset >= len(message) {
+			return "", 0, false
+		}
+		length := int(message[offset])
+		offset++
+		if length == 0 {
+			return strings.Join(labels, "."), offset, true
+		}
+		// Queries don't compress the question name
+		if length > 63 || offset+length > len(message) {
+			return "", 0, false
+		}
+		labels = append(labels, string(message[offset:offset+length]))
+		offset += length
+	}
+}
+
+// dnsResponse builds a response repeating the question of a query, up to
+// questionEnd, followed by an optional answer record
+func dnsResponse(query []byte, questionEnd int, rcode byte, answer []byte) []byte {
+	response := append([]byte{}, query[:questionEnd]...)
+	response[2] = 0x80 | query[2]&0x79 | 0x04 // QR, opcode and RD of the query, AA
+	response[3] = 0x80 | rcode                // RA
+	if questionEnd == dnsHeaderSize {
+		binary.BigEndian.PutUint16(response[4:6], 0)
+	}
+	answers := uint16(0)
+	if answer != nil {
+		answers = 1
+	}
+	binary.BigEndian.PutUint16(response[6:8], answers)
+	binary.BigEndian.PutUint16(response[8:10], 0)
+	binary.BigEndian.PutUint16(response[10:12], 0)
+	return append(response, answer...)
+}
+
+// forwardDNS sends a query to the upstream resolver and returns its response
+func forwardDNS(query []byte, upstream string) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", upstream, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
+
+// runHosts implements the hosts command, printing /etc/hosts entries for
+// the hostnames of the DNS configuration, and returns the exit code
+func runHosts(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("hosts", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "Configuration file with the dns hosts")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+	}
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hosts: failed to read config file: %v\n", err)
+		return 2
+	}
+	var config Config
+	if data, err = newSecretStore().resolve(data, ignoreSecret); err == nil {
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hosts: failed to parse config file: %v\n", err)
+		return 2
+	}
+	if err := validateDNS(config.DNS); err != nil {
+		fmt.Fprintf(os.Stderr, "hosts: %v\n", err)
+		return 2
+	}
+	if config.DNS == nil || len(config.DNS.Hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "hosts: %s has no dns hosts\n", *configPath)
+		return 2
+	}
+
+	writeHostsEntries(stdout, *config.DNS)
+	return 0
+}
+
+// writeHostsEntries writes /etc/hosts lines for the hosts. Wildcards can't
+// be expressed in a hosts file and are listed as comments.
+func writeHostsEntries(w io.Writer, config DNSConfig) {
+	fmt.Fprintln(w, "# nmock")
+	for _, host := range config.Hosts {
+		if strings.HasPrefix(host, "*.") {
+			fmt.Fprintf(w, "# %s: wildcards need the dns resolver\n", host)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", config.address(), host)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDNSResolver tests answering mocked hostnames and refusing others
+func TestDNSResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	go serveDNS(conn, DNSConfig{Hosts: []string{"api.example.com", "*.stripe.test"}, Address: "127.0.0.2"})
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+
+	for _, host := range []string{"api.example.com", "API.Example.com.", "checkout.stripe.test"} {
+		ips, err := resolver.LookupIP(context.Background(), "ip4", host)
+		if err != nil {
+			t.Errorf("Failed to resolve %s: %v", host, err)
+			continue
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.ParseIP("127.0.0.2")) {
+			t.Errorf("Expected %s to resolve to 127.0.0.2, got %v", host, ips)
+		}
+	}
+
+	// Mocked names have no records of the other address family
+	if ips, err := resolver.LookupIP(context.Background(), "ip6", "api.example.com"); err == nil {
+		t.Errorf("Expected no IPv6 address, got %v", ips)
+	}
+
+	// Other names are refused without an upstream resolver
+	for _, host := range []string{"example.com", "stripe.test"} {
+		_, err := resolver.LookupIP(context.Background(), "ip4", host)
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) {
+			t.Errorf("Expected %s to be refused, got %v", host, err)
+		}
+	}
+}
+
+// TestDNSForward tests forwarding other names to the upstream resolver
+func TestDNSForward(t *testing.T) {
+	upstream := DNSConfig{Hosts: []string{"example.com"}, Address: "10.0.0.1"}
+	query := dnsTestQuery("example.com", dnsTypeA)
+	direct := resolveDNS(query, upstream)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	go serveDNS(conn, upstream)
+
+	forwarded := resolveDNS(query, DNSConfig{Hosts: []string{"api.test"}, Upstream: conn.LocalAddr().String()})
+	if !bytes.Equal(forwarded, direct) {
+		t.Errorf("Expected the upstream response %v, got %v", direct, forwarded)
+	}
+
+	// Malformed queries are answered with a format error
+	response := resolveDNS(query[:dnsHeaderSize+3], upstream)
+	if len(response) != dnsHeaderSize || response[3]&0x0f != dnsRcodeFormatError {
+		t.Errorf("Expected a format error, got %v", response)
+	}
+}
+
+// TestHostsCommand tests printing /etc/hosts entries
+func TestHostsCommand(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configPath, []byte(`{"dns": {"port": "5353", "hosts": ["api.example.com", "*.stripe.test"]}}`), 0644)
+
+	var out bytes.Buffer
+	if code := runHosts([]string{configPath}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	expected := "# nmock\n127.0.0.1\tapi.example.com\n# *.stripe.test: wildcards need the dns resolver\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	if err := validateDNS(&DNSConfig{Port: "5353", Address: "localhost"}); err == nil {
+		t.Error("Expected an invalid address to be rejected")
+	}
+}
+
+// dnsTestQuery builds a query with one question
+func dnsTestQuery(name string, qtype uint16) []byte {
+	query := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range bytes.Split([]byte(name), []byte(".")) {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	return append(query, 0, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Fills of generated download content
+const (
+	DownloadZero   = "zero"   // zero bytes
+	DownloadRandom = "random" // pseudo-random bytes, the same on every request
+)
+
+// DownloadConfig serves an endpoint's body as a file download
+type DownloadConfig struct {
+	Filename string `json:"filename,omitempty"` // template with the request data (default: the response file or the last path segment)
+	Inline   bool   `json:"inline,omitempty"`   // display in the browser instead of saving as an attachment
+	Size     int64  `json:"size,omitempty"`     // bytes of generated content served instead of the response
+	Fill     string `json:"fill,omitempty"`     // "zero" (default) or "random"
+	Seed     int64  `json:"seed,omitempty"`     // seed of random content
+}
+
+// validateDownload checks the download setting of an endpoint
+func validateDownload(config *DownloadConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Size < 0 {
+		return fmt.Errorf("size must not be negative, got %d", config.Size)
+	}
+	switch config.Fill {
+	case "", DownloadZero, DownloadRandom:
+	default:
+		return fmt.Errorf("unknown fill %q, expected %q or %q", config.Fill, DownloadZero, DownloadRandom)
+	}
+	if _, err := template.New("filename").Funcs(responseTemplateFuncs).Parse(config.Filename); err != nil {
+		return fmt.Errorf("invalid filename template: %v", err)
+	}
+	return nil
+}
+
+// download is the compiled download setting of an endpoint
+type download struct {
+	config   *DownloadConfig
+	filename *template.Template
+	file     string // response file of the endpoint, if any
+}
+
+// newDownload compiles a validated download setting
+func newDownload(config *DownloadConfig, responseFile string) *download {
+	if config == nil {
+		return nil
+	}
+	filename, _ := template.New("filename").Funcs(responseTemplateFuncs).Parse(config.Filename)
+	return &download{config: config, filename: filename, file: responseFile}
+}
+
+// name returns the file name of a download for a request
+func (d *download) name(r *http.Request) string {
+	var buf bytes.Buffer
+	if err := d.filename.Execute(&buf, newRequestData(r)); err != nil {
+		buf.Reset()
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" && d.file != "" {
+		file, _ := resolveResponseFile(d.file, mux.Vars(r))
+		name = path.Base(strings.ReplaceAll(file, "\\", "/"))
+	}
+	if name == "" {
+		name = path.Base(r.URL.Path)
+	}
+	if name == "/" || name == "." {
+		return ""
+	}
+
+	// A file name never contains a directory
+	name = strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c < ' ' || c == 0x7f {
+			return '_'
+		}
+		return c
+	}, name)
+	return name
+}
+
+// disposition returns the Content-Disposition header of a download. Names
+// outside ASCII are sent as filename* as described in RFC 6266.
+func (d *download) disposition(name string) string {
+	kind := "attachment"
+	if d.config.Inline {
+		kind = "inline"
+	}
+	if name == "" {
+		return kind
+	}
+	if value := mime.FormatMediaType(kind, map[string]string{"filename": name}); value != "" {
+		return value
+	}
+	return kind
+}
+
+// generated reports whether the download content is generated
+func (d *download) generated() bool {
+	return d.config.Size > 0
+}
+
+// serve writes generated content of the configured size. With status 200,
+// range requests get 206 Partial Content, so download managers can resume.
+func (d *download) serve(w http.ResponseWriter, r *http.Request, name string, statusCode int) {
+	content := &generatedContent{size: d.config.Size, random: d.config.Fill == DownloadRandom, seed: splitMix64(uint64(d.config.Seed))}
+	if len(w.Header()["Content-Type"]) == 0 && mime.TypeByExtension(path.Ext(name)) == "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	serveContent(w, r, name, time.Time{}, content, d.config.Size, statusCode)
+}
+
+// generatedContent is seekable content of zero or pseudo-random bytes. Random
+// bytes depend only on the seed and the offset, so every range of the
+// content is the same on each request.
+type generatedContent struct {
+	size   int64
+	offset int64
+	random bool
+	seed   uint64 // mixed, so nearby seeds give unrelated content
+}
+
+// Read reads generated bytes from the current offset
+func (g *generatedContent) Read(p []byte) (int, error) {
+	if g.offset >= g.size {
+		return 0, io.EOF
+	}
+	if remaining := g.size - g.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if !g.random {
+		clear(p)
+	} else {
+		var block [8]byte
+		for i := range p {
+			offset := g.offset + int64(i)
+			if i == 0 || offset%8 == 0 {
+				binary.LittleEndian.PutUint64(block[:], splitMix64(g.seed+uint64(offset/8)))
+			}
+			p[i] = block[offset%8]
+		}
+	}
+	g.offset += int64(len(p))
+	return len(p), nil
+}
+
+// Seek sets the offset of the next read
+func (g *generatedContent) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += g.offset
+	case io.SeekEnd:
+		offset += g.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	g.offset = offset
+	return offset, nil
+}
+
+// splitMix64 returns the value of the SplitMix64 generator at a position
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDownload tests Content-Disposition and generated download content
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.pdf"), []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/invoices/{id}", Method: "GET", ResponseFile: filepath.Join(dir, "report.pdf"), Download: &DownloadConfig{Filename: "invoice-{{.Vars.id}}.pdf"}},
+			{Path: "/report", Method: "GET", ResponseFile: filepath.Join(dir, "report.pdf"), Download: &DownloadConfig{Inline: true}},
+			{Path: "/zeros.bin", Method: "GET", Download: &DownloadConfig{Size: 1000}},
+			{Path: "/random", Method: "GET", Download: &DownloadConfig{Filename: "data.bin", Size: 100, Fill: DownloadRandom, Seed: 7}},
+			{Path: "/export", Method: "GET", ContentType: "text/csv", Response: "id,name\n1,Ann\n", Download: &DownloadConfig{Filename: "Übersicht.csv"}},
+			{Path: "/failed", Method: "GET", StatusCode: 503, Download: &DownloadConfig{Size: 10}},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := get("/invoices/42", nil)
+	if string(body) != "%PDF-1.4" || resp.Header.Get("Content-Disposition") != `attachment; filename=invoice-42.pdf` || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected a named PDF attachment, got %s %s '%s'", resp.Header.Get("Content-Disposition"), resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, _ = get("/report", nil)
+	if resp.Header.Get("Content-Disposition") != "inline; filename=report.pdf" {
+		t.Errorf("Expected the file name of the response file inline, got %s", resp.Header.Get("Content-Disposition"))
+	}
+
+	resp, body = get("/zeros.bin", nil)
+	if resp.StatusCode != 200 || !bytes.Equal(body, make([]byte, 1000)) || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected 1000 zero bytes, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+	if resp.Header.Get("Content-Disposition") != "attachment; filename=zeros.bin" || resp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Expected a binary attachment named after the path, got %s %s", resp.Header.Get("Content-Disposition"), resp.Header.Get("Content-Type"))
+	}
+
+	// Random content is the same on every request, so ranges can be joined
+	_, full := get("/random", nil)
+	if len(full) != 100 || bytes.Equal(full, make([]byte, 100)) {
+		t.Fatalf("Expected 100 random bytes, got %v", full)
+	}
+	_, again := get("/random", nil)
+	if !bytes.Equal(full, again) {
+		t.Errorf("Expected the same random content on each request")
+	}
+	resp, part := get("/random", http.Header{"Range": {"bytes=13-60"}})
+	if resp.StatusCode != 206 || !bytes.Equal(part, full[13:61]) || resp.Header.Get("Content-Range") != "bytes 13-60/100" {
+		t.Errorf("Expected the requested range of the content, got %d %s", resp.StatusCode, resp.Header.Get("Content-Range"))
+	}
+
+	resp, body = get("/export", nil)
+	if string(body) != "id,name\n1,Ann\n" || resp.Header.Get("Content-Disposition") != "attachment; filename*=utf-8''%C3%9Cbersicht.csv" {
+		t.Errorf("Expected the response with an encoded file name, got %s '%s'", resp.Header.Get("Content-Disposition"), body)
+	}
+
+	resp, body = get("/failed", http.Header{"Range": {"bytes=0-1"}})
+	if resp.StatusCode != 503 || len(body) != 10 {
+		t.Errorf("Expected the whole content with the configured status, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+}
+
+// TestValidateDownload tests checking download settings
+func TestValidateDownload(t *testing.T) {
+	tests := []struct {
+		config *DownloadConfig
+		valid  bool
+	}{
+		{nil, true},
+		{&DownloadConfig{Filename: "{{.Vars.id}}.zip", Size: 1 << 30, Fill: DownloadZero}, true},
+		{&DownloadConfig{Size: -1}, false},
+		{&DownloadConfig{Fill: "ones"}, false},
+		{&DownloadConfig{Filename: "{{.Vars.id"}, false},
+	}
+	for _, test := range tests {
+		if err := validateDownload(test.config); (err == nil) != test.valid {
+			t.Errorf("validateDownload(%+v): expected valid=%v, got %v", test.config, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// endpointEnabled reports whether an endpoint is switched on: by its
+// enabled field unless it was toggled through the admin API. Must be called
+// with ms.mutex held.
+func (ms *MockServer) endpointEnabled(ep Endpoint) bool {
+	if enabled, toggled := ms.endpointToggles[endpointID(ep)]; toggled {
+		return enabled
+	}
+	return ep.Enabled == nil || *ep.Enabled
+}
+
+// findEndpoints returns the endpoints with an ID in all sources. Must be
+// called with ms.mutex held.
+func (ms *MockServer) findEndpoints(id string) []Endpoint {
+	var found []Endpoint
+	collect := func(endpoints []Endpoint) {
+		for _, ep := range endpoints {
+			if endpointID(ep) == id {
+				found = append(found, ep)
+			}
+		}
+	}
+	collect(ms.runtimeEndpoints)
+	collect(ms.config.Endpoints)
+	for _, plugin := range ms.plugins {
+		collect(plugin.allEndpoints())
+	}
+	return found
+}
+
+// setupEndpointToggleAPI registers the admin API switching single endpoints
+func (ms *MockServer) setupEndpointToggleAPI() {
+	// Switch an endpoint off or back on
+	ms.router.HandleFunc("/_admin/endpoints/{id}/toggle", func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		ms.mutex.Lock()
+		found := ms.findEndpoints(id)
+		if len(found) == 0 {
+			ms.mutex.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Endpoint not found"})
+			return
+		}
+		enabled := !ms.endpointEnabled(found[0])
+		ms.endpointToggles[id] = enabled
+		ms.mutex.Unlock()
+
+		// The new routes replace the old ones at once
+		ms.SetupRoutes()
+
+		ep := found[0]
+		state := map[bool]string{true: "enabled", false: "disabled"}[enabled]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      id,
+			"method":  strings.ToUpper(ep.Method),
+			"path":    ep.Path,
+			"enabled": enabled,
+		})
+		log.Printf("Endpoint %s %s %s", strings.ToUpper(ep.Method), ep.Path, state)
+	}).Methods("POST")
+}
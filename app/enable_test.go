@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestToggleEndpoint tests switching a single endpoint off and back on
+func TestToggleEndpoint(t *testing.T) {
+	disabled := false
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/users", Method: "GET", Response: "users"},
+		{Path: "/orders", Method: "GET", Response: "orders", Enabled: &disabled},
+	}}
+	server.plugins["payments"] = &Plugin{Name: "payments", Enabled: true, Endpoints: []Endpoint{
+		{Path: "/payments", Method: "GET", Response: "payments"},
+	}}
+	server.SetupRoutes()
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if code := call("GET", "/orders").Code; code != 404 {
+		t.Errorf("Expected the disabled endpoint to return 404, got %d", code)
+	}
+
+	id := endpointID(Endpoint{Method: "GET", Path: "/payments"})
+	w := call("POST", "/_admin/endpoints/"+id+"/toggle")
+	var result struct {
+		ID      string `json:"id"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.ID != id || result.Enabled {
+		t.Fatalf("Expected the endpoint to be disabled, got %s", w.Body.String())
+	}
+	for path, expected := range map[string]int{"/payments": 404, "/users": 200} {
+		if code := call("GET", path).Code; code != expected {
+			t.Errorf("Expected %s to return %d, got %d", path, expected, code)
+		}
+	}
+	for _, route := range server.listRoutes("") {
+		if route.ID == id {
+			t.Error("Expected the disabled endpoint to be missing from the routes")
+		}
+	}
+
+	call("POST", "/_admin/endpoints/"+id+"/toggle")
+	call("POST", "/_admin/endpoints/"+endpointID(Endpoint{Method: "GET", Path: "/orders"})+"/toggle")
+	for _, path := range []string{"/payments", "/orders"} {
+		if code := call("GET", path).Code; code != 200 {
+			t.Errorf("Expected %s to be enabled, got %d", path, code)
+		}
+	}
+
+	if code := call("POST", "/_admin/endpoints/unknown/toggle").Code; code != 404 {
+		t.Errorf("Expected 404 for an unknown endpoint, got %d", code)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// setupEndpointsAPI registers the admin API for endpoints created at runtime.
+// Runtime endpoints are kept in memory and take precedence over endpoints
+// defined in files. With ?persist=true, changes are written to the config
+// file instead.
+func (ms *MockServer) setupEndpointsAPI() {
+	// List runtime endpoints
+	ms.router.HandleFunc("/_admin/endpoints", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		endpoints := append([]Endpoint{}, ms.runtimeEndpoints...)
+		ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		ms.writeRedactedJSON(w, endpoints)
+	}).Methods("GET")
+
+	// Add or replace an endpoint
+	ms.router.HandleFunc("/_admin/endpoints", func(w http.ResponseWriter, r *http.Request) {
+		endpoint, err := decodeEndpoint(r)
+		if err != nil {
+			writeEndpointError(w, http.StatusBadRequest, fmt.Sprintf("Invalid endpoint: %v", err))
+			return
+		}
+
+		var replaced bool
+		if r.URL.Query().Get("persist") == "true" {
+			replaced, err = ms.persistEndpoint("", &endpoint)
+		} else {
+			replaced, err = ms.putRuntimeEndpoint(-1, endpoint)
+		}
+		if err != nil {
+			writeEndpointError(w, http.StatusBadRequest, fmt.Sprintf("Invalid endpoint: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !replaced {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Endpoint %s %s added", endpoint.Method, endpoint.Path),
+			"id":      endpointID(endpoint),
+		})
+		log.Printf("Runtime endpoint added: %s %s", endpoint.Method, endpoint.Path)
+	}).Methods("POST")
+
+	// Update the endpoint with an ID, which may change its method and path
+	ms.router.HandleFunc("/_admin/endpoints/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		endpoint, err := decodeEndpoint(r)
+		if err != nil {
+			writeEndpointError(w, http.StatusBadRequest, fmt.Sprintf("Invalid endpoint: %v", err))
+			return
+		}
+
+		var found bool
+		if r.URL.Query().Get("persist") == "true" {
+			found, err = ms.persistEndpoint(id, &endpoint)
+		} else {
+			ms.mutex.RLock()
+			index := runtimeEndpointIndex(ms.runtimeEndpoints, id)
+			ms.mutex.RUnlock()
+			if found = index >= 0; found {
+				_, err = ms.putRuntimeEndpoint(index, endpoint)
+			}
+		}
+		if err != nil {
+			writeEndpointError(w, http.StatusBadRequest, fmt.Sprintf("Invalid endpoint: %v", err))
+			return
+		}
+		if !found {
+			writeEndpointError(w, http.StatusNotFound, "Endpoint not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("Endpoint %s %s updated", endpoint.Method, endpoint.Path),
+			"id":      endpointID(endpoint),
+		})
+		log.Printf("Runtime endpoint updated: %s %s", endpoint.Method, endpoint.Path)
+	}).Methods("PUT")
+
+	// Remove the endpoint with an ID
+	ms.router.HandleFunc("/_admin/endpoints/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		var found bool
+		var err error
+		if r.URL.Query().Get("persist") == "true" {
+			found, err = ms.persistEndpoint(id, nil)
+		} else {
+			ms.mutex.Lock()
+			if index := runtimeEndpointIndex(ms.runtimeEndpoints, id); index >= 0 {
+				ms.removeRuntimeEndpoint(index)
+				found = true
+			}
+			ms.mutex.Unlock()
+		}
+		if err != nil {
+			writeEndpointError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeEndpointError(w, http.StatusNotFound, "Endpoint not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Endpoint removed", "id": id})
+		log.Printf("Runtime endpoint removed: %s", id)
+	}).Methods("DELETE")
+
+	// Remove all runtime endpoints
+	ms.router.HandleFunc("/_admin/endpoints", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.Lock()
+		removed := len(ms.runtimeEndpoints)
+		for len(ms.runtimeEndpoints) > 0 {
+			ms.removeRuntimeEndpoint(len(ms.runtimeEndpoints) - 1)
+		}
+		ms.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Runtime endpoints removed", "removed": removed})
+		log.Printf("Runtime endpoints removed: %d", removed)
+	}).Methods("DELETE")
+}
+
+// decodeEndpoint reads an endpoint from a request body and checks the fields
+// needed to route it
+func decodeEndpoint(r *http.Request) (Endpoint, error) {
+	var endpoint Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoint); err != nil {
+		return endpoint, err
+	}
+	if endpoint.Path == "" || endpoint.Method == "" {
+		return endpoint, fmt.Errorf("path and method are required")
+	}
+	if err := validateEndpointIDs([]Endpoint{endpoint}); err != nil {
+		return endpoint, err
+	}
+	endpoint.Method = strings.ToUpper(endpoint.Method)
+	return endpoint, nil
+}
+
+// writeEndpointError writes an error response of the endpoints API
+func writeEndpointError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// runtimeEndpointIndex returns the index of the endpoint with an ID, or -1
+func runtimeEndpointIndex(endpoints []Endpoint, id string) int {
+	for i, ep := range endpoints {
+		if endpointID(ep) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// putRuntimeEndpoint stores a runtime endpoint and registers only its route
+// instead of rebuilding all routes. The endpoint replaces the one at index,
+// if not negative, and the one with the same method and path. Routes are
+// replaced at once, so requests never find neither. It reports whether an
+// endpoint was replaced.
+func (ms *MockServer) putRuntimeEndpoint(index int, endpoint Endpoint) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	route, err := ms.compileRoute(endpoint, "runtime")
+	if err != nil {
+		return false, err
+	}
+	removed := []Endpoint{endpoint}
+	if index >= 0 && index < len(ms.runtimeEndpoints) {
+		removed = append(removed, ms.runtimeEndpoints[index])
+		ms.runtimeEndpoints = append(ms.runtimeEndpoints[:index], ms.runtimeEndpoints[index+1:]...)
+	}
+
+	replaced := index >= 0
+	for i, existing := range ms.runtimeEndpoints {
+		if existing.Path == endpoint.Path && existing.Method == endpoint.Method {
+			ms.runtimeEndpoints = append(ms.runtimeEndpoints[:i], ms.runtimeEndpoints[i+1:]...)
+			replaced = true
+			break
+		}
+	}
+	ms.runtimeEndpoints = append(ms.runtimeEndpoints, endpoint)
+
+	if !ms.endpointEnabled(endpoint) || ms.tagDisabled(endpoint, "runtime") {
+		route = nil
+	}
+	ms.routes.replaceRuntime(route, removed...)
+	ms.pruneRouteState()
+	return replaced, nil
+}
+
+// removeRuntimeEndpoint removes the runtime endpoint at index, its route and
+// its state. Must be called with ms.mutex held.
+func (ms *MockServer) removeRuntimeEndpoint(index int) {
+	ep := ms.runtimeEndpoints[index]
+	ms.runtimeEndpoints = append(ms.runtimeEndpoints[:index], ms.runtimeEndpoints[index+1:]...)
+	ms.routes.removeRuntime(ep.Method, ep.Path)
+	ms.pruneRouteState()
+}
+
+// persistEndpoint changes the endpoints of the config file and reloads it.
+// The endpoint replaces the one with the ID id, or the one with its method
+// and path if id is empty, and is appended if none matches. A nil endpoint
+// removes the match. The rest of the file, secret references included, is
+// kept as written. It reports whether an endpoint matched.
+func (ms *MockServer) persistEndpoint(id string, endpoint *Endpoint) (bool, error) {
+	if ms.readOnly {
+		return false, errReadOnly
+	}
+	if endpoint != nil {
+		// Only the route is checked: compiling the handler would set up
+		// rate limiters and sequences before the endpoint is stored
+		if _, err := newEndpointRoute(endpoint.Method, endpoint.Path, nil); err != nil {
+			return false, err
+		}
+	}
+	ms.persistMutex.Lock()
+	defer ms.persistMutex.Unlock()
+
+	original, err := os.ReadFile(ms.configPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(original, &document); err != nil {
+		return false, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	var endpoints []json.RawMessage
+	if raw, ok := document["endpoints"]; ok {
+		if err := json.Unmarshal(raw, &endpoints); err != nil {
+			return false, fmt.Errorf("failed to parse config file: %v", err)
+		}
+	}
+
+	index := -1
+	for i, raw := range endpoints {
+		var ep struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Path   string `json:"path"`
+		}
+		json.Unmarshal(raw, &ep)
+		existing := Endpoint{ID: ep.ID, Method: ep.Method, Path: ep.Path}
+		if (id != "" && endpointID(existing) == id) ||
+			(id == "" && strings.EqualFold(ep.Method, endpoint.Method) && ep.Path == endpoint.Path) {
+			index = i
+			break
+		}
+	}
+	if index < 0 && (id != "" || endpoint == nil) {
+		return false, nil
+	}
+
+	switch {
+	case endpoint == nil:
+		endpoints = append(endpoints[:index], endpoints[index+1:]...)
+	default:
+		raw, err := json.Marshal(endpoint)
+		if err != nil {
+			return false, err
+		}
+		if index >= 0 {
+			endpoints[index] = raw
+		} else {
+			endpoints = append(endpoints, raw)
+		}
+	}
+	if document["endpoints"], err = json.Marshal(endpoints); err != nil {
+		return false, err
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	// Reload at once instead of waiting for the file watcher, and restore
+	// the file if the change makes it invalid
+	ms.reloadPaused.Store(true)
+	defer ms.reloadPaused.Store(false)
+	if err := writeFileAtomic(ms.configPath, data); err != nil {
+		return false, err
+	}
+	if err := ms.LoadConfig(); err != nil {
+		if restoreErr := writeFileAtomic(ms.configPath, original); restoreErr != nil {
+			log.Printf("Failed to restore config file: %v", restoreErr)
+		} else if reloadErr := ms.LoadConfig(); reloadErr != nil {
+			log.Printf("Failed to reload restored config file: %v", reloadErr)
+		}
+		return false, err
+	}
+	ms.SetupRoutes()
+	return index >= 0, nil
+}
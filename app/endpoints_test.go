@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEndpointsAPI tests creating, updating and removing runtime endpoints
+func TestEndpointsAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := call("POST", "/_admin/endpoints", `{"id": "users", "path": "/users", "method": "get", "response": "v1"}`); w.Code != 201 {
+		t.Fatalf("Expected the endpoint to be created, got %d %s", w.Code, w.Body.String())
+	}
+	call("POST", "/_admin/endpoints", `{"path": "/orders", "method": "GET", "response": "orders"}`)
+	if w := call("GET", "/users", ""); w.Body.String() != "v1" {
+		t.Errorf("Expected the created endpoint, got %s", w.Body.String())
+	}
+
+	// Updating may move the endpoint to another path
+	if w := call("PUT", "/_admin/endpoints/users", `{"id": "users", "path": "/people", "method": "GET", "response": "v2"}`); w.Code != 200 {
+		t.Fatalf("Expected the endpoint to be updated, got %d %s", w.Code, w.Body.String())
+	}
+	if w := call("GET", "/users", ""); w.Code != 404 {
+		t.Errorf("Expected the old path to be removed, got %d", w.Code)
+	}
+	if w := call("GET", "/people", ""); w.Body.String() != "v2" {
+		t.Errorf("Expected the updated endpoint, got %s", w.Body.String())
+	}
+	if w := call("PUT", "/_admin/endpoints/unknown", `{"path": "/x", "method": "GET"}`); w.Code != 404 {
+		t.Errorf("Expected an unknown endpoint to return 404, got %d", w.Code)
+	}
+	if w := call("PUT", "/_admin/endpoints/users", `{"path": "/x"}`); w.Code != 400 {
+		t.Errorf("Expected an invalid endpoint to be rejected, got %d", w.Code)
+	}
+
+	if w := call("DELETE", "/_admin/endpoints/users", ""); w.Code != 200 {
+		t.Errorf("Expected the endpoint to be removed, got %d", w.Code)
+	}
+	if w := call("GET", "/people", ""); w.Code != 404 {
+		t.Errorf("Expected the removed endpoint to return 404, got %d", w.Code)
+	}
+	if w := call("DELETE", "/_admin/endpoints/users", ""); w.Code != 404 {
+		t.Errorf("Expected removing twice to return 404, got %d", w.Code)
+	}
+
+	w := call("DELETE", "/_admin/endpoints", "")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"removed":1`) || len(server.runtimeEndpoints) != 0 {
+		t.Errorf("Expected all runtime endpoints to be removed, got %s", w.Body.String())
+	}
+	if w := call("GET", "/orders", ""); w.Code != 404 {
+		t.Errorf("Expected the cleared endpoint to return 404, got %d", w.Code)
+	}
+
+	// The state of removed endpoints is dropped with them
+	call("POST", "/_admin/endpoints", `{"id": "limited", "path": "/limited", "method": "GET", "rate_limit": {"requests": 1}}`)
+	call("GET", "/limited", "")
+	if len(server.rateLimiters) != 1 {
+		t.Fatalf("Expected the rate limiter of the endpoint, got %v", server.rateLimiters)
+	}
+	call("PUT", "/_admin/endpoints/limited", `{"id": "limited", "path": "/unlimited", "method": "GET"}`)
+	if len(server.rateLimiters) != 0 {
+		t.Errorf("Expected the rate limiter of the moved endpoint to be dropped, got %v", server.rateLimiters)
+	}
+	call("PUT", "/_admin/endpoints/limited", `{"id": "limited", "path": "/limited", "method": "GET", "rate_limit": {"requests": 1}}`)
+	call("DELETE", "/_admin/endpoints/limited", "")
+	if len(server.rateLimiters) != 0 {
+		t.Errorf("Expected the rate limiter of the removed endpoint to be dropped, got %v", server.rateLimiters)
+	}
+}
+
+// TestPersistEndpoints tests writing endpoint changes to the config file
+func TestPersistEndpoints(t *testing.T) {
+	t.Setenv("NMOCK_TEST_KEY", "s3cret")
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	os.WriteFile(configPath, []byte(`{
+  "port": "9000",
+  "plugins_dir": "`+filepath.Join(dir, "plugins")+`",
+  "endpoints": [
+    {"path": "/users", "method": "GET", "response": "users", "headers": {"X-Key": {"$secret": "NMOCK_TEST_KEY"}}}
+  ]
+}`), 0644)
+
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	fileEndpoints := func() []map[string]interface{} {
+		data, _ := os.ReadFile(configPath)
+		var config struct {
+			Endpoints []map[string]interface{} `json:"endpoints"`
+		}
+		json.Unmarshal(data, &config)
+		return config.Endpoints
+	}
+
+	if w := call("POST", "/_admin/endpoints?persist=true", `{"path": "/orders", "method": "post", "status_code": 201}`); w.Code != 201 {
+		t.Fatalf("Expected the endpoint to be persisted, got %d %s", w.Code, w.Body.String())
+	}
+	if w := call("POST", "/orders", ""); w.Code != 201 {
+		t.Errorf("Expected the persisted endpoint to be served at once, got %d", w.Code)
+	}
+	if endpoints := fileEndpoints(); len(endpoints) != 2 || !strings.Contains(fmt.Sprint(endpoints[0]["headers"]), "$secret") || endpoints[1]["method"] != "POST" {
+		t.Errorf("Unexpected endpoints in the config file: %v", endpoints)
+	}
+	if len(server.runtimeEndpoints) != 0 {
+		t.Errorf("Expected no runtime endpoints, got %v", server.runtimeEndpoints)
+	}
+
+	id := endpointID(Endpoint{Method: "GET", Path: "/users"})
+	if w := call("PUT", "/_admin/endpoints/"+id+"?persist=true", `{"path": "/users", "method": "GET", "response": "updated"}`); w.Code != 200 {
+		t.Fatalf("Expected the file endpoint to be updated, got %d %s", w.Code, w.Body.String())
+	}
+	if w := call("GET", "/users", ""); w.Body.String() != "updated" {
+		t.Errorf("Expected the updated endpoint, got %s", w.Body.String())
+	}
+
+	// Invalid endpoints are rejected, and a change that makes the file
+	// invalid is rolled back
+	call("POST", "/_admin/endpoints?persist=true", `{"id": "health", "path": "/health", "method": "GET"}`)
+	before, _ := os.ReadFile(configPath)
+	if w := call("POST", "/_admin/endpoints?persist=true", `{"path": "/bad/{id", "method": "GET"}`); w.Code != 400 {
+		t.Errorf("Expected an invalid endpoint to be rejected, got %d", w.Code)
+	}
+	if w := call("POST", "/_admin/endpoints?persist=true", `{"id": "health", "path": "/status", "method": "GET", "rate_limit": {"requests": 1}}`); w.Code != 400 {
+		t.Errorf("Expected a duplicate ID to be rejected, got %d", w.Code)
+	}
+	if _, ok := server.rateLimiters["GET /status"]; ok {
+		t.Error("Expected the rejected endpoint not to set up a rate limiter")
+	}
+	if after, _ := os.ReadFile(configPath); string(after) != string(before) {
+		t.Errorf("Expected the config file to be restored, got %s", after)
+	}
+
+	if w := call("DELETE", "/_admin/endpoints/"+id+"?persist=true", ""); w.Code != 200 {
+		t.Errorf("Expected the file endpoint to be removed, got %d", w.Code)
+	}
+	if w := call("GET", "/users", ""); w.Code != 404 {
+		t.Errorf("Expected the removed endpoint to return 404, got %d", w.Code)
+	}
+	if endpoints := fileEndpoints(); len(endpoints) != 2 || endpoints[0]["path"] != "/orders" {
+		t.Errorf("Unexpected endpoints in the config file: %v", endpoints)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// settings are the values that command line flags and environment variables
+// override. Empty values leave the configuration file alone.
+type settings struct {
+	ConfigPath string
+	Port       string
+	PluginsDir string
+	ReadOnly   bool
+	TLSAuto    bool
+	Seed       string
+
+	NoRouteSummary bool
+}
+
+// settingEnv maps environment variables to settings
+var settingEnv = map[string]func(*settings, string) error{
+	"NMOCK_CONFIG":      func(s *settings, v string) error { s.ConfigPath = v; return nil },
+	"NMOCK_PORT":        func(s *settings, v string) error { s.Port = v; return nil },
+	"NMOCK_PLUGINS_DIR": func(s *settings, v string) error { s.PluginsDir = v; return nil },
+	"NMOCK_READ_ONLY":   boolSetting("NMOCK_READ_ONLY", func(s *settings) *bool { return &s.ReadOnly }),
+	"NMOCK_TLS_AUTO":    boolSetting("NMOCK_TLS_AUTO", func(s *settings) *bool { return &s.TLSAuto }),
+	"NMOCK_SEED": func(s *settings, v string) error {
+		if _, err := parseSeed(v); err != nil {
+			return fmt.Errorf("invalid NMOCK_SEED %q, expected an integer", v)
+		}
+		s.Seed = v
+		return nil
+	},
+	"NMOCK_NO_ROUTE_SUMMARY": boolSetting("NMOCK_NO_ROUTE_SUMMARY", func(s *settings) *bool { return &s.NoRouteSummary }),
+}
+
+// parseSeed parses a random seed given as a flag or environment variable
+func parseSeed(v string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+}
+
+// boolSetting parses a boolean environment variable into a setting
+func boolSetting(name string, field func(*settings) *bool) func(*settings, string) error {
+	return func(s *settings, v string) error {
+		value, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q, expected true or false", name, v)
+		}
+		*field(s) = value
+		return nil
+	}
+}
+
+// parseDotEnv parses KEY=VALUE lines of a .env file. Blank lines, comments
+// and an "export " prefix are allowed, and values may be quoted.
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", number)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value: %v", number, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// Unquoted values end at a comment
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// loadDotEnv sets the variables of a .env file that aren't already set in
+// the environment. A missing file is not an error.
+func loadDotEnv(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer file.Close()
+
+	values, err := parseDotEnv(file)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", path, err)
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// envSettings reads the settings given as environment variables
+func envSettings() (settings, error) {
+	var s settings
+	for name, set := range settingEnv {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			if err := set(&s, value); err != nil {
+				return s, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// override returns the settings with the non-empty values of other taking
+// precedence
+func (s settings) override(other settings) settings {
+	if other.ConfigPath != "" {
+		s.ConfigPath = other.ConfigPath
+	}
+	if other.Port != "" {
+		s.Port = other.Port
+	}
+	if other.PluginsDir != "" {
+		s.PluginsDir = other.PluginsDir
+	}
+	if other.Seed != "" {
+		s.Seed = other.Seed
+	}
+	s.ReadOnly = s.ReadOnly || other.ReadOnly
+	s.TLSAuto = s.TLSAuto || other.TLSAuto
+	s.NoRouteSummary = s.NoRouteSummary || other.NoRouteSummary
+	return s
+}
+
+// apply overrides the values of a configuration file
+func (s settings) apply(config *Config) {
+	if s.Port != "" {
+		config.Port = s.Port
+	}
+	if s.PluginsDir != "" {
+		config.PluginsDir = s.PluginsDir
+	}
+	if s.Seed != "" {
+		if seed, err := parseSeed(s.Seed); err == nil {
+			config.Seed = &seed
+		}
+	}
+	if s.TLSAuto {
+		// Certificate files give way to a generated certificate, whose
+		// hosts may still come from the file
+		tls := &TLSConfig{Auto: true}
+		if config.TLS != nil && config.TLS.Auto {
+			tls.Hosts = config.TLS.Hosts
+		}
+		config.TLS = tls
+	}
+}
+
+// resolveSettings combines flags, the environment and a .env file, in this
+// order of precedence
+func resolveSettings(flagSettings settings, envFile string) (settings, error) {
+	if err := loadDotEnv(envFile); err != nil {
+		return settings{}, err
+	}
+	s, err := envSettings()
+	if err != nil {
+		return settings{}, err
+	}
+	s = s.override(flagSettings)
+	if s.ConfigPath == "" {
+		s.ConfigPath = "config.json"
+	}
+	return s, nil
+}
+
+// runConfig implements the config command and returns the exit code
+func runConfig(args []string, stdout io.Writer) int {
+	if len(args) == 0 || args[0] != "resolve" {
+		fmt.Fprintln(os.Stderr, "Usage: nmock config resolve [--config FILE] [--env-file FILE] [--port PORT] [--plugins-dir DIR]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config resolve", flag.ContinueOnError)
+	configPath := flags.String("config", "", "Path to configuration file (default: config.json)")
+	envFile := flags.String("env-file", ".env", "File with environment variables to load")
+	port := flags.String("port", "", "Port to listen on")
+	pluginsDir := flags.String("plugins-dir", "", "Directory of plugin files")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	s, err := resolveSettings(settings{ConfigPath: *configPath, Port: *port, PluginsDir: *pluginsDir}, *envFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 1
+	}
+
+	ms := NewMockServer(s.ConfigPath)
+	ms.settings = s
+	config, err := ms.readConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 1
+	}
+
+	// Secrets are printed as references
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 1
+	}
+	stdout.Write(append(ms.secrets.redactJSON(data), '\n'))
+	return 0
+}
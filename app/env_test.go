@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseDotEnv tests reading .env files
+func TestParseDotEnv(t *testing.T) {
+	values, err := parseDotEnv(strings.NewReader(`
+# comment
+NMOCK_PORT=8080
+export API_KEY="line\nbreak"
+SINGLE='kept #as is'
+INLINE=value # comment
+EMPTY=
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	expected := map[string]string{"NMOCK_PORT": "8080", "API_KEY": "line\nbreak", "SINGLE": "kept #as is", "INLINE": "value", "EMPTY": ""}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, values[key])
+		}
+	}
+
+	if _, err := parseDotEnv(strings.NewReader("not a variable")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected an error for line 1, got %v", err)
+	}
+}
+
+// TestConfigResolve tests the precedence of flags, environment, .env file
+// and configuration file
+func TestConfigResolve(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	os.WriteFile(configPath, []byte(`{"port": "7000", "plugins_dir": "from-config", "admin_tokens": [{"name": "ops", "token": {"$secret": "NMOCK_TEST_TOKEN"}, "role": "admin"}]}`), 0644)
+	envFile := filepath.Join(dir, ".env")
+	os.WriteFile(envFile, []byte("NMOCK_PORT=7100\nNMOCK_PLUGINS_DIR=from-dotenv\nNMOCK_TEST_TOKEN=token-from-dotenv\n"), 0644)
+
+	// Variables set by .env files leak into the test process
+	for _, name := range []string{"NMOCK_PORT", "NMOCK_PLUGINS_DIR", "NMOCK_TEST_TOKEN"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	t.Setenv("NMOCK_PLUGINS_DIR", "from-env")
+
+	var stdout bytes.Buffer
+	if code := runConfig([]string{"resolve", "--config", configPath, "--env-file", envFile, "--port", "7200"}, &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var config struct {
+		Port       string `json:"port"`
+		PluginsDir string `json:"plugins_dir"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &config); err != nil {
+		t.Fatalf("Failed to parse output: %v\n%s", err, stdout.String())
+	}
+	if config.Port != "7200" || config.PluginsDir != "from-env" {
+		t.Errorf("Expected the flag port and the environment plugins dir, got %q and %q", config.Port, config.PluginsDir)
+	}
+	if strings.Contains(stdout.String(), "token-from-dotenv") || !strings.Contains(stdout.String(), `{"$secret":"NMOCK_TEST_TOKEN"}`) {
+		t.Errorf("Expected the secret from .env to be printed as a reference, got %s", stdout.String())
+	}
+
+	// Without flags, variables or .env file, the configuration file applies
+	os.Unsetenv("NMOCK_PLUGINS_DIR")
+	os.Unsetenv("NMOCK_PORT")
+	s, err := resolveSettings(settings{ConfigPath: configPath}, filepath.Join(dir, "missing.env"))
+	if err != nil {
+		t.Fatalf("Failed to resolve settings: %v", err)
+	}
+	if s.Port != "" || s.PluginsDir != "" {
+		t.Errorf("Expected no overrides, got %+v", s)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// itemETag returns the entity tag of a resource item, a hash of its fields,
+// so that it changes whenever the item does
+func itemETag(item resourceItem) string {
+	data, _ := json.Marshal(item)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists an
+// entity tag. Weak tags only match with weak comparison, as used by
+// If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions evaluates If-Match for a change of an item, so that
+// clients can't overwrite changes they haven't seen. It writes 412 for a
+// stale entity tag, or 428 without If-Match if the resource requires it,
+// and returns the status written, or 0 if the change may proceed.
+func (c *collection) checkPreconditions(w http.ResponseWriter, r *http.Request, item resourceItem) int {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if c.config.RequireIfMatch {
+			c.writeError(w, http.StatusPreconditionRequired, "If-Match header required")
+			return http.StatusPreconditionRequired
+		}
+		return 0
+	}
+	if etag := itemETag(item); !etagMatches(header, etag, false) {
+		w.Header().Set("ETag", etag)
+		c.writeError(w, http.StatusPreconditionFailed, "Item has been modified")
+		return http.StatusPreconditionFailed
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResourceETags tests optimistic concurrency with ETag and If-Match
+func TestResourceETags(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	err := server.resources.configure([]Resource{
+		{Name: "users", Path: "/api/users", Seed: []map[string]interface{}{{"id": float64(1), "name": "Alice"}}},
+		{Name: "orders", Path: "/api/orders", RequireIfMatch: true, Seed: []map[string]interface{}{{"id": float64(1), "total": float64(10)}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call("GET", "/api/users/1", "", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || len(etag) != 18 || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("Expected an entity tag, got %d %q", w.Code, etag)
+	}
+	if w := call("GET", "/api/users/1", "", map[string]string{"If-None-Match": "W/" + etag}); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("Expected an unchanged item to be not modified, got %d", w.Code)
+	}
+
+	// Two clients update the item they read: the second one is stale
+	w = call("PATCH", "/api/users/1", `{"name": "Alicia"}`, map[string]string{"If-Match": etag})
+	updated := w.Header().Get("ETag")
+	if w.Code != 200 || updated == "" || updated == etag {
+		t.Fatalf("Expected the update to succeed with a new entity tag, got %d %q", w.Code, updated)
+	}
+	w = call("PUT", "/api/users/1", `{"name": "Ali"}`, map[string]string{"If-Match": etag})
+	if w.Code != 412 || w.Header().Get("ETag") != updated {
+		t.Errorf("Expected a stale update to fail with the current entity tag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	if w := call("GET", "/api/users/1", "", nil); !strings.Contains(w.Body.String(), "Alicia") {
+		t.Errorf("Expected the stale update not to be applied, got %s", w.Body.String())
+	}
+	if w := call("DELETE", "/api/users/1", "", map[string]string{"If-Match": `W/` + updated}); w.Code != 412 {
+		t.Errorf("Expected weak entity tags not to match If-Match, got %d", w.Code)
+	}
+	if w := call("DELETE", "/api/users/1", "", map[string]string{"If-Match": `"other", ` + updated}); w.Code != 204 {
+		t.Errorf("Expected a listed entity tag to match, got %d", w.Code)
+	}
+
+	// Resources can require If-Match for changes
+	if w := call("DELETE", "/api/orders/1", "", nil); w.Code != 428 {
+		t.Errorf("Expected a change without If-Match to be rejected, got %d", w.Code)
+	}
+	if w := call("PATCH", "/api/orders/1", `{"total": 20}`, map[string]string{"If-Match": "*"}); w.Code != 200 {
+		t.Errorf("Expected If-Match: * to match an existing item, got %d", w.Code)
+	}
+	if w := call("POST", "/api/orders", `{"total": 30}`, nil); w.Code != 201 || w.Header().Get("ETag") == "" {
+		t.Errorf("Expected created items to carry an entity tag, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Expectation is a requirement on the requests received during a run, e.g.
+// that /api/pay is called at least once with an Idempotency-Key header
+type Expectation struct {
+	Name     string            `json:"name,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Path     string            `json:"path,omitempty"`     // exact path or glob pattern such as /api/*
+	Endpoint string            `json:"endpoint,omitempty"` // ID of the endpoint answering the calls
+	Headers  map[string]string `json:"headers,omitempty"`  // required headers; an empty value accepts any value
+	MinCalls *int              `json:"min_calls,omitempty"`
+	MaxCalls *int              `json:"max_calls,omitempty"`
+}
+
+// Expectation statuses
+const (
+	ExpectationMet     = "met"
+	ExpectationPending = "pending" // not called often enough yet
+	ExpectationFailed  = "failed"  // called too often
+)
+
+// expectationResult is the current state of an expectation
+type expectationResult struct {
+	Expectation
+	Calls  int    `json:"calls"`
+	Status string `json:"status"`
+}
+
+// expectations counts the requests matching each expectation
+type expectations struct {
+	mutex   sync.Mutex
+	results []expectationResult
+}
+
+// newExpectations creates a tracker without expectations
+func newExpectations() *expectations {
+	return &expectations{}
+}
+
+// validate checks the fields of an expectation
+func (e Expectation) validate() error {
+	if e.Path == "" && e.Endpoint == "" {
+		return fmt.Errorf("path or endpoint is required")
+	}
+	if _, err := path.Match(e.Path, "/"); err != nil {
+		return fmt.Errorf("invalid path pattern: %v", err)
+	}
+	if e.MinCalls != nil && e.MaxCalls != nil && *e.MinCalls > *e.MaxCalls {
+		return fmt.Errorf("min_calls is greater than max_calls")
+	}
+	return nil
+}
+
+// String describes an expectation by its name or by what it matches
+func (e Expectation) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	if e.Path == "" {
+		return "endpoint " + e.Endpoint
+	}
+	method := e.Method
+	if method == "" {
+		method = "ANY"
+	}
+	return strings.ToUpper(method) + " " + e.Path
+}
+
+// matches reports whether a recorded request counts for the expectation
+func (e Expectation) matches(entry historyEntry) bool {
+	filter := historyFilter{method: strings.ToUpper(e.Method), path: e.Path, endpoint: e.Endpoint}
+	if !filter.matches(entry) {
+		return false
+	}
+	for key, value := range e.Headers {
+		values, exists := entry.RequestHeaders[http.CanonicalHeaderKey(key)]
+		if !exists || (value != "" && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// status evaluates the expectation for a number of calls. Without
+// min_calls, an expectation requires at least one call unless it only sets
+// an upper bound.
+func (e Expectation) status(calls int) string {
+	minCalls := 1
+	if e.MinCalls != nil {
+		minCalls = *e.MinCalls
+	} else if e.MaxCalls != nil {
+		minCalls = 0
+	}
+	switch {
+	case e.MaxCalls != nil && calls > *e.MaxCalls:
+		return ExpectationFailed
+	case calls < minCalls:
+		return ExpectationPending
+	}
+	return ExpectationMet
+}
+
+// configure replaces the expectations. Calls counted for expectations that
+// are unchanged are kept, so that a config reload doesn't reset them.
+func (ex *expectations) configure(definitions []Expectation) error {
+	for i, expectation := range definitions {
+		if err := expectation.validate(); err != nil {
+			return fmt.Errorf("invalid expectation %d (%s): %v", i, expectation, err)
+		}
+	}
+
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+
+	previous := make(map[string]int)
+	for _, result := range ex.results {
+		key, _ := json.Marshal(result.Expectation)
+		previous[string(key)] = result.Calls
+	}
+
+	ex.results = make([]expectationResult, 0, len(definitions))
+	for _, expectation := range definitions {
+		key, _ := json.Marshal(expectation)
+		calls := previous[string(key)]
+		ex.results = append(ex.results, expectationResult{Expectation: expectation, Calls: calls, Status: expectation.status(calls)})
+	}
+	return nil
+}
+
+// observe counts a recorded request for the expectations it matches
+func (ex *expectations) observe(entry historyEntry) {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+
+	for i := range ex.results {
+		result := &ex.results[i]
+		if result.matches(entry) {
+			result.Calls++
+			result.Status = result.status(result.Calls)
+		}
+	}
+}
+
+// list returns the current state of the expectations
+func (ex *expectations) list() []expectationResult {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+	return append([]expectationResult{}, ex.results...)
+}
+
+// reset sets the calls of all expectations back to zero
+func (ex *expectations) reset() {
+	ex.mutex.Lock()
+	defer ex.mutex.Unlock()
+
+	for i := range ex.results {
+		ex.results[i].Calls = 0
+		ex.results[i].Status = ex.results[i].status(0)
+	}
+}
+
+// verify logs the expectations that are not met and reports whether all are
+func (ex *expectations) verify() bool {
+	ok := true
+	for _, result := range ex.list() {
+		if result.Status != ExpectationMet {
+			log.Printf("Expectation %s %s: called %d times", result.Expectation, result.Status, result.Calls)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// setupExpectationsAPI registers the expectations admin API
+func (ms *MockServer) setupExpectationsAPI() {
+	// Current state of the expectations
+	ms.router.HandleFunc("/_admin/expectations", func(w http.ResponseWriter, r *http.Request) {
+		results := ms.expectations.list()
+		met := true
+		for _, result := range results {
+			met = met && result.Status == ExpectationMet
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"met": met, "expectations": results})
+	}).Methods("GET")
+
+	// Reset the counted calls, e.g. between test suites
+	ms.router.HandleFunc("/_admin/expectations", func(w http.ResponseWriter, r *http.Request) {
+		ms.expectations.reset()
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+}
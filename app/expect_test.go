@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExpectations tests counting requests against expectations and reporting them
+func TestExpectations(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	writeConfig(`{
+		"plugins_dir": "` + filepath.Join(dir, "plugins") + `",
+		"endpoints": [{"path": "/api/pay", "method": "POST", "response": "paid"}],
+		"expectations": [
+			{"name": "payment", "method": "post", "path": "/api/pay", "headers": {"idempotency-key": ""}},
+			{"path": "/api/legacy/*", "max_calls": 0}
+		]
+	}`)
+
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.SetupRoutes()
+
+	status := func() (bool, []expectationResult) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/expectations", nil))
+		var response struct {
+			Met          bool                `json:"met"`
+			Expectations []expectationResult `json:"expectations"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse expectations: %v", err)
+		}
+		return response.Met, response.Expectations
+	}
+
+	// A call without the header doesn't count
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/pay", nil))
+	if met, results := status(); met || results[0].Calls != 0 || results[0].Status != ExpectationPending || results[1].Status != ExpectationMet {
+		t.Errorf("Expected the payment expectation to be pending, got %+v", results)
+	}
+
+	req := httptest.NewRequest("POST", "/api/pay", nil)
+	req.Header.Set("Idempotency-Key", "abc")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	if met, results := status(); !met || results[0].Calls != 1 {
+		t.Errorf("Expected all expectations to be met, got %+v", results)
+	}
+	if !server.expectations.verify() {
+		t.Error("Expected verify to succeed")
+	}
+
+	// Reloading the configuration keeps the calls of unchanged expectations
+	writeConfig(strings.Replace(mustReadFile(t, configPath), `"max_calls": 0`, `"max_calls": 1`, 1))
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/legacy/orders", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/api/legacy/users", nil))
+	if met, results := status(); met || results[0].Calls != 1 || results[1].Calls != 2 || results[1].Status != ExpectationFailed {
+		t.Errorf("Expected the legacy expectation to fail after 2 calls, got %+v", results)
+	}
+	if server.expectations.verify() {
+		t.Error("Expected verify to fail")
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/_admin/expectations", nil))
+	if _, results := status(); w.Code != 204 || results[0].Calls != 0 || results[1].Status != ExpectationMet {
+		t.Errorf("Expected the calls to be reset, got %d %+v", w.Code, results)
+	}
+
+	// Invalid expectations are rejected
+	writeConfig(`{"expectations": [{"path": "/api/[", "method": "GET"}]}`)
+	if err := server.LoadConfig(); err == nil || !strings.Contains(err.Error(), "GET /api/[") {
+		t.Errorf("Expected an invalid path pattern error, got %v", err)
+	}
+}
+
+// mustReadFile reads a file or fails the test
+func mustReadFile(t *testing.T, file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", file, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyFilter selects request history entries to export
+type historyFilter struct {
+	from   time.Time
+	to     time.Time
+	method string
+	path   string // exact path or glob pattern such as /api/*
+	status string // exact status code or class such as 4xx
+	tag    string // tag name, value or "name:value" of the endpoint
+
+	endpoint string // endpoint ID
+}
+
+// parseHistoryFilter reads filters from query parameters
+func parseHistoryFilter(query url.Values) (historyFilter, error) {
+	filter := historyFilter{
+		method: strings.ToUpper(query.Get("method")),
+		path:   query.Get("path"),
+		status: strings.ToLower(query.Get("status")),
+		tag:    query.Get("tag"),
+
+		endpoint: query.Get("endpoint"),
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.from, "to": &filter.to} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s time, expected RFC 3339: %v", name, err)
+		}
+		*target = parsed
+	}
+
+	if filter.path != "" {
+		if _, err := path.Match(filter.path, "/"); err != nil {
+			return filter, fmt.Errorf("invalid path pattern: %v", err)
+		}
+	}
+
+	if filter.status != "" {
+		valid := len(filter.status) == 3 && strings.HasSuffix(filter.status, "xx") && filter.status[0] >= '1' && filter.status[0] <= '5'
+		if _, err := strconv.Atoi(filter.status); err == nil {
+			valid = true
+		}
+		if !valid {
+			return filter, fmt.Errorf("invalid status %q, expected a code such as 404 or a class such as 4xx", filter.status)
+		}
+	}
+
+	return filter, nil
+}
+
+// matches reports whether an entry passes the filter
+func (f historyFilter) matches(entry historyEntry) bool {
+	if !f.from.IsZero() && entry.StartedAt.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && entry.StartedAt.After(f.to) {
+		return false
+	}
+	if f.method != "" && entry.Method != f.method {
+		return false
+	}
+	if f.path != "" {
+		if matched, _ := path.Match(f.path, entry.Path); !matched {
+			return false
+		}
+	}
+	if f.tag != "" && !matchTag(entry.Tags, f.tag) {
+		return false
+	}
+	if f.endpoint != "" && entry.EndpointID != f.endpoint {
+		return false
+	}
+	if f.status != "" {
+		code := strconv.Itoa(entry.StatusCode)
+		if strings.HasSuffix(f.status, "xx") {
+			return code[0] == f.status[0]
+		}
+		return code == f.status
+	}
+	return true
+}
+
+// apply returns the entries passing the filter
+func (f historyFilter) apply(entries []historyEntry) []historyEntry {
+	var result []historyEntry
+	for _, entry := range entries {
+		if f.matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// exportRecord is the flat representation of a history entry used by the
+// CSV and JSON Lines exports
+type exportRecord struct {
+	ID           int     `json:"id"`
+	StartedAt    string  `json:"started_at"`
+	DurationMs   float64 `json:"duration_ms"`
+	IP           string  `json:"ip"`
+	Method       string  `json:"method"`
+	URL          string  `json:"url"`
+	StatusCode   int     `json:"status_code"`
+	Route        string  `json:"route"`
+	Source       string  `json:"source"`
+	EndpointID   string  `json:"endpoint_id"`
+	RequestBody  string  `json:"request_body"`
+	ResponseBody string  `json:"response_body"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// exportColumns are the CSV columns, in the order of exportRecord
+var exportColumns = []string{"id", "started_at", "duration_ms", "ip", "method", "url", "status_code", "route", "source", "endpoint_id", "request_body", "response_body"}
+
+// newExportRecord flattens a history entry
+func newExportRecord(entry historyEntry) exportRecord {
+	return exportRecord{
+		ID:           entry.ID,
+		StartedAt:    entry.StartedAt.Format(time.RFC3339Nano),
+		DurationMs:   float64(entry.Duration) / float64(time.Millisecond),
+		IP:           entry.IP,
+		Method:       entry.Method,
+		URL:          entry.URL,
+		StatusCode:   entry.StatusCode,
+		Route:        entry.Route,
+		Source:       entry.Source,
+		EndpointID:   entry.EndpointID,
+		RequestBody:  string(entry.RequestBody),
+		ResponseBody: string(entry.ResponseBody),
+		Tags:         entry.Tags,
+	}
+}
+
+// writeCSV exports history entries as CSV with a header row
+func writeCSV(w io.Writer, entries []historyEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write(exportColumns)
+	for _, entry := range entries {
+		record := newExportRecord(entry)
+		writer.Write([]string{
+			strconv.Itoa(record.ID),
+			record.StartedAt,
+			strconv.FormatFloat(record.DurationMs, 'f', 3, 64),
+			record.IP,
+			record.Method,
+			record.URL,
+			strconv.Itoa(record.StatusCode),
+			record.Route,
+			record.Source,
+			record.EndpointID,
+			record.RequestBody,
+			record.ResponseBody,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSONLines exports history entries as one JSON object per line
+func writeJSONLines(w io.Writer, entries []historyEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(newExportRecord(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportHistory writes the request history in the requested format
+func exportHistory(w http.ResponseWriter, r *http.Request, entries []historyEntry) {
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	entries = filter.apply(entries)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "har":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="nmock.har"`)
+		json.NewEncoder(w).Encode(buildHAR(entries))
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="nmock-requests.csv"`)
+		writeCSV(w, entries)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="nmock-requests.jsonl"`)
+		writeJSONLines(w, entries)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Unsupported export format: %s", format)})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHistoryFilter tests filtering the request history
+func TestHistoryFilter(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []historyEntry{
+		{ID: 1, StartedAt: base, Method: "GET", Path: "/api/users", StatusCode: 200, EndpointID: "list-users"},
+		{ID: 2, StartedAt: base.Add(time.Hour), Method: "POST", Path: "/api/users", StatusCode: 201},
+		{ID: 3, StartedAt: base.Add(2 * time.Hour), Method: "GET", Path: "/api/orders/1", StatusCode: 404},
+		{ID: 4, StartedAt: base.Add(3 * time.Hour), Method: "GET", Path: "/health", StatusCode: 503},
+	}
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"", []int{1, 2, 3, 4}},
+		{"status=2xx", []int{1, 2}},
+		{"status=404", []int{3}},
+		{"method=get", []int{1, 3, 4}},
+		{"path=/api/users", []int{1, 2}},
+		{"path=/api/*/*", []int{3}},
+		{"endpoint=list-users", []int{1}},
+		{"from=2024-01-01T12:30:00Z&to=2024-01-01T14:00:00Z", []int{2, 3}},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/?"+test.query, nil)
+		filter, err := parseHistoryFilter(req.URL.Query())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.query, err)
+			continue
+		}
+		var ids []int
+		for _, entry := range filter.apply(entries) {
+			ids = append(ids, entry.ID)
+		}
+		if len(ids) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.query, test.expected, ids)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"status=abc", "status=6xx", "from=yesterday", "path=["} {
+		req := httptest.NewRequest("GET", "/?"+query, nil)
+		if _, err := parseHistoryFilter(req.URL.Query()); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+// TestHistoryExportFormats tests CSV and JSON Lines exports
+func TestHistoryExportFormats(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Method: "GET", Response: "a,\"b\"\nc"},
+		},
+	}
+	server.SetupRoutes()
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/missing", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=csv&status=2xx", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Expected CSV content type, got %s", w.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "id" || rows[1][4] != "GET" || rows[1][9] != endpointID(Endpoint{Method: "GET", Path: "/api/users"}) || rows[1][11] != "a,\"b\"\nc" {
+		t.Errorf("Unexpected CSV rows: %q", rows)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=jsonl", nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got %d", len(lines))
+	}
+	var record exportRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record.StatusCode != 404 {
+		t.Errorf("Unexpected JSON line %s (%v)", lines[1], err)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=csv&status=abc", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid filter, got %d", w.Code)
+	}
+}
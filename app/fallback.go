@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/gorilla/mux"
+)
+
+// ResponseSpec represents a static response definition
+type ResponseSpec struct {
+	StatusCode int               `json:"status_code,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Response   interface{}       `json:"response,omitempty"`
+}
+
+// DefaultResponse represents the answer given to requests that match no
+// endpoint, optionally scoped by path prefix
+type DefaultResponse struct {
+	ResponseSpec
+	PathPrefixes map[string]ResponseSpec `json:"path_prefixes,omitempty"`
+}
+
+// isSet reports whether the response has been configured
+func (spec ResponseSpec) isSet() bool {
+	return spec.StatusCode != 0 || spec.Response != nil || len(spec.Headers) > 0
+}
+
+// compiledResponse is a ResponseSpec with its body checked as a template
+type compiledResponse struct {
+	statusCode  int
+	headers     map[string]string
+	contentType string
+	body        []byte
+	templates   *responseTemplates
+}
+
+// compileResponse prepares a ResponseSpec for rendering. The body is treated
+// as a Go template with access to the request (e.g. {{.Path}}). As with
+// response_template, each string of a JSON body is a template whose result
+// is encoded as a JSON string, so request values can't break the body.
+func (ms *MockServer) compileResponse(spec ResponseSpec, defaultStatus int) (*compiledResponse, error) {
+	cr := &compiledResponse{
+		statusCode:  spec.StatusCode,
+		headers:     spec.Headers,
+		contentType: ms.serverContentType(),
+	}
+	if cr.statusCode == 0 {
+		cr.statusCode = defaultStatus
+	}
+
+	if spec.Response != nil {
+		body, ok := spec.Response.(string)
+		if !ok {
+			data, err := json.Marshal(spec.Response)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal response: %v", err)
+			}
+			body = string(data)
+		}
+
+		cr.body = []byte(body)
+		texts := []string{body}
+		if isJSONBody(cr.body) {
+			texts = jsonTemplateStrings(cr.body)
+		}
+		for _, text := range texts {
+			if _, err := template.New("response").Funcs(responseTemplateFuncs).Parse(text); err != nil {
+				return nil, fmt.Errorf("invalid response template: %v", err)
+			}
+		}
+		cr.templates = &responseTemplates{}
+	}
+
+	return cr, nil
+}
+
+// write renders the response for the given request
+func (cr *compiledResponse) write(w http.ResponseWriter, r *http.Request) {
+	for key, value := range cr.headers {
+		w.Header().Set(key, value)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", cr.contentType)
+	}
+
+	var body []byte
+	if cr.templates != nil {
+		var err error
+		if body, err = cr.templates.render(r, cr.body); err != nil {
+			log.Printf("Failed to render response for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
+
+	w.WriteHeader(cr.statusCode)
+	w.Write(body)
+}
+
+// notFoundHandler returns the handler for requests that match no route
+func (ms *MockServer) notFoundHandler() http.Handler {
+	var custom *compiledResponse
+	if ms.config.NotFound != nil {
+		var err error
+		if custom, err = ms.compileResponse(*ms.config.NotFound, http.StatusNotFound); err != nil {
+			log.Printf("Invalid not_found response, using default: %v", err)
+		}
+	}
+
+	defaults := ms.compileDefaultResponses()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms.notifier.notify(EventUnmatchedRequest, fmt.Sprintf("Unmatched request: %s %s", r.Method, r.URL.Path),
+			map[string]string{"method": r.Method, "path": r.URL.Path, "ip": clientIP(r)})
+
+		if response := defaults.lookup(r.URL.Path); response != nil {
+			response.write(w, r)
+			log.Printf("%s %s - %d [default]", r.Method, r.URL.Path, response.statusCode)
+			return
+		}
+
+		if custom != nil {
+			custom.write(w, r)
+			log.Printf("%s %s - %d (Not Found)", r.Method, r.URL.Path, custom.statusCode)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Endpoint not found",
+			"path":  r.URL.Path,
+		})
+		log.Printf("%s %s - 404 (Not Found)", r.Method, r.URL.Path)
+	})
+}
+
+// defaultResponses holds the compiled default responses
+type defaultResponses struct {
+	global   *compiledResponse
+	prefixes map[string]*compiledResponse
+}
+
+// compileDefaultResponses compiles the configured default responses
+func (ms *MockServer) compileDefaultResponses() *defaultResponses {
+	defaults := &defaultResponses{prefixes: make(map[string]*compiledResponse)}
+	if ms.config.DefaultResponse == nil {
+		return defaults
+	}
+
+	if ms.config.DefaultResponse.isSet() {
+		response, err := ms.compileResponse(ms.config.DefaultResponse.ResponseSpec, http.StatusOK)
+		if err != nil {
+			log.Printf("Invalid default_response: %v", err)
+		} else {
+			defaults.global = response
+		}
+	}
+
+	for prefix, spec := range ms.config.DefaultResponse.PathPrefixes {
+		response, err := ms.compileResponse(spec, http.StatusOK)
+		if err != nil {
+			log.Printf("Invalid default_response for prefix %s: %v", prefix, err)
+			continue
+		}
+		defaults.prefixes[prefix] = response
+	}
+
+	return defaults
+}
+
+// lookup returns the default response for a path, preferring the longest
+// matching prefix, or nil if none applies
+func (d *defaultResponses) lookup(path string) *compiledResponse {
+	var match *compiledResponse
+	longest := -1
+	for prefix, response := range d.prefixes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			match, longest = response, len(prefix)
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return d.global
+}
+
+// methodNotAllowedHandler returns the handler for requests whose path matches
+// a route but whose method does not. The Allow header lists the valid methods.
+func (ms *MockServer) methodNotAllowedHandler() http.Handler {
+	var custom *compiledResponse
+	if ms.config.MethodNotAllowed != nil {
+		var err error
+		if custom, err = ms.compileResponse(*ms.config.MethodNotAllowed, http.StatusMethodNotAllowed); err != nil {
+			log.Printf("Invalid method_not_allowed response, using default: %v", err)
+		}
+	}
+
+	router := ms.router
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := allowedMethods(router, r)
+		for _, method := range ms.routes.snapshot.Load().allowedMethods(r) {
+			if !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+
+		if custom != nil {
+			custom.write(w, r)
+			log.Printf("%s %s - %d (Method Not Allowed)", r.Method, r.URL.Path, custom.statusCode)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":  "Method not allowed",
+			"path":   r.URL.Path,
+			"method": r.Method,
+		})
+		log.Printf("%s %s - 405 (Method Not Allowed)", r.Method, r.URL.Path)
+	})
+}
+
+// allowedMethods returns the methods of the management routes matching the request path
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	seen := make(map[string]bool)
+	var methods []string
+
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		routeMethods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range routeMethods {
+			if seen[method] {
+				continue
+			}
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			var match mux.RouteMatch
+			if route.Match(probe, &match) {
+				seen[method] = true
+				methods = append(methods, method)
+			}
+		}
+		return nil
+	})
+
+	return methods
+}
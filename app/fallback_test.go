@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCustomNotFoundResponse tests a templated not_found response
+func TestCustomNotFoundResponse(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		NotFound: &ResponseSpec{
+			StatusCode: 404,
+			Headers:    map[string]string{"X-Error-Kind": "routing"},
+			Response: map[string]interface{}{
+				"errors": []map[string]string{{"code": "not_found", "detail": "{{.Method}} {{.Path}}"}},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != 404 {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	if w.Header().Get("X-Error-Kind") != "routing" {
+		t.Errorf("Expected X-Error-Kind header 'routing', got '%s'", w.Header().Get("X-Error-Kind"))
+	}
+
+	var response struct {
+		Errors []map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Errors) != 1 || response.Errors[0]["detail"] != "GET /missing" {
+		t.Errorf("Expected detail 'GET /missing', got %v", response.Errors)
+	}
+
+	// Request values are escaped, so they keep the body valid JSON
+	req = httptest.NewRequest("GET", `/missing/"quoted"\\path`, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected valid JSON, got %v: %s", err, w.Body.String())
+	}
+	if response.Errors[0]["detail"] != `GET /missing/"quoted"\\path` {
+		t.Errorf("Expected the path to be kept, got %v", response.Errors)
+	}
+}
+
+// TestDefaultResponse tests the catch-all default response and prefix scoping
+func TestDefaultResponse(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		DefaultResponse: &DefaultResponse{
+			ResponseSpec: ResponseSpec{Response: map[string]interface{}{}},
+			PathPrefixes: map[string]ResponseSpec{
+				"/api/":   {StatusCode: 501, Response: map[string]string{"error": "not mocked"}},
+				"/api/v2": {StatusCode: 202, Response: "accepted"},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path     string
+		expected int
+		body     string
+	}{
+		{path: "/anything", expected: 200, body: "{}"},
+		{path: "/api/users", expected: 501, body: `{"error":"not mocked"}`},
+		{path: "/api/v2/users", expected: 202, body: "accepted"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("Expected status %d for %s, got %d", test.expected, test.path, w.Code)
+		}
+
+		if w.Body.String() != test.body {
+			t.Errorf("Expected body '%s' for %s, got '%s'", test.body, test.path, w.Body.String())
+		}
+	}
+}
+
+// TestMethodNotAllowed tests the 405 handler and its Allow header
+func TestMethodNotAllowed(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/items/{id}", Method: "GET", Response: "item"},
+			{Path: "/api/items/{id}", Method: "DELETE", StatusCode: 204},
+			{Path: "/api/other", Method: "POST", Response: "other"},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("PUT", "/api/items/1", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != 405 {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+
+	if allow := w.Header().Get("Allow"); allow != "GET, DELETE" {
+		t.Errorf("Expected Allow header 'GET, DELETE', got '%s'", allow)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response["error"] != "Method not allowed" {
+		t.Errorf("Expected error 'Method not allowed', got '%s'", response["error"])
+	}
+}
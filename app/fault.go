@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+)
+
+// Modes of faults injected into the responses of an endpoint
+const (
+	FaultConnectionReset = "connection_reset" // close the connection with a TCP reset instead of responding
+	FaultEmptyResponse   = "empty_response"   // close the connection without sending anything
+	FaultMalformedJSON   = "malformed_json"   // send the response with its body cut off in the middle
+	FaultRandom500       = "random_500"       // answer 500 Internal Server Error
+)
+
+// faultTruncate names the truncate setting of an endpoint in notifications
+const faultTruncate = "truncate"
+
+// maxMalformedBody is the most of a response body buffered to cut it off
+const maxMalformedBody = 1 << 20
+
+// FaultConfig injects a fault into a share of the responses of an endpoint,
+// to test how clients cope with broken servers
+type FaultConfig struct {
+	Mode        string  `json:"mode"`                  // connection_reset, empty_response, malformed_json or random_500
+	Probability float64 `json:"probability,omitempty"` // share of requests that get the fault, from 0 to 1 (default: 1)
+}
+
+// notifyFault notifies the hooks about a fault injected into the response
+// to a request
+func (ms *MockServer) notifyFault(r *http.Request, fault, source string) {
+	ms.notifier.notify(EventFaultInjected, fmt.Sprintf("Fault %s injected: %s %s", fault, r.Method, r.URL.Path),
+		map[string]string{"fault": fault, "method": r.Method, "path": r.URL.Path, "source": source, "ip": clientIP(r)})
+}
+
+// validateFault checks the fault setting of an endpoint
+func validateFault(config *FaultConfig) error {
+	if config == nil {
+		return nil
+	}
+	switch config.Mode {
+	case FaultConnectionReset, FaultEmptyResponse, FaultMalformedJSON, FaultRandom500:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s, %s, %s or %s", config.Mode,
+			FaultConnectionReset, FaultEmptyResponse, FaultMalformedJSON, FaultRandom500)
+	}
+	if config.Probability < 0 || config.Probability > 1 {
+		return fmt.Errorf("probability must be between 0 and 1, got %v", config.Probability)
+	}
+	return nil
+}
+
+// strikes decides whether a request gets the fault
+func (fc *FaultConfig) strikes(random *rand.Rand) bool {
+	probability := fc.Probability
+	if probability == 0 {
+		probability = 1
+	}
+	return random.Float64() < probability
+}
+
+// closeConnection closes the connection of a request without a response.
+// HTTP/2 streams are reset instead.
+func closeConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+// writeFault500 answers a request with the error of the random_500 fault
+func writeFault500(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Internal Server Error"})
+}
+
+// malformedWriter holds back the body of a response, so that it can be
+// sent cut off in the middle once the handler is done
+type malformedWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader holds back the status code
+func (mw *malformedWriter) WriteHeader(statusCode int) {
+	if mw.statusCode == 0 {
+		mw.statusCode = statusCode
+	}
+}
+
+// Write holds back the body, up to maxMalformedBody bytes
+func (mw *malformedWriter) Write(data []byte) (int, error) {
+	if mw.statusCode == 0 {
+		mw.statusCode = http.StatusOK
+	}
+	if room := maxMalformedBody - mw.body.Len(); room > 0 {
+		mw.body.Write(data[:min(len(data), room)])
+	}
+	return len(data), nil
+}
+
+// finish sends the response with the first half of its body. A half that
+// is still valid JSON, like part of a number, gets an opening brace, so
+// that the body never parses.
+func (mw *malformedWriter) finish() {
+	body := mw.body.Bytes()
+	cut := body[:len(body)/2]
+	if len(bytes.TrimSpace(cut)) == 0 || json.Valid(cut) {
+		cut = append(cut[:len(cut):len(cut)], '{')
+	}
+
+	header := mw.ResponseWriter.Header()
+	if len(header["Content-Type"]) == 0 {
+		header.Set("Content-Type", "application/json")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(cut)))
+	statusCode := mw.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	mw.ResponseWriter.WriteHeader(statusCode)
+	mw.ResponseWriter.Write(cut)
+}
+
+// Flush does nothing, so that streamed responses are held back as well
+func (mw *malformedWriter) Flush() {}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (mw *malformedWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
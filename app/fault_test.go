@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFaultInjection tests the fault modes of endpoints
+func TestFaultInjection(t *testing.T) {
+	seed := int64(1)
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Seed:       &seed,
+		Endpoints: []Endpoint{
+			{Path: "/reset", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: FaultConnectionReset}},
+			{Path: "/empty", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: FaultEmptyResponse}},
+			{Path: "/malformed", Method: "GET", StatusCode: 201, Response: map[string]interface{}{"id": 1, "name": "Widget"}, Fault: &FaultConfig{Mode: FaultMalformedJSON}},
+			{Path: "/number", Method: "GET", StatusCode: 200, Response: 12345, Fault: &FaultConfig{Mode: FaultMalformedJSON}},
+			{Path: "/flaky", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: FaultRandom500, Probability: 0.5}},
+			{Path: "/invalid", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: "slow"}},
+		},
+	}
+	server.random.configure(&seed)
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, path := range []string{"/reset", "/empty"} {
+		if resp, err := http.Get(ts.URL + path); err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected no response from %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	for _, path := range []string{"/malformed", "/number"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to call %s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || len(body) == 0 || json.Valid(body) || resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a cut off JSON body from %s, got %q (%v)", path, body, err)
+		}
+		if path == "/malformed" && (resp.StatusCode != 201 || !strings.HasPrefix(`{"id":1,"name":"Widget"}`, string(body))) {
+			t.Errorf("Expected the start of the response with its status, got %d %q", resp.StatusCode, body)
+		}
+	}
+
+	failures := 0
+	for i := 0; i < 40; i++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/flaky", nil))
+		switch w.Code {
+		case 500:
+			failures++
+			if !strings.Contains(w.Body.String(), "Internal Server Error") {
+				t.Errorf("Expected the fault error body, got %s", w.Body.String())
+			}
+		case 200:
+		default:
+			t.Fatalf("Unexpected status %d", w.Code)
+		}
+	}
+	if failures < 5 || failures > 35 {
+		t.Errorf("Expected about half of the requests to fail, got %d of 40", failures)
+	}
+
+	// Unknown modes are logged and the endpoint answers normally
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/invalid", nil))
+	if w.Code != 200 || w.Body.String() != "ok" {
+		t.Errorf("Expected the normal response, got %d %s", w.Code, w.Body.String())
+	}
+
+	if validateFault(&FaultConfig{Mode: FaultRandom500, Probability: 1.5}) == nil {
+		t.Error("Expected a probability above 1 to be rejected")
+	}
+}
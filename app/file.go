@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseFileVariable matches the path variables of a response file path,
+// e.g. {id} in fixtures/users/{id}.json
+var responseFileVariable = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// templatedFile reports whether a response file path has path variables
+func templatedFile(file string) bool {
+	return responseFileVariable.MatchString(file)
+}
+
+// resolveResponseFile fills the path variables of a response file path with
+// the variables of a request. It returns false if a variable is missing or
+// its value could reach another directory.
+func resolveResponseFile(file string, vars map[string]string) (string, bool) {
+	ok := true
+	resolved := responseFileVariable.ReplaceAllStringFunc(file, func(match string) string {
+		value := vars[match[1:len(match)-1]]
+		if value == "" || value == "." || value == ".." || strings.ContainsAny(value, "/\\\x00") {
+			ok = false
+		}
+		return value
+	})
+	return resolved, ok
+}
+
+// responseFileGlob returns a pattern matching every file a templated response
+// file path can resolve to
+func responseFileGlob(file string) string {
+	return responseFileVariable.ReplaceAllString(file, "*")
+}
+
+// missingFileResponse returns the response to requests whose response file
+// doesn't exist: the configured one, 404 for templated paths, or nil to
+// answer with 500
+func missingFileResponse(ep Endpoint) (*encodedResponse, error) {
+	if ep.MissingFile == nil {
+		if !templatedFile(ep.ResponseFile) {
+			return nil, nil
+		}
+		body, _ := encodeResponse(map[string]string{"error": "Not found"})
+		return &encodedResponse{statusCode: http.StatusNotFound, body: body}, nil
+	}
+	if err := validateStatusCode(ep.MissingFile.StatusCode); err != nil {
+		return nil, err
+	}
+	body, err := encodeResponse(ep.MissingFile.Response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %v", err)
+	}
+	missing := &encodedResponse{statusCode: ep.MissingFile.StatusCode, body: body}
+	if missing.statusCode == 0 {
+		missing.statusCode = http.StatusNotFound
+	}
+	return missing, nil
+}
+
+// serveFile streams the response file of an endpoint from disk, so large
+// files are never held in memory
+func serveFile(w http.ResponseWriter, r *http.Request, path string, statusCode int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Response file not available", http.StatusInternalServerError)
+		return fmt.Errorf("failed to open response file: %v", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err == nil && stat.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		http.Error(w, "Response file not available", http.StatusInternalServerError)
+		return fmt.Errorf("failed to read response file: %v", err)
+	}
+
+	serveContent(w, r, stat.Name(), stat.ModTime(), file, stat.Size(), statusCode)
+	return nil
+}
+
+// serveContent writes seekable content of a known size. With status 200,
+// http.ServeContent answers range and conditional requests; other status
+// codes send the whole content.
+func serveContent(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, content io.ReadSeeker, size int64, statusCode int) {
+	if statusCode == http.StatusOK {
+		http.ServeContent(w, r, name, modTime, content)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(statusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, content)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResponseFile tests streaming response files with range requests
+func TestResponseFile(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	if err := os.WriteFile(filepath.Join(dir, "large.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/download", Method: "GET", ResponseFile: filepath.Join(dir, "large.txt")},
+			{Path: "/accepted", Method: "GET", StatusCode: 202, ContentType: "application/octet-stream", ResponseFile: filepath.Join(dir, "large.txt")},
+			{Path: "/missing", Method: "GET", ResponseFile: filepath.Join(dir, "missing.bin")},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := get("/download", nil)
+	if resp.StatusCode != 200 || !bytes.Equal(body, content) || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the whole file as text/plain, got %d %s with %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(body))
+	}
+
+	resp, body = get("/download", http.Header{"Range": {"bytes=10-14"}})
+	if resp.StatusCode != 206 || string(body) != "01234" || resp.Header.Get("Content-Range") != "bytes 10-14/1000000" {
+		t.Errorf("Expected a partial response, got %d '%s' %s", resp.StatusCode, body, resp.Header.Get("Content-Range"))
+	}
+
+	resp, body = get("/accepted", nil)
+	if resp.StatusCode != 202 || len(body) != len(content) || resp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Expected the whole file with status 202, got %d %s with %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(body))
+	}
+
+	if resp, _ := get("/missing", nil); resp.StatusCode != 500 {
+		t.Errorf("Expected 500 for a missing file, got %d", resp.StatusCode)
+	}
+
+	// File bodies are not kept in the request history
+	for _, entry := range server.history.list() {
+		if entry.ResponseBody != nil && entry.Path != "/missing" {
+			t.Errorf("Expected the body of %s not to be recorded, got %d bytes", entry.Path, len(entry.ResponseBody))
+		}
+	}
+}
+
+// TestTemplatedResponseFile tests selecting response files by path variables
+func TestTemplatedResponseFile(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "users"), 0755)
+	os.WriteFile(filepath.Join(dir, "users", "1.json"), []byte(`{"id": 1, "name": "Alice"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "users", "2.json"), []byte(`{"id": 2, "name": "Bob"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{"secret": true}`), 0644)
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users/{id}", Method: "GET", ResponseFile: filepath.Join(dir, "users", "{id}.json")},
+			{Path: "/api/orders/{id}", Method: "GET", ResponseFile: filepath.Join(dir, "orders", "{id}.json"),
+				MissingFile: &MappedResponse{StatusCode: 410, Response: map[string]string{"error": "Order archived"}}},
+			{Path: "/api/files/{name:.+}", Method: "GET", ResponseFile: filepath.Join(dir, "users", "{name}")},
+		},
+	}
+	server.SetupRoutes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/api/users/2"); w.Code != 200 || w.Body.String() != `{"id": 2, "name": "Bob"}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the file of user 2, got %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if w := get("/api/users/3"); w.Code != 404 || strings.TrimSpace(w.Body.String()) != `{"error":"Not found"}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected 404 for a missing file, got %d %s", w.Code, w.Body.String())
+	}
+	if w := get("/api/orders/7"); w.Code != 410 || strings.TrimSpace(w.Body.String()) != `{"error":"Order archived"}` {
+		t.Errorf("Expected the configured response for a missing file, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Variables can't reach other directories
+	for _, path := range []string{"/api/files/..%2Fsecret.json", "/api/files/../secret.json", "/api/files/..", "/api/files/%5C..%5Csecret.json"} {
+		if w := get(path); w.Code == 200 {
+			t.Errorf("Expected %s to be rejected, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Bundles include the files the path can resolve to
+	files := server.bundleFiles()
+	if len(files) != 2 || files[0] != filepath.Join(dir, "users", "1.json") || files[1] != filepath.Join(dir, "users", "2.json") {
+		t.Errorf("Unexpected bundled files %v", files)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// GenerateConfig generates a JSON array response of an exact item count or
+// byte size from an item pattern, so that large responses need no fixtures
+type GenerateConfig struct {
+	Item  interface{} `json:"item"`            // pattern of the items; strings are Go templates with .Index and .Number
+	Count int         `json:"count,omitempty"` // number of items
+	Size  int64       `json:"size,omitempty"`  // exact size of the body in bytes, filled with as many items as fit
+}
+
+// generatorData is the data of the templates of an item pattern
+type generatorData struct {
+	Index  int // position of the item, starting at 0
+	Number int // position of the item, starting at 1
+}
+
+// generator renders the items of a generated response
+type generator struct {
+	config GenerateConfig
+	render func(data generatorData) ([]byte, error)
+}
+
+// newGenerator checks a generate setting and compiles the templates of its
+// item pattern
+func newGenerator(config GenerateConfig) (*generator, error) {
+	if (config.Count > 0) == (config.Size > 0) {
+		return nil, fmt.Errorf("either count or size is required")
+	}
+	if config.Count < 0 || config.Size < 0 {
+		return nil, fmt.Errorf("count and size must not be negative")
+	}
+	if config.Size > 0 && config.Size < 2 {
+		return nil, fmt.Errorf("size must be at least 2 bytes")
+	}
+	if config.Item == nil {
+		return nil, fmt.Errorf("item is required")
+	}
+
+	build, err := compileItemPattern(config.Item)
+	if err != nil {
+		return nil, err
+	}
+	return &generator{config: config, render: func(data generatorData) ([]byte, error) {
+		value, err := build(data)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(value)
+	}}, nil
+}
+
+// compileItemPattern compiles the string templates of an item pattern. The
+// returned function builds an item; values other than strings are copied.
+func compileItemPattern(pattern interface{}) (func(data generatorData) (interface{}, error), error) {
+	switch pattern := pattern.(type) {
+	case string:
+		if !strings.Contains(pattern, "{{") {
+			return func(generatorData) (interface{}, error) { return pattern, nil }, nil
+		}
+		tmpl, err := template.New("item").Funcs(responseTemplateFuncs).Parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item template %q: %v", pattern, err)
+		}
+		return func(data generatorData) (interface{}, error) {
+			var buf strings.Builder
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, err
+			}
+			return buf.String(), nil
+		}, nil
+
+	case map[string]interface{}:
+		fields := make(map[string]func(generatorData) (interface{}, error), len(pattern))
+		for key, value := range pattern {
+			build, err := compileItemPattern(value)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = build
+		}
+		return func(data generatorData) (interface{}, error) {
+			item := make(map[string]interface{}, len(fields))
+			for key, build := range fields {
+				value, err := build(data)
+				if err != nil {
+					return nil, err
+				}
+				item[key] = value
+			}
+			return item, nil
+		}, nil
+
+	case []interface{}:
+		elements := make([]func(generatorData) (interface{}, error), 0, len(pattern))
+		for _, value := range pattern {
+			build, err := compileItemPattern(value)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, build)
+		}
+		return func(data generatorData) (interface{}, error) {
+			list := make([]interface{}, 0, len(elements))
+			for _, build := range elements {
+				value, err := build(data)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			return list, nil
+		}, nil
+	}
+	return func(generatorData) (interface{}, error) { return pattern, nil }, nil
+}
+
+// serve streams the generated array. With a size, items are added while they
+// fit and the rest is filled with spaces before the closing bracket, which
+// keeps the body valid JSON of exactly that size.
+func (g *generator) serve(w http.ResponseWriter, r *http.Request, statusCode int) (int, error) {
+	if g.config.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(g.config.Size, 10))
+	}
+	w.WriteHeader(statusCode)
+	if r.Method == http.MethodHead {
+		return 0, nil
+	}
+
+	out := bufio.NewWriterSize(w, 32*1024)
+	defer out.Flush()
+
+	out.WriteByte('[')
+	written := int64(1)
+	items := 0
+	for g.config.Size > 0 || items < g.config.Count {
+		item, err := g.render(generatorData{Index: items, Number: items + 1})
+		if err != nil {
+			return items, fmt.Errorf("failed to render item %d: %v", items, err)
+		}
+		separator := int64(0)
+		if items > 0 {
+			separator = 1
+		}
+		if g.config.Size > 0 && written+separator+int64(len(item))+1 > g.config.Size {
+			break
+		}
+		if separator > 0 {
+			out.WriteByte(',')
+		}
+		if _, err := out.Write(item); err != nil {
+			return items, err
+		}
+		written += separator + int64(len(item))
+		items++
+	}
+	if g.config.Size > 0 {
+		padding := g.config.Size - written - 1
+		for padding > 0 {
+			chunk := min(padding, int64(len(generatorPadding)))
+			out.Write(generatorPadding[:chunk])
+			padding -= chunk
+		}
+	}
+	out.WriteByte(']')
+	return items, nil
+}
+
+// generatorPadding fills generated bodies up to their size
+var generatorPadding = bytes.Repeat([]byte{' '}, 4096)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// TestGeneratedResponses tests generating arrays of an exact count or size
+func TestGeneratedResponses(t *testing.T) {
+	item := map[string]interface{}{"id": "{{.Number}}", "name": `user-{{printf "%03d" .Index}}`, "active": true, "tags": []interface{}{"a", "{{.Index}}"}}
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Method: "GET", Generate: &GenerateConfig{Item: item, Count: 3}},
+			{Path: "/api/big", Method: "GET", Generate: &GenerateConfig{Item: item, Size: 1 << 20}},
+			{Path: "/api/tiny", Method: "GET", Generate: &GenerateConfig{Item: item, Size: 10}},
+		},
+	}
+	server.SetupRoutes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/api/users")
+	expected := `[{"active":true,"id":"1","name":"user-000","tags":["a","0"]},` +
+		`{"active":true,"id":"2","name":"user-001","tags":["a","1"]},` +
+		`{"active":true,"id":"3","name":"user-002","tags":["a","2"]}]`
+	if w.Code != 200 || w.Body.String() != expected || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected generated items %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// Sized bodies are valid JSON of exactly that size
+	for _, test := range []struct {
+		path  string
+		size  int
+		items int
+	}{{"/api/big", 1 << 20, 15000}, {"/api/tiny", 10, 0}} {
+		w := get(test.path)
+		var items []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+			t.Fatalf("Expected valid JSON from %s: %v", test.path, err)
+		}
+		if w.Body.Len() != test.size || w.Header().Get("Content-Length") != strconv.Itoa(test.size) || len(items) < test.items {
+			t.Errorf("Expected %d bytes with %d items from %s, got %d bytes with %d items", test.size, test.items, test.path, w.Body.Len(), len(items))
+		}
+		if len(items) > 0 && items[len(items)-1]["id"] != strconv.Itoa(len(items)) {
+			t.Errorf("Expected consecutive items, got last %v", items[len(items)-1])
+		}
+	}
+
+	// Generated bodies are not recorded
+	if entries := server.history.list(); len(entries) != 3 || len(entries[1].ResponseBody) != 0 {
+		t.Errorf("Expected generated bodies to be left out of the history")
+	}
+
+	for _, config := range []GenerateConfig{{Item: item}, {Item: item, Count: 1, Size: 10}, {Count: 1}, {Item: item, Size: 1}, {Item: "{{.Missing", Count: 1}} {
+		if _, err := newGenerator(config); err == nil {
+			t.Errorf("Expected %+v to be rejected", config)
+		}
+	}
+}
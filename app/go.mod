@@ -5,6 +5,11 @@ go 1.24
 require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gorilla/mux v1.8.1
+	github.com/vektah/gqlparser/v2 v2.5.37
+	golang.org/x/term v0.30.0
 )
 
-require golang.org/x/sys v0.4.0 // indirect
+require (
+	github.com/agnivade/levenshtein v1.2.1 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+)
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// GraphQLMock represents a GraphQL endpoint answering any query with
+// type-appropriate fake data generated from a schema
+type GraphQLMock struct {
+	Schema     string                 `json:"schema"`                // path to the SDL file
+	Overrides  map[string]interface{} `json:"overrides,omitempty"`   // "Type.field" to fixed value
+	ListLength int                    `json:"list_length,omitempty"` // items generated per list (default: 2)
+}
+
+// graphqlMocker executes queries against a loaded schema
+type graphqlMocker struct {
+	schema     *ast.Schema
+	overrides  map[string]interface{}
+	listLength int
+}
+
+// graphqlRequest is the body of a GraphQL request
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// newGraphQLMocker loads the schema of a GraphQL mock
+func newGraphQLMocker(mock GraphQLMock) (*graphqlMocker, error) {
+	data, err := os.ReadFile(mock.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: mock.Schema, Input: string(data)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	}
+
+	listLength := mock.ListLength
+	if listLength <= 0 {
+		listLength = 2
+	}
+
+	return &graphqlMocker{
+		schema:     schema,
+		overrides:  mock.Overrides,
+		listLength: listLength,
+	}, nil
+}
+
+// execute answers a GraphQL request with a JSON encoded result
+func (gm *graphqlMocker) execute(r *http.Request) []byte {
+	var req graphqlRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		buf.ReadFrom(r.Body)
+		if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+			return graphqlErrors(fmt.Sprintf("invalid request body: %v", err))
+		}
+	}
+
+	doc, errs := gqlparser.LoadQuery(gm.schema, req.Query)
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, e := range errs {
+			messages = append(messages, e.Message)
+		}
+		return graphqlErrors(messages...)
+	}
+
+	var operation *ast.OperationDefinition
+	if req.OperationName != "" {
+		operation = doc.Operations.ForName(req.OperationName)
+	} else if len(doc.Operations) == 1 {
+		operation = doc.Operations[0]
+	}
+	if operation == nil {
+		return graphqlErrors("operation not found, operationName is required for documents with several operations")
+	}
+
+	var root *ast.Definition
+	switch operation.Operation {
+	case ast.Mutation:
+		root = gm.schema.Mutation
+	case ast.Subscription:
+		root = gm.schema.Subscription
+	default:
+		root = gm.schema.Query
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"data": gm.resolveObject(root, operation.SelectionSet, 0),
+	})
+	if err != nil {
+		return graphqlErrors(err.Error())
+	}
+	return data
+}
+
+// resolveObject generates an object of the given type for a selection set
+func (gm *graphqlMocker) resolveObject(def *ast.Definition, selections ast.SelectionSet, index int) orderedObject {
+	var result orderedObject
+	for _, field := range gm.collectFields(def, selections) {
+		key := field.Alias
+		if key == "" {
+			key = field.Name
+		}
+		result = append(result, objectField{key: key, value: gm.resolveField(def, field, index)})
+	}
+	return result
+}
+
+// collectFields flattens fragments applying to the given object type
+func (gm *graphqlMocker) collectFields(def *ast.Definition, selections ast.SelectionSet) []*ast.Field {
+	var fields []*ast.Field
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, sel)
+		case *ast.InlineFragment:
+			if gm.appliesTo(sel.TypeCondition, def) {
+				fields = append(fields, gm.collectFields(def, sel.SelectionSet)...)
+			}
+		case *ast.FragmentSpread:
+			if sel.Definition != nil && gm.appliesTo(sel.Definition.TypeCondition, def) {
+				fields = append(fields, gm.collectFields(def, sel.Definition.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+// appliesTo reports whether a fragment type condition matches an object type
+func (gm *graphqlMocker) appliesTo(condition string, def *ast.Definition) bool {
+	if condition == "" || condition == def.Name {
+		return true
+	}
+	for _, iface := range gm.schema.GetImplements(def) {
+		if iface.Name == condition {
+			return true
+		}
+	}
+	if conditionDef := gm.schema.Types[condition]; conditionDef != nil && conditionDef.Kind == ast.Union {
+		for _, member := range conditionDef.Types {
+			if member == def.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveField generates the value of a single field
+func (gm *graphqlMocker) resolveField(parent *ast.Definition, field *ast.Field, index int) interface{} {
+	if field.Name == "__typename" {
+		return parent.Name
+	}
+	if value, ok := gm.overrides[parent.Name+"."+field.Name]; ok {
+		return value
+	}
+	if field.Definition == nil {
+		return nil
+	}
+	return gm.resolveType(field.Definition.Type, field, index)
+}
+
+// resolveType generates a value of the given type
+func (gm *graphqlMocker) resolveType(typ *ast.Type, field *ast.Field, index int) interface{} {
+	if typ.Elem != nil {
+		items := make([]interface{}, 0, gm.listLength)
+		for i := 0; i < gm.listLength; i++ {
+			items = append(items, gm.resolveType(typ.Elem, field, i))
+		}
+		return items
+	}
+
+	def := gm.schema.Types[typ.NamedType]
+	if def == nil {
+		return nil
+	}
+
+	switch def.Kind {
+	case ast.Object:
+		return gm.resolveObject(def, field.SelectionSet, index)
+	case ast.Interface, ast.Union:
+		possible := gm.schema.GetPossibleTypes(def)
+		if len(possible) == 0 {
+			return nil
+		}
+		return gm.resolveObject(possible[index%len(possible)], field.SelectionSet, index)
+	case ast.Enum:
+		if len(def.EnumValues) == 0 {
+			return nil
+		}
+		return def.EnumValues[index%len(def.EnumValues)].Name
+	default:
+		return fakeScalar(def.Name, field.Name, index)
+	}
+}
+
+// fakeScalar generates a deterministic value for a scalar type
+func fakeScalar(typeName, fieldName string, index int) interface{} {
+	switch typeName {
+	case "Int":
+		return index + 1
+	case "Float":
+		return float64(index+1) + 0.5
+	case "Boolean":
+		return index%2 == 0
+	case "ID":
+		return fmt.Sprintf("%d", index+1)
+	case "String":
+		return fmt.Sprintf("%s %d", fieldName, index+1)
+	default:
+		return fmt.Sprintf("%s %d", typeName, index+1)
+	}
+}
+
+// graphqlErrors encodes a GraphQL error response
+func graphqlErrors(messages ...string) []byte {
+	errors := make([]map[string]string, 0, len(messages))
+	for _, message := range messages {
+		errors = append(errors, map[string]string{"message": message})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"errors": errors})
+	return data
+}
+
+// orderedObject is a JSON object that keeps the order of its fields, since
+// GraphQL responses follow the order of the selection set
+type orderedObject []objectField
+
+// objectField is a single key/value pair of an orderedObject
+type objectField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the object with its fields in order
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return bytes.Clone(buf.Bytes()), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGraphQLSchema = `
+type Query {
+  user(id: ID!): User
+  search(term: String!): [SearchResult!]!
+}
+
+type Mutation {
+  createUser(name: String!): User!
+}
+
+enum Role { ADMIN MEMBER }
+
+type User {
+  id: ID!
+  name: String!
+  age: Int
+  role: Role!
+  friends: [User!]!
+}
+
+type Post {
+  title: String!
+}
+
+union SearchResult = User | Post
+`
+
+// TestGraphQLMock tests fake data generation for GraphQL queries
+func TestGraphQLMock(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "schema.graphql")
+	if err := os.WriteFile(schemaPath, []byte(testGraphQLSchema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path:   "/graphql",
+				Method: "POST",
+				GraphQL: &GraphQLMock{
+					Schema:     schemaPath,
+					Overrides:  map[string]interface{}{"User.name": "Alice"},
+					ListLength: 1,
+				},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    `{"query": "{ user(id: \"1\") { id name role me: age friends { id } } }"}`,
+			expected: `{"data":{"user":{"id":"1","name":"Alice","role":"ADMIN","me":1,"friends":[{"id":"1"}]}}}`,
+		},
+		{
+			query:    `{"query": "query { search(term: \"x\") { __typename ... on User { name } ...P } } fragment P on Post { title }"}`,
+			expected: `{"data":{"search":[{"__typename":"User","name":"Alice"}]}}`,
+		},
+		{
+			query:    `{"query": "mutation { createUser(name: \"Bob\") { id } }"}`,
+			expected: `{"data":{"createUser":{"id":"1"}}}`,
+		},
+		{
+			query:    `{"query": "{ user(id: \"1\") { email } }"}`,
+			expected: `{"errors":[{"message":"Cannot query field \"email\" on type \"User\"."}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(test.query))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+
+		if body := w.Body.String(); body != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, body)
+		}
+	}
+}
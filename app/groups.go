@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+)
+
+// EndpointGroup gives endpoints of a plugin shared defaults. Values set on
+// an endpoint take precedence over those of its group.
+type EndpointGroup struct {
+	Name       string `json:"name,omitempty"`
+	PathPrefix string `json:"path_prefix,omitempty"` // prepended to the paths of the endpoints
+
+	StatusCode int             `json:"status_code,omitempty"`
+	Delay      int             `json:"delay,omitempty"` // delay in milliseconds
+	RateLimit  *RateLimit      `json:"rate_limit,omitempty"`
+	Truncate   *TruncateConfig `json:"truncate,omitempty"`
+
+	Headers        map[string]string `json:"headers,omitempty"`         // merged with the headers of the endpoints
+	HeaderProfiles []string          `json:"header_profiles,omitempty"` // applied before those of the endpoints
+	Tags           map[string]string `json:"tags,omitempty"`            // merged with the tags of the endpoints
+
+	Enabled *bool `json:"enabled,omitempty"` // false switches all endpoints of the group off (default: true)
+
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// apply returns an endpoint of the group with the group's defaults filled in
+func (g *EndpointGroup) apply(ep Endpoint) Endpoint {
+	ep.Path = g.PathPrefix + ep.Path
+	if ep.StatusCode == 0 {
+		ep.StatusCode = g.StatusCode
+	}
+	if ep.Delay == 0 {
+		ep.Delay = g.Delay
+	}
+	if ep.RateLimit == nil {
+		ep.RateLimit = g.RateLimit
+	}
+	if ep.Truncate == nil {
+		ep.Truncate = g.Truncate
+	}
+	ep.Headers = mergeStrings(g.Headers, ep.Headers)
+	ep.Tags = mergeStrings(g.Tags, ep.Tags)
+	if len(g.HeaderProfiles) > 0 {
+		ep.HeaderProfiles = append(append([]string{}, g.HeaderProfiles...), ep.HeaderProfiles...)
+	}
+	if g.Enabled != nil && !*g.Enabled {
+		ep.Enabled = g.Enabled
+	}
+	return ep
+}
+
+// allEndpoints returns the endpoints of a plugin followed by those of its
+// groups, with the group defaults applied
+func (p *Plugin) allEndpoints() []Endpoint {
+	if len(p.Groups) == 0 {
+		return p.Endpoints
+	}
+	endpoints := append([]Endpoint{}, p.Endpoints...)
+	for i := range p.Groups {
+		for _, ep := range p.Groups[i].Endpoints {
+			endpoints = append(endpoints, p.Groups[i].apply(ep))
+		}
+	}
+	return endpoints
+}
+
+// endpointPointers returns the JSON pointers of the endpoints returned by
+// allEndpoints, for locating them in the plugin file
+func (p *Plugin) endpointPointers() []string {
+	var pointers []string
+	for i := range p.Endpoints {
+		pointers = append(pointers, fmt.Sprintf("/endpoints/%d", i))
+	}
+	for i, group := range p.Groups {
+		for j := range group.Endpoints {
+			pointers = append(pointers, fmt.Sprintf("/groups/%d/endpoints/%d", i, j))
+		}
+	}
+	return pointers
+}
+
+// mergeStrings returns the values of base overridden by those of overrides,
+// sharing a map when only one has values
+func mergeStrings(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 {
+		return overrides
+	}
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEndpointGroups tests endpoints inheriting the defaults of their group
+func TestEndpointGroups(t *testing.T) {
+	dir := t.TempDir()
+	pluginPath := filepath.Join(dir, "payments.json")
+	plugin := `{
+		"name": "payments",
+		"enabled": true,
+		"endpoints": [{"path": "/health/payments", "method": "GET", "response": "ok"}],
+		"groups": [
+			{
+				"name": "v2",
+				"path_prefix": "/api/v2",
+				"status_code": 503,
+				"headers": {"Retry-After": "30", "X-Version": "2"},
+				"tags": {"team": "payments"},
+				"endpoints": [
+					{"path": "/payments", "method": "POST", "response": "unavailable"},
+					{"path": "/refunds", "method": "POST", "status_code": 201, "headers": {"X-Version": "2.1"}, "response": "refunded"}
+				]
+			},
+			{
+				"name": "legacy",
+				"path_prefix": "/api/v1",
+				"enabled": false,
+				"endpoints": [{"path": "/payments", "method": "POST", "response": "legacy"}]
+			}
+		]
+	}`
+	if err := os.WriteFile(pluginPath, []byte(plugin), 0644); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: dir}
+	if err := server.loadSinglePlugin(pluginPath); err != nil {
+		t.Fatalf("Failed to load plugin: %v", err)
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path           string
+		status         int
+		retry, version string
+	}{
+		{"/health/payments", 200, "", ""},
+		{"/api/v2/payments", 503, "30", "2"},
+		{"/api/v2/refunds", 201, "30", "2.1"},
+		{"/api/v1/payments", 404, "", ""},
+	}
+	for _, test := range tests {
+		method := "POST"
+		if test.path == "/health/payments" {
+			method = "GET"
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, w.Code)
+		}
+		if retry, version := w.Header().Get("Retry-After"), w.Header().Get("X-Version"); retry != test.retry || version != test.version {
+			t.Errorf("%s: expected headers %q and %q, got %q and %q", test.path, test.retry, test.version, retry, version)
+		}
+	}
+
+	for _, route := range server.listRoutes("team:payments") {
+		if route.Source != "payments" || route.Tags["team"] != "payments" {
+			t.Errorf("Unexpected route %+v", route)
+		}
+	}
+	if routes := server.listRoutes("team:payments"); len(routes) != 2 {
+		t.Errorf("Expected the group tags on 2 routes, got %d", len(routes))
+	}
+
+	pointers := server.plugins["payments"].endpointPointers()
+	if len(pointers) != 4 || pointers[0] != "/endpoints/0" || pointers[2] != "/groups/0/endpoints/1" {
+		t.Errorf("Unexpected pointers %v", pointers)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 structures, see http://www.softwareishard.com/blog/har-12-spec/
+
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harBody        `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harBody struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// buildHAR converts history entries to a HAR log
+func buildHAR(entries []historyEntry) harLog {
+	har := harLog{Log: harContent{
+		Version: "1.2",
+		Creator: harCreator{Name: "nmock", Version: "1.0"},
+		Entries: make([]harEntry, 0, len(entries)),
+	}}
+
+	for _, entry := range entries {
+		milliseconds := float64(entry.Duration) / float64(time.Millisecond)
+
+		request := harRequest{
+			Method:      entry.Method,
+			URL:         entry.URL,
+			HTTPVersion: entry.Proto,
+			Cookies:     harCookies(entry.RequestHeaders),
+			Headers:     harHeaders(entry.RequestHeaders),
+			QueryString: harQuery(entry.URL),
+			HeadersSize: -1,
+			BodySize:    len(entry.RequestBody),
+		}
+		if len(entry.RequestBody) > 0 {
+			text, encoding := harText(entry.RequestBody)
+			request.PostData = &harPostData{
+				MimeType: entry.RequestHeaders.Get("Content-Type"),
+				Text:     text,
+				Encoding: encoding,
+			}
+		}
+
+		text, encoding := harText(entry.ResponseBody)
+		response := harResponse{
+			Status:      entry.StatusCode,
+			StatusText:  http.StatusText(entry.StatusCode),
+			HTTPVersion: entry.Proto,
+			Cookies:     []harCookie{},
+			Headers:     harHeaders(entry.ResponseHeaders),
+			Content: harBody{
+				Size:     len(entry.ResponseBody),
+				MimeType: entry.ResponseHeaders.Get("Content-Type"),
+				Text:     text,
+				Encoding: encoding,
+			},
+			RedirectURL: entry.ResponseHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(entry.ResponseBody),
+		}
+
+		har.Log.Entries = append(har.Log.Entries, harEntry{
+			StartedDateTime: entry.StartedAt.Format(time.RFC3339Nano),
+			Time:            milliseconds,
+			Request:         request,
+			Response:        response,
+			Timings:         harTimings{Wait: milliseconds},
+			Comment:         entry.Route,
+		})
+	}
+
+	return har
+}
+
+// harHeaders converts headers to sorted name/value pairs
+func harHeaders(headers http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for name, values := range headers {
+		for _, value := range values {
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// harQuery converts the query string of a URL to name/value pairs
+func harQuery(rawURL string) []harNameValue {
+	pairs := []harNameValue{}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	query := parsed.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// harCookies extracts request cookies
+func harCookies(headers http.Header) []harCookie {
+	cookies := []harCookie{}
+	for _, cookie := range (&http.Request{Header: headers}).Cookies() {
+		cookies = append(cookies, harCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+// harText returns a body as text, base64 encoding it when it isn't valid UTF-8
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of the request history
+const (
+	historyLimit     = 1000
+	historyBytes     = 64 << 20
+	historyBodyBytes = 1 << 20
+)
+
+// spillQueueSize is the number of evicted requests waiting to be written to
+// the spill file before evictions wait for the disk
+const spillQueueSize = 1024
+
+// HistoryConfig limits the memory used by the request history
+type HistoryConfig struct {
+	MaxEntries   int    `json:"max_entries,omitempty"`    // requests kept in memory (default: 1000)
+	MaxBytes     int    `json:"max_bytes,omitempty"`      // approximate size of the requests kept in memory (default: 64 MiB)
+	MaxBodyBytes int    `json:"max_body_bytes,omitempty"` // bytes kept of each request and response body (default: 1 MiB)
+	SpillFile    string `json:"spill_file,omitempty"`     // file that evicted requests are appended to as JSON Lines
+}
+
+// historyEntry is a request served by the mock server with its response
+type historyEntry struct {
+	ID              int           `json:"id"`
+	StartedAt       time.Time     `json:"started_at"`
+	Duration        time.Duration `json:"duration"`
+	IP              string        `json:"ip"`
+	Method          string        `json:"method"`
+	URL             string        `json:"url"`
+	Path            string        `json:"path"`
+	Proto           string        `json:"proto"`
+	RequestHeaders  http.Header   `json:"request_headers"`
+	RequestBody     []byte        `json:"request_body,omitempty"`
+	StatusCode      int           `json:"status_code"`
+	ResponseHeaders http.Header   `json:"response_headers"`
+	ResponseBody    []byte        `json:"response_body,omitempty"`
+	Route           string        `json:"route,omitempty"`  // matched endpoint as "METHOD /path"
+	Source          string        `json:"source,omitempty"` // config or plugin defining the endpoint
+	EndpointID      string        `json:"endpoint_id,omitempty"`
+
+	// The bodies were cut off at the body limit of the history
+	RequestBodyTruncated  bool `json:"request_body_truncated,omitempty"`
+	ResponseBodyTruncated bool `json:"response_body_truncated,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"` // tags of the endpoint, shared with its route
+}
+
+// size approximates the memory used by an entry
+func (e *historyEntry) size() int {
+	size := len(e.IP) + len(e.Method) + len(e.URL) + len(e.Path) + len(e.Proto) +
+		len(e.RequestBody) + len(e.ResponseBody) + len(e.Route) + len(e.Source) + len(e.EndpointID)
+	for _, header := range []http.Header{e.RequestHeaders, e.ResponseHeaders} {
+		for key, values := range header {
+			size += len(key)
+			for _, value := range values {
+				size += len(value)
+			}
+		}
+	}
+	return size
+}
+
+// requestHistory keeps the most recent requests in a ring buffer. The oldest
+// requests are evicted when there are more than maxEntries or their total
+// size exceeds maxBytes, and appended to the spill file if one is configured.
+type requestHistory struct {
+	mutex  sync.Mutex
+	nextID int
+
+	ring  []historyEntry // capacity maxEntries, oldest entry at start
+	start int
+	count int
+	bytes int
+
+	maxBytes     int
+	maxBodyBytes int
+	spillFile    string
+	spill        *os.File
+	spills       chan spillOp // written by writeSpills, created with the first spill file
+}
+
+// spillOp is an evicted request to append to a spill file. An op without
+// an entry closes the file, or signals done, once the requests queued
+// before it are written.
+type spillOp struct {
+	file  *os.File
+	entry *historyEntry
+	done  chan struct{}
+}
+
+// newRequestHistory creates an empty request history with the default limits
+func newRequestHistory() *requestHistory {
+	return &requestHistory{ring: make([]historyEntry, historyLimit), maxBytes: historyBytes, maxBodyBytes: historyBodyBytes}
+}
+
+// configure applies the limits of a history configuration, evicting
+// requests that exceed the new limits
+func (h *requestHistory) configure(config *HistoryConfig) {
+	var settings HistoryConfig
+	if config != nil {
+		settings = *config
+	}
+	if settings.MaxEntries <= 0 {
+		settings.MaxEntries = historyLimit
+	}
+	if settings.MaxBytes <= 0 {
+		settings.MaxBytes = historyBytes
+	}
+	if settings.MaxBodyBytes <= 0 {
+		settings.MaxBodyBytes = historyBodyBytes
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if settings.SpillFile != h.spillFile {
+		if h.spill != nil {
+			h.spills <- spillOp{file: h.spill}
+			h.spill = nil
+		}
+		h.spillFile = settings.SpillFile
+		if h.spillFile != "" {
+			file, err := os.OpenFile(h.spillFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				log.Printf("Failed to open history spill file: %v", err)
+			} else if h.spills == nil {
+				h.spills = make(chan spillOp, spillQueueSize)
+				go writeSpills(h.spills)
+			}
+			h.spill = file
+		}
+	}
+
+	h.maxBytes = settings.MaxBytes
+	h.maxBodyBytes = settings.MaxBodyBytes
+	if settings.MaxEntries != len(h.ring) {
+		for h.count > settings.MaxEntries {
+			h.evict()
+		}
+		entries := h.entries()
+		h.ring = make([]historyEntry, settings.MaxEntries)
+		h.start = 0
+		copy(h.ring, entries)
+	}
+	h.trim()
+}
+
+// bodyLimit returns the bytes of a body kept with a request
+func (h *requestHistory) bodyLimit() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.maxBodyBytes
+}
+
+// add stores a request
+func (h *requestHistory) add(entry historyEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.nextID++
+	entry.ID = h.nextID
+	h.push(entry)
+}
+
+// push appends an entry, cutting off its bodies at the body limit and
+// evicting the oldest entries as needed. It must be called with the mutex
+// held.
+func (h *requestHistory) push(entry historyEntry) {
+	if len(entry.RequestBody) > h.maxBodyBytes {
+		entry.RequestBody = bytes.Clone(entry.RequestBody[:h.maxBodyBytes])
+		entry.RequestBodyTruncated = true
+	}
+	if len(entry.ResponseBody) > h.maxBodyBytes {
+		entry.ResponseBody = bytes.Clone(entry.ResponseBody[:h.maxBodyBytes])
+		entry.ResponseBodyTruncated = true
+	}
+	if h.count == len(h.ring) {
+		h.evict()
+	}
+	h.ring[(h.start+h.count)%len(h.ring)] = entry
+	h.count++
+	h.bytes += entry.size()
+	h.trim()
+}
+
+// trim evicts the oldest entries until the size limit is respected. An
+// entry larger than the limit on its own is evicted as well.
+func (h *requestHistory) trim() {
+	for h.count > 0 && h.bytes > h.maxBytes {
+		h.evict()
+	}
+}
+
+// evict removes the oldest entry and queues it for the spill file, which
+// is written by writeSpills without holding the mutex
+func (h *requestHistory) evict() {
+	entry := &h.ring[h.start]
+	if h.spill != nil {
+		spilled := *entry
+		h.spills <- spillOp{file: h.spill, entry: &spilled}
+	}
+
+	h.bytes -= entry.size()
+	*entry = historyEntry{}
+	h.start = (h.start + 1) % len(h.ring)
+	h.count--
+}
+
+// writeSpills appends the queued evicted requests to their spill files
+func writeSpills(ops <-chan spillOp) {
+	for op := range ops {
+		switch {
+		case op.done != nil:
+			close(op.done)
+		case op.entry == nil:
+			op.file.Close()
+		default:
+			data, err := json.Marshal(op.entry)
+			if err == nil {
+				_, err = op.file.Write(append(data, '\n'))
+			}
+			if err != nil {
+				log.Printf("Failed to spill request history: %v", err)
+			}
+		}
+	}
+}
+
+// flushSpills waits until the requests evicted so far are written to the
+// spill file
+func (h *requestHistory) flushSpills() {
+	h.mutex.Lock()
+	if h.spills == nil {
+		h.mutex.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	h.spills <- spillOp{done: done}
+	h.mutex.Unlock()
+	<-done
+}
+
+// entries returns a copy of the stored requests, oldest first. It must be
+// called with the mutex held.
+func (h *requestHistory) entries() []historyEntry {
+	entries := make([]historyEntry, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		entries = append(entries, h.ring[(h.start+i)%len(h.ring)])
+	}
+	return entries
+}
+
+// list returns a copy of the stored requests, oldest first
+func (h *requestHistory) list() []historyEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.entries()
+}
+
+// restore replaces the stored requests, applying the limits
+func (h *requestHistory) restore(entries []historyEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	clear(h.ring)
+	h.start, h.count, h.bytes = 0, 0, 0
+	for _, entry := range entries {
+		h.nextID = max(h.nextID, entry.ID)
+		h.push(entry)
+	}
+}
+
+// requestInfo is filled in by handlers to annotate the history entry of a request
+type requestInfo struct {
+	Route      string
+	EndpointID string
+	Source     string
+	OmitBody   bool              // the response body is not recorded, e.g. for large files
+	Tags       map[string]string // tags of the endpoint and its plugin
+
+	MetricTags string // Tags in DogStatsD syntax
+}
+
+type requestInfoKey struct{}
+
+// requestInfoFrom returns the annotations of a request, or nil if the
+// request is not being recorded
+func requestInfoFrom(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// recordingWriter captures the status, headers and body of a response.
+// It also holds the request body and annotations, so that recording a
+// request needs a single pooled object.
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	headers    http.Header
+	body       bytes.Buffer
+	limit      int  // bytes of each body recorded
+	truncated  bool // the response body exceeded the limit
+
+	requestBody      bytes.Buffer
+	requestTruncated bool
+	replay           replayBody
+	info             requestInfo
+}
+
+// replayBody serves a request body that was read for recording
+type replayBody struct {
+	bytes.Reader
+}
+
+// Close implements io.ReadCloser
+func (rb *replayBody) Close() error {
+	return nil
+}
+
+// WriteHeader captures the status code and headers
+func (rw *recordingWriter) WriteHeader(statusCode int) {
+	if rw.headers == nil {
+		rw.statusCode = statusCode
+		rw.headers = rw.Header().Clone()
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the body
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	if rw.headers == nil {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.info.OmitBody {
+		rw.truncated = recordLimited(&rw.body, data, rw.limit) || rw.truncated
+	}
+	return rw.ResponseWriter.Write(data)
+}
+
+// ReadFrom passes copies through to the underlying writer when the body is
+// not recorded, so that net/http can send files with sendfile
+func (rw *recordingWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rw.headers == nil {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if readerFrom, ok := rw.ResponseWriter.(io.ReaderFrom); ok && rw.info.OmitBody {
+		return readerFrom.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{rw}, src)
+}
+
+// recordLimited appends data to a recorded body up to limit bytes. It
+// reports whether data was cut off.
+func recordLimited(buf *bytes.Buffer, data []byte, limit int) bool {
+	if room := limit - buf.Len(); len(data) > room {
+		buf.Write(data[:max(room, 0)])
+		return true
+	}
+	buf.Write(data)
+	return false
+}
+
+// Flush passes flushes through for streamed responses
+func (rw *recordingWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes connection takeovers through
+func (rw *recordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// recordRequest serves a request through next and stores it in the history.
+// Admin API requests are not recorded, but changes go to the audit log.
+func (ms *MockServer) recordRequest(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if strings.HasPrefix(r.URL.Path, "/_admin/") {
+		// Denied changes are audited as well
+		ms.auditRequest(w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ms.authorizeAdmin(w, r) && ms.allowChange(w, r) {
+				next.ServeHTTP(w, r)
+			}
+		}))
+		return
+	}
+
+	recorder := getRecorder(w)
+	defer putRecorder(recorder)
+	recorder.limit = ms.history.bodyLimit()
+
+	// Bodies announced with "Expect: 100-continue" are read only when a
+	// handler asks for them, so that endpoints control the 100 Continue.
+	// Other bodies are read up to the limit and the rest is streamed to
+	// the handler without being recorded.
+	var deferred *continueBody
+	if expectsContinue(r) {
+		deferred = &continueBody{ReadCloser: r.Body, recorded: &recorder.requestBody, limit: recorder.limit}
+		r.Body = deferred
+	} else {
+		recorder.requestBody.ReadFrom(io.LimitReader(r.Body, int64(recorder.limit)+1))
+		recorder.replay.Reset(recorder.requestBody.Bytes())
+		if recorder.requestBody.Len() > recorder.limit {
+			recorder.requestTruncated = true
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(&recorder.replay, r.Body), r.Body}
+		} else {
+			r.Body = &recorder.replay
+		}
+	}
+
+	info := &recorder.info
+	r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+
+	started := time.Now()
+	next.ServeHTTP(recorder, r)
+
+	// Once 100 Continue was sent the client sends the whole body
+	if deferred != nil && deferred.started {
+		io.Copy(io.Discard, deferred)
+		recorder.requestTruncated = deferred.truncated
+	}
+	if recorder.requestBody.Len() > recorder.limit {
+		recorder.requestBody.Truncate(recorder.limit)
+	}
+
+	if recorder.headers == nil {
+		recorder.statusCode = http.StatusOK
+		recorder.headers = recorder.Header().Clone()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	entry := historyEntry{
+		StartedAt:       started,
+		Duration:        time.Since(started),
+		IP:              clientIP(r),
+		Method:          r.Method,
+		URL:             scheme + "://" + r.Host + r.URL.RequestURI(),
+		Path:            r.URL.Path,
+		Proto:           r.Proto,
+		RequestHeaders:  r.Header.Clone(),
+		RequestBody:     ownedBytes(&recorder.requestBody),
+		StatusCode:      recorder.statusCode,
+		ResponseHeaders: recorder.headers,
+		ResponseBody:    ownedBytes(&recorder.body),
+
+		RequestBodyTruncated:  recorder.requestTruncated,
+		ResponseBodyTruncated: recorder.truncated,
+		Route:                 info.Route,
+		Source:                info.Source,
+		EndpointID:            info.EndpointID,
+		Tags:                  info.Tags,
+	}
+	ms.history.add(entry)
+	ms.routeHits.add(info.Source, info.Route)
+	ms.expectations.observe(entry)
+	ms.statsd.observe(entry, info.MetricTags)
+	ms.metrics.observe(entry)
+	ms.mirror.observe(entry)
+}
+
+// setupHistoryAPI registers the request history admin API
+func (ms *MockServer) setupHistoryAPI() {
+	// Export captured requests
+	ms.router.HandleFunc("/_admin/requests/export", func(w http.ResponseWriter, r *http.Request) {
+		entries := ms.history.list()
+		for i, entry := range entries {
+			entries[i] = ms.secrets.redactEntry(entry)
+		}
+		exportHistory(w, r, entries)
+	}).Methods("GET")
+}
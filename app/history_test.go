@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHARExport tests exporting the request history as HAR
+func TestHARExport(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 1}},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("POST", "/api/users?notify=true", strings.NewReader(`{"name":"Alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "session=abc")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/missing", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_admin/plugins", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=har", nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var har harLog
+	if err := json.NewDecoder(w.Body).Decode(&har); err != nil {
+		t.Fatalf("Failed to decode HAR: %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected HAR 1.2 with 2 entries (admin requests excluded), got %s with %d", har.Log.Version, len(har.Log.Entries))
+	}
+
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.URL != "http://example.com/api/users?notify=true" {
+		t.Errorf("Unexpected request: %s %s", entry.Request.Method, entry.Request.URL)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"name":"Alice"}` {
+		t.Errorf("Expected request body in postData, got %+v", entry.Request.PostData)
+	}
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0].Name != "notify" {
+		t.Errorf("Expected query string, got %+v", entry.Request.QueryString)
+	}
+	if len(entry.Request.Cookies) != 1 || entry.Request.Cookies[0].Value != "abc" {
+		t.Errorf("Expected cookies, got %+v", entry.Request.Cookies)
+	}
+	if entry.Response.Status != 201 || entry.Response.Content.Text != "{\"id\":1}\n" ||
+		entry.Response.Content.MimeType != "application/json" {
+		t.Errorf("Unexpected response: %+v", entry.Response)
+	}
+	if entry.Comment != "POST /api/users" {
+		t.Errorf("Expected matched route in comment, got %q", entry.Comment)
+	}
+
+	if status := har.Log.Entries[1].Response.Status; status != 404 {
+		t.Errorf("Expected unmatched request with status 404, got %d", status)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=xml", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for unknown format, got %d", w.Code)
+	}
+}
+
+// TestHistoryLimits tests evicting requests by count and size and spilling them to disk
+func TestHistoryLimits(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "spill.jsonl")
+	history := newRequestHistory()
+	history.configure(&HistoryConfig{MaxEntries: 3, SpillFile: spillFile})
+
+	for i := 0; i < 5; i++ {
+		history.add(historyEntry{Path: fmt.Sprintf("/%d", i), ResponseBody: []byte("0123456789")})
+	}
+	entries := history.list()
+	if len(entries) != 3 || entries[0].Path != "/2" || entries[2].ID != 5 {
+		t.Fatalf("Expected the 3 most recent requests, got %+v", entries)
+	}
+
+	// A size limit evicts the oldest requests until the rest fit
+	size := entries[0].size()
+	history.configure(&HistoryConfig{MaxEntries: 3, MaxBytes: 2*size + 1, SpillFile: spillFile})
+	if entries := history.list(); len(entries) != 2 || entries[0].Path != "/3" {
+		t.Errorf("Expected 2 requests within the size limit, got %+v", entries)
+	}
+	history.add(historyEntry{Path: "/big", ResponseBody: make([]byte, 3*size)})
+	if entries := history.list(); len(entries) != 0 {
+		t.Errorf("Expected a request over the size limit to evict everything, got %d requests", len(entries))
+	}
+
+	// Growing the buffer keeps the stored requests
+	history.configure(&HistoryConfig{MaxEntries: 10})
+	for i := 0; i < 4; i++ {
+		history.add(historyEntry{Path: "/after"})
+	}
+	history.configure(&HistoryConfig{MaxEntries: 20})
+	if entries := history.list(); len(entries) != 4 || entries[3].ID != 10 {
+		t.Errorf("Expected 4 requests after resizing, got %+v", entries)
+	}
+
+	// Bodies are cut off at the body limit
+	history.configure(&HistoryConfig{MaxEntries: 20, MaxBodyBytes: 4})
+	history.add(historyEntry{Path: "/long", RequestBody: []byte("abcdefgh"), ResponseBody: []byte("abcd")})
+	entries = history.list()
+	if last := entries[len(entries)-1]; string(last.RequestBody) != "abcd" || !last.RequestBodyTruncated ||
+		string(last.ResponseBody) != "abcd" || last.ResponseBodyTruncated {
+		t.Errorf("Expected the request body to be truncated, got %+v", last)
+	}
+
+	history.flushSpills()
+	data, err := os.ReadFile(spillFile)
+	if err != nil {
+		t.Fatalf("Failed to read spill file: %v", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to parse spilled request: %v", err)
+		}
+		paths = append(paths, entry.Path)
+	}
+	if strings.Join(paths, ",") != "/0,/1,/2,/3,/4,/big" {
+		t.Errorf("Expected the evicted requests in order, got %v", paths)
+	}
+}
+
+// TestHistoryBodyCapture tests recording bodies only up to the body limit,
+// while handlers still get the whole request body
+func TestHistoryBodyCapture(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/echo", Method: "POST", StatusCode: 200, ResponseTemplate: true, Response: "{{.Body}}"}},
+	}
+	server.history.configure(&HistoryConfig{MaxBodyBytes: 8})
+	server.SetupRoutes()
+
+	for _, expect := range []bool{false, true} {
+		upload := strings.Repeat("0123456789", 100)
+		r := httptest.NewRequest("POST", "/echo", strings.NewReader(upload))
+		if expect {
+			r.Header.Set("Expect", "100-continue")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Body.String() != upload {
+			t.Errorf("Expected the handler to get the whole body, got %d bytes", w.Body.Len())
+		}
+
+		entries := server.history.list()
+		last := entries[len(entries)-1]
+		if string(last.RequestBody) != "01234567" || !last.RequestBodyTruncated ||
+			string(last.ResponseBody) != "01234567" || !last.ResponseBodyTruncated {
+			t.Errorf("Expected both bodies to be cut off while recording, got %+v", last)
+		}
+	}
+	// The recorder never holds more than the limit
+	recorder := getRecorder(httptest.NewRecorder())
+	recorder.limit = 8
+	for i := 0; i < 10; i++ {
+		recorder.Write([]byte("0123456789"))
+	}
+	if recorder.body.Len() != 8 || !recorder.truncated {
+		t.Errorf("Expected 8 bytes to be kept, got %d", recorder.body.Len())
+	}
+	putRecorder(recorder)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// validEndpointID matches explicit endpoint IDs, which are used in admin
+// API paths
+var validEndpointID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// endpointID returns the stable ID of an endpoint: its explicit id, or a
+// hash of its method and path, matchers included, so that the same endpoint
+// keeps its ID across reloads
+func endpointID(ep Endpoint) string {
+	if ep.ID != "" {
+		return ep.ID
+	}
+	return routeID(ep.Method, ep.Path)
+}
+
+// routeID hashes a method and path into an endpoint ID
+func routeID(method, path string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(method) + " " + path))
+	return hex.EncodeToString(sum[:6])
+}
+
+// validateEndpointIDs checks the explicit IDs of a list of endpoints. IDs
+// must be unique, except between endpoints with the same method and path.
+func validateEndpointIDs(endpoints []Endpoint) error {
+	routes := make(map[string]string)
+	for _, ep := range endpoints {
+		if ep.ID == "" {
+			continue
+		}
+		if !validEndpointID.MatchString(ep.ID) {
+			return fmt.Errorf("invalid endpoint id %q, expected letters, digits, '.', '_' or '-'", ep.ID)
+		}
+		route := strings.ToUpper(ep.Method) + " " + ep.Path
+		if other, exists := routes[ep.ID]; exists && other != route {
+			return fmt.Errorf("endpoint id %q is used by %s and %s", ep.ID, other, route)
+		}
+		routes[ep.ID] = route
+	}
+	return nil
+}
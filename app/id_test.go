@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEndpointID tests that endpoint IDs are explicit or depend on the
+// method and path only
+func TestEndpointID(t *testing.T) {
+	id := endpointID(Endpoint{Method: "get", Path: "/users/{id}", Response: "a"})
+	if id != endpointID(Endpoint{Method: "GET", Path: "/users/{id}", Response: "b"}) {
+		t.Error("Expected the same ID for the same method and path")
+	}
+	if id == endpointID(Endpoint{Method: "POST", Path: "/users/{id}"}) {
+		t.Error("Expected different IDs for different methods")
+	}
+	if id == endpointID(Endpoint{Method: "GET", Path: "/users/{id:[0-9]+}"}) {
+		t.Error("Expected different IDs for different matchers")
+	}
+	if len(id) != 12 {
+		t.Errorf("Expected a 12 character ID, got %q", id)
+	}
+	if id := endpointID(Endpoint{ID: "get-user", Method: "GET", Path: "/users/{id}"}); id != "get-user" {
+		t.Errorf("Expected the explicit ID, got %q", id)
+	}
+}
+
+// TestValidateEndpointIDs tests the checks of explicit endpoint IDs
+func TestValidateEndpointIDs(t *testing.T) {
+	for name, test := range map[string]struct {
+		endpoints []Endpoint
+		valid     bool
+	}{
+		"unique":     {[]Endpoint{{ID: "a", Method: "GET", Path: "/a"}, {ID: "b", Method: "GET", Path: "/b"}, {Method: "GET", Path: "/c"}}, true},
+		"same route": {[]Endpoint{{ID: "a", Method: "GET", Path: "/a"}, {ID: "a", Method: "get", Path: "/a"}}, true},
+		"duplicate":  {[]Endpoint{{ID: "a", Method: "GET", Path: "/a"}, {ID: "a", Method: "GET", Path: "/b"}}, false},
+		"slash":      {[]Endpoint{{ID: "users/get", Method: "GET", Path: "/users"}}, false},
+	} {
+		if err := validateEndpointIDs(test.endpoints); (err == nil) != test.valid {
+			t.Errorf("%s: unexpected result %v", name, err)
+		}
+	}
+}
+
+// TestEndpointIDAcrossAPIs tests referencing an endpoint by its ID in the
+// routes, the request history and expectations
+func TestEndpointIDAcrossAPIs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	config := `{
+		"plugins_dir": "` + filepath.Join(dir, "plugins") + `",
+		"endpoints": [
+			{"id": "create-payment", "path": "/api/pay", "method": "POST", "response": "paid"},
+			{"path": "/api/refund", "method": "POST", "response": "refunded"}
+		],
+		"expectations": [{"endpoint": "create-payment", "min_calls": 2}]
+	}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.SetupRoutes()
+
+	routes := server.listRoutes("")
+	if len(routes) != 2 || routes[0].ID != "create-payment" || routes[1].ID != routeID("POST", "/api/refund") {
+		t.Errorf("Unexpected route IDs %+v", routes)
+	}
+
+	for _, path := range []string{"/api/pay", "/api/pay", "/api/refund"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+	}
+	if results := server.expectations.list(); results[0].Calls != 2 || results[0].Status != ExpectationMet {
+		t.Errorf("Expected 2 calls of the endpoint, got %+v", results)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=jsonl&endpoint=create-payment", nil))
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"endpoint_id":"create-payment"`) {
+		t.Errorf("Expected 2 requests of the endpoint, got %s", w.Body.String())
+	}
+
+	// Explicit IDs can be toggled too
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/_admin/endpoints/create-payment/toggle", nil))
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/api/pay", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected the toggled endpoint to return 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// idempotencyMaxBody is the size of the largest response that is kept for
+// replays
+const idempotencyMaxBody = 1 << 20
+
+// idempotencyMaxKeys is the default number of keys remembered per endpoint
+const idempotencyMaxKeys = 10000
+
+// IdempotencyConfig tracks the idempotency keys sent to an endpoint, so that
+// the retry logic of clients can be verified
+type IdempotencyConfig struct {
+	Header   string `json:"header,omitempty"`   // request header carrying the key (default: Idempotency-Key)
+	TTL      int    `json:"ttl,omitempty"`      // milliseconds a key is remembered (default: 86400000)
+	Required bool   `json:"required,omitempty"` // reject requests without a key with 400
+	Replay   bool   `json:"replay,omitempty"`   // answer repeated keys with the first response, and with 409 if the request differs
+	MaxKeys  int    `json:"max_keys,omitempty"` // keys remembered, the least recently used are forgotten first (default: 10000)
+}
+
+// validateIdempotency checks the idempotency setting of an endpoint
+func validateIdempotency(config *IdempotencyConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if config.MaxKeys < 0 {
+		return fmt.Errorf("max_keys must not be negative")
+	}
+	return nil
+}
+
+// idempotencyKey is the state of a key sent to an endpoint
+type idempotencyKey struct {
+	fingerprint [sha256.Size]byte // hash of the method, URL and body of the first request
+	firstSeen   time.Time
+	lastSeen    time.Time
+	requests    int
+	replays     int
+	conflicts   int
+
+	// Response of the first request, kept for replays
+	pending    bool
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// idempotencyStore remembers the idempotency keys of an endpoint
+type idempotencyStore struct {
+	config  IdempotencyConfig
+	header  string
+	ttl     time.Duration
+	maxKeys int
+	now     func() time.Time
+
+	mutex sync.Mutex
+	keys  map[string]*idempotencyKey
+}
+
+// newIdempotencyStore creates an empty store from a validated configuration
+func newIdempotencyStore(config IdempotencyConfig) *idempotencyStore {
+	is := &idempotencyStore{
+		config:  config,
+		header:  config.Header,
+		ttl:     time.Duration(config.TTL) * time.Millisecond,
+		maxKeys: config.MaxKeys,
+		now:     time.Now,
+		keys:    make(map[string]*idempotencyKey),
+	}
+	if is.header == "" {
+		is.header = "Idempotency-Key"
+	}
+	if is.maxKeys == 0 {
+		is.maxKeys = idempotencyMaxKeys
+	}
+	if config.TTL == 0 {
+		is.ttl = 24 * time.Hour
+	}
+	return is
+}
+
+// begin looks up the key of a request. If the request was answered, without
+// a required key, with a replayed response or with a conflict, it returns
+// the status code and a reason to log. Otherwise the request is served
+// through the returned writer and finish must be called afterwards, if not
+// nil, to keep the response.
+func (is *idempotencyStore) begin(w http.ResponseWriter, r *http.Request) (writer http.ResponseWriter, finish func(), status int, reason string) {
+	key := r.Header.Get(is.header)
+	if key == "" {
+		if is.config.Required {
+			writeIdempotencyError(w, http.StatusBadRequest, fmt.Sprintf("Missing %s header", is.header))
+			return w, nil, http.StatusBadRequest, "Missing Idempotency Key"
+		}
+		return w, nil, 0, ""
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+	var fingerprint [sha256.Size]byte
+	hash.Sum(fingerprint[:0])
+
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	now := is.now()
+	entry, ok := is.keys[key]
+	if ok && now.Sub(entry.firstSeen) >= is.ttl {
+		ok = false
+	}
+	if !ok {
+		is.prune(now)
+		entry = &idempotencyKey{fingerprint: fingerprint, firstSeen: now}
+		is.keys[key] = entry
+	}
+	entry.requests++
+	entry.lastSeen = now
+
+	if ok {
+		if entry.fingerprint != fingerprint {
+			entry.conflicts++
+			if is.config.Replay {
+				writeIdempotencyError(w, http.StatusConflict, "Idempotency key reused with a different request")
+				return w, nil, http.StatusConflict, "Idempotency Key Reused"
+			}
+		} else if is.config.Replay && entry.pending {
+			entry.conflicts++
+			writeIdempotencyError(w, http.StatusConflict, "A request with this idempotency key is in progress")
+			return w, nil, http.StatusConflict, "Idempotency Key In Progress"
+		} else if is.config.Replay {
+			entry.replays++
+			for name, values := range entry.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.statusCode)
+			w.Write(entry.body)
+			return w, nil, entry.statusCode, "Idempotent Replay"
+		}
+		return w, nil, 0, ""
+	}
+	if !is.config.Replay {
+		return w, nil, 0, ""
+	}
+
+	// Keep the response of the first request. Server errors aren't kept, so
+	// that a retry is served again.
+	entry.pending = true
+	iw := &idempotencyWriter{ResponseWriter: w}
+	finish = func() {
+		is.mutex.Lock()
+		defer is.mutex.Unlock()
+		if iw.statusCode == 0 || iw.statusCode >= 500 || iw.overflow {
+			if is.keys[key] == entry {
+				delete(is.keys, key)
+			}
+			return
+		}
+		entry.pending = false
+		entry.statusCode = iw.statusCode
+		entry.header = iw.header
+		entry.body = iw.body.Bytes()
+	}
+	return iw, finish, 0, ""
+}
+
+// prune removes expired keys, and the least recently used ones while the
+// store is full, to make room for a new key. The caller must hold the mutex.
+func (is *idempotencyStore) prune(now time.Time) {
+	for key, entry := range is.keys {
+		if now.Sub(entry.firstSeen) >= is.ttl && !entry.pending {
+			delete(is.keys, key)
+		}
+	}
+	for len(is.keys) >= is.maxKeys {
+		oldest := ""
+		for key, entry := range is.keys {
+			if !entry.pending && (oldest == "" || entry.lastSeen.Before(is.keys[oldest].lastSeen)) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			return // all keys are in progress
+		}
+		delete(is.keys, oldest)
+	}
+}
+
+// reset forgets all keys
+func (is *idempotencyStore) reset() {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	is.keys = make(map[string]*idempotencyKey)
+}
+
+// snapshot returns the keys that haven't expired for the admin API, most
+// recently used first
+func (is *idempotencyStore) snapshot() []map[string]interface{} {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	now := is.now()
+	keys := make([]map[string]interface{}, 0, len(is.keys))
+	for key, entry := range is.keys {
+		if now.Sub(entry.firstSeen) >= is.ttl {
+			continue
+		}
+		snapshot := map[string]interface{}{
+			"key":        key,
+			"requests":   entry.requests,
+			"replays":    entry.replays,
+			"conflicts":  entry.conflicts,
+			"first_seen": entry.firstSeen,
+			"last_seen":  entry.lastSeen,
+			"expires_at": entry.firstSeen.Add(is.ttl),
+		}
+		if entry.pending {
+			snapshot["in_progress"] = true
+		} else if entry.statusCode != 0 {
+			snapshot["status_code"] = entry.statusCode
+		}
+		keys = append(keys, snapshot)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i]["last_seen"].(time.Time).After(keys[j]["last_seen"].(time.Time))
+	})
+	return keys
+}
+
+// writeIdempotencyError answers a request rejected because of its key
+func writeIdempotencyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// idempotencyWriter captures a response to replay it for repeated keys
+type idempotencyWriter struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	overflow   bool // the body is too large to be kept
+}
+
+// WriteHeader captures the status code and headers
+func (iw *idempotencyWriter) WriteHeader(statusCode int) {
+	if iw.statusCode == 0 {
+		iw.statusCode = statusCode
+		iw.header = iw.Header().Clone()
+	}
+	iw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the body up to idempotencyMaxBody
+func (iw *idempotencyWriter) Write(data []byte) (int, error) {
+	if iw.statusCode == 0 {
+		iw.WriteHeader(http.StatusOK)
+	}
+	if !iw.overflow && iw.body.Len()+len(data) <= idempotencyMaxBody {
+		iw.body.Write(data)
+	} else {
+		iw.overflow = true
+		iw.body.Reset()
+	}
+	return iw.ResponseWriter.Write(data)
+}
+
+// Flush passes flushes of streamed responses through
+func (iw *idempotencyWriter) Flush() {
+	if flusher, ok := iw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (iw *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
+
+// idempotencyStoreFor returns the idempotency store of a route. An unchanged
+// store keeps its keys when routes are set up again, e.g. on reload.
+func (ms *MockServer) idempotencyStoreFor(routeKey string, config IdempotencyConfig) *idempotencyStore {
+	if existing, ok := ms.idempotency[routeKey]; ok && reflect.DeepEqual(existing.config, config) {
+		return existing
+	}
+	is := newIdempotencyStore(config)
+	ms.idempotency[routeKey] = is
+	return is
+}
+
+// pruneIdempotencyStores drops the stores of endpoints that were removed or
+// no longer track idempotency keys. Must be called with ms.mutex held.
+func (ms *MockServer) pruneIdempotencyStores() {
+	tracked := ms.routeKeys(func(ep *Endpoint) bool { return ep.Idempotency != nil })
+	for routeKey := range ms.idempotency {
+		if !tracked[routeKey] {
+			delete(ms.idempotency, routeKey)
+		}
+	}
+}
+
+// setupIdempotencyAPI registers the admin API of idempotency keys
+func (ms *MockServer) setupIdempotencyAPI() {
+	// Show the keys sent to every endpoint tracking them
+	ms.router.HandleFunc("/_admin/idempotency", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		result := make(map[string]interface{}, len(ms.idempotency))
+		for routeKey, is := range ms.idempotency {
+			result[routeKey] = is.snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Forget keys, of all endpoints or of a route
+	ms.router.HandleFunc("/_admin/idempotency", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if route := r.URL.Query().Get("route"); route != "" {
+			is, ok := ms.idempotency[route]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("No idempotency keys tracked for %s", route)})
+				return
+			}
+			is.reset()
+		} else {
+			for _, is := range ms.idempotency {
+				is.reset()
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Idempotency keys cleared"})
+	}).Methods("DELETE")
+}
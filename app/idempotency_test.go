@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyReplay tests replaying the first response for repeated keys
+func TestIdempotencyReplay(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/payments", Method: "POST", Headers: map[string]string{"X-Region": "eu"}, Idempotency: &IdempotencyConfig{Replay: true, TTL: 60000}, Responses: []MappedResponse{
+				{StatusCode: 201, Response: map[string]string{"id": "pay_1"}},
+				{StatusCode: 201, Response: map[string]string{"id": "pay_2"}},
+				{StatusCode: 503, Response: "unavailable"},
+				{StatusCode: 201, Response: map[string]string{"id": "pay_3"}},
+			}},
+		},
+	}
+	server.SetupRoutes()
+	store := server.idempotency["POST /payments"]
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	call := func(key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	first := call("a", `{"amount": 10}`)
+	if first.Code != 201 || first.Body.String() != `{"id":"pay_1"}`+"\n" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Unexpected first response %d %q", first.Code, first.Body.String())
+	}
+
+	// A retry gets the same response without advancing the sequence
+	w := call("a", `{"amount": 10}`)
+	if w.Code != 201 || w.Body.String() != first.Body.String() || w.Header().Get("X-Region") != "eu" || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the first response to be replayed, got %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	// The same key with another body is a conflict
+	if w := call("a", `{"amount": 20}`); w.Code != 409 {
+		t.Errorf("Expected a conflict for a different body, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Requests without a key and new keys are served
+	if w := call("", `{"amount": 10}`); w.Body.String() != `{"id":"pay_2"}`+"\n" {
+		t.Errorf("Expected a request without key to be served, got %s", w.Body.String())
+	}
+
+	// Server errors aren't kept, so that a retry is served again
+	now = now.Add(time.Second)
+	if w := call("b", `{}`); w.Code != 503 {
+		t.Errorf("Expected the server error, got %d", w.Code)
+	}
+	if w := call("b", `{}`); w.Code != 201 || w.Body.String() != `{"id":"pay_3"}`+"\n" {
+		t.Errorf("Expected the retry after a server error to be served, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Keys expire after the TTL
+	snapshot := store.snapshot()
+	if len(snapshot) != 2 || snapshot[0]["key"] != "b" || snapshot[1]["requests"] != 3 || snapshot[1]["replays"] != 1 || snapshot[1]["conflicts"] != 1 {
+		t.Errorf("Unexpected keys %v", snapshot)
+	}
+	now = now.Add(time.Minute)
+	if w := call("a", `{"amount": 10}`); w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected an expired key to be served again")
+	}
+
+	// The admin API forgets keys
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/_admin/idempotency?route=POST%20/payments", nil))
+	if w.Code != 200 || len(store.snapshot()) != 0 {
+		t.Errorf("Expected the keys to be cleared, got %d %v", w.Code, store.snapshot())
+	}
+}
+
+// TestIdempotencyTracking tests tracking keys without replaying and
+// requiring them
+func TestIdempotencyTracking(t *testing.T) {
+	is := newIdempotencyStore(IdempotencyConfig{Header: "X-Request-Id", Required: true})
+	call := func(key, body string) (*httptest.ResponseRecorder, int) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("X-Request-Id", key)
+		}
+		_, _, status, _ := is.begin(w, r)
+		return w, status
+	}
+
+	if w, status := call("", ""); status != 400 || !strings.Contains(w.Body.String(), "Missing X-Request-Id header") {
+		t.Errorf("Expected a missing key to be rejected, got %d %s", status, w.Body.String())
+	}
+	for _, body := range []string{"a", "a", "b"} {
+		if _, status := call("k1", body); status != 0 {
+			t.Errorf("Expected the request to be served without replay, got %d", status)
+		}
+	}
+	if snapshot := is.snapshot(); len(snapshot) != 1 || snapshot[0]["requests"] != 3 || snapshot[0]["conflicts"] != 1 || snapshot[0]["replays"] != 0 {
+		t.Errorf("Unexpected keys %v", snapshot)
+	}
+
+	if validateIdempotency(&IdempotencyConfig{TTL: -1}) == nil {
+		t.Error("Expected a negative ttl to be rejected")
+	}
+	if validateIdempotency(&IdempotencyConfig{MaxKeys: -1}) == nil {
+		t.Error("Expected negative max_keys to be rejected")
+	}
+
+	// A full store forgets the least recently used keys
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	is = newIdempotencyStore(IdempotencyConfig{Header: "X-Request-Id", MaxKeys: 2})
+	is.now = func() time.Time { return now }
+	for _, key := range []string{"k1", "k2", "k1", "k3"} {
+		now = now.Add(time.Second)
+		call(key, "")
+	}
+	snapshot := is.snapshot()
+	if len(snapshot) != 2 || snapshot[0]["key"] != "k3" || snapshot[1]["key"] != "k1" {
+		t.Errorf("Expected k2 to be forgotten, got %v", snapshot)
+	}
+
+	// Stores of removed endpoints are dropped
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/orders", Method: "POST", StatusCode: 201, Idempotency: &IdempotencyConfig{}},
+			{Path: "/payments", Method: "POST", StatusCode: 201, Idempotency: &IdempotencyConfig{}},
+		},
+	}
+	server.SetupRoutes()
+	server.config.Endpoints = server.config.Endpoints[:1]
+	server.SetupRoutes()
+	if _, ok := server.idempotency["POST /orders"]; !ok || len(server.idempotency) != 1 {
+		t.Errorf("Expected only the store of the remaining endpoint, got %v", server.idempotency)
+	}
+}
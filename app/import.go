@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importSpec generates a plugin from an API description, a WSDL document
+// or an OpenAPI 3 document in JSON. The format is detected from the content.
+func importSpec(data []byte, name string) (*Plugin, []string, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(data, []byte("<")) {
+		return importWSDL(data, name)
+	}
+	if bytes.HasPrefix(data, []byte("{")) {
+		return importOpenAPI(data, name)
+	}
+	return nil, nil, fmt.Errorf("unsupported format, expected a WSDL document or an OpenAPI 3 document in JSON")
+}
+
+// runImport implements the import command and returns the exit code
+func runImport(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	name := flags.String("name", "", "Name of the generated plugin (default: taken from the spec)")
+	out := flags.String("out", "", "Plugin file to write (default: standard output)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: nmock import [--name NAME] [--out FILE] <spec>")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: failed to read %s: %v\n", path, err)
+		return 2
+	}
+	if *name == "" && *out != "" {
+		*name = strings.TrimSuffix(filepath.Base(*out), filepath.Ext(*out))
+	}
+
+	plugin, warnings, err := importSpec(data, *name)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "import: warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %s: %v\n", path, err)
+		return 1
+	}
+	if plugin.Name == "" {
+		plugin.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	encoded, err := json.MarshalIndent(plugin, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	encoded = append(encoded, '\n')
+
+	if *out == "" {
+		stdout.Write(encoded)
+		return 0
+	}
+	if err := os.WriteFile(*out, encoded, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "import: failed to write %s: %v\n", *out, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Imported %d endpoints into %s\n", len(plugin.allEndpoints()), *out)
+	return 0
+}
+
+// setupImportAPI registers the admin API generating plugins from specs
+func (ms *MockServer) setupImportAPI() {
+	// Generate a plugin from the spec in the body and load it
+	ms.router.HandleFunc("/_admin/plugins/import", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fail := func(status int, message string) {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": message})
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			fail(http.StatusBadRequest, fmt.Sprintf("Failed to read spec: %v", err))
+			return
+		}
+		query := r.URL.Query()
+		plugin, warnings, err := importSpec(data, query.Get("name"))
+		if err != nil {
+			fail(http.StatusBadRequest, fmt.Sprintf("Invalid spec: %v", err))
+			return
+		}
+		if plugin.Name == "" || !validEndpointID.MatchString(plugin.Name) {
+			fail(http.StatusBadRequest, fmt.Sprintf("Invalid plugin name %q, set one with ?name=", plugin.Name))
+			return
+		}
+		if warnings == nil {
+			warnings = []string{}
+		}
+
+		// A dry run only shows the plugin that would be generated
+		if query.Get("dry_run") == "true" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"plugin": plugin, "warnings": warnings})
+			return
+		}
+
+		ms.mutex.RLock()
+		_, exists := ms.plugins[plugin.Name]
+		ms.mutex.RUnlock()
+		if exists && query.Get("replace") != "true" {
+			fail(http.StatusConflict, fmt.Sprintf("Plugin %s already exists, use ?replace=true to overwrite it", plugin.Name))
+			return
+		}
+
+		if err := os.MkdirAll(ms.pluginsDir, 0755); err != nil {
+			fail(http.StatusInternalServerError, fmt.Sprintf("Failed to create plugins directory: %v", err))
+			return
+		}
+		if err := ms.savePlugin(plugin.Name, plugin); err != nil {
+			fail(http.StatusInternalServerError, fmt.Sprintf("Failed to save plugin: %v", err))
+			return
+		}
+		if err := ms.LoadPlugins(); err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ms.SetupRoutes()
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   fmt.Sprintf("Imported %d endpoints into plugin %s", len(plugin.allEndpoints()), plugin.Name),
+			"plugin":    plugin.Name,
+			"endpoints": len(plugin.allEndpoints()),
+			"warnings":  warnings,
+		})
+		log.Printf("Plugin %s imported via admin API", plugin.Name)
+	}).Methods("POST")
+}
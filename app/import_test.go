@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestImportCommand tests writing a generated plugin file
+func TestImportCommand(t *testing.T) {
+	dir := t.TempDir()
+	specPath := filepath.Join(dir, "orders.wsdl")
+	os.WriteFile(specPath, []byte("\xef\xbb\xbf"+testWSDL), 0644)
+	out := filepath.Join(dir, "legacy-orders.json")
+
+	var stdout bytes.Buffer
+	if code := runImport([]string{"--out", out, specPath}, &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if stdout.String() != "Imported 2 endpoints into "+out+"\n" {
+		t.Errorf("Unexpected output: %q", stdout.String())
+	}
+
+	var plugin Plugin
+	data, _ := os.ReadFile(out)
+	if err := json.Unmarshal(data, &plugin); err != nil {
+		t.Fatalf("Invalid plugin file: %v", err)
+	}
+	if plugin.Name != "legacy-orders" || !plugin.Enabled || len(plugin.Endpoints) != 2 ||
+		plugin.Endpoints[0].ResponseMap.Key != "{{.SOAPAction}}" {
+		t.Errorf("Unexpected plugin: %+v", plugin)
+	}
+
+	// Unknown formats are rejected
+	os.WriteFile(specPath, []byte("name: orders"), 0644)
+	if code := runImport([]string{specPath}, &stdout); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if strings.Contains(stdout.String(), "name: orders") {
+		t.Error("Expected nothing to be written for an unknown format")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// inboxLimit is the number of requests kept per channel
+const inboxLimit = 1000
+
+// inboxEntry is a request captured by the webhook inbox
+type inboxEntry struct {
+	ID         int                 `json:"id"`
+	ReceivedAt time.Time           `json:"received_at"`
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Query      map[string][]string `json:"query,omitempty"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+}
+
+// inbox stores captured requests per channel and wakes up waiting readers
+type inbox struct {
+	mutex    sync.Mutex
+	nextID   int
+	channels map[string][]inboxEntry
+	changed  chan struct{} // closed and replaced whenever a request arrives
+}
+
+// newInbox creates an empty inbox
+func newInbox() *inbox {
+	return &inbox{
+		channels: make(map[string][]inboxEntry),
+		changed:  make(chan struct{}),
+	}
+}
+
+// add stores a request in a channel
+func (ib *inbox) add(channel string, entry inboxEntry) int {
+	ib.mutex.Lock()
+	defer ib.mutex.Unlock()
+
+	ib.nextID++
+	entry.ID = ib.nextID
+	entries := append(ib.channels[channel], entry)
+	if len(entries) > inboxLimit {
+		entries = entries[len(entries)-inboxLimit:]
+	}
+	ib.channels[channel] = entries
+
+	close(ib.changed)
+	ib.changed = make(chan struct{})
+	return entry.ID
+}
+
+// wait returns the requests of a channel once at least count have been
+// received, or what has been received when the timeout or context ends
+func (ib *inbox) wait(r *http.Request, channel string, count int, timeout time.Duration) ([]inboxEntry, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		ib.mutex.Lock()
+		entries := append([]inboxEntry{}, ib.channels[channel]...)
+		changed := ib.changed
+		ib.mutex.Unlock()
+
+		if len(entries) >= count {
+			return entries, true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return entries, false
+		case <-r.Context().Done():
+			return entries, false
+		}
+	}
+}
+
+// clear removes the requests of a channel
+func (ib *inbox) clear(channel string) {
+	ib.mutex.Lock()
+	defer ib.mutex.Unlock()
+	delete(ib.channels, channel)
+}
+
+// snapshot returns a copy of all channels
+func (ib *inbox) snapshot() map[string][]inboxEntry {
+	ib.mutex.Lock()
+	defer ib.mutex.Unlock()
+
+	result := make(map[string][]inboxEntry, len(ib.channels))
+	for channel, entries := range ib.channels {
+		result[channel] = append([]inboxEntry{}, entries...)
+	}
+	return result
+}
+
+// restore replaces all channels
+func (ib *inbox) restore(channels map[string][]inboxEntry) {
+	ib.mutex.Lock()
+	defer ib.mutex.Unlock()
+
+	ib.channels = make(map[string][]inboxEntry, len(channels))
+	for channel, entries := range channels {
+		ib.channels[channel] = entries
+		for _, entry := range entries {
+			ib.nextID = max(ib.nextID, entry.ID)
+		}
+	}
+}
+
+// counts returns the number of requests per channel
+func (ib *inbox) counts() map[string]int {
+	ib.mutex.Lock()
+	defer ib.mutex.Unlock()
+
+	result := make(map[string]int, len(ib.channels))
+	for channel, entries := range ib.channels {
+		result[channel] = len(entries)
+	}
+	return result
+}
+
+// setupInboxAPI registers the capture endpoints and their admin API
+func (ms *MockServer) setupInboxAPI() {
+	// Capture any request sent to a channel
+	ms.router.HandleFunc("/_inbox/{channel}", func(w http.ResponseWriter, r *http.Request) {
+		channel := mux.Vars(r)["channel"]
+		body, _ := io.ReadAll(r.Body)
+
+		id := ms.inbox.add(channel, inboxEntry{
+			ReceivedAt: time.Now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.Query(),
+			Headers:    r.Header,
+			Body:       string(body),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "received", "id": id})
+		log.Printf("%s %s - captured [inbox]", r.Method, r.URL.Path)
+	})
+
+	// List channels with their number of requests
+	ms.router.HandleFunc("/_admin/inbox", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ms.inbox.counts())
+	}).Methods("GET")
+
+	// Get the requests of a channel, optionally waiting for them
+	ms.router.HandleFunc("/_admin/inbox/{channel}", func(w http.ResponseWriter, r *http.Request) {
+		channel := mux.Vars(r)["channel"]
+
+		count := 1
+		if value, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && value > 0 {
+			count = value
+		}
+		waitMs, _ := strconv.Atoi(r.URL.Query().Get("wait"))
+
+		entries, ok := ms.inbox.wait(r, channel, count, time.Duration(waitMs)*time.Millisecond)
+		if waitMs <= 0 {
+			ok = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"channel":  channel,
+			"count":    len(entries),
+			"requests": entries,
+		})
+	}).Methods("GET")
+
+	// Clear the requests of a channel
+	ms.router.HandleFunc("/_admin/inbox/{channel}", func(w http.ResponseWriter, r *http.Request) {
+		ms.inbox.clear(mux.Vars(r)["channel"])
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Inbox cleared"})
+	}).Methods("DELETE")
+}
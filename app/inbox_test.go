@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWebhookInbox tests capturing requests and waiting for them
+func TestWebhookInbox(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.SetupRoutes()
+
+	// Waiting times out while nothing has been received
+	req := httptest.NewRequest("GET", "/_admin/inbox/stripe?wait=50", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != 408 {
+		t.Errorf("Expected status 408, got %d", w.Code)
+	}
+
+	// A waiting reader is woken up by an incoming webhook
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		req := httptest.NewRequest("POST", "/_inbox/stripe?source=test", strings.NewReader(`{"type":"charge.succeeded"}`))
+		req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+		server.router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	req = httptest.NewRequest("GET", "/_admin/inbox/stripe?wait=2000", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var result struct {
+		Count    int          `json:"count"`
+		Requests []inboxEntry `json:"requests"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Count != 1 {
+		t.Fatalf("Expected 1 request, got %d", result.Count)
+	}
+	entry := result.Requests[0]
+	if entry.Method != "POST" || entry.Body != `{"type":"charge.succeeded"}` ||
+		entry.Headers["Stripe-Signature"][0] != "t=1,v1=abc" || entry.Query["source"][0] != "test" {
+		t.Errorf("Unexpected captured request: %+v", entry)
+	}
+
+	// Clearing empties the channel
+	server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/_admin/inbox/stripe", nil))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/inbox/stripe", nil))
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || result.Count != 0 {
+		t.Errorf("Expected empty channel, got %d requests (status %d)", result.Count, w.Code)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxJobs is the number of jobs kept per job API; the oldest are dropped
+const maxJobs = 1000
+
+// JobAPI is an asynchronous job API: POST creates a job that is answered
+// with 202, and the job moves through its states over time while clients
+// poll it
+type JobAPI struct {
+	Name          string      `json:"name"`
+	Path          string      `json:"path"`                     // collection path, e.g. /api/exports
+	States        []JobState  `json:"states,omitempty"`         // states in order, the last one is final (default: queued, running, succeeded)
+	Result        interface{} `json:"result,omitempty"`         // result added to jobs in the final state
+	Webhook       string      `json:"webhook,omitempty"`        // URL the job is posted to when it finishes
+	CallbackField string      `json:"callback_field,omitempty"` // field of the request body overriding webhook, e.g. callback_url
+}
+
+// JobState is a state of a job and how long jobs stay in it
+type JobState struct {
+	Name     string `json:"name"`
+	Duration int    `json:"duration,omitempty"` // milliseconds before the next state; ignored for the last state
+}
+
+// defaultJobStates are the states of jobs without configured states
+var defaultJobStates = []JobState{{Name: "queued", Duration: 1000}, {Name: "running", Duration: 3000}, {Name: "succeeded"}}
+
+// validateJobs checks the job APIs of a configuration
+func validateJobs(jobs []JobAPI) error {
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		if job.Name == "" {
+			return fmt.Errorf("invalid job API %s: name is required", job.Path)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicate job API %s", job.Name)
+		}
+		names[job.Name] = true
+		if !strings.HasPrefix(job.Path, "/") || strings.Contains(job.Path, "{") {
+			return fmt.Errorf("invalid job API %s: path must start with / and have no variables", job.Name)
+		}
+		for _, state := range job.States {
+			if state.Name == "" {
+				return fmt.Errorf("invalid job API %s: states need a name", job.Name)
+			}
+			if state.Duration < 0 {
+				return fmt.Errorf("invalid job API %s: duration of state %s must not be negative", job.Name, state.Name)
+			}
+		}
+		if job.Webhook != "" {
+			if target, err := url.Parse(job.Webhook); err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+				return fmt.Errorf("invalid job API %s: webhook must be an http or https URL", job.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// job is a job created through a job API
+type job struct {
+	id        string
+	request   interface{}
+	createdAt time.Time
+	cancelled time.Time   // zero unless cancelled
+	timer     *time.Timer // sends the webhook when the job finishes
+}
+
+// jobQueue holds the jobs of a job API
+type jobQueue struct {
+	config JobAPI
+	states []JobState
+	now    func() time.Time
+	client *http.Client
+
+	mutex  sync.Mutex
+	jobs   map[string]*job
+	order  []string
+	nextID int
+}
+
+// newJobQueue creates an empty queue from a validated job API
+func newJobQueue(config JobAPI) *jobQueue {
+	jq := &jobQueue{
+		config: config,
+		states: config.States,
+		now:    time.Now,
+		client: &http.Client{Timeout: 5 * time.Second},
+		jobs:   make(map[string]*job),
+		nextID: 1,
+	}
+	if len(jq.states) == 0 {
+		jq.states = defaultJobStates
+	}
+	return jq
+}
+
+// duration returns the time from creation to the final state
+func (jq *jobQueue) duration() time.Duration {
+	var total time.Duration
+	for _, state := range jq.states[:len(jq.states)-1] {
+		total += time.Duration(state.Duration) * time.Millisecond
+	}
+	return total
+}
+
+// view returns the current state of a job. The state follows from the time
+// since the job was created, so jobs don't need a timer per state.
+func (jq *jobQueue) view(j *job) map[string]interface{} {
+	now := jq.now()
+	if !j.cancelled.IsZero() {
+		now = j.cancelled
+	}
+	elapsed := now.Sub(j.createdAt)
+
+	index := len(jq.states) - 1
+	entered := j.createdAt
+	remaining := time.Duration(0)
+	for i, state := range jq.states[:len(jq.states)-1] {
+		duration := time.Duration(state.Duration) * time.Millisecond
+		if now.Before(entered.Add(duration)) {
+			index = i
+			remaining = entered.Add(duration).Sub(now)
+			break
+		}
+		entered = entered.Add(duration)
+	}
+
+	progress := 100
+	if total := jq.duration(); index < len(jq.states)-1 && total > 0 {
+		progress = int(elapsed * 100 / total)
+	}
+
+	view := map[string]interface{}{
+		"id":         j.id,
+		"status":     jq.states[index].Name,
+		"progress":   progress,
+		"created_at": j.createdAt.UTC().Format(time.RFC3339Nano),
+		"updated_at": entered.UTC().Format(time.RFC3339Nano),
+	}
+	if j.request != nil {
+		view["request"] = j.request
+	}
+	switch {
+	case !j.cancelled.IsZero():
+		view["status"] = "cancelled"
+		view["updated_at"] = j.cancelled.UTC().Format(time.RFC3339Nano)
+	case index == len(jq.states)-1:
+		if jq.config.Result != nil {
+			view["result"] = jq.config.Result
+		}
+	default:
+		view["retry_after_ms"] = remaining.Milliseconds()
+	}
+	return view
+}
+
+// create adds a job for a request body, which may be empty or JSON
+func (jq *jobQueue) create(body []byte) (map[string]interface{}, error) {
+	var request interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %v", err)
+		}
+	}
+
+	webhook := jq.config.Webhook
+	if object, ok := request.(map[string]interface{}); ok && jq.config.CallbackField != "" {
+		if callback, ok := object[jq.config.CallbackField].(string); ok && callback != "" {
+			target, err := url.Parse(callback)
+			if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+				return nil, fmt.Errorf("invalid %s, expected an http or https URL", jq.config.CallbackField)
+			}
+			webhook = callback
+		}
+	}
+
+	jq.mutex.Lock()
+	defer jq.mutex.Unlock()
+
+	j := &job{
+		id:        fmt.Sprintf("job-%d", jq.nextID),
+		request:   request,
+		createdAt: jq.now(),
+	}
+	jq.nextID++
+	jq.jobs[j.id] = j
+	jq.order = append(jq.order, j.id)
+	if len(jq.order) > maxJobs {
+		jq.drop(jq.order[0])
+	}
+
+	if webhook != "" {
+		j.timer = time.AfterFunc(jq.duration(), func() {
+			jq.mutex.Lock()
+			view := jq.view(j)
+			jq.mutex.Unlock()
+			jq.notify(webhook, view)
+		})
+	}
+	return jq.view(j), nil
+}
+
+// drop removes a job and stops its webhook. The caller must hold the mutex.
+func (jq *jobQueue) drop(id string) {
+	if j, ok := jq.jobs[id]; ok && j.timer != nil {
+		j.timer.Stop()
+	}
+	delete(jq.jobs, id)
+	for i, existing := range jq.order {
+		if existing == id {
+			jq.order = append(jq.order[:i], jq.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// notify posts a finished job to its webhook
+func (jq *jobQueue) notify(webhook string, view map[string]interface{}) {
+	data, err := json.Marshal(view)
+	if err != nil {
+		log.Printf("Failed to encode job %v: %v", view["id"], err)
+		return
+	}
+	resp, err := jq.client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to send job %v to %s: %v", view["id"], webhook, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Webhook of job %v to %s failed with status %d", view["id"], webhook, resp.StatusCode)
+	}
+}
+
+// cancel stops a job that hasn't finished. It returns the job, whether it
+// was found and whether it was cancelled.
+func (jq *jobQueue) cancel(id string) (view map[string]interface{}, found, cancelled bool) {
+	jq.mutex.Lock()
+	defer jq.mutex.Unlock()
+
+	j, ok := jq.jobs[id]
+	if !ok {
+		return nil, false, false
+	}
+	if !j.cancelled.IsZero() || jq.now().Sub(j.createdAt) >= jq.duration() {
+		return jq.view(j), true, false
+	}
+	j.cancelled = jq.now()
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	return jq.view(j), true, true
+}
+
+// stop stops the webhooks of all jobs, when the job API is removed or
+// replaced
+func (jq *jobQueue) stop() {
+	jq.mutex.Lock()
+	defer jq.mutex.Unlock()
+	for _, j := range jq.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+	}
+}
+
+// jobQueueFor returns the queue of a job API. An unchanged job API keeps its
+// jobs when routes are set up again, e.g. on reload.
+func (ms *MockServer) jobQueueFor(config JobAPI) *jobQueue {
+	if existing, ok := ms.jobQueues[config.Name]; ok && reflect.DeepEqual(existing.config, config) {
+		return existing
+	}
+	if existing, ok := ms.jobQueues[config.Name]; ok {
+		existing.stop()
+	}
+	jq := newJobQueue(config)
+	ms.jobQueues[config.Name] = jq
+	return jq
+}
+
+// jobRoutes compiles the routes of the job APIs of the configuration
+func (ms *MockServer) jobRoutes() []*endpointRoute {
+	queues := make(map[string]*jobQueue, len(ms.config.Jobs))
+	var routes []*endpointRoute
+	for _, config := range ms.config.Jobs {
+		jq := ms.jobQueueFor(config)
+		queues[config.Name] = jq
+		source := "jobs " + config.Name
+		itemPath := strings.TrimSuffix(config.Path, "/") + "/{id}"
+
+		add := func(method, routePath string, handle func(w http.ResponseWriter, r *http.Request) int) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if info := requestInfoFrom(r); info != nil {
+					info.Route = method + " " + routePath
+					info.Source = source
+				}
+				status := handle(w, r)
+				log.Printf("%s %s - %d [%s]", r.Method, r.URL.Path, status, source)
+			})
+			route, err := newEndpointRoute(method, routePath, handler)
+			if err != nil {
+				log.Printf("Invalid path for %s %s [%s]: %v", method, routePath, source, err)
+				return
+			}
+			route.source = source
+			routes = append(routes, route)
+		}
+
+		add("POST", config.Path, func(w http.ResponseWriter, r *http.Request) int {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeResourceJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return http.StatusBadRequest
+			}
+			view, err := jq.create(body)
+			if err != nil {
+				writeResourceJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return http.StatusBadRequest
+			}
+			w.Header().Set("Location", strings.TrimSuffix(config.Path, "/")+"/"+view["id"].(string))
+			writeResourceJSON(w, http.StatusAccepted, view)
+			return http.StatusAccepted
+		})
+
+		add("GET", config.Path, func(w http.ResponseWriter, r *http.Request) int {
+			jq.mutex.Lock()
+			views := make([]map[string]interface{}, 0, len(jq.order))
+			for _, id := range jq.order {
+				views = append(views, jq.view(jq.jobs[id]))
+			}
+			jq.mutex.Unlock()
+			writeResourceJSON(w, http.StatusOK, views)
+			return http.StatusOK
+		})
+
+		add("GET", itemPath, func(w http.ResponseWriter, r *http.Request) int {
+			jq.mutex.Lock()
+			j, ok := jq.jobs[mux.Vars(r)["id"]]
+			var view map[string]interface{}
+			if ok {
+				view = jq.view(j)
+			}
+			jq.mutex.Unlock()
+
+			if !ok {
+				writeResourceJSON(w, http.StatusNotFound, map[string]string{"error": "Job not found"})
+				return http.StatusNotFound
+			}
+			if remaining, pending := view["retry_after_ms"].(int64); pending {
+				w.Header().Set("Retry-After", fmt.Sprint((remaining+999)/1000))
+			}
+			writeResourceJSON(w, http.StatusOK, view)
+			return http.StatusOK
+		})
+
+		add("DELETE", itemPath, func(w http.ResponseWriter, r *http.Request) int {
+			view, found, cancelled := jq.cancel(mux.Vars(r)["id"])
+			switch {
+			case !found:
+				writeResourceJSON(w, http.StatusNotFound, map[string]string{"error": "Job not found"})
+				return http.StatusNotFound
+			case !cancelled:
+				writeResourceJSON(w, http.StatusConflict, map[string]interface{}{"error": "Job already finished", "job": view})
+				return http.StatusConflict
+			}
+			writeResourceJSON(w, http.StatusOK, view)
+			return http.StatusOK
+		})
+	}
+
+	// Forget the jobs of removed job APIs
+	for name, jq := range ms.jobQueues {
+		if _, ok := queues[name]; !ok {
+			jq.stop()
+			delete(ms.jobQueues, name)
+		}
+	}
+	return routes
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJobAPI tests creating jobs and polling them through their states
+func TestJobAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Jobs: []JobAPI{{
+			Name:   "exports",
+			Path:   "/api/exports",
+			States: []JobState{{Name: "pending", Duration: 1000}, {Name: "processing", Duration: 3000}, {Name: "done"}},
+			Result: map[string]interface{}{"url": "/files/export.csv"},
+		}},
+	}
+	server.SetupRoutes()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.jobQueues["exports"].now = func() time.Time { return now }
+
+	call := func(method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var result map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w, result
+	}
+
+	w, job := call("POST", "/api/exports", `{"format": "csv"}`)
+	if w.Code != 202 || job["id"] != "job-1" || job["status"] != "pending" || w.Header().Get("Location") != "/api/exports/job-1" {
+		t.Fatalf("Expected a pending job, got %d %v", w.Code, job)
+	}
+	if request, _ := job["request"].(map[string]interface{}); request["format"] != "csv" {
+		t.Errorf("Expected the request to be kept, got %v", job["request"])
+	}
+
+	tests := []struct {
+		elapsed    time.Duration
+		status     string
+		progress   float64
+		retryAfter string
+	}{
+		{500 * time.Millisecond, "pending", 12, "1"},
+		{1500 * time.Millisecond, "processing", 37, "3"},
+		{4 * time.Second, "done", 100, ""},
+	}
+	for _, test := range tests {
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Add(test.elapsed)
+		w, job := call("GET", "/api/exports/job-1", "")
+		if w.Code != 200 || job["status"] != test.status || job["progress"] != test.progress || w.Header().Get("Retry-After") != test.retryAfter {
+			t.Errorf("After %v expected %s at %v%%, got %v (Retry-After %q)", test.elapsed, test.status, test.progress, job, w.Header().Get("Retry-After"))
+		}
+	}
+	if _, job := call("GET", "/api/exports/job-1", ""); job["result"] == nil || job["updated_at"] != "2024-01-01T12:00:04Z" {
+		t.Errorf("Expected the result once done, got %v", job)
+	}
+
+	// Unfinished jobs can be cancelled
+	call("POST", "/api/exports", "")
+	if w, job := call("DELETE", "/api/exports/job-2", ""); w.Code != 200 || job["status"] != "cancelled" {
+		t.Errorf("Expected the job to be cancelled, got %d %v", w.Code, job)
+	}
+	now = now.Add(time.Hour)
+	if _, job := call("GET", "/api/exports/job-2", ""); job["status"] != "cancelled" || job["result"] != nil {
+		t.Errorf("Expected the job to stay cancelled, got %v", job)
+	}
+	if w, _ := call("DELETE", "/api/exports/job-1", ""); w.Code != 409 {
+		t.Errorf("Expected finished jobs not to be cancelled, got %d", w.Code)
+	}
+	if w, _ := call("GET", "/api/exports/job-9", ""); w.Code != 404 {
+		t.Errorf("Expected unknown jobs to get 404, got %d", w.Code)
+	}
+	if w, _ := call("POST", "/api/exports", "{"); w.Code != 400 {
+		t.Errorf("Expected invalid bodies to be rejected, got %d", w.Code)
+	}
+	if w, _ := call("GET", "/api/exports", ""); !strings.Contains(w.Body.String(), `"id":"job-2"`) {
+		t.Errorf("Expected the jobs to be listed, got %s", w.Body.String())
+	}
+
+	// Jobs survive setting up routes again with the same configuration
+	server.SetupRoutes()
+	if w, _ := call("GET", "/api/exports/job-1", ""); w.Code != 200 {
+		t.Errorf("Expected jobs to be kept, got %d", w.Code)
+	}
+
+	for _, jobs := range [][]JobAPI{
+		{{Path: "/jobs"}},
+		{{Name: "a", Path: "/a"}, {Name: "a", Path: "/b"}},
+		{{Name: "a", Path: "/a/{id}"}},
+		{{Name: "a", Path: "/a", States: []JobState{{Name: "x", Duration: -1}}}},
+		{{Name: "a", Path: "/a", Webhook: "ftp://example.com"}},
+	} {
+		if validateJobs(jobs) == nil {
+			t.Errorf("Expected %+v to be rejected", jobs)
+		}
+	}
+}
+
+// TestJobWebhook tests posting finished jobs to a callback URL
+func TestJobWebhook(t *testing.T) {
+	received := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.URL.Path + " " + string(body)
+	}))
+	defer hook.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Jobs: []JobAPI{{
+			Name:          "reports",
+			Path:          "/reports",
+			States:        []JobState{{Name: "running", Duration: 20}, {Name: "failed"}},
+			Webhook:       hook.URL + "/default",
+			CallbackField: "callback_url",
+		}},
+	}
+	server.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/reports", strings.NewReader(`{"callback_url": "`+hook.URL+`/custom"}`)))
+	if w.Code != 202 {
+		t.Fatalf("Expected the job to be created, got %d", w.Code)
+	}
+	select {
+	case got := <-received:
+		if !strings.HasPrefix(got, "/custom ") || !strings.Contains(got, `"status":"failed"`) {
+			t.Errorf("Unexpected webhook %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a webhook when the job finished")
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/reports", strings.NewReader(`{"callback_url": "file:///etc"}`)))
+	if w.Code != 400 {
+		t.Errorf("Expected invalid callback URLs to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// journalEntry is a request of the history as returned by the requests
+// query API, with readable bodies and the latency in milliseconds
+type journalEntry struct {
+	ID        int       `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	LatencyMs float64   `json:"latency_ms"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+
+	RequestHeaders       http.Header `json:"request_headers"`
+	RequestBody          string      `json:"request_body,omitempty"`
+	RequestBodyEncoding  string      `json:"request_body_encoding,omitempty"` // "base64" for binary bodies
+	StatusCode           int         `json:"status_code"`
+	ResponseHeaders      http.Header `json:"response_headers"`
+	ResponseBody         string      `json:"response_body,omitempty"`
+	ResponseBodyEncoding string      `json:"response_body_encoding,omitempty"`
+
+	Matched    bool              `json:"matched"`         // served by an endpoint, resource or plugin
+	Route      string            `json:"route,omitempty"` // matched endpoint as "METHOD /path"
+	Source     string            `json:"source,omitempty"`
+	EndpointID string            `json:"endpoint_id,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// newJournalEntry converts a history entry for the query API
+func newJournalEntry(entry historyEntry) journalEntry {
+	je := journalEntry{
+		ID:              entry.ID,
+		StartedAt:       entry.StartedAt,
+		LatencyMs:       float64(entry.Duration) / float64(time.Millisecond),
+		IP:              entry.IP,
+		Method:          entry.Method,
+		URL:             entry.URL,
+		Path:            entry.Path,
+		Proto:           entry.Proto,
+		RequestHeaders:  entry.RequestHeaders,
+		StatusCode:      entry.StatusCode,
+		ResponseHeaders: entry.ResponseHeaders,
+		Matched:         entry.Route != "",
+		Route:           entry.Route,
+		Source:          entry.Source,
+		EndpointID:      entry.EndpointID,
+		Tags:            entry.Tags,
+	}
+	je.RequestBody, je.RequestBodyEncoding = harText(entry.RequestBody)
+	je.ResponseBody, je.ResponseBodyEncoding = harText(entry.ResponseBody)
+	return je
+}
+
+// clear removes all stored requests
+func (h *requestHistory) clear() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	removed := h.count
+	clear(h.ring)
+	h.start, h.count, h.bytes = 0, 0, 0
+	return removed
+}
+
+// get returns the stored request with an ID
+func (h *requestHistory) get(id int) (historyEntry, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i := 0; i < h.count; i++ {
+		if entry := h.ring[(h.start+i)%len(h.ring)]; entry.ID == id {
+			return entry, true
+		}
+	}
+	return historyEntry{}, false
+}
+
+// setupJournalAPI registers the API querying the requests of the history
+func (ms *MockServer) setupJournalAPI() {
+	// List recorded requests, oldest first, filtered like the export
+	ms.router.HandleFunc("/_admin/requests", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		query := r.URL.Query()
+		filter, err := parseHistoryFilter(query)
+		limit := 0
+		if err == nil && query.Get("limit") != "" {
+			if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 0 {
+				err = fmt.Errorf("invalid limit %q", query.Get("limit"))
+			}
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		// The limit keeps the most recent requests
+		entries := filter.apply(ms.history.list())
+		if limit > 0 && len(entries) > limit {
+			entries = entries[len(entries)-limit:]
+		}
+		result := make([]journalEntry, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, newJournalEntry(ms.secrets.redactEntry(entry)))
+		}
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Get a single recorded request
+	ms.router.HandleFunc("/_admin/requests/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		entry, ok := ms.history.get(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Request not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(newJournalEntry(ms.secrets.redactEntry(entry)))
+	}).Methods("GET")
+
+	// Forget recorded requests, e.g. between test cases
+	ms.router.HandleFunc("/_admin/requests", func(w http.ResponseWriter, r *http.Request) {
+		removed := ms.history.clear()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Request history cleared", "removed": removed})
+	}).Methods("DELETE")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRequestJournal tests querying, reading and clearing recorded requests
+func TestRequestJournal(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 1}},
+			{Path: "/api/users/{id}", Method: "GET", Response: "user"},
+		},
+	}
+	server.SetupRoutes()
+
+	started := time.Now().Add(-time.Second)
+	req := httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"name":"Alice"}`))
+	req.Header.Set("X-Trace", "abc")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/1", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/2", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/api/orders", strings.NewReader("\xff\xfe")))
+
+	query := func(target string) ([]journalEntry, int) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var entries []journalEntry
+		json.Unmarshal(w.Body.Bytes(), &entries)
+		return entries, w.Code
+	}
+
+	entries, _ := query("/_admin/requests")
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 requests without admin requests, got %d", len(entries))
+	}
+	first := entries[0]
+	if first.Method != "POST" || first.RequestBody != `{"name":"Alice"}` || first.RequestHeaders.Get("X-Trace") != "abc" ||
+		first.StatusCode != 201 || first.Route != "POST /api/users" || !first.Matched || first.LatencyMs < 0 {
+		t.Errorf("Unexpected request %+v", first)
+	}
+	if last := entries[3]; last.Matched || last.StatusCode != 404 || last.RequestBodyEncoding != "base64" || last.RequestBody != "//4=" {
+		t.Errorf("Expected an unmatched request with a binary body, got %+v", last)
+	}
+
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"method=get", []int{2, 3}},
+		{"path=/api/users/*", []int{2, 3}},
+		{"method=GET&limit=1", []int{3}},
+		{"from=" + started.Format(time.RFC3339) + "&status=4xx", []int{4}},
+		{"to=" + started.Format(time.RFC3339), nil},
+	}
+	for _, test := range tests {
+		entries, code := query("/_admin/requests?" + test.query)
+		var ids []int
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		if code != 200 || len(ids) != len(test.ids) || (len(ids) > 0 && ids[0] != test.ids[0]) {
+			t.Errorf("%s: expected requests %v, got %v (%d)", test.query, test.ids, ids, code)
+		}
+	}
+	if _, code := query("/_admin/requests?limit=x"); code != 400 {
+		t.Errorf("Expected an invalid limit to be rejected, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/2", nil))
+	var entry journalEntry
+	if json.Unmarshal(w.Body.Bytes(), &entry); w.Code != 200 || entry.URL != "http://example.com/api/users/1" || entry.ResponseBody != "user" {
+		t.Errorf("Unexpected request %d %+v", w.Code, entry)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/_admin/requests", nil))
+	if entries, _ := query("/_admin/requests"); w.Code != 200 || len(entries) != 0 {
+		t.Errorf("Expected the history to be cleared, got %d %d", w.Code, len(entries))
+	}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/2", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected a cleared request to be gone, got %d", w.Code)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// jsonAPIResource is a resource object of a JSON:API document
+type jsonAPIResource struct {
+	Type          string                 `json:"type"`
+	ID            string                 `json:"id,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes"`
+	Relationships map[string]interface{} `json:"relationships,omitempty"`
+	Links         map[string]string      `json:"links,omitempty"`
+}
+
+// writeJSONAPI writes a JSON:API document
+func writeJSONAPI(w http.ResponseWriter, status int, document interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(document)
+}
+
+// jsonAPIID converts a JSON:API id to the value stored in items, keeping
+// numeric ids numbers
+func jsonAPIID(id string) interface{} {
+	if n, err := strconv.Atoi(id); err == nil {
+		return n
+	}
+	return id
+}
+
+// childCollections returns the resources whose parent is a collection. It
+// must be called with the store mutex held.
+func (rs *resourceStore) childCollections(c *collection) []*collection {
+	var children []*collection
+	for _, name := range rs.order {
+		child := rs.collections[name]
+		if child.config.Parent != nil && child.config.Parent.Resource == c.config.Name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// jsonAPIResource converts an item to a resource object. The parent id
+// becomes a relationship, and children are linked by their nested path.
+// Links are absolute URLs on the host the client used.
+func (rs *resourceStore) jsonAPIResource(r *http.Request, c *collection, item resourceItem) jsonAPIResource {
+	id := itemID(item[c.config.idField()])
+	itemURL := absoluteURL(r, strings.TrimSuffix(c.config.Path, "/")+"/"+id)
+	resource := jsonAPIResource{
+		Type:       c.config.Name,
+		ID:         id,
+		Attributes: make(map[string]interface{}, len(item)),
+		Links:      map[string]string{"self": itemURL},
+	}
+	for key, value := range item {
+		resource.Attributes[key] = value
+	}
+	delete(resource.Attributes, c.config.idField())
+
+	relationships := make(map[string]interface{})
+	if parent := c.config.Parent; parent != nil {
+		delete(resource.Attributes, parent.Field)
+		var data interface{}
+		if parentID := itemID(item[parent.Field]); parentID != "" {
+			data = map[string]string{"type": parent.Resource, "id": parentID}
+		}
+		relationships[parent.Resource] = map[string]interface{}{"data": data}
+	}
+	for _, child := range rs.childCollections(c) {
+		relationships[child.config.Name] = map[string]interface{}{
+			"links": map[string]string{"related": itemURL + "/" + path.Base(child.config.Path)},
+		}
+	}
+	if len(relationships) > 0 {
+		resource.Relationships = relationships
+	}
+	return resource
+}
+
+// jsonAPIIncluded returns the related items requested by the include
+// parameter: the parent and the children of the given items. Unknown
+// relationships are ignored.
+func (rs *resourceStore) jsonAPIIncluded(r *http.Request, c *collection, items []resourceItem) []jsonAPIResource {
+	include := r.URL.Query().Get("include")
+	if include == "" {
+		return nil
+	}
+
+	included := []jsonAPIResource{}
+	seen := make(map[string]bool)
+	add := func(related *collection, item resourceItem) {
+		key := related.config.Name + "/" + itemID(item[related.config.idField()])
+		if !seen[key] {
+			seen[key] = true
+			included = append(included, rs.jsonAPIResource(r, related, item))
+		}
+	}
+
+	for _, name := range strings.Split(include, ",") {
+		name = strings.TrimSpace(name)
+		if parent := c.config.Parent; parent != nil && parent.Resource == name {
+			parents := rs.collections[name]
+			for _, item := range items {
+				if i := parents.find(itemID(item[parent.Field])); i >= 0 {
+					add(parents, parents.items[i])
+				}
+			}
+			continue
+		}
+		for _, child := range rs.childCollections(c) {
+			if child.config.Name != name {
+				continue
+			}
+			for _, item := range items {
+				for _, childItem := range child.children(itemID(item[c.config.idField()])) {
+					add(child, childItem)
+				}
+			}
+		}
+	}
+	return included
+}
+
+// jsonAPIDocument wraps an item in a JSON:API document. It must be called
+// with the store mutex held.
+func (rs *resourceStore) jsonAPIDocument(r *http.Request, c *collection, item resourceItem) map[string]interface{} {
+	resource := rs.jsonAPIResource(r, c, item)
+	document := map[string]interface{}{
+		"data":  resource,
+		"links": map[string]string{"self": resource.Links["self"]},
+	}
+	if included := rs.jsonAPIIncluded(r, c, []resourceItem{item}); included != nil {
+		document["included"] = included
+	}
+	return document
+}
+
+// writeJSONAPIList writes items as a JSON:API document to the buffered
+// response of a request, paged by the page[offset] and page[limit]
+// parameters. It must be called with the store mutex held.
+func (rs *resourceStore) writeJSONAPIList(w http.ResponseWriter, r *http.Request, c *collection, items []resourceItem) int {
+	query := r.URL.Query()
+	offset, limit := 0, -1
+	for name, target := range map[string]*int{"page[offset]": &offset, "page[limit]": &limit} {
+		if !query.Has(name) {
+			continue
+		}
+		n, err := strconv.Atoi(query.Get(name))
+		if err != nil || n < 0 {
+			c.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, query.Get(name)))
+			return http.StatusBadRequest
+		}
+		*target = n
+	}
+
+	total := len(items)
+	links := map[string]interface{}{"self": absoluteURL(r, r.URL.RequestURI())}
+	if limit >= 0 {
+		pageLink := func(offset int) string {
+			values := r.URL.Query()
+			values.Set("page[offset]", strconv.Itoa(offset))
+			values.Set("page[limit]", strconv.Itoa(limit))
+			return absoluteURL(r, r.URL.Path+"?"+values.Encode())
+		}
+		last := 0
+		if limit > 0 && total > 0 {
+			last = (total - 1) / limit * limit
+		}
+		links["first"] = pageLink(0)
+		links["last"] = pageLink(last)
+		links["prev"], links["next"] = nil, nil
+		if offset > 0 {
+			links["prev"] = pageLink(max(offset-limit, 0))
+		}
+		if limit > 0 && offset+limit < total {
+			links["next"] = pageLink(offset + limit)
+		}
+	}
+
+	items = items[min(offset, total):]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	data := make([]jsonAPIResource, 0, len(items))
+	for _, item := range items {
+		data = append(data, rs.jsonAPIResource(r, c, item))
+	}
+	document := map[string]interface{}{
+		"data":  data,
+		"links": links,
+		"meta":  map[string]int{"total": total},
+	}
+	if included := rs.jsonAPIIncluded(r, c, items); included != nil {
+		document["included"] = included
+	}
+	writeJSONAPI(w, http.StatusOK, document)
+	return http.StatusOK
+}
+
+// decodeJSONAPI reads an item from a JSON:API document. Attributes become
+// fields, and the parent relationship sets the parent field.
+func (res Resource) decodeJSONAPI(r *http.Request) (resourceItem, error) {
+	var document struct {
+		Data *struct {
+			Type          string                 `json:"type"`
+			ID            string                 `json:"id"`
+			Attributes    map[string]interface{} `json:"attributes"`
+			Relationships map[string]struct {
+				Data *struct {
+					Type string `json:"type"`
+					ID   string `json:"id"`
+				} `json:"data"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON:API document: %v", err)
+	}
+	if document.Data == nil {
+		return nil, fmt.Errorf("invalid JSON:API document: missing data")
+	}
+	if document.Data.Type != res.Name {
+		return nil, fmt.Errorf("invalid JSON:API document: expected type %q, got %q", res.Name, document.Data.Type)
+	}
+
+	item := make(resourceItem, len(document.Data.Attributes)+2)
+	for key, value := range document.Data.Attributes {
+		item[key] = value
+	}
+	if document.Data.ID != "" {
+		item[res.idField()] = jsonAPIID(document.Data.ID)
+	}
+	if parent := res.Parent; parent != nil {
+		if relationship, exists := document.Data.Relationships[parent.Resource]; exists {
+			item[parent.Field] = nil
+			if relationship.Data != nil {
+				item[parent.Field] = jsonAPIID(relationship.Data.ID)
+			}
+		}
+	}
+	return item, nil
+}
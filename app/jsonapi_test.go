@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestJSONAPI tests JSON:API documents for resources
+func TestJSONAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	err := server.resources.configure([]Resource{
+		{Name: "users", Path: "/api/users", Format: "jsonapi", Seed: []map[string]interface{}{
+			{"id": float64(1), "name": "Alice"}, {"id": float64(2), "name": "Bob"}, {"id": float64(3), "name": "Carol"},
+		}},
+		{Name: "articles", Path: "/api/articles", Format: "jsonapi", Parent: &ResourceParent{Resource: "users", Field: "author_id"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/vnd.api+json" {
+			t.Errorf("Expected JSON:API content type for %s %s, got %s", method, path, contentType)
+		}
+		var document map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &document)
+		return w.Code, document
+	}
+	encode := func(value interface{}) string {
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+
+	code, document := call("POST", "/api/articles", `{"data": {"type": "articles", "attributes": {"title": "Hello"}, "relationships": {"users": {"data": {"type": "users", "id": "2"}}}}}`)
+	expected := `{"attributes":{"title":"Hello"},"id":"1","links":{"self":"http://example.com/api/articles/1"},"relationships":{"users":{"data":{"id":"2","type":"users"}}},"type":"articles"}`
+	if code != 201 || encode(document["data"]) != expected {
+		t.Errorf("Expected created article %s, got %d %s", expected, code, encode(document))
+	}
+
+	code, document = call("GET", "/api/users/2?include=articles", "")
+	expected = `{"attributes":{"name":"Bob"},"id":"2","links":{"self":"http://example.com/api/users/2"},"relationships":{"articles":{"links":{"related":"http://example.com/api/users/2/articles"}}},"type":"users"}`
+	if code != 200 || encode(document["data"]) != expected {
+		t.Errorf("Expected user %s, got %d %s", expected, code, encode(document))
+	}
+	if included, _ := document["included"].([]interface{}); len(included) != 1 {
+		t.Errorf("Expected the article to be included, got %s", encode(document["included"]))
+	}
+
+	code, document = call("GET", "/api/users?page[offset]=1&page[limit]=1", "")
+	links := document["links"].(map[string]interface{})
+	if data, _ := document["data"].([]interface{}); code != 200 || len(data) != 1 || encode(document["meta"]) != `{"total":3}` {
+		t.Errorf("Expected one user of three, got %d %s", code, encode(document))
+	}
+	if links["prev"] != "http://example.com/api/users?page%5Blimit%5D=1&page%5Boffset%5D=0" || links["next"] != "http://example.com/api/users?page%5Blimit%5D=1&page%5Boffset%5D=2" || links["last"] != "http://example.com/api/users?page%5Blimit%5D=1&page%5Boffset%5D=2" {
+		t.Errorf("Unexpected pagination links %s", encode(links))
+	}
+
+	if code, document = call("GET", "/api/users/9", ""); code != 404 || encode(document) != `{"errors":[{"status":"404","title":"Item not found"}]}` {
+		t.Errorf("Expected a JSON:API error, got %d %s", code, encode(document))
+	}
+	if code, _ = call("POST", "/api/users", `{"data": {"type": "articles", "attributes": {}}}`); code != 400 {
+		t.Errorf("Expected a type mismatch to be rejected, got %d", code)
+	}
+	if code, _ = call("GET", "/api/users?page[limit]=x", ""); code != 400 {
+		t.Errorf("Expected an invalid page limit to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+)
+
+// validateResponseRefs checks that the endpoints of the main configuration
+// only reference responses of its library. Plugins are checked when their
+// routes are built, since the library can change without them.
+func validateResponseRefs(config *Config) error {
+	for _, ep := range config.Endpoints {
+		if ep.ResponseRef == "" {
+			continue
+		}
+		if _, found := config.Responses[ep.ResponseRef]; !found {
+			return fmt.Errorf("unknown response %q referenced by %s %s", ep.ResponseRef, ep.Method, ep.Path)
+		}
+	}
+	return nil
+}
+
+// applyResponseRef fills the status code, headers and response of an
+// endpoint from the library response it references. Values set on the
+// endpoint take precedence. Must be called with ms.mutex held.
+func (ms *MockServer) applyResponseRef(ep Endpoint) (Endpoint, error) {
+	if ep.ResponseRef == "" {
+		return ep, nil
+	}
+	var spec ResponseSpec
+	found := false
+	if ms.config != nil {
+		spec, found = ms.config.Responses[ep.ResponseRef]
+	}
+	if !found {
+		return ep, fmt.Errorf("unknown response %q", ep.ResponseRef)
+	}
+
+	if ep.StatusCode == 0 {
+		ep.StatusCode = spec.StatusCode
+	}
+	if ep.Response == nil {
+		ep.Response = spec.Response
+	}
+	if len(spec.Headers) > 0 {
+		headers := make(map[string]string, len(spec.Headers)+len(ep.Headers))
+		for key, value := range spec.Headers {
+			headers[key] = value
+		}
+		for key, value := range ep.Headers {
+			headers[key] = value
+		}
+		ep.Headers = headers
+	}
+	return ep, nil
+}
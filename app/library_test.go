@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResponseLibrary tests endpoints referencing named responses of the
+// configuration
+func TestResponseLibrary(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	writeConfig(`{
+		"plugins_dir": "` + filepath.Join(dir, "plugins") + `",
+		"responses": {
+			"standard-401": {"status_code": 401, "headers": {"WWW-Authenticate": "Bearer"}, "response": {"error": "unauthorized"}}
+		},
+		"endpoints": [
+			{"path": "/api/admin", "method": "GET", "response_ref": "standard-401"},
+			{"path": "/api/legacy", "method": "GET", "response_ref": "standard-401", "response": {"error": "legacy tokens expired"}}
+		]
+	}`)
+
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true, Endpoints: []Endpoint{
+		{Path: "/api/invoices", Method: "GET", ResponseRef: "standard-401", Headers: map[string]string{"WWW-Authenticate": "Basic"}},
+		{Path: "/api/missing", Method: "GET", ResponseRef: "unknown", Response: "fallback"},
+	}}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path, body, authenticate string
+		status                   int
+	}{
+		{"/api/admin", `{"error":"unauthorized"}`, "Bearer", 401},
+		{"/api/legacy", `{"error":"legacy tokens expired"}`, "Bearer", 401},
+		{"/api/invoices", `{"error":"unauthorized"}`, "Basic", 401},
+		{"/api/missing", "fallback", "", 200},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body || w.Header().Get("WWW-Authenticate") != test.authenticate {
+			t.Errorf("%s: expected %d %s (%s), got %d %s (%s)", test.path, test.status, test.body, test.authenticate,
+				w.Code, w.Body.String(), w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// Unknown references in the configuration are rejected
+	writeConfig(`{"endpoints": [{"path": "/api/admin", "method": "GET", "response_ref": "standard-403"}]}`)
+	if err := server.LoadConfig(); err == nil || !strings.Contains(err.Error(), `unknown response "standard-403"`) {
+		t.Errorf("Expected an unknown response error, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// requestBaseURL returns the scheme and host the client used to reach the
+// server, honoring the X-Forwarded-Proto and X-Forwarded-Host headers set
+// by proxies
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + host
+}
+
+// absoluteURL resolves a reference, e.g. "/api/users/1", "?page=2" or
+// "../items", against the URL of a request
+func absoluteURL(r *http.Request, ref string) string {
+	base, err := url.Parse(requestBaseURL(r) + r.URL.RequestURI())
+	if err != nil {
+		return ref
+	}
+	target, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(target).String()
+}
+
+// Link returns the absolute URL of a path, e.g. {{.Link "/api/users/1"}}
+func (d requestData) Link(ref string) string {
+	return absoluteURL(d.request, ref)
+}
+
+// PageLink returns the absolute URL of the request with a numeric query
+// parameter moved by delta pages, e.g. {{.PageLink "page" 1}} for the next
+// page. The current page defaults to 1, and links before the first page
+// are empty.
+func (d requestData) PageLink(param string, delta int) string {
+	page := 1
+	if value := d.Query.Get(param); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			page = n
+		}
+	}
+	if page+delta < 1 {
+		return ""
+	}
+	query := d.request.URL.Query()
+	query.Set(param, strconv.Itoa(page+delta))
+	return absoluteURL(d.request, d.Path+"?"+query.Encode())
+}
+
+// linkTemplates renders the links of an endpoint
+type linkTemplates struct {
+	names     []string
+	templates map[string]*template.Template
+}
+
+// newLinkTemplates parses the link templates of an endpoint
+func newLinkTemplates(links map[string]string) (*linkTemplates, error) {
+	lt := &linkTemplates{templates: make(map[string]*template.Template, len(links))}
+	for name, link := range links {
+		tmpl, err := template.New(name).Parse(link)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link %s: %v", name, err)
+		}
+		lt.names = append(lt.names, name)
+		lt.templates[name] = tmpl
+	}
+	sort.Strings(lt.names)
+	return lt, nil
+}
+
+// render returns the links for a request as HAL link objects. Rendered
+// links are resolved against the request URL; empty links are left out.
+func (lt *linkTemplates) render(r *http.Request) map[string]interface{} {
+	data := newRequestData(r)
+	links := make(map[string]interface{}, len(lt.names))
+	for _, name := range lt.names {
+		var buf bytes.Buffer
+		if err := lt.templates[name].Execute(&buf, data); err != nil {
+			continue
+		}
+		if href := strings.TrimSpace(buf.String()); href != "" {
+			links[name] = map[string]string{"href": absoluteURL(r, href)}
+		}
+	}
+	return links
+}
+
+// addTo returns a JSON object body with the links added as "_links"
+func (lt *linkTemplates) addTo(r *http.Request, body []byte) ([]byte, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, fmt.Errorf("links require a JSON object response")
+	}
+	object["_links"] = lt.render(r)
+	return encodeResponse(object)
+}
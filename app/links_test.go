@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestEndpointLinks tests HAL links rendered from the incoming request
+func TestEndpointLinks(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path: "/api/users/{id}", Method: "GET", Response: map[string]interface{}{"id": 1, "name": "Alice"},
+				Links: map[string]string{
+					"self":   "{{.URL}}",
+					"orders": "{{.Path}}/orders",
+					"avatar": "../avatars/{{.Vars.id}}.png",
+				},
+			},
+			{
+				Path: "/api/users", Method: "GET", Response: map[string]interface{}{"items": []int{}},
+				Links: map[string]string{
+					"next": `{{.PageLink "page" 1}}`,
+					"prev": `{{.PageLink "page" -1}}`,
+					"docs": `{{.Link "/docs"}}`,
+				},
+			},
+			{Path: "/api/list", Method: "GET", Response: []int{1}, Links: map[string]string{"self": "{{.URL}}"}},
+		},
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		body    string
+	}{
+		{"/api/users/1", nil, `{"_links":{"avatar":{"href":"http://example.com/api/avatars/1.png"},"orders":{"href":"http://example.com/api/users/1/orders"},"self":{"href":"http://example.com/api/users/1"}},"id":1,"name":"Alice"}`},
+		{"/api/users/1", map[string]string{"Host": "localhost:9999"}, `{"_links":{"avatar":{"href":"http://localhost:9999/api/avatars/1.png"},"orders":{"href":"http://localhost:9999/api/users/1/orders"},"self":{"href":"http://localhost:9999/api/users/1"}},"id":1,"name":"Alice"}`},
+		{"/api/users?page=2&size=10", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.org"}, `{"_links":{"docs":{"href":"https://api.example.org/docs"},"next":{"href":"https://api.example.org/api/users?page=3\u0026size=10"},"prev":{"href":"https://api.example.org/api/users?page=1\u0026size=10"}},"items":[]}`},
+		{"/api/users", nil, `{"_links":{"docs":{"href":"http://example.com/docs"},"next":{"href":"http://example.com/api/users?page=2"}},"items":[]}`},
+		{"/api/list", nil, `[1]`},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		for key, value := range test.headers {
+			if key == "Host" {
+				req.Host = value
+			}
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if got := w.Body.String(); got != test.body+"\n" {
+			t.Errorf("Expected %s to respond %s, got %s", test.path, test.body, got)
+		}
+	}
+
+	if _, err := newLinkTemplates(map[string]string{"self": "{{.URL"}); err == nil {
+		t.Error("Expected an error for an invalid link template")
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// lintFinding is a suspicious pattern found in a configuration or plugin file
+type lintFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Pointer  string `json:"pointer,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // error or warning
+	Message  string `json:"message"`
+}
+
+// lintOptions are the thresholds used by the linter
+type lintOptions struct {
+	MaxDelay  int // milliseconds
+	StaleDays int
+	EnvFile   string // .env file whose variables should be referenced
+}
+
+// lintFile is a parsed configuration or plugin file
+type lintFile struct {
+	path     string
+	data     []byte
+	source   string // "main" or the plugin name
+	modTime  time.Time
+	enabled  bool
+	contents interface{} // *Config or *Plugin
+	secrets  []string    // secret references of the file
+}
+
+// lintEndpoint is an endpoint with the file defining it
+type lintEndpoint struct {
+	file     *lintFile
+	pointer  string // JSON pointer of the endpoint in its file
+	endpoint Endpoint
+}
+
+// runLint implements the lint command and returns the exit code
+func runLint(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	format := flags.String("format", "text", "Output format (text or json)")
+	maxDelay := flags.Int("max-delay", 5000, "Report delays longer than this many milliseconds")
+	staleDays := flags.Int("stale-days", 90, "Report plugins disabled and unchanged for this many days")
+	envFile := flags.String("env-file", ".env", "Report variables of this file that no secret references")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+	}
+
+	findings, err := lintConfig(*configPath, lintOptions{MaxDelay: *maxDelay, StaleDays: *staleDays, EnvFile: *envFile})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 2
+	}
+
+	if *format == "json" {
+		if findings == nil {
+			findings = []lintFinding{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(findings)
+	} else {
+		for _, f := range findings {
+			location := f.File
+			if f.Line > 0 {
+				location = fmt.Sprintf("%s:%d", f.File, f.Line)
+			}
+			fmt.Fprintf(stdout, "%s: %s: [%s] %s\n", location, f.Severity, f.Rule, f.Message)
+		}
+		if len(findings) == 0 {
+			fmt.Fprintln(stdout, "No problems found")
+		}
+	}
+
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lintConfig lints a configuration file and the plugins it loads
+func lintConfig(configPath string, options lintOptions) ([]lintFinding, error) {
+	var findings []lintFinding
+
+	config, err := readLintFile(configPath, "main", reflect.TypeOf(Config{}), &findings)
+	if err != nil {
+		return nil, err
+	}
+	files := []*lintFile{}
+	pluginsDir := "plugins"
+	if config != nil {
+		files = append(files, config)
+		if dir := config.contents.(*Config).PluginsDir; dir != "" {
+			pluginsDir = dir
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(pluginsDir, "*.json"))
+	sort.Strings(matches)
+	var plugins []*lintFile
+	for _, match := range matches {
+		plugin, err := readLintFile(match, "", reflect.TypeOf(Plugin{}), &findings)
+		if err != nil {
+			return nil, err
+		}
+		if plugin != nil {
+			plugins = append(plugins, plugin)
+		}
+	}
+	files = append(files, orderLintPlugins(plugins)...)
+
+	var endpoints []lintEndpoint
+	for _, file := range files {
+		var list []Endpoint
+		var pointers []string
+		switch contents := file.contents.(type) {
+		case *Config:
+			list = contents.Endpoints
+			for i := range list {
+				pointers = append(pointers, fmt.Sprintf("/endpoints/%d", i))
+			}
+		case *Plugin:
+			list, pointers = contents.allEndpoints(), contents.endpointPointers()
+			if !contents.Enabled && options.StaleDays > 0 && time.Since(file.modTime) > time.Duration(options.StaleDays)*24*time.Hour {
+				findings = append(findings, lintFinding{
+					File:     file.path,
+					Line:     1,
+					Rule:     "stale-plugin",
+					Severity: "warning",
+					Message: fmt.Sprintf("plugin %s has been disabled and unchanged for %d days, consider removing it",
+						contents.Name, int(time.Since(file.modTime).Hours()/24)),
+				})
+			}
+		}
+		if !file.enabled {
+			continue
+		}
+		for i, endpoint := range list {
+			endpoints = append(endpoints, lintEndpoint{file: file, pointer: pointers[i], endpoint: endpoint})
+		}
+	}
+
+	for _, ep := range endpoints {
+		findings = append(findings, lintEndpointSettings(ep, config, options)...)
+	}
+	findings = append(findings, lintRoutes(endpoints)...)
+	variables, err := lintVariables(options.EnvFile, files)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, variables...)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// readLintFile reads and validates a file, recording schema errors as findings.
+// It returns nil if the file can't be parsed.
+func readLintFile(path, source string, typ reflect.Type, findings *[]lintFinding) (*lintFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	for _, e := range validateJSON(data, typ) {
+		*findings = append(*findings, lintFinding{
+			File:     path,
+			Line:     e.Line,
+			Pointer:  e.Pointer,
+			Rule:     "schema",
+			Severity: "error",
+			Message:  e.Message,
+		})
+	}
+
+	file := &lintFile{path: path, data: data, source: source, modTime: info.ModTime(), enabled: true}
+
+	// Secrets aren't needed to check the files, only their references
+	data, err = newSecretStore().resolve(data, func(ref string) (string, error) {
+		file.secrets = append(file.secrets, ref)
+		return "", nil
+	})
+	if err != nil {
+		return nil, nil
+	}
+	if typ == reflect.TypeOf(Config{}) {
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, nil
+		}
+		file.contents = &config
+	} else {
+		var plugin Plugin
+		if err := json.Unmarshal(data, &plugin); err != nil {
+			return nil, nil
+		}
+		if plugin.Name == "" {
+			plugin.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		file.source = plugin.Name
+		file.enabled = plugin.Enabled
+		file.contents = &plugin
+	}
+	return file, nil
+}
+
+// orderLintPlugins sorts plugin files in the order their routes are matched
+func orderLintPlugins(plugins []*lintFile) []*lintFile {
+	overrides := make(map[string][]string, len(plugins))
+	for _, plugin := range plugins {
+		overrides[plugin.source] = plugin.contents.(*Plugin).Overrides
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	rank := make(map[string]int, len(names))
+	for i, name := range orderPlugins(names, func(name string) []string { return overrides[name] }) {
+		rank[name] = i
+	}
+
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return rank[plugins[i].source] < rank[plugins[j].source]
+	})
+	return plugins
+}
+
+// finding creates a finding located at an endpoint
+func (ep lintEndpoint) finding(rule, severity, message string) lintFinding {
+	return lintFinding{
+		File:     ep.file.path,
+		Line:     pointerLine(ep.file.data, ep.pointer),
+		Pointer:  ep.pointer,
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+	}
+}
+
+// lintEndpointSettings checks the settings of a single endpoint
+func lintEndpointSettings(ep lintEndpoint, config *lintFile, options lintOptions) []lintFinding {
+	var findings []lintFinding
+	endpoint := ep.endpoint
+	name := strings.ToUpper(endpoint.Method) + " " + endpoint.Path
+
+	if options.MaxDelay > 0 && endpoint.Delay > options.MaxDelay {
+		findings = append(findings, ep.finding("slow-delay", "warning",
+			fmt.Sprintf("%s has a delay of %dms, over the %dms threshold", name, endpoint.Delay, options.MaxDelay)))
+	}
+
+	if err := validateStatusCode(endpoint.StatusCode); err != nil {
+		findings = append(findings, ep.finding("invalid-status-code", "error", fmt.Sprintf("%s: %v", name, err)))
+	}
+
+	contentType := endpoint.ContentType
+	for key, value := range endpoint.Headers {
+		if strings.EqualFold(key, "Content-Type") {
+			contentType = value
+		}
+	}
+	for _, field := range endpoint.HeaderList {
+		if strings.EqualFold(field.Name, "Content-Type") {
+			contentType = field.Value
+		}
+	}
+	if contentType == "" {
+		contentType = defaultContentType
+		if config != nil && config.contents.(*Config).DefaultContentType != "" {
+			contentType = config.contents.(*Config).DefaultContentType
+		}
+	}
+
+	if body, ok := endpoint.Response.(string); ok && isJSONContentType(contentType) && endpoint.GraphQL == nil && !json.Valid([]byte(body)) {
+		findings = append(findings, ep.finding("invalid-json-response", "warning",
+			fmt.Sprintf("%s responds with %s but its string response is not valid JSON", name, contentType)))
+	}
+
+	return findings
+}
+
+// isJSONContentType reports whether a content type denotes JSON
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// pathVariable matches a path variable such as {id} or {id:[0-9]+}
+var pathVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// lintRoutes reports endpoints that can never be reached because a route
+// matched before them matches all of their requests. Endpoints of the main
+// configuration are matched first, then plugins in the order of
+// orderLintPlugins. Endpoints replaced by an overlay plugin on purpose are
+// not reported.
+func lintRoutes(endpoints []lintEndpoint) []lintFinding {
+	var findings []lintFinding
+	routers := make([]*mux.Router, len(endpoints))
+
+	for i, ep := range endpoints {
+		router := mux.NewRouter()
+		route := router.NewRoute().Path(ep.endpoint.Path).Methods(strings.ToUpper(ep.endpoint.Method))
+		if err := route.GetError(); err != nil {
+			findings = append(findings, ep.finding("invalid-path", "error", fmt.Sprintf("invalid path %q: %v", ep.endpoint.Path, err)))
+			continue
+		}
+		routers[i] = router
+	}
+
+	matches := func(router *mux.Router, method, path string) bool {
+		var match mux.RouteMatch
+		return router.Match(httptest.NewRequest(method, path, nil), &match) && match.MatchErr == nil
+	}
+
+	for j, later := range endpoints {
+		if routers[j] == nil {
+			continue
+		}
+		method := strings.ToUpper(later.endpoint.Method)
+
+		// Find two distinct requests the later endpoint matches
+		var samples []string
+		for _, values := range [][2]string{{"1", "2"}, {"a", "b"}, {"a1", "b2"}} {
+			first := pathVariable.ReplaceAllString(later.endpoint.Path, values[0])
+			second := pathVariable.ReplaceAllString(later.endpoint.Path, values[1])
+			if matches(routers[j], method, first) && matches(routers[j], method, second) {
+				samples = []string{first, second}
+				break
+			}
+		}
+		if samples == nil {
+			continue
+		}
+
+		for i := 0; i < j; i++ {
+			earlier := endpoints[i]
+			if routers[i] == nil || !matches(routers[i], method, samples[0]) || !matches(routers[i], method, samples[1]) {
+				continue
+			}
+			if overlay, ok := earlier.file.contents.(*Plugin); ok && slices.Contains(overlay.Overrides, later.file.source) {
+				break
+			}
+
+			earlierName := fmt.Sprintf("%s %s (%s)", strings.ToUpper(earlier.endpoint.Method), earlier.endpoint.Path, earlier.file.source)
+			laterName := fmt.Sprintf("%s %s", method, later.endpoint.Path)
+			if earlier.file.source == later.file.source || earlier.file.source == "main" {
+				findings = append(findings, later.finding("unreachable-endpoint", "warning",
+					fmt.Sprintf("%s is never reached because %s is registered before it and matches the same requests", laterName, earlierName)))
+			} else {
+				findings = append(findings, later.finding("route-conflict", "warning",
+					fmt.Sprintf("%s is never reached because %s from another plugin is matched before it and matches the same requests", laterName, earlierName)))
+			}
+			break
+		}
+	}
+
+	return findings
+}
+
+// lintVariables reports variables of a .env file that no secret of the
+// linted files references. Variables of nmock's own settings are used
+// without a reference. A missing file is not an error.
+func lintVariables(envFile string, files []*lintFile) ([]lintFinding, error) {
+	if envFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(envFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", envFile, err)
+	}
+	values, err := parseDotEnv(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", envFile, err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, file := range files {
+		for _, ref := range file.secrets {
+			referenced[ref] = true
+		}
+	}
+
+	var findings []lintFinding
+	for number, line := range strings.Split(string(data), "\n") {
+		key, _, found := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+		key = strings.TrimSpace(key)
+		if _, set := values[key]; !found || !set || referenced[key] || strings.HasPrefix(key, "NMOCK_") {
+			continue
+		}
+		findings = append(findings, lintFinding{
+			File:     envFile,
+			Line:     number + 1,
+			Rule:     "unused-variable",
+			Severity: "warning",
+			Message:  fmt.Sprintf("variable %s is set but no {\"$secret\": %q} references it", key, key),
+		})
+	}
+	return findings, nil
+}
+
+// pointerLine returns the line of the value at a JSON pointer, or 0 if it
+// can't be found
+func pointerLine(data []byte, pointer string) int {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	v := &schemaValidator{data: data, dec: dec}
+
+	var walk func(current string) (int, bool)
+	walk = func(current string) (int, bool) {
+		start := v.tokenStart()
+		if current == pointer {
+			return v.errorAt(start, "", "").Line, true
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, true
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return 0, true
+				}
+				if line, done := walk(current + "/" + escapePointer(fmt.Sprint(key))); done {
+					return line, true
+				}
+			}
+			dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if line, done := walk(fmt.Sprintf("%s/%d", current, i)); done {
+					return line, true
+				}
+			}
+			dec.Token()
+		}
+		return 0, false
+	}
+
+	line, _ := walk("")
+	return line
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLint tests detection of suspicious configuration patterns
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	pluginsDir := filepath.Join(dir, "plugins")
+	os.MkdirAll(pluginsDir, 0755)
+
+	configPath := filepath.Join(dir, "config.json")
+	os.WriteFile(configPath, []byte(`{
+  "plugins_dir": "`+pluginsDir+`",
+  "endpoints": [
+    {"path": "/api/users/{id}", "method": "GET", "response": {}},
+    {"path": "/api/users/me", "method": "GET", "response": {}},
+    {"path": "/api/users/{id:[0-9]+}", "method": "GET", "response": {}, "delay": 10000},
+    {"path": "/api/raw", "method": "GET", "response": "{not json"},
+    {"path": "/api/text", "method": "GET", "content_type": "text/plain", "response": "plain"},
+    {"path": "/api/typo", "method": "GET", "satus_code": 201},
+    {"path": "/api/status", "method": "GET", "status_code": 1000},
+    {"path": "/api/key", "method": "GET", "headers": {"X-Api-Key": {"$secret": "API_KEY"}}}
+  ]
+}`), 0644)
+
+	os.WriteFile(filepath.Join(pluginsDir, "a.json"), []byte(`{"name": "a", "enabled": true, "endpoints": [{"path": "/api/orders", "method": "POST"}]}`), 0644)
+	os.WriteFile(filepath.Join(pluginsDir, "b.json"), []byte(`{"name": "b", "enabled": true, "endpoints": [{"path": "/api/orders", "method": "POST"}, {"path": "/api/orders/{id}", "method": "GET"}]}`), 0644)
+	os.WriteFile(filepath.Join(pluginsDir, "chaos.json"), []byte(`{"name": "chaos", "enabled": true, "overrides": ["b"], "endpoints": [{"path": "/api/orders/{id}", "method": "GET", "status_code": 500}]}`), 0644)
+	envFile := filepath.Join(dir, ".env")
+	os.WriteFile(envFile, []byte("# keys\nAPI_KEY=abc\nNMOCK_PORT=9001\nexport OLD_TOKEN=xyz\n"), 0644)
+	old := filepath.Join(pluginsDir, "old.json")
+	os.WriteFile(old, []byte(`{"name": "old", "enabled": false, "endpoints": [{"path": "/api/orders", "method": "POST"}]}`), 0644)
+	stale := time.Now().Add(-200 * 24 * time.Hour)
+	os.Chtimes(old, stale, stale)
+
+	var out bytes.Buffer
+	if code := runLint([]string{"--format", "json", "--env-file", envFile, configPath}, &out); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	var findings []lintFinding
+	if err := json.Unmarshal(out.Bytes(), &findings); err != nil {
+		t.Fatalf("Failed to parse output: %v\n%s", err, out.String())
+	}
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s:%d %s", strings.TrimPrefix(f.File, dir+"/"), f.Line, f.Rule))
+	}
+	expected := []string{
+		".env:4 unused-variable",
+		"config.json:5 unreachable-endpoint",
+		"config.json:6 slow-delay",
+		"config.json:6 unreachable-endpoint",
+		"config.json:7 invalid-json-response",
+		"config.json:9 schema",
+		"config.json:10 invalid-status-code",
+		"plugins/b.json:1 route-conflict",
+		"plugins/old.json:1 stale-plugin",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected findings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// A clean configuration passes
+	os.WriteFile(configPath, []byte(`{"plugins_dir": "`+filepath.Join(dir, "none")+`", "endpoints": [{"path": "/ok", "method": "GET", "response": {}}]}`), 0644)
+	out.Reset()
+	if code := runLint([]string{configPath}, &out); code != 0 || out.String() != "No problems found\n" {
+		t.Errorf("Expected a clean run, got %d: %s", code, out.String())
+	}
+}
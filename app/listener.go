@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// httpListener is the HTTP server currently accepting requests. A reload
+// that changes the port or switches TLS on or off replaces it.
+type httpListener struct {
+	mutex    sync.Mutex
+	server   *http.Server
+	listener net.Listener
+	tls      bool // the server serves HTTPS
+	down     bool // the listener was closed to switch TLS, but binding again failed
+}
+
+// listen binds the configured address and serves requests on it. If another
+// address is already served, the previous server is shut down gracefully
+// once the new one accepts connections; if binding fails, it keeps serving.
+// Switching TLS on the same address stops accepting on the old server first,
+// so that the new one can bind; if binding again fails, nothing is listening
+// until the next successful call.
+func (ms *MockServer) listen() error {
+	server := ms.newHTTPServer()
+	// Serving writes the TLS config of the server, so it is read only here
+	tlsEnabled := server.TLSConfig != nil
+
+	ms.listener.mutex.Lock()
+	defer ms.listener.mutex.Unlock()
+
+	previous := ms.listener.server
+	sameAddr := previous != nil && previous.Addr == server.Addr
+	if sameAddr && ms.listener.tls == tlsEnabled && !ms.listener.down {
+		return nil
+	}
+	if sameAddr && ms.listener.listener != nil {
+		ms.listener.listener.Close()
+		ms.listener.listener = nil
+	}
+
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		if sameAddr {
+			ms.listener.down = true
+			return fmt.Errorf("failed to listen on %s again, the server is not listening: %v", server.Addr, err)
+		}
+		return fmt.Errorf("failed to listen on %s: %v", server.Addr, err)
+	}
+	ms.listener.server = server
+	ms.listener.listener = ln
+	ms.listener.tls = tlsEnabled
+	ms.listener.down = false
+	go func() {
+		serve := server.Serve
+		if tlsEnabled {
+			// The certificate comes from the TLS config, which also
+			// enables HTTP/2
+			serve = func(ln net.Listener) error { return server.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Server on %s stopped: %v", server.Addr, err)
+		}
+	}()
+
+	if previous != nil {
+		if sameAddr && tlsEnabled {
+			log.Printf("Serving HTTPS on %s", server.Addr)
+		} else if sameAddr {
+			log.Printf("Serving HTTP on %s", server.Addr)
+		} else {
+			log.Printf("Listening on %s instead of %s", server.Addr, previous.Addr)
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			previous.Shutdown(ctx)
+		}()
+	}
+	return nil
+}
+
+// reloadListener applies a changed port or TLS setting after a configuration reload
+func (ms *MockServer) reloadListener() {
+	ms.listener.mutex.Lock()
+	running := ms.listener.server != nil
+	ms.listener.mutex.Unlock()
+	if !running {
+		return
+	}
+
+	if err := ms.listen(); err != nil {
+		ms.listener.mutex.Lock()
+		addr, down := ms.listener.server.Addr, ms.listener.down
+		ms.listener.mutex.Unlock()
+		if down {
+			log.Printf("Failed to apply the new listener settings, not listening on %s anymore: %v", addr, err)
+		} else {
+			log.Printf("Failed to apply the new port, still listening on %s: %v", addr, err)
+		}
+		ms.notifier.notify(EventConfigReloadFailed, fmt.Sprintf("Failed to apply the new port: %v", err),
+			map[string]string{"config_file": ms.configPath, "error": err.Error()})
+	}
+}
+
+// shutdown stops the HTTP server gracefully
+func (ms *MockServer) shutdown(ctx context.Context) error {
+	ms.listener.mutex.Lock()
+	server := ms.listener.server
+	ms.listener.mutex.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
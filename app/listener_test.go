@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a port that is free at the time of the call
+func freePort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// TestReloadListener tests moving to a new port after a configuration reload
+func TestReloadListener(t *testing.T) {
+	first, second := freePort(t), freePort(t)
+	server := NewMockServer("")
+	server.config = &Config{Port: first}
+	server.SetupRoutes()
+	if err := server.listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer server.shutdown(context.Background())
+
+	health := func(port string) error {
+		client := &http.Client{Timeout: time.Second}
+		resp, err := client.Get("http://127.0.0.1:" + port + "/health")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := health(first); err != nil {
+		t.Fatalf("Expected the first port to answer: %v", err)
+	}
+
+	server.config = &Config{Port: second}
+	server.reloadListener()
+	if err := health(second); err != nil {
+		t.Fatalf("Expected the new port to answer: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for health(first) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the old port to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A port in use keeps the current listener
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	server.config = &Config{Port: strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)}
+	server.reloadListener()
+	if err := health(second); err != nil {
+		t.Errorf("Expected to keep serving on the previous port: %v", err)
+	}
+}
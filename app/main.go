@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -18,27 +25,195 @@ import (
 
 // Endpoint represents a mock API endpoint configuration
 type Endpoint struct {
+	ID string `json:"id,omitempty"` // stable ID for admin APIs (default: a hash of method and path)
+
 	Path       string            `json:"path"`
 	Method     string            `json:"method"`
 	StatusCode int               `json:"status_code"`
+	Reason     string            `json:"reason,omitempty"` // custom reason phrase of the status line (HTTP/1.x only)
 	Headers    map[string]string `json:"headers,omitempty"`
 	Response   interface{}       `json:"response"`
 	Delay      int               `json:"delay,omitempty"` // delay in milliseconds
+	RateLimit  *RateLimit        `json:"rate_limit,omitempty"`
+
+	Upstream string `json:"upstream,omitempty"` // name of an upstream of the configuration whose latency and errors apply
+
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"` // reject requests for a while after repeated failures
+	Fault          *FaultConfig          `json:"fault,omitempty"`           // break a share of the responses, e.g. reset the connection or cut off the body
+	CORS           *CORSConfig           `json:"cors,omitempty"`            // CORS setting replacing the one of the configuration
+	Sticky         string                `json:"sticky,omitempty"`          // client key, like "ip" or "header:X-User-Id", whose requests get the same random choices
+
+	Idempotency *IdempotencyConfig `json:"idempotency,omitempty"` // track Idempotency-Key headers and replay responses for repeated keys
+
+	HeaderList []HeaderField `json:"header_list,omitempty"` // headers sent in order after headers; names can repeat
+
+	HeaderProfiles []string `json:"header_profiles,omitempty"` // names of header profiles of the configuration, overridden by headers
+
+	ResponseFile string          `json:"response_file,omitempty"` // file streamed as the body instead of response; {name} is replaced by a path variable
+	MissingFile  *MappedResponse `json:"missing_file,omitempty"`  // response when the response file doesn't exist (default: 404 for paths with variables)
+	Download     *DownloadConfig `json:"download,omitempty"`      // Content-Disposition and generated content for file downloads
+	Generate     *GenerateConfig `json:"generate,omitempty"`      // JSON array of an exact item count or size generated from an item pattern
+	Dataset      *Dataset        `json:"dataset,omitempty"`       // rows of a CSV or JSON file selected by the request
+	Search       *SearchConfig   `json:"search,omitempty"`        // ranked search over a dataset file or a resource
+	ResponseMap  *ResponseMap    `json:"response_map,omitempty"`  // responses selected by a value of the request
+
+	Variants map[string]MappedResponse `json:"variants,omitempty"` // named responses picked with X-Nmock-Response
+
+	Responses []MappedResponse `json:"responses,omitempty"` // responses answered in turn on consecutive calls
+	Sequence  string           `json:"sequence,omitempty"`  // after the last of responses: "stick" (default) or "loop"
+
+	ResponseRef string `json:"response_ref,omitempty"` // name of a response in the library of the configuration
+
+	Multipart *MultipartResponse `json:"multipart,omitempty"` // multipart body composed of parts instead of response
+
+	ResponseTemplate bool                 `json:"response_template,omitempty"` // render the response as a Go template with the request data
+	TemplateCache    *TemplateCacheConfig `json:"template_cache,omitempty"`    // keep rendered responses for requests with the same values
+
+	Links map[string]string `json:"links,omitempty"` // HAL links added to the response as "_links"; values are templates
+
+	Continue *ContinueConfig `json:"continue,omitempty"` // handling of "Expect: 100-continue" requests
+	Truncate *TruncateConfig `json:"truncate,omitempty"` // close the connection after part of the body
+
+	RawResponse string `json:"raw_response,omitempty"` // exact bytes written to the connection, including the status line and headers
+
+	Tags map[string]string `json:"tags,omitempty"` // tags for metrics and admin filters, added to those of the plugin
+
+	Enabled *bool `json:"enabled,omitempty"` // false switches the endpoint off (default: true)
+
+	TransferEncoding string `json:"transfer_encoding,omitempty"` // "content-length" or "chunked"
+	ContentType      string `json:"content_type,omitempty"`
+	Charset          string `json:"charset,omitempty"`
+
+	// Streaming: explicit chunks, or the response split into chunk_size pieces
+	Chunks     []Chunk `json:"chunks,omitempty"`
+	ChunkSize  int     `json:"chunk_size,omitempty"`  // bytes per chunk
+	ChunkDelay int     `json:"chunk_delay,omitempty"` // delay between chunks in milliseconds
+
+	GraphQL *GraphQLMock `json:"graphql,omitempty"`
+}
+
+// HeaderField is a response header of a header list
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // Plugin represents a plugin configuration
 type Plugin struct {
+	Schema      string     `json:"$schema,omitempty"`
 	Name        string     `json:"name"`
 	Description string     `json:"description,omitempty"`
 	Enabled     bool       `json:"enabled"`
 	Endpoints   []Endpoint `json:"endpoints"`
+	TCP         []TCPMock  `json:"tcp,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"` // tags of the plugin's endpoints, for metrics and admin filters
+
+	HeaderProfiles []string `json:"header_profiles,omitempty"` // header profiles of the plugin's endpoints
+
+	Overrides []string `json:"overrides,omitempty"` // plugins whose endpoints with the same method and path this one replaces
+
+	Groups []EndpointGroup `json:"groups,omitempty"` // endpoints sharing defaults such as a delay
 }
 
 // Config represents the entire mock server configuration
 type Config struct {
+	Schema     string     `json:"$schema,omitempty"`
 	Port       string     `json:"port,omitempty"`
 	PluginsDir string     `json:"plugins_dir,omitempty"`
 	Endpoints  []Endpoint `json:"endpoints"`
+
+	// Server timeouts in milliseconds (0 means no timeout)
+	ReadTimeout       int `json:"read_timeout,omitempty"`
+	ReadHeaderTimeout int `json:"read_header_timeout,omitempty"`
+	WriteTimeout      int `json:"write_timeout,omitempty"`
+	IdleTimeout       int `json:"idle_timeout,omitempty"`
+
+	// Custom responses for unmatched requests
+	NotFound         *ResponseSpec `json:"not_found,omitempty"`
+	MethodNotAllowed *ResponseSpec `json:"method_not_allowed,omitempty"`
+
+	// Catch-all response for unmatched requests
+	DefaultResponse *DefaultResponse `json:"default_response,omitempty"`
+
+	// Backend receiving unmatched requests instead of the responses above
+	FallbackProxy string `json:"fallback_proxy,omitempty"`
+
+	// Browser access from other origins, including preflight requests
+	CORS *CORSConfig `json:"cors,omitempty"`
+
+	// Automatically answer HEAD and OPTIONS for defined endpoints
+	AutoHead    bool `json:"auto_head,omitempty"`
+	AutoOptions bool `json:"auto_options,omitempty"`
+
+	// Route matching backend: "mux" (default) or "radix" for large numbers of endpoints
+	Router string `json:"router,omitempty"`
+
+	// Content type of responses that don't specify one (default: application/json)
+	DefaultContentType string `json:"default_content_type,omitempty"`
+
+	// S3-compatible object storage mock on its own port
+	S3 *S3Config `json:"s3,omitempty"`
+
+	// SMTP listener capturing sent mail into the mailbox
+	SMTP *SMTPConfig `json:"smtp,omitempty"`
+
+	// DNS resolver redirecting mocked hostnames to nmock
+	DNS *DNSConfig `json:"dns,omitempty"`
+
+	// Hooks called on server events such as unmatched requests
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	// Periodic snapshots of runtime state, restored on startup
+	State *StateConfig `json:"state,omitempty"`
+
+	// Limits of the request history kept in memory
+	History *HistoryConfig `json:"history,omitempty"`
+
+	// Requirements on the requests received, verified on shutdown
+	Expectations []Expectation `json:"expectations,omitempty"`
+
+	// REST collections whose items are kept in memory
+	Resources []Resource `json:"resources,omitempty"`
+
+	// Asynchronous job APIs whose jobs move through states over time
+	Jobs []JobAPI `json:"jobs,omitempty"`
+
+	// Request metrics pushed to a StatsD or DogStatsD server
+	StatsD *StatsDConfig `json:"statsd,omitempty"`
+
+	// Request and plugin metrics exposed for Prometheus
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+
+	// Seed of random choices like upstream jitter and errors (default: a new seed every run)
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Client key whose requests get the same random choices on every call, for endpoints without their own
+	Sticky string `json:"sticky,omitempty"`
+
+	// HTTPS with a certificate from files or a generated self-signed one
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Copies of mocked requests sent to another server
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+
+	// Append-only log of changes made through the admin API
+	Audit *AuditConfig `json:"audit,omitempty"`
+
+	// Tokens and roles for the admin API, which is open when none are set
+	AdminTokens []AdminToken `json:"admin_tokens,omitempty"`
+
+	// Let clients override delays and inject faults with X-Nmock-* request headers
+	HeaderOverrides bool `json:"header_overrides,omitempty"`
+
+	// Library of named responses that endpoints reference with response_ref
+	Responses map[string]ResponseSpec `json:"responses,omitempty"`
+
+	// Named header sets that endpoints and plugins reference with header_profiles
+	HeaderProfiles map[string]map[string]string `json:"header_profiles,omitempty"`
+
+	// Latency and error models of fake services shared by the endpoints referencing them
+	Upstreams map[string]UpstreamConfig `json:"upstreams,omitempty"`
 }
 
 // MockServer represents the mock server
@@ -50,15 +225,79 @@ type MockServer struct {
 	pluginsDir string
 	mutex      sync.RWMutex
 	watcher    *fsnotify.Watcher
+
+	rateLimiters map[string]*rateLimiter
+	sequences    map[string]*responseSequence
+	breakers     map[string]*circuitBreaker
+	idempotency  map[string]*idempotencyStore
+	jobQueues    map[string]*jobQueue
+	tcpListeners map[string]*tcpListener
+	inbox        *inbox
+	mailbox      *mailbox
+	notifier     *notifier
+	history      *requestHistory
+	expectations *expectations
+	resources    *resourceStore
+	statsd       *statsdClient
+	metrics      *metrics
+	random       *randomness
+	tls          *tlsCertificates
+	mirror       *mirror
+	upstreams    *upstreamSet
+	audit        *auditLog
+	listener     httpListener
+	secrets      *secretStore
+	routeHits    *routeHits
+	reloadPaused atomic.Bool // set while a bundle import rewrites the files
+	persistMutex sync.Mutex  // serializes edits of the config file through the admin API
+	readOnly     bool        // --read-only: no admin API changes and no file writes
+	settings     settings    // flags and environment variables overriding the config file
+
+	runtimeEndpoints  []Endpoint      // endpoints added through the admin API
+	disabledTags      map[string]bool // tag filters whose endpoints are switched off
+	endpointToggles   map[string]bool // endpoint IDs switched on or off through the admin API
+	restoredSequences map[string]int  // calls of sequences restored from a state file, by route
+	routes            *routeTable
+	pluginFiles       map[string]string // plugin file path to plugin name
+
+	serving atomic.Pointer[mux.Router] // router used by requests, swapped on reload
 }
 
 // NewMockServer creates a new mock server instance
 func NewMockServer(configPath string) *MockServer {
-	return &MockServer{
+	ms := &MockServer{
 		router:     mux.NewRouter(),
 		plugins:    make(map[string]*Plugin),
 		configPath: configPath,
+
+		rateLimiters:    make(map[string]*rateLimiter),
+		sequences:       make(map[string]*responseSequence),
+		breakers:        make(map[string]*circuitBreaker),
+		idempotency:     make(map[string]*idempotencyStore),
+		jobQueues:       make(map[string]*jobQueue),
+		tcpListeners:    make(map[string]*tcpListener),
+		inbox:           newInbox(),
+		mailbox:         newMailbox(),
+		notifier:        newNotifier(),
+		history:         newRequestHistory(),
+		expectations:    newExpectations(),
+		resources:       newResourceStore(),
+		statsd:          newStatsDClient(),
+		metrics:         newMetrics(),
+		random:          newRandomness(),
+		tls:             newTLSCertificates(),
+		mirror:          newMirror(),
+		upstreams:       newUpstreamSet(),
+		audit:           newAuditLog(),
+		secrets:         newSecretStore(),
+		routeHits:       newRouteHits(),
+		disabledTags:    make(map[string]bool),
+		endpointToggles: make(map[string]bool),
+		routes:          newRouteTable(),
+		pluginFiles:     make(map[string]string),
 	}
+	ms.serving.Store(ms.router)
+	return ms
 }
 
 // LoadPlugins loads all plugins from the plugins directory
@@ -68,6 +307,7 @@ func (ms *MockServer) LoadPlugins() error {
 
 	// Clear existing plugins
 	ms.plugins = make(map[string]*Plugin)
+	ms.pluginFiles = make(map[string]string)
 
 	// Check if plugins directory exists
 	if _, err := os.Stat(ms.pluginsDir); os.IsNotExist(err) {
@@ -85,6 +325,8 @@ func (ms *MockServer) LoadPlugins() error {
 			pluginPath := filepath.Join(ms.pluginsDir, file.Name())
 			if err := ms.loadSinglePlugin(pluginPath); err != nil {
 				log.Printf("Failed to load plugin %s: %v", file.Name(), err)
+				ms.notifier.notify(EventPluginReloadFailed, fmt.Sprintf("Failed to load plugin %s: %v", file.Name(), err),
+					map[string]string{"plugin_file": pluginPath, "error": err.Error()})
 			}
 		}
 	}
@@ -94,40 +336,62 @@ func (ms *MockServer) LoadPlugins() error {
 }
 
 // loadSinglePlugin loads a single plugin from file
-func (ms *MockServer) loadSinglePlugin(pluginPath string) error {
+func (ms *MockServer) loadSinglePlugin(pluginPath string) (err error) {
+	defer func() { ms.metrics.pluginLoaded(err == nil) }()
+
 	data, err := os.ReadFile(pluginPath)
 	if err != nil {
 		return fmt.Errorf("failed to read plugin file: %v", err)
 	}
 
+	if errs := validateJSON(data, reflect.TypeOf(Plugin{})); len(errs) > 0 {
+		return fmt.Errorf("invalid plugin file:\n%v", schemaErrors(pluginPath, errs))
+	}
+	if data, err = ms.secrets.resolve(data, lookupSecret); err != nil {
+		return fmt.Errorf("invalid plugin file: %v", err)
+	}
+
 	var plugin Plugin
 	if err := json.Unmarshal(data, &plugin); err != nil {
 		return fmt.Errorf("failed to parse plugin file: %v", err)
 	}
+	if err := validateEndpointIDs(plugin.allEndpoints()); err != nil {
+		return fmt.Errorf("invalid plugin file: %v", err)
+	}
 
 	if plugin.Name == "" {
 		plugin.Name = strings.TrimSuffix(filepath.Base(pluginPath), ".json")
 	}
+	if err := validateOverrides(&plugin); err != nil {
+		return fmt.Errorf("invalid plugin file: %v", err)
+	}
 
 	ms.plugins[plugin.Name] = &plugin
-	log.Printf("Loaded plugin: %s (enabled: %t, endpoints: %d)", plugin.Name, plugin.Enabled, len(plugin.Endpoints))
+	ms.pluginFiles[pluginPath] = plugin.Name
+	log.Printf("Loaded plugin: %s (enabled: %t, endpoints: %d)", plugin.Name, plugin.Enabled, len(plugin.allEndpoints()))
 	return nil
 }
 
-// LoadConfig loads configuration from JSON file
-func (ms *MockServer) LoadConfig() error {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
+// readConfig reads the configuration file, with secrets resolved, the
+// settings of flags and environment variables applied, and default values set
+func (ms *MockServer) readConfig() (Config, error) {
+	var config Config
 	data, err := os.ReadFile(ms.configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+		return config, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if errs := validateJSON(data, reflect.TypeOf(Config{})); len(errs) > 0 {
+		return config, fmt.Errorf("invalid config file:\n%v", schemaErrors(ms.configPath, errs))
+	}
+	if data, err = ms.secrets.resolve(data, lookupSecret); err != nil {
+		return config, fmt.Errorf("invalid config file: %v", err)
 	}
 
-	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse config file: %v", err)
+		return config, fmt.Errorf("failed to parse config file: %v", err)
 	}
+	ms.settings.apply(&config)
 
 	// Set default values
 	if config.Port == "" {
@@ -136,13 +400,88 @@ func (ms *MockServer) LoadConfig() error {
 	if config.PluginsDir == "" {
 		config.PluginsDir = "plugins"
 	}
+	return config, nil
+}
+
+// LoadConfig loads configuration from JSON file
+func (ms *MockServer) LoadConfig() error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	config, err := ms.readConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := validateAdminTokens(config.AdminTokens); err != nil {
+		return err
+	}
+	if err := validateEndpointIDs(config.Endpoints); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateResponseRefs(&config); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateHeaderProfiles(&config); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateDNS(config.DNS); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateUpstreams(&config); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateFallbackProxy(config.FallbackProxy); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateMetrics(config.Metrics); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateJobs(config.Jobs); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if err := validateTLS(config.TLS); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	if _, err := newCORSPolicy(config.CORS); err != nil {
+		return fmt.Errorf("invalid config file: cors: %v", err)
+	}
+	if config.Sticky != "" {
+		if _, err := compileKey(config.Sticky); err != nil {
+			return fmt.Errorf("invalid config file: sticky: %v", err)
+		}
+	}
+	if err := ms.expectations.configure(config.Expectations); err != nil {
+		return err
+	}
+	if err := ms.resources.configure(config.Resources); err != nil {
+		return err
+	}
+	if err := ms.statsd.configure(config.StatsD); err != nil {
+		return err
+	}
+	if err := ms.mirror.configure(config.Mirror); err != nil {
+		return err
+	}
+	audit, history := ms.memoryOnly(config.Audit, config.History)
+	if err := ms.audit.configure(audit); err != nil {
+		return err
+	}
+	if err := ms.tls.configure(config.TLS); err != nil {
+		return err
+	}
+	ms.random.configure(config.Seed)
 
 	ms.config = &config
 	ms.pluginsDir = config.PluginsDir
+	ms.history.configure(history)
+	ms.upstreams.configure(config.Upstreams)
 
-	// Ensure plugins directory exists
-	if err := os.MkdirAll(ms.pluginsDir, 0755); err != nil {
-		log.Printf("Warning: Failed to create plugins directory: %v", err)
+	// Ensure plugins directory exists, unless nothing may be written
+	if !ms.readOnly {
+		if err := os.MkdirAll(ms.pluginsDir, 0755); err != nil {
+			log.Printf("Warning: Failed to create plugins directory: %v", err)
+		}
 	}
 
 	return nil
@@ -155,6 +494,7 @@ func (ms *MockServer) SetupRoutes() {
 
 	// Clear existing routes
 	ms.router = mux.NewRouter()
+	ms.notifier.configure(ms.config.Notifications)
 
 	// Add management API endpoints
 	ms.setupManagementAPI()
@@ -165,53 +505,419 @@ func (ms *MockServer) SetupRoutes() {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	}).Methods("GET")
 
-	// Add configured endpoints from main config
-	for _, endpoint := range ms.config.Endpoints {
-		ms.addEndpoint(endpoint, "main")
+	// Add metrics endpoint for Prometheus
+	if ms.config.Metrics != nil {
+		ms.router.Handle(ms.config.Metrics.metricsPath(), ms.metricsHandler()).Methods("GET")
 	}
 
-	// Add endpoints from enabled plugins
+	// Compile endpoints created at runtime, which override the files, the
+	// main configuration followed by its resources and enabled plugins into
+	// the route table
+	plugins := make(map[string][]*endpointRoute)
+	overrides := make(map[string][]string)
 	for pluginName, plugin := range ms.plugins {
 		if plugin.Enabled {
-			for _, endpoint := range plugin.Endpoints {
-				ms.addEndpoint(endpoint, pluginName)
-			}
+			plugins[pluginName] = ms.compileRoutes(plugin.allEndpoints(), pluginName)
+			overrides[pluginName] = plugin.Overrides
 		}
 	}
+	generated := append(ms.resourceRoutes(), ms.jobRoutes()...)
+	global := ms.corsPolicyFor(Endpoint{}, "main")
+	for _, route := range generated {
+		route.applyCORS(global)
+	}
+	ms.routes.reset(
+		ms.compileRoutes(ms.runtimeEndpoints, "runtime"),
+		append(ms.compileRoutes(ms.config.Endpoints, "main"), generated...),
+		plugins,
+		overrides,
+		ms.config,
+	)
 
-	// Add a catch-all handler for undefined routes
-	ms.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Endpoint not found",
-			"path":  r.URL.Path,
-		})
-		log.Printf("%s %s - 404 (Not Found)", r.Method, r.URL.Path)
-	})
+	// Serve endpoints from the route table, falling back to the handlers
+	// for undefined routes and unsupported methods. With a fallback proxy,
+	// both are forwarded to the real backend instead.
+	notFound := ms.notFoundHandler()
+	methodNotAllowed := ms.methodNotAllowedHandler()
+	if ms.config.FallbackProxy != "" {
+		proxy := ms.fallbackProxyHandler(notFound)
+		ms.router.NotFoundHandler = ms.endpointsHandler(false, proxy, proxy)
+		ms.router.MethodNotAllowedHandler = ms.endpointsHandler(true, proxy, methodNotAllowed)
+	} else {
+		ms.router.NotFoundHandler = ms.endpointsHandler(false, notFound, methodNotAllowed)
+		ms.router.MethodNotAllowedHandler = ms.endpointsHandler(true, notFound, methodNotAllowed)
+	}
+
+	// Start or stop raw TCP mocks defined by plugins
+	ms.syncTCPListeners()
+
+	// Drop the state of removed endpoints
+	ms.pruneRouteState()
+
+	// Serve requests from the new router
+	ms.serving.Store(ms.router)
+	ms.logRouteSummary()
 }
 
-// addEndpoint adds a single endpoint to the router
-func (ms *MockServer) addEndpoint(endpoint Endpoint, source string) {
+// endpointHandler returns the handler of a single endpoint
+func (ms *MockServer) endpointHandler(endpoint Endpoint, source string) http.Handler {
 	// Create a closure to capture the endpoint configuration
 	ep := endpoint // Important: create a copy to avoid closure issues
 
-	ms.router.HandleFunc(ep.Path, func(w http.ResponseWriter, r *http.Request) {
+	ep, err := ms.applyResponseRef(ep)
+	if err != nil {
+		log.Printf("Invalid response reference for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+	}
+	if ep, err = ms.applyHeaderProfiles(ep, source); err != nil {
+		log.Printf("Invalid header profiles for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+	}
+
+	var limiter *rateLimiter
+	if ep.RateLimit != nil {
+		var err error
+		limiter, err = ms.rateLimiterFor(strings.ToUpper(ep.Method)+" "+ep.Path, *ep.RateLimit)
+		if err != nil {
+			log.Printf("Invalid rate limit for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	if err := validateTransferEncoding(ep.TransferEncoding); err != nil {
+		log.Printf("Invalid transfer encoding for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.TransferEncoding = ""
+	}
+	if err := validateContinue(ep.Continue); err != nil {
+		log.Printf("Invalid continue setting for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.Continue = nil
+	}
+	if err := validateStatusCode(ep.StatusCode); err != nil {
+		log.Printf("Invalid status code for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.StatusCode = http.StatusInternalServerError
+	}
+	if err := validateTruncate(ep.Truncate); err != nil {
+		log.Printf("Invalid truncate setting for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.Truncate = nil
+	}
+	if err := validateCircuitBreaker(ep.CircuitBreaker); err != nil {
+		log.Printf("Invalid circuit breaker for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.CircuitBreaker = nil
+	}
+	var breaker *circuitBreaker
+	if ep.CircuitBreaker != nil {
+		breaker = ms.circuitBreakerFor(strings.ToUpper(ep.Method)+" "+ep.Path, *ep.CircuitBreaker)
+	}
+	if err := validateIdempotency(ep.Idempotency); err != nil {
+		log.Printf("Invalid idempotency setting for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.Idempotency = nil
+	}
+	var idempotency *idempotencyStore
+	if ep.Idempotency != nil {
+		idempotency = ms.idempotencyStoreFor(strings.ToUpper(ep.Method)+" "+ep.Path, *ep.Idempotency)
+	}
+	if err := validateDownload(ep.Download); err != nil {
+		log.Printf("Invalid download setting for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.Download = nil
+	}
+	if ep.Multipart != nil {
+		// The composed body replaces the response; its boundary is in the content type
+		random := ms.random.forEndpoint(strings.ToUpper(ep.Method) + " " + ep.Path)
+		if body, contentType, err := ep.Multipart.encode(random); err != nil {
+			log.Printf("Invalid multipart response for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		} else {
+			ep.Response = string(body)
+			ep.ContentType = contentType
+			ep.Charset = ""
+		}
+	}
+	download := newDownload(ep.Download, ep.ResponseFile)
+	generated := download != nil && download.generated()
+
+	// Canonicalize the headers once; the values are shared by all responses
+	headers := make(http.Header, len(ep.Headers))
+	for key, value := range ep.Headers {
+		headers.Set(key, value)
+	}
+	for _, field := range ep.HeaderList {
+		headers.Add(field.Name, field.Value)
+	}
+	// Files get a content type from their extension unless one is configured
+	var contentType []string
+	if (ep.ResponseFile == "" && !generated) || ep.ContentType != "" {
+		contentType = []string{ms.contentTypeFor(ep)}
+	}
+	if ep.ResponseFile != "" && !templatedFile(ep.ResponseFile) && ep.MissingFile == nil {
+		if _, err := os.Stat(ep.ResponseFile); err != nil {
+			log.Printf("Invalid response file for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+	var missingFile *encodedResponse
+	if ep.ResponseFile != "" {
+		if missingFile, err = missingFileResponse(ep); err != nil {
+			log.Printf("Invalid missing file response for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	stream, err := streamParts(ep)
+	if err != nil {
+		log.Printf("Invalid chunks for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+	}
+
+	var gql *graphqlMocker
+	if ep.GraphQL != nil {
+		if gql, err = newGraphQLMocker(*ep.GraphQL); err != nil {
+			log.Printf("Invalid GraphQL mock for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var data *dataset
+	if ep.Dataset != nil {
+		if data, err = newDataset(*ep.Dataset); err != nil {
+			log.Printf("Invalid dataset for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var items *generator
+	if ep.Generate != nil {
+		if items, err = newGenerator(*ep.Generate); err != nil {
+			log.Printf("Invalid generate setting for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var search *searcher
+	if ep.Search != nil {
+		if search, err = newSearcher(*ep.Search, ms.resources); err != nil {
+			log.Printf("Invalid search for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var mapper *responseMapper
+	if ep.ResponseMap != nil {
+		if mapper, err = newResponseMapper(*ep.ResponseMap); err != nil {
+			log.Printf("Invalid response map for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	variants, err := encodeVariants(ep.Variants)
+	if err != nil {
+		log.Printf("Invalid variants for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+	}
+
+	var sticky keyFunc
+	if stickyKey := ep.Sticky; stickyKey != "" || (ms.config != nil && ms.config.Sticky != "") {
+		if stickyKey == "" {
+			stickyKey = ms.config.Sticky
+		}
+		if sticky, err = compileKey(stickyKey); err != nil {
+			log.Printf("Invalid sticky key for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	if err := validateFault(ep.Fault); err != nil {
+		log.Printf("Invalid fault for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		ep.Fault = nil
+	}
+
+	var shared *upstream
+	if ep.Upstream != "" {
+		var found bool
+		if shared, found = ms.upstreams.get(ep.Upstream); !found {
+			log.Printf("Unknown upstream %q for %s %s [%s]", ep.Upstream, ep.Method, ep.Path, source)
+		}
+	}
+
+	var sequence *responseSequence
+	if len(ep.Responses) > 0 {
+		if sequence, err = ms.sequenceFor(strings.ToUpper(ep.Method)+" "+ep.Path, ep.Responses, ep.Sequence); err != nil {
+			log.Printf("Invalid responses for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var links *linkTemplates
+	if len(ep.Links) > 0 {
+		if links, err = newLinkTemplates(ep.Links); err != nil {
+			log.Printf("Invalid links for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	var templates *responseTemplates
+	if ep.ResponseTemplate {
+		templates = &responseTemplates{}
+		if ep.TemplateCache != nil {
+			if templates.rendered, err = newRenderCache(ep.TemplateCache); err != nil {
+				log.Printf("Invalid template_cache for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+			}
+		}
+	}
+
+	// Responses other than GraphQL results and datasets are static, so
+	// encode them once instead of on every request
+	var static []byte
+	if gql == nil && data == nil && ep.ResponseFile == "" && !generated {
+		if static, err = encodeResponse(ep.Response); err != nil {
+			log.Printf("Failed to encode response for %s %s [%s]: %v", ep.Method, ep.Path, source, err)
+		}
+	}
+
+	allowOverrides := ms.config != nil && ms.config.HeaderOverrides
+
+	route := strings.ToUpper(ep.Method) + " " + ep.Path
+	id := endpointID(ep)
+	tags := ms.endpointTagMap(ep, source)
+	metricTags := formatTags(tags)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Annotate the request history with the matched endpoint
+		if info := requestInfoFrom(r); info != nil {
+			info.Route = route
+			info.EndpointID = id
+			info.Source = source
+			info.Tags = tags
+			info.MetricTags = metricTags
+		}
+
+		// Enforce rate limit if configured
+		if limiter != nil && !limiter.allow(w, r) {
+			log.Printf("%s %s - %d (Rate Limited) [%s]", r.Method, r.URL.Path, limiter.limit.StatusCode, source)
+			return
+		}
+
+		// Reject requests while the circuit is open and count failures otherwise
+		if breaker != nil {
+			allowed, remaining := breaker.allow()
+			if !allowed {
+				breaker.writeOpen(w, remaining)
+				log.Printf("%s %s - %d (Circuit Open) [%s]", r.Method, r.URL.Path, breaker.statusCode, source)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			w = sw
+			defer func() { breaker.record(sw.statusCode) }()
+		}
+
+		// Answer the 100-continue expectation before the body is read
+		if expectsContinue(r) {
+			if status, rejected := handleContinue(w, r, ep.Continue); rejected {
+				log.Printf("%s %s - %d (Expectation Rejected) [%s]", r.Method, r.URL.Path, status, source)
+				return
+			}
+		}
+
+		// Answer repeated idempotency keys with the first response. HEAD
+		// requests answered by a GET endpoint don't use up keys.
+		if idempotency != nil && !isAutomaticHead(r) {
+			var finish func()
+			var status int
+			var reason string
+			if w, finish, status, reason = idempotency.begin(w, r); status != 0 {
+				log.Printf("%s %s - %d (%s) [%s]", r.Method, r.URL.Path, status, reason, source)
+				return
+			}
+			if finish != nil {
+				defer finish()
+			}
+		}
+
+		// Apply the delay, fault and response requested by the client if allowed
+		delay := ep.Delay
+		var variant *encodedResponse
+		if allowOverrides {
+			overrides, err := parseRequestOverrides(r)
+			if err == nil && overrides.response != "" {
+				variant, err = selectVariant(variants, overrides.response)
+			}
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				log.Printf("%s %s - %d (%v) [%s]", r.Method, r.URL.Path, http.StatusBadRequest, err, source)
+				return
+			}
+			if overrides.delay != nil {
+				delay = *overrides.delay
+			}
+			if overrides.fault == faultReset {
+				time.Sleep(time.Duration(delay) * time.Millisecond)
+				log.Printf("%s %s - connection reset by %s [%s]", r.Method, r.URL.Path, faultHeader, source)
+				ms.notifyFault(r, FaultConnectionReset, source)
+				resetConnection(w)
+				return
+			}
+		}
+
 		// Add delay if specified
-		if ep.Delay > 0 {
-			time.Sleep(time.Duration(ep.Delay) * time.Millisecond)
+		if delay > 0 {
+			time.Sleep(time.Duration(delay) * time.Millisecond)
 		}
 
-		// Set custom headers
-		if ep.Headers != nil {
-			for key, value := range ep.Headers {
-				w.Header().Set(key, value)
+		// Random choices of the request come from the seed of the run, and
+		// from the client for sticky endpoints
+		var random *rand.Rand
+		if shared != nil || ep.Fault != nil {
+			if sticky != nil {
+				if client := sticky(r); client != "" {
+					random = ms.random.forClient(route, client)
+				}
+			}
+			if random == nil {
+				random = ms.random.forRequest(route)
+			}
+		}
+
+		// Apply the latency and errors of the upstream shared with other endpoints
+		if shared != nil {
+			defer shared.acquire()()
+			model := shared.model()
+			time.Sleep(shared.delay(model, random))
+			if shared.fails(model, random) {
+				shared.writeError(w)
+				log.Printf("%s %s - %d (Upstream %s error) [%s]", r.Method, r.URL.Path, shared.errorStatus, shared.name, source)
+				return
+			}
+		}
+
+		// Inject the configured fault instead of the response
+		if ep.Fault != nil && ep.Fault.strikes(random) {
+			ms.notifyFault(r, ep.Fault.Mode, source)
+			switch ep.Fault.Mode {
+			case FaultConnectionReset:
+				log.Printf("%s %s - connection reset by fault [%s]", r.Method, r.URL.Path, source)
+				resetConnection(w)
+				return
+			case FaultEmptyResponse:
+				log.Printf("%s %s - connection closed without a response by fault [%s]", r.Method, r.URL.Path, source)
+				closeConnection(w)
+				return
+			case FaultRandom500:
+				writeFault500(w)
+				log.Printf("%s %s - %d (Fault) [%s]", r.Method, r.URL.Path, http.StatusInternalServerError, source)
+				return
+			case FaultMalformedJSON:
+				mw := &malformedWriter{ResponseWriter: w}
+				w = mw
+				defer mw.finish()
+				log.Printf("%s %s - body cut off by fault [%s]", r.Method, r.URL.Path, source)
+			}
+		}
+
+		// Write the raw response instead of letting net/http build one
+		if ep.RawResponse != "" {
+			if err := writeRaw(w, ep.RawResponse); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				log.Printf("%s %s - %d (%v) [%s]", r.Method, r.URL.Path, http.StatusInternalServerError, err, source)
+				return
 			}
+			log.Printf("%s %s - raw response of %d bytes [%s]", r.Method, r.URL.Path, len(ep.RawResponse), source)
+			return
 		}
 
-		// Set content type to JSON if not specified
-		if w.Header().Get("Content-Type") == "" {
-			w.Header().Set("Content-Type", "application/json")
+		// Set custom headers
+		header := w.Header()
+		for key, values := range headers {
+			header[key] = values
+		}
+
+		// Set content type if not specified in the headers
+		if contentType != nil && len(header["Content-Type"]) == 0 {
+			header["Content-Type"] = contentType
 		}
 
 		// Set status code
@@ -219,19 +925,149 @@ func (ms *MockServer) addEndpoint(endpoint Endpoint, source string) {
 		if statusCode == 0 {
 			statusCode = http.StatusOK
 		}
-		w.WriteHeader(statusCode)
+
+		// Name the body of downloads
+		var filename string
+		if download != nil && variant == nil {
+			filename = download.name(r)
+			if len(header["Content-Disposition"]) == 0 {
+				header.Set("Content-Disposition", download.disposition(filename))
+			}
+		}
+
+		// Generate the content of downloads without recording it
+		if generated && variant == nil {
+			if info := requestInfoFrom(r); info != nil {
+				info.OmitBody = true
+			}
+			download.serve(w, r, filename, statusCode)
+			log.Printf("%s %s - %d (Download %s of %d bytes) [%s]", r.Method, r.URL.Path, statusCode, filename, ep.Download.Size, source)
+			return
+		}
+
+		// Generate large arrays without recording them
+		if items != nil && variant == nil {
+			if info := requestInfoFrom(r); info != nil {
+				info.OmitBody = true
+			}
+			count, err := items.serve(w, r, statusCode)
+			if err != nil {
+				log.Printf("%s %s - %d (%v) [%s]", r.Method, r.URL.Path, statusCode, err, source)
+				return
+			}
+			log.Printf("%s %s - %d (Generated %d items) [%s]", r.Method, r.URL.Path, statusCode, count, source)
+			return
+		}
+
+		// Stream the response file without recording its body
+		if ep.ResponseFile != "" && variant == nil {
+			file, found := resolveResponseFile(ep.ResponseFile, mux.Vars(r))
+			if found && missingFile != nil {
+				_, err := os.Stat(file)
+				found = !os.IsNotExist(err)
+			}
+			if !found && missingFile != nil {
+				if len(header["Content-Type"]) == 0 {
+					header.Set("Content-Type", "application/json")
+				}
+				writeBody(w, missingFile.statusCode, missingFile.body, ep.TransferEncoding)
+				log.Printf("%s %s - %d (File %s not found) [%s]", r.Method, r.URL.Path, missingFile.statusCode, file, source)
+				return
+			}
+
+			if info := requestInfoFrom(r); info != nil {
+				info.OmitBody = true
+			}
+			if err := serveFile(w, r, file, statusCode); err != nil {
+				log.Printf("%s %s - %d (%v) [%s]", r.Method, r.URL.Path, http.StatusInternalServerError, err, source)
+				return
+			}
+			log.Printf("%s %s - %d (File %s) [%s]", r.Method, r.URL.Path, statusCode, file, source)
+			return
+		}
+
+		// Stream the response in chunks if configured
+		if stream != nil && variant == nil {
+			writeStream(w, r, statusCode, stream)
+			log.Printf("%s %s - %d (Streamed %d chunks) [%s]", r.Method, r.URL.Path, statusCode, len(stream), source)
+			return
+		}
 
 		// Write response
-		if ep.Response != nil {
-			if responseStr, ok := ep.Response.(string); ok {
-				fmt.Fprint(w, responseStr)
+		body := static
+		if variant != nil {
+			body = variant.body
+			if variant.statusCode != 0 {
+				statusCode = variant.statusCode
+			}
+		}
+		if sequence != nil && variant == nil {
+			var next encodedResponse
+			if isAutomaticHead(r) {
+				next = sequence.peek()
+			} else {
+				next = sequence.next()
+			}
+			body = next.body
+			if next.statusCode != 0 {
+				statusCode = next.statusCode
+			}
+		}
+		if gql != nil && variant == nil {
+			body = gql.execute(r)
+		}
+		if data != nil && variant == nil {
+			var status int
+			if body, status = data.respond(r); status != http.StatusOK {
+				statusCode = status
+			}
+		}
+		if search != nil && variant == nil {
+			var status int
+			if body, status = search.respond(r); status != http.StatusOK {
+				statusCode = status
+			}
+		}
+		if mapper != nil && variant == nil {
+			if mapped, found := mapper.lookup(r); found {
+				body = mapped.body
+				if mapped.statusCode != 0 {
+					statusCode = mapped.statusCode
+				}
+			}
+		}
+		if templates != nil && (gql == nil || variant != nil) {
+			if rendered, err := templates.render(r, body); err != nil {
+				log.Printf("Failed to render response template for %s %s [%s]: %v", r.Method, r.URL.Path, source, err)
+			} else {
+				body = rendered
+			}
+		}
+		if links != nil {
+			if linked, err := links.addTo(r, body); err != nil {
+				log.Printf("Failed to add links for %s %s [%s]: %v", r.Method, r.URL.Path, source, err)
 			} else {
-				json.NewEncoder(w).Encode(ep.Response)
+				body = linked
+			}
+		}
+		if ep.Truncate != nil {
+			ms.notifyFault(r, faultTruncate, source)
+			sent := writeTruncated(w, statusCode, body, ep.Truncate)
+			log.Printf("%s %s - %d (Truncated %d of %d bytes) [%s]", r.Method, r.URL.Path, statusCode, sent, len(body), source)
+			return
+		}
+		if ep.Reason != "" && r.ProtoMajor == 1 {
+			if err := writeWithReason(w, r, statusCode, ep.Reason, body); err == nil {
+				log.Printf("%s %s - %d %s [%s]", r.Method, r.URL.Path, statusCode, ep.Reason, source)
+				return
 			}
 		}
+		writeBody(w, statusCode, body, ep.TransferEncoding)
 
 		log.Printf("%s %s - %d [%s]", r.Method, r.URL.Path, statusCode, source)
-	}).Methods(strings.ToUpper(ep.Method))
+	})
+
+	return handler
 }
 
 // setupManagementAPI sets up management API endpoints
@@ -242,7 +1078,7 @@ func (ms *MockServer) setupManagementAPI() {
 		defer ms.mutex.RUnlock()
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(ms.plugins)
+		ms.writeRedactedJSON(w, ms.plugins)
 	}).Methods("GET")
 
 	// Get specific plugin
@@ -261,7 +1097,7 @@ func (ms *MockServer) setupManagementAPI() {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(plugin)
+		ms.writeRedactedJSON(w, plugin)
 	}).Methods("GET")
 
 	// Enable/disable plugin
@@ -279,14 +1115,16 @@ func (ms *MockServer) setupManagementAPI() {
 		}
 
 		plugin.Enabled = !plugin.Enabled
+
+		// Replace the routes of this plugin only
+		ms.updatePluginRoutes(name)
+		ms.syncTCPListeners()
+		ms.pruneRouteState()
 		ms.mutex.Unlock()
 
 		// Save plugin state to file
 		ms.savePlugin(name, plugin)
 
-		// Reload routes
-		ms.SetupRoutes()
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": fmt.Sprintf("Plugin %s %s", name, map[bool]string{true: "enabled", false: "disabled"}[plugin.Enabled]),
@@ -309,14 +1147,86 @@ func (ms *MockServer) setupManagementAPI() {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Plugins reloaded successfully"})
 		log.Println("Plugins reloaded via admin API")
 	}).Methods("POST")
+
+	// Rate limit counters
+	ms.setupRateLimitAPI()
+
+	// Positions of response sequences
+	ms.setupSequenceAPI()
+
+	// Latency and error models shared by endpoints
+	ms.setupUpstreamAPI()
+
+	// Circuit breakers of endpoints
+	ms.setupCircuitBreakerAPI()
+
+	// Idempotency keys sent to endpoints
+	ms.setupIdempotencyAPI()
+
+	// Webhook inbox
+	ms.setupInboxAPI()
+
+	// Mail captured over SMTP
+	ms.setupMailboxAPI()
+
+	// Request history
+	ms.setupHistoryAPI()
+	ms.setupJournalAPI()
+	ms.setupVerifyAPI()
+
+	// Requests mirrored to another server
+	ms.setupMirrorAPI()
+
+	// Configuration bundle export and import
+	ms.setupBundleAPI()
+
+	// JSON Schema of configuration files
+	ms.setupSchemaAPI()
+
+	// Endpoints created at runtime
+	ms.setupEndpointsAPI()
+
+	// Plugins generated from WSDL and OpenAPI specs
+	ms.setupImportAPI()
+
+	// Runtime state snapshots
+	ms.setupStateAPI()
+
+	// Expectations on the requests received
+	ms.setupExpectationsAPI()
+
+	// Stateful resources
+	ms.setupResourcesAPI()
+
+	// Audit log of admin API changes
+	ms.setupAuditAPI()
+
+	// Active routes
+	ms.setupRoutesAPI()
+
+	// Switching endpoints on and off by tag
+	ms.setupTagsAPI()
+
+	// Switching single endpoints on and off
+	ms.setupEndpointToggleAPI()
+
+	// Certificate of the HTTPS listener
+	ms.setupTLSAPI()
+
+	// Build version and random seed
+	ms.setupVersionAPI()
 } // savePlugin saves a plugin to file
 func (ms *MockServer) savePlugin(name string, plugin *Plugin) error {
+	if ms.readOnly {
+		return errReadOnly
+	}
 	pluginPath := filepath.Join(ms.pluginsDir, name+".json")
 	data, err := json.MarshalIndent(plugin, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(pluginPath, data, 0644)
+	// Secrets are written back as references
+	return os.WriteFile(pluginPath, ms.secrets.redactJSON(data), 0644)
 }
 
 // WatchConfig watches for configuration file changes and reloads
@@ -352,30 +1262,33 @@ func (ms *MockServer) WatchConfig() {
 				return
 			}
 
+			// Skip changes made by a bundle import, which reloads by itself
+			if ms.reloadPaused.Load() {
+				continue
+			}
+
 			// Check if the modified file is our config file
 			if event.Name == ms.configPath && (event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create) {
 				log.Println("Config file changed, reloading...")
 				if err := ms.LoadConfig(); err != nil {
 					log.Printf("Failed to reload config: %v", err)
+					ms.notifier.notify(EventConfigReloadFailed, fmt.Sprintf("Failed to reload config: %v", err),
+						map[string]string{"config_file": ms.configPath, "error": err.Error()})
 				} else {
 					if err := ms.LoadPlugins(); err != nil {
 						log.Printf("Failed to reload plugins: %v", err)
 					}
 					ms.SetupRoutes()
+					ms.reloadListener()
 					log.Println("Configuration reloaded successfully")
 				}
 			}
 
-			// Check if a plugin file was modified
+			// Check if a plugin file was modified, and reload only that plugin
 			if strings.HasPrefix(event.Name, ms.pluginsDir) && strings.HasSuffix(event.Name, ".json") &&
-				(event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Remove == fsnotify.Remove) {
+				event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
 				log.Printf("Plugin file changed: %s", event.Name)
-				if err := ms.LoadPlugins(); err != nil {
-					log.Printf("Failed to reload plugins: %v", err)
-				} else {
-					ms.SetupRoutes()
-					log.Println("Plugins reloaded successfully")
-				}
+				ms.reloadPlugin(event.Name)
 			}
 		case err, ok := <-ms.watcher.Errors:
 			if !ok {
@@ -398,20 +1311,86 @@ func (ms *MockServer) Start() error {
 		log.Printf("Warning: Failed to load plugins: %v", err)
 	}
 
+	// Restore runtime state saved by a previous run
+	if ms.config.State != nil {
+		if err := ms.restoreState(ms.config.State.stateFile()); err != nil {
+			log.Printf("Warning: Failed to restore runtime state: %v", err)
+		}
+		if !ms.readOnly {
+			go ms.runStateSnapshots(*ms.config.State)
+		}
+	}
+
 	// Setup routes
 	ms.SetupRoutes()
 
 	// Start watching for config changes
 	go ms.WatchConfig()
 
+	if ms.config.S3 != nil {
+		go ms.startS3(*ms.config.S3)
+	}
+	if ms.config.SMTP != nil {
+		go ms.startSMTP(*ms.config.SMTP)
+	}
+	if ms.config.DNS != nil {
+		go ms.startDNS(*ms.config.DNS)
+	}
+
 	port := ms.config.Port
+	scheme := "http"
+	if ms.config.TLS != nil {
+		scheme = "https"
+	}
 	log.Printf("Starting mock server on port :%s", port)
-	log.Printf("Health check available at: http://localhost:%s/health", port)
-	log.Printf("Admin API available at: http://localhost:%s/_admin/", port)
+	log.Printf("Health check available at: %s://localhost:%s/health", scheme, port)
+	log.Printf("Admin API available at: %s://localhost:%s/_admin/", scheme, port)
 	log.Printf("Config file: %s", ms.configPath)
 	log.Printf("Plugins directory: %s", ms.pluginsDir)
 
-	return http.ListenAndServe(":"+port, ms.router)
+	// Register for signals before serving, so that none is missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	if err := ms.listen(); err != nil {
+		return err
+	}
+
+	// Shut down gracefully on interrupt, so that the caller can verify
+	// expectations once in-flight requests are done
+	<-signals
+	log.Printf("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ms.shutdown(ctx)
+	return nil
+}
+
+// newHTTPServer creates the HTTP server using the configured timeouts
+func (ms *MockServer) newHTTPServer() *http.Server {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	server := &http.Server{
+		Addr:              ":" + ms.config.Port,
+		Handler:           ms,
+		ReadTimeout:       time.Duration(ms.config.ReadTimeout) * time.Millisecond,
+		ReadHeaderTimeout: time.Duration(ms.config.ReadHeaderTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(ms.config.WriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(ms.config.IdleTimeout) * time.Millisecond,
+	}
+	if ms.config.TLS != nil {
+		server.TLSConfig = &tls.Config{GetCertificate: ms.tls.get}
+	}
+	return server
+}
+
+// ServeHTTP dispatches requests to the current router, so that routes
+// rebuilt on reload take effect without restarting the listener. The router
+// is swapped atomically, so requests don't wait for a reload in progress.
+func (ms *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ms.recordRequest(w, r, ms.serving.Load())
 }
 
 // CommandLineEndpoint represents an endpoint to be added via command line
@@ -424,10 +1403,16 @@ type CommandLineEndpoint struct {
 	Delay      int
 }
 
-// parseCommandLineArgs parses command line arguments for endpoint configuration
-func parseCommandLineArgs() (*CommandLineEndpoint, string, bool) {
+// parseCommandLineArgs parses command line arguments for endpoint
+// configuration. It also returns the settings given as flags, the .env file
+// and whether to add the endpoint.
+func parseCommandLineArgs() (*CommandLineEndpoint, settings, string, bool) {
 	var (
-		configPath  = flag.String("config", "config.json", "Path to configuration file")
+		configPath  = flag.String("config", "", "Path to configuration file (default: config.json)")
+		port        = flag.String("port", "", "Port to listen on, overriding the configuration file")
+		pluginsDir  = flag.String("plugins-dir", "", "Directory of plugin files, overriding the configuration file")
+		envFile     = flag.String("env-file", ".env", "File with environment variables to load")
+		noSummary   = flag.Bool("no-route-summary", false, "Don't log the mounted routes on startup and reload")
 		addEndpoint = flag.Bool("add-endpoint", false, "Add a new endpoint")
 		path        = flag.String("path", "", "API endpoint path (e.g., /api/test)")
 		method      = flag.String("method", "GET", "HTTP method (GET, POST, PUT, DELETE, etc.)")
@@ -435,6 +1420,10 @@ func parseCommandLineArgs() (*CommandLineEndpoint, string, bool) {
 		response    = flag.String("response", `{"message": "Hello World"}`, "Response body (JSON string)")
 		headers     = flag.String("headers", "", "Custom headers in format 'key1:value1,key2:value2'")
 		delay       = flag.Int("delay", 0, "Response delay in milliseconds")
+		schema      = flag.String("schema", "", "Print the JSON Schema of configuration files (config or plugin)")
+		readOnly    = flag.Bool("read-only", false, "Reject admin API changes and never write configuration, plugin or state files")
+		tlsAuto     = flag.Bool("tls-auto", false, "Serve HTTPS with a self-signed certificate generated on startup")
+		seed        = flag.String("seed", "", "Seed of random choices, e.g. the one logged by a run to reproduce it")
 		help        = flag.Bool("help", false, "Show help message")
 	)
 
@@ -442,7 +1431,15 @@ func parseCommandLineArgs() (*CommandLineEndpoint, string, bool) {
 		fmt.Fprintf(os.Stderr, "nmock - A mock server with dynamic endpoint management\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  %s [options]                     Start the mock server\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s --add-endpoint [options]      Add a new endpoint\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --add-endpoint [options]      Add a new endpoint\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s lint [options] [config_file]  Check configuration and plugins for problems\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s repl [--url URL]              Interactive shell for a running server\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s tui [--url URL]               Terminal dashboard for a running server\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s bench [--target :9000]        Load test the endpoints of a running server\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s replay --from <har>           Replay recorded requests and compare the responses\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s config resolve [options]      Print the effective configuration\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s hosts [config_file]           Print /etc/hosts entries for the dns hosts\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s import [options] <spec>       Generate a plugin from a WSDL or OpenAPI spec\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -463,6 +1460,23 @@ func parseCommandLineArgs() (*CommandLineEndpoint, string, bool) {
 		os.Exit(0)
 	}
 
+	if *schema != "" {
+		generate, ok := configSchemas[*schema]
+		if !ok {
+			log.Fatalf("Error: unknown schema %q, use config or plugin", *schema)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(generate())
+		os.Exit(0)
+	}
+
+	if *seed != "" {
+		if _, err := parseSeed(*seed); err != nil {
+			log.Fatalf("Error: invalid --seed %q, expected an integer", *seed)
+		}
+	}
+
 	if *addEndpoint {
 		if *path == "" {
 			log.Fatal("Error: --path is required when using --add-endpoint")
@@ -474,10 +1488,10 @@ func parseCommandLineArgs() (*CommandLineEndpoint, string, bool) {
 			Response:   *response,
 			Headers:    *headers,
 			Delay:      *delay,
-		}, *configPath, true
+		}, settings{ConfigPath: *configPath}, *envFile, true
 	}
 
-	return nil, *configPath, false
+	return nil, settings{ConfigPath: *configPath, Port: *port, PluginsDir: *pluginsDir, ReadOnly: *readOnly, TLSAuto: *tlsAuto, Seed: *seed, NoRouteSummary: *noSummary}, *envFile, false
 }
 
 // parseHeaders parses header string into map
@@ -573,10 +1587,48 @@ func AddEndpointToConfig(configPath string, cmdEndpoint *CommandLineEndpoint) er
 }
 
 func main() {
+	// Run subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runLint(os.Args[2:], os.Stdout))
+		case "repl":
+			os.Exit(runREPL(os.Args[2:], os.Stdin, os.Stdout))
+		case "tui":
+			os.Exit(runTUI(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:], os.Stdout))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:], os.Stdout))
+		case "config":
+			os.Exit(runConfig(os.Args[2:], os.Stdout))
+		case "hosts":
+			os.Exit(runHosts(os.Args[2:], os.Stdout))
+		case "import":
+			os.Exit(runImport(os.Args[2:], os.Stdout))
+		}
+	}
+
 	// Parse command line arguments
-	cmdEndpoint, configPath, shouldAddEndpoint := parseCommandLineArgs()
+	cmdEndpoint, flagSettings, envFile, shouldAddEndpoint := parseCommandLineArgs()
+
+	// Check for legacy command line argument (backward compatibility)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		flagSettings.ConfigPath = os.Args[1]
+	}
+
+	// Flags take precedence over the environment, which takes precedence
+	// over the .env file
+	resolved, err := resolveSettings(flagSettings, envFile)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	configPath := resolved.ConfigPath
 
 	if shouldAddEndpoint {
+		if resolved.ReadOnly {
+			log.Fatal("Error: --add-endpoint can't be used with --read-only")
+		}
 		// Add endpoint and exit
 		if err := AddEndpointToConfig(configPath, cmdEndpoint); err != nil {
 			log.Fatalf("Failed to add endpoint: %v", err)
@@ -585,13 +1637,11 @@ func main() {
 		return
 	}
 
-	// Check for legacy command line argument (backward compatibility)
-	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
-		configPath = os.Args[1]
-	}
-
 	// Check if config file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		if resolved.ReadOnly {
+			log.Fatalf("Config file %s does not exist", configPath)
+		}
 		log.Printf("Config file %s does not exist, creating example config...", configPath)
 		if err := createExampleConfig(configPath); err != nil {
 			log.Fatalf("Failed to create example config: %v", err)
@@ -601,9 +1651,16 @@ func main() {
 
 	// Create and start mock server
 	server := NewMockServer(configPath)
+	server.settings = resolved
+	server.readOnly = resolved.ReadOnly
 	if err := server.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	// Fail the run if requests didn't meet the expectations
+	if !server.expectations.verify() {
+		os.Exit(1)
+	}
 }
 
 // createExampleConfig creates an example configuration file
@@ -461,6 +461,42 @@ func TestEndpointWithCustomHeaders(t *testing.T) {
 	}
 }
 
+// TestEndpointWithHeaderList tests repeated headers sent in order
+func TestEndpointWithHeaderList(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path:       "/login",
+				Method:     "POST",
+				StatusCode: 200,
+				Response:   "ok",
+				Headers:    map[string]string{"Set-Cookie": "tracking=1"},
+				HeaderList: []HeaderField{
+					{Name: "set-cookie", Value: "session=abc; HttpOnly"},
+					{Name: "Set-Cookie", Value: "theme=dark"},
+					{Name: "Content-Type", Value: "text/plain"},
+				},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	cookies := strings.Join(w.Header()["Set-Cookie"], " | ")
+	if cookies != "tracking=1 | session=abc; HttpOnly | theme=dark" {
+		t.Errorf("Expected the cookies in order, got '%s'", cookies)
+	}
+	if w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected Content-Type 'text/plain', got '%s'", w.Header().Get("Content-Type"))
+	}
+}
+
 // TestParseHeaders tests header parsing functionality
 func TestParseHeaders(t *testing.T) {
 	tests := []struct {
@@ -654,3 +690,81 @@ func TestStringResponse(t *testing.T) {
 		t.Errorf("Expected response 'Hello, World!', got '%s'", body)
 	}
 }
+
+// TestStaticResponseEncodedOnce tests that static responses are encoded when
+// routes are built rather than on every request
+func TestStaticResponseEncodedOnce(t *testing.T) {
+	response := map[string]interface{}{"message": "built"}
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/static", Method: "GET", Response: response}},
+	}
+	server.SetupRoutes()
+
+	response["message"] = "changed"
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/static", nil))
+		if body := strings.TrimSpace(w.Body.String()); body != `{"message":"built"}` {
+			t.Errorf("Expected the response encoded at build time, got '%s'", body)
+		}
+	}
+}
+
+// TestServerTimeouts tests that configured timeouts are applied to the HTTP server
+func TestServerTimeouts(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:              "9000",
+		PluginsDir:        "plugins",
+		ReadTimeout:       1500,
+		ReadHeaderTimeout: 500,
+		WriteTimeout:      2000,
+		IdleTimeout:       30000,
+	}
+
+	httpServer := server.newHTTPServer()
+
+	if httpServer.Addr != ":9000" {
+		t.Errorf("Expected addr ':9000', got '%s'", httpServer.Addr)
+	}
+
+	if httpServer.ReadTimeout != 1500*time.Millisecond {
+		t.Errorf("Expected read timeout 1.5s, got %v", httpServer.ReadTimeout)
+	}
+
+	if httpServer.ReadHeaderTimeout != 500*time.Millisecond {
+		t.Errorf("Expected read header timeout 500ms, got %v", httpServer.ReadHeaderTimeout)
+	}
+
+	if httpServer.WriteTimeout != 2*time.Second {
+		t.Errorf("Expected write timeout 2s, got %v", httpServer.WriteTimeout)
+	}
+
+	if httpServer.IdleTimeout != 30*time.Second {
+		t.Errorf("Expected idle timeout 30s, got %v", httpServer.IdleTimeout)
+	}
+}
+
+// TestServeHTTPUsesCurrentRouter tests that rebuilt routes are served without restarting
+func TestServeHTTPUsesCurrentRouter(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.SetupRoutes()
+
+	server.config.Endpoints = []Endpoint{
+		{Path: "/added", Method: "GET", StatusCode: 200, Response: "added"},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/added", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
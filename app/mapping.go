@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ResponseMap selects the response of an endpoint by a value taken from the
+// request. Requests whose value is not in the map get the endpoint's response.
+type ResponseMap struct {
+	Key       string                    `json:"key"` // "path:<name>", "header:<name>", "query:<name>", "body:<field>" or a template
+	Responses map[string]MappedResponse `json:"responses"`
+}
+
+// MappedResponse is the response for one value of a ResponseMap
+type MappedResponse struct {
+	StatusCode int         `json:"status_code,omitempty"` // default: the endpoint's status code
+	Response   interface{} `json:"response"`
+}
+
+// encodedResponse is a MappedResponse with its body encoded
+type encodedResponse struct {
+	statusCode int
+	body       []byte
+}
+
+// responseMapper looks up the responses of a ResponseMap
+type responseMapper struct {
+	key       keyFunc
+	responses map[string]encodedResponse
+}
+
+// newResponseMapper compiles the key of a response map and encodes its responses
+func newResponseMapper(config ResponseMap) (*responseMapper, error) {
+	if config.Key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	key, err := compileKey(config.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	rm := &responseMapper{key: key, responses: make(map[string]encodedResponse, len(config.Responses))}
+	for value, response := range config.Responses {
+		body, err := encodeResponse(response.Response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode response for %q: %v", value, err)
+		}
+		rm.responses[value] = encodedResponse{statusCode: response.StatusCode, body: body}
+	}
+	return rm, nil
+}
+
+// lookup returns the response mapped to the value of a request, if any
+func (rm *responseMapper) lookup(r *http.Request) (encodedResponse, bool) {
+	response, found := rm.responses[rm.key(r)]
+	return response, found
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResponseMap tests selecting responses by path variables, headers and body fields
+func TestResponseMap(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path: "/api/users/{id}", Method: "GET", StatusCode: 404, Response: map[string]string{"error": "unknown user"},
+				ResponseMap: &ResponseMap{Key: "path:id", Responses: map[string]MappedResponse{
+					"1": {StatusCode: 200, Response: map[string]string{"name": "Alice"}},
+					"2": {StatusCode: 200, Response: map[string]string{"name": "Bob"}},
+				}},
+			},
+			{
+				Path: "/api/plan", Method: "GET", Response: "free",
+				ResponseMap: &ResponseMap{Key: "header:X-Tenant", Responses: map[string]MappedResponse{"acme": {Response: "enterprise"}}},
+			},
+			{
+				Path: "/api/pay", Method: "POST", StatusCode: 201, Response: "accepted",
+				ResponseMap: &ResponseMap{Key: "body:card.number", Responses: map[string]MappedResponse{
+					"4000000000000002": {StatusCode: 402, Response: "declined"},
+				}},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	tests := []struct {
+		method, path, header, body string
+		status                     int
+		response                   string
+	}{
+		{"GET", "/api/users/2", "", "", 200, `{"name":"Bob"}` + "\n"},
+		{"GET", "/api/users/9", "", "", 404, `{"error":"unknown user"}` + "\n"},
+		{"GET", "/api/plan", "acme", "", 200, "enterprise"},
+		{"GET", "/api/plan", "other", "", 200, "free"},
+		{"POST", "/api/pay", "", `{"card": {"number": "4000000000000002"}}`, 402, "declined"},
+		{"POST", "/api/pay", "", `{"card": {"number": "4242424242424242"}}`, 201, "accepted"},
+		{"POST", "/api/pay", "", `not json`, 201, "accepted"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		req.Header.Set("X-Tenant", test.header)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != test.status || w.Body.String() != test.response {
+			t.Errorf("Expected %s %s to respond %d %s, got %d %s", test.method, test.path, test.status, test.response, w.Code, w.Body.String())
+		}
+	}
+
+	if _, err := newResponseMapper(ResponseMap{Key: "cookie:session"}); err == nil {
+		t.Error("Expected an error for an unsupported key")
+	}
+}
+
+// TestBodyFieldKey tests keys taken from JSON body fields
+func TestBodyFieldKey(t *testing.T) {
+	key, err := compileKey("body:order.total")
+	if err != nil {
+		t.Fatalf("Failed to compile key: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"order": {"total": 42.5, "items": [1]}}`))
+	if got := key(req); got != "42.5" {
+		t.Errorf("Expected key '42.5', got '%s'", got)
+	}
+	if body, _ := io.ReadAll(req.Body); !strings.Contains(string(body), "total") {
+		t.Error("Expected the body to stay readable")
+	}
+
+	items, _ := compileKey("body:order.items")
+	if got := items(httptest.NewRequest("POST", "/", strings.NewReader(`{"order": {"items": [1]}}`))); got != "" {
+		t.Errorf("Expected no key for an array field, got '%s'", got)
+	}
+}
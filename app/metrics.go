@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsBuckets are the upper bounds of the request duration histogram in
+// seconds
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsConfig exposes request and plugin metrics for Prometheus
+type MetricsConfig struct {
+	Path string `json:"path,omitempty"` // path of the metrics endpoint (default: /metrics)
+}
+
+// validateMetrics checks the metrics setting of a configuration
+func validateMetrics(config *MetricsConfig) error {
+	if config == nil || config.Path == "" {
+		return nil
+	}
+	if !strings.HasPrefix(config.Path, "/") || strings.HasPrefix(config.Path, "/_admin/") {
+		return fmt.Errorf("invalid metrics path %q, expected a path outside /_admin/", config.Path)
+	}
+	return nil
+}
+
+// metricsPath returns the path of the metrics endpoint
+func (config *MetricsConfig) metricsPath() string {
+	if config.Path == "" {
+		return "/metrics"
+	}
+	return config.Path
+}
+
+// requestLabels identify a request counter
+type requestLabels struct {
+	method string
+	route  string
+	source string
+	status int
+}
+
+// durationLabels identify a request duration histogram
+type durationLabels struct {
+	method string
+	route  string
+	source string
+}
+
+// histogram counts observations per bucket
+type histogram struct {
+	counts []uint64 // per bucket of metricsBuckets, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(value float64) {
+	for i, bound := range metricsBuckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// metrics counts requests and plugin loads since startup. Counters are
+// never reset, as Prometheus expects.
+type metrics struct {
+	mutex       sync.Mutex
+	requests    map[requestLabels]uint64
+	durations   map[durationLabels]*histogram
+	pluginLoads map[string]uint64 // by result, success or failure
+}
+
+// newMetrics creates empty metrics
+func newMetrics() *metrics {
+	return &metrics{
+		requests:    make(map[requestLabels]uint64),
+		durations:   make(map[durationLabels]*histogram),
+		pluginLoads: make(map[string]uint64),
+	}
+}
+
+// observe counts a recorded request
+func (m *metrics) observe(entry historyEntry) {
+	route := entry.Route
+	if _, path, found := strings.Cut(route, " "); found {
+		route = path
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests[requestLabels{entry.Method, route, entry.Source, entry.StatusCode}]++
+	key := durationLabels{entry.Method, route, entry.Source}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(metricsBuckets))}
+		m.durations[key] = h
+	}
+	h.observe(entry.Duration.Seconds())
+}
+
+// pluginLoaded counts an attempt to load a plugin file
+func (m *metrics) pluginLoaded(ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if ok {
+		m.pluginLoads["success"]++
+	} else {
+		m.pluginLoads["failure"]++
+	}
+}
+
+// metricLabels formats labels in the Prometheus text format. Pairs are
+// given as name, value, name, value...
+func metricLabels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, pairs[i]+`="`+value+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatMetric formats a sample value
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// write writes the request and plugin load metrics in the Prometheus text
+// format, sorted by labels so that scrapes are stable
+func (m *metrics) write(b *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	requests := make([]requestLabels, 0, len(m.requests))
+	for labels := range m.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		if a.source != b.source {
+			return a.source < b.source
+		}
+		return a.status < b.status
+	})
+	b.WriteString("# HELP nmock_requests_total Requests served, by route and status code.\n")
+	b.WriteString("# TYPE nmock_requests_total counter\n")
+	for _, labels := range requests {
+		fmt.Fprintf(b, "nmock_requests_total%s %d\n",
+			metricLabels("method", labels.method, "route", labels.route, "source", labels.source, "status", strconv.Itoa(labels.status)),
+			m.requests[labels])
+	}
+
+	durations := make([]durationLabels, 0, len(m.durations))
+	for labels := range m.durations {
+		durations = append(durations, labels)
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		a, b := durations[i], durations[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.source < b.source
+	})
+	b.WriteString("# HELP nmock_request_duration_seconds Time to serve requests, by route.\n")
+	b.WriteString("# TYPE nmock_request_duration_seconds histogram\n")
+	for _, labels := range durations {
+		h := m.durations[labels]
+		pairs := []string{"method", labels.method, "route", labels.route, "source", labels.source}
+		var cumulative uint64
+		for i, bound := range metricsBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "nmock_request_duration_seconds_bucket%s %d\n", metricLabels(append(pairs, "le", formatMetric(bound))...), cumulative)
+		}
+		fmt.Fprintf(b, "nmock_request_duration_seconds_bucket%s %d\n", metricLabels(append(pairs, "le", "+Inf")...), h.count)
+		fmt.Fprintf(b, "nmock_request_duration_seconds_sum%s %s\n", metricLabels(pairs...), formatMetric(h.sum))
+		fmt.Fprintf(b, "nmock_request_duration_seconds_count%s %d\n", metricLabels(pairs...), h.count)
+	}
+
+	b.WriteString("# HELP nmock_plugin_loads_total Attempts to load plugin files, by result.\n")
+	b.WriteString("# TYPE nmock_plugin_loads_total counter\n")
+	for _, result := range []string{"failure", "success"} {
+		fmt.Fprintf(b, "nmock_plugin_loads_total%s %d\n", metricLabels("result", result), m.pluginLoads[result])
+	}
+}
+
+// metricsHandler serves the metrics, with gauges of the loaded plugins
+func (ms *MockServer) metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		ms.metrics.write(&b)
+
+		ms.mutex.RLock()
+		names := make([]string, 0, len(ms.plugins))
+		enabled := 0
+		for name, plugin := range ms.plugins {
+			names = append(names, name)
+			if plugin.Enabled {
+				enabled++
+			}
+		}
+		sort.Strings(names)
+
+		b.WriteString("# HELP nmock_plugins Plugins loaded, by state.\n")
+		b.WriteString("# TYPE nmock_plugins gauge\n")
+		fmt.Fprintf(&b, "nmock_plugins%s %d\n", metricLabels("state", "disabled"), len(names)-enabled)
+		fmt.Fprintf(&b, "nmock_plugins%s %d\n", metricLabels("state", "enabled"), enabled)
+		b.WriteString("# HELP nmock_plugin_endpoints Endpoints defined by each loaded plugin.\n")
+		b.WriteString("# TYPE nmock_plugin_endpoints gauge\n")
+		for _, name := range names {
+			plugin := ms.plugins[name]
+			fmt.Fprintf(&b, "nmock_plugin_endpoints%s %d\n",
+				metricLabels("plugin", name, "enabled", strconv.FormatBool(plugin.Enabled)), len(plugin.allEndpoints()))
+		}
+		ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String()))
+	})
+}
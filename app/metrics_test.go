@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricsEndpoint tests exposing request and plugin metrics for Prometheus
+func TestMetricsEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "billing.json"), []byte(`{"name": "billing", "enabled": true, "endpoints": [
+		{"path": "/api/invoices", "method": "POST", "status_code": 201, "response": "ok"}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0644)
+
+	server := NewMockServer("")
+	server.pluginsDir = dir
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: dir,
+		Metrics:    &MetricsConfig{},
+		Endpoints: []Endpoint{
+			{Path: "/api/users/{id}", Method: "GET", StatusCode: 200, Response: "ok"},
+			{Path: "/api/slow", Method: "GET", StatusCode: 503, Response: "busy", Delay: 30},
+		},
+	}
+	if err := server.LoadPlugins(); err != nil {
+		t.Fatalf("Failed to load plugins: %v", err)
+	}
+	server.SetupRoutes()
+
+	for _, request := range []struct{ method, path string }{
+		{"GET", "/api/users/1"}, {"GET", "/api/users/2"}, {"GET", "/api/slow"}, {"POST", "/api/invoices"}, {"GET", "/missing"},
+		{"GET", "/_admin/plugins"},
+	} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Expected metrics, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		"# TYPE nmock_requests_total counter\n",
+		`nmock_requests_total{method="GET",route="/api/users/{id}",source="main",status="200"} 2` + "\n",
+		`nmock_requests_total{method="GET",route="/api/slow",source="main",status="503"} 1` + "\n",
+		`nmock_requests_total{method="POST",route="/api/invoices",source="billing",status="201"} 1` + "\n",
+		`nmock_requests_total{method="GET",route="",source="",status="404"} 1` + "\n",
+		"# TYPE nmock_request_duration_seconds histogram\n",
+		`nmock_request_duration_seconds_bucket{method="GET",route="/api/slow",source="main",le="0.005"} 0` + "\n",
+		`nmock_request_duration_seconds_bucket{method="GET",route="/api/slow",source="main",le="+Inf"} 1` + "\n",
+		`nmock_request_duration_seconds_count{method="GET",route="/api/users/{id}",source="main"} 2` + "\n",
+		`nmock_plugin_loads_total{result="failure"} 1` + "\n",
+		`nmock_plugin_loads_total{result="success"} 1` + "\n",
+		`nmock_plugins{state="enabled"} 1` + "\n",
+		`nmock_plugin_endpoints{plugin="billing",enabled="true"} 1` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "/_admin/") {
+		t.Errorf("Expected admin API requests not to be measured, got:\n%s", body)
+	}
+
+	// Metrics are only exposed when configured, and never reset
+	server.metrics.observe(historyEntry{Method: "GET", Route: "GET /api/users/{id}", Source: "main", StatusCode: 200, Duration: time.Second})
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `nmock_requests_total{method="GET",route="/api/users/{id}",source="main",status="200"} 3`) {
+		t.Errorf("Expected counters to keep counting, got:\n%s", w.Body.String())
+	}
+	server.config.Metrics = nil
+	server.SetupRoutes()
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected no metrics endpoint without configuration, got %d", w.Code)
+	}
+
+	if validateMetrics(&MetricsConfig{Path: "/_admin/metrics"}) == nil || validateMetrics(&MetricsConfig{Path: "metrics"}) == nil {
+		t.Error("Expected invalid metrics paths to be rejected")
+	}
+}
+
+// TestMetricLabels tests escaping label values
+func TestMetricLabels(t *testing.T) {
+	if labels := metricLabels("route", "/a\"b\\c\nd"); labels != `{route="/a\"b\\c\nd"}` {
+		t.Errorf("Unexpected labels %s", labels)
+	}
+}
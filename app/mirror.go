@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mirrorHeader marks mirrored requests, which are never mirrored again
+const mirrorHeader = "X-Nmock-Mirror"
+
+// MirrorConfig sends a copy of every mocked request to another server
+// (shadow traffic), while the mock still answers the client
+type MirrorConfig struct {
+	URL        string   `json:"url"`                   // base URL the request path and query are appended to
+	Paths      []string `json:"paths,omitempty"`       // path prefixes of the mirrored requests (default: all)
+	Timeout    int      `json:"timeout,omitempty"`     // milliseconds (default: 5000)
+	MaxPending int      `json:"max_pending,omitempty"` // mirrored requests in flight before new ones are dropped (default: 100)
+}
+
+// hopHeaders are connection-specific headers that are not mirrored
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// mirrorStats counts mirrored requests
+type mirrorStats struct {
+	Sent       int64 `json:"sent"`
+	Failed     int64 `json:"failed"`     // the target could not be reached
+	Dropped    int64 `json:"dropped"`    // not sent because too many were pending
+	Mismatched int64 `json:"mismatched"` // the target answered with another status than the mock
+}
+
+// mirror sends copies of recorded requests to the configured target
+type mirror struct {
+	mutex   sync.RWMutex
+	config  *MirrorConfig
+	target  *url.URL
+	client  *http.Client
+	pending chan struct{}
+	wg      sync.WaitGroup
+
+	sent, failed, dropped, mismatched atomic.Int64
+}
+
+// newMirror creates a mirror that sends nothing until configured
+func newMirror() *mirror {
+	return &mirror{}
+}
+
+// configure replaces the mirror target. A nil config stops mirroring.
+func (m *mirror) configure(config *MirrorConfig) error {
+	var target *url.URL
+	if config != nil {
+		var err error
+		target, err = url.Parse(config.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("invalid mirror url %q, expected an http or https URL", config.URL)
+		}
+		if config.Timeout < 0 || config.MaxPending < 0 {
+			return fmt.Errorf("mirror timeout and max_pending must not be negative")
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.config = config
+	m.target = target
+	if config == nil {
+		return nil
+	}
+	timeout := 5000
+	if config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+	maxPending := 100
+	if config.MaxPending > 0 {
+		maxPending = config.MaxPending
+	}
+	m.client = &http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+		// Redirects are answers of the target, not requests of the client
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	m.pending = make(chan struct{}, maxPending)
+	return nil
+}
+
+// observe mirrors a recorded request in the background
+func (m *mirror) observe(entry historyEntry) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.config == nil || entry.RequestHeaders.Get(mirrorHeader) != "" || !m.matches(entry.Path) {
+		return
+	}
+	select {
+	case m.pending <- struct{}{}:
+	default:
+		m.dropped.Add(1)
+		return
+	}
+
+	req, err := m.request(entry)
+	if err != nil {
+		<-m.pending
+		m.failed.Add(1)
+		log.Printf("Failed to mirror %s %s: %v", entry.Method, entry.Path, err)
+		return
+	}
+	client, pending := m.client, m.pending
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-pending }()
+		m.send(client, req, entry)
+	}()
+}
+
+// matches reports whether requests to a path are mirrored
+func (m *mirror) matches(path string) bool {
+	if len(m.config.Paths) == 0 {
+		return true
+	}
+	for _, prefix := range m.config.Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// request builds the copy of a recorded request sent to the target
+func (m *mirror) request(entry historyEntry) (*http.Request, error) {
+	original, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, err
+	}
+	target := *m.target
+	target.Path = strings.TrimSuffix(target.Path, "/") + original.Path
+	target.RawPath = ""
+	target.RawQuery = original.RawQuery
+
+	req, err := http.NewRequest(entry.Method, target.String(), bytes.NewReader(entry.RequestBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = entry.RequestHeaders.Clone()
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Del("Content-Length")
+	req.Header.Set(mirrorHeader, "1")
+	if ip := entry.IP; ip != "" {
+		req.Header.Add("X-Forwarded-For", ip)
+	}
+	return req, nil
+}
+
+// send sends a mirrored request and compares the status with the mock's
+func (m *mirror) send(client *http.Client, req *http.Request, entry historyEntry) {
+	resp, err := client.Do(req)
+	if err != nil {
+		m.failed.Add(1)
+		log.Printf("Failed to mirror %s %s: %v", entry.Method, entry.Path, err)
+		return
+	}
+	resp.Body.Close()
+	m.sent.Add(1)
+	if resp.StatusCode != entry.StatusCode {
+		m.mismatched.Add(1)
+		log.Printf("Mirrored %s %s - %d, mock answered %d", entry.Method, entry.Path, resp.StatusCode, entry.StatusCode)
+	}
+}
+
+// wait blocks until the mirrored requests in flight are sent
+func (m *mirror) wait() {
+	m.wg.Wait()
+}
+
+// stats returns the counts of mirrored requests
+func (m *mirror) stats() mirrorStats {
+	return mirrorStats{
+		Sent:       m.sent.Load(),
+		Failed:     m.failed.Load(),
+		Dropped:    m.dropped.Load(),
+		Mismatched: m.mismatched.Load(),
+	}
+}
+
+// setupMirrorAPI registers the admin API of request mirroring
+func (ms *MockServer) setupMirrorAPI() {
+	// Show the mirror target and the counts of mirrored requests
+	ms.router.HandleFunc("/_admin/mirror", func(w http.ResponseWriter, r *http.Request) {
+		ms.mirror.mutex.RLock()
+		target := ""
+		if ms.mirror.config != nil {
+			target = ms.mirror.config.URL
+		}
+		ms.mirror.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":   target,
+			"stats": ms.mirror.stats(),
+		})
+	}).Methods("GET")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMirror tests sending copies of mocked requests to another server
+func TestMirror(t *testing.T) {
+	type mirrored struct {
+		method, uri, body, mirror, contentType string
+	}
+	var mutex sync.Mutex
+	var received []mirrored
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		received = append(received, mirrored{r.Method, r.URL.RequestURI(), string(body), r.Header.Get(mirrorHeader), r.Header.Get("Content-Type")})
+		mutex.Unlock()
+		if r.URL.Path == "/base/api/orders" {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/orders", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 1}},
+			{Path: "/api/users", Method: "GET", Response: []interface{}{}},
+			{Path: "/health/ready", Method: "GET", Response: "ok"},
+		},
+	}
+	if err := server.mirror.configure(&MirrorConfig{URL: target.URL + "/base/", Paths: []string{"/api/"}}); err != nil {
+		t.Fatalf("Failed to configure mirror: %v", err)
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/orders?source=web", "application/json", strings.NewReader(`{"item":"book"}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || !strings.Contains(string(body), `"id":1`) {
+		t.Errorf("Expected the mock response, got %d %s", resp.StatusCode, body)
+	}
+
+	for _, path := range []string{"/api/users", "/health/ready"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Requests that were already mirrored are not mirrored again
+	req, _ := http.NewRequest("GET", ts.URL+"/api/users", nil)
+	req.Header.Set(mirrorHeader, "1")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+	server.mirror.wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 mirrored requests, got %+v", received)
+	}
+	order := received[0]
+	if received[0].method != "POST" {
+		order = received[1]
+	}
+	if order.uri != "/base/api/orders?source=web" || order.body != `{"item":"book"}` || order.mirror != "1" || order.contentType != "application/json" {
+		t.Errorf("Unexpected mirrored request %+v", order)
+	}
+
+	// The target answers the users request with another status than the mock
+	if stats := server.mirror.stats(); stats.Sent != 2 || stats.Failed != 0 || stats.Mismatched != 1 {
+		t.Errorf("Unexpected mirror stats %+v", stats)
+	}
+}
+
+// TestMirrorFailures tests counting unreachable targets and invalid settings
+func TestMirrorFailures(t *testing.T) {
+	target := httptest.NewServer(http.NotFoundHandler())
+	unreachable := target.URL
+	target.Close()
+
+	m := newMirror()
+	if err := m.configure(&MirrorConfig{URL: unreachable}); err != nil {
+		t.Fatalf("Failed to configure mirror: %v", err)
+	}
+	m.observe(historyEntry{Method: "GET", URL: "http://localhost/a", Path: "/a", RequestHeaders: http.Header{}, StatusCode: 200})
+	m.wait()
+	if stats := m.stats(); stats.Failed != 1 || stats.Sent != 0 {
+		t.Errorf("Expected a failed request, got %+v", stats)
+	}
+
+	for _, config := range []*MirrorConfig{{URL: ""}, {URL: "ftp://example.com"}, {URL: "http://"}, {URL: "http://example.com", Timeout: -1}} {
+		if err := newMirror().configure(config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
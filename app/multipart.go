@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// MultipartResponse is a multipart body composed of parts, such as the
+// answer to an OData $batch request
+type MultipartResponse struct {
+	Subtype  string         `json:"subtype,omitempty"`  // subtype of the content type: "mixed" (default), "related", "alternative", ...
+	Boundary string         `json:"boundary,omitempty"` // boundary between the parts (default: random)
+	Parts    []ResponsePart `json:"parts"`
+}
+
+// ResponsePart is one part of a multipart body
+type ResponsePart struct {
+	Headers map[string]string `json:"headers,omitempty"` // headers of the part, e.g. Content-ID
+	Body    interface{}       `json:"body,omitempty"`    // strings are sent as-is, other values as JSON
+
+	Multipart *MultipartResponse `json:"multipart,omitempty"` // nested multipart body instead of body, e.g. an OData changeset
+
+	// An HTTP response message as the body (application/http), as in batch
+	// responses. Body and response headers make up the message.
+	StatusCode      int               `json:"status_code,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// encode returns the body of a multipart response and its content type.
+// Boundaries that aren't configured are drawn from random, or from a
+// cryptographic source if it is nil.
+func (m *MultipartResponse) encode(random *rand.Rand) ([]byte, string, error) {
+	if len(m.Parts) == 0 {
+		return nil, "", fmt.Errorf("multipart response without parts")
+	}
+	subtype := m.Subtype
+	if subtype == "" {
+		subtype = "mixed"
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if m.Boundary != "" {
+		if err := writer.SetBoundary(m.Boundary); err != nil {
+			return nil, "", fmt.Errorf("invalid boundary %q: %v", m.Boundary, err)
+		}
+	} else if random != nil {
+		writer.SetBoundary(randomBoundary(random))
+	}
+	for i, part := range m.Parts {
+		header, body, err := part.encode(random)
+		if err != nil {
+			return nil, "", fmt.Errorf("part %d: %v", i+1, err)
+		}
+		if bytes.Contains(body, []byte("--"+writer.Boundary())) {
+			return nil, "", fmt.Errorf("part %d contains the boundary %q", i+1, writer.Boundary())
+		}
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		w.Write(body)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "multipart/" + subtype + "; boundary=" + writer.Boundary(), nil
+}
+
+// encode returns the headers and body of a part
+func (p ResponsePart) encode(random *rand.Rand) (textproto.MIMEHeader, []byte, error) {
+	header := make(textproto.MIMEHeader, len(p.Headers)+1)
+	for name, value := range p.Headers {
+		header.Set(name, value)
+	}
+
+	if p.Multipart != nil {
+		body, contentType, err := p.Multipart.encode(random)
+		if err != nil {
+			return nil, nil, err
+		}
+		header.Set("Content-Type", contentType)
+		return header, body, nil
+	}
+
+	body, err := encodeResponse(p.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, isString := p.Body.(string)
+	if p.StatusCode == 0 {
+		if !isString && p.Body != nil && header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+		return header, body, nil
+	}
+
+	// Wrap the body in an HTTP response message
+	if err := validateStatusCode(p.StatusCode); err != nil {
+		return nil, nil, err
+	}
+	responseHeader := make(http.Header, len(p.ResponseHeaders)+1)
+	for name, value := range p.ResponseHeaders {
+		responseHeader.Set(name, value)
+	}
+	if !isString && p.Body != nil && responseHeader.Get("Content-Type") == "" {
+		responseHeader.Set("Content-Type", "application/json")
+	}
+	names := make([]string, 0, len(responseHeader))
+	for name := range responseHeader {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "HTTP/1.1 %d %s\r\n", p.StatusCode, http.StatusText(p.StatusCode))
+	for _, name := range names {
+		fmt.Fprintf(&message, "%s: %s\r\n", name, strings.Join(responseHeader[name], ", "))
+	}
+	message.WriteString("\r\n")
+	message.Write(bytes.TrimSuffix(body, []byte("\n")))
+
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/http")
+	}
+	if header.Get("Content-Transfer-Encoding") == "" {
+		header.Set("Content-Transfer-Encoding", "binary")
+	}
+	return header, message.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMultipartResponse tests composing batch responses from parts
+func TestMultipartResponse(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path:   "/odata/$batch",
+				Method: "POST",
+				Multipart: &MultipartResponse{
+					Boundary: "batch_1",
+					Parts: []ResponsePart{
+						{StatusCode: 200, Body: map[string]interface{}{"id": 1}, ResponseHeaders: map[string]string{"OData-Version": "4.0"}},
+						{Multipart: &MultipartResponse{Boundary: "changeset_1", Parts: []ResponsePart{
+							{Headers: map[string]string{"Content-ID": "1"}, StatusCode: 204},
+						}}},
+						{Headers: map[string]string{"Content-Type": "text/plain"}, Body: "done"},
+					},
+				},
+			},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/odata/$batch", "multipart/mixed; boundary=request", strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" || params["boundary"] != "batch_1" {
+		t.Fatalf("Expected multipart/mixed with the configured boundary, got %s", resp.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+
+	// An HTTP response message
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read part 1: %v", err)
+	}
+	if part.Header.Get("Content-Type") != "application/http" || part.Header.Get("Content-Transfer-Encoding") != "binary" {
+		t.Errorf("Expected an application/http part, got %v", part.Header)
+	}
+	message, err := http.ReadResponse(bufio.NewReader(part), nil)
+	if err != nil {
+		t.Fatalf("Failed to read the response message: %v", err)
+	}
+	body, _ := io.ReadAll(message.Body)
+	if message.StatusCode != 200 || message.Header.Get("OData-Version") != "4.0" || message.Header.Get("Content-Type") != "application/json" || string(body) != `{"id":1}` {
+		t.Errorf("Unexpected response message %d %v '%s'", message.StatusCode, message.Header, body)
+	}
+
+	// A nested changeset
+	part, err = reader.NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read part 2: %v", err)
+	}
+	if part.Header.Get("Content-Type") != "multipart/mixed; boundary=changeset_1" {
+		t.Errorf("Expected a nested multipart part, got %v", part.Header)
+	}
+	nested, err := multipart.NewReader(part, "changeset_1").NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read the changeset: %v", err)
+	}
+	content, _ := io.ReadAll(nested)
+	if nested.Header.Get("Content-ID") != "1" || !strings.HasPrefix(string(content), "HTTP/1.1 204 No Content\r\n") {
+		t.Errorf("Unexpected changeset part %v '%s'", nested.Header, content)
+	}
+
+	// A plain part
+	part, err = reader.NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read part 3: %v", err)
+	}
+	content, _ = io.ReadAll(part)
+	if part.Header.Get("Content-Type") != "text/plain" || string(content) != "done" {
+		t.Errorf("Unexpected plain part %v '%s'", part.Header, content)
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("Expected 3 parts, got %v", err)
+	}
+}
+
+// TestMultipartEncodeErrors tests rejecting invalid multipart responses
+func TestMultipartEncodeErrors(t *testing.T) {
+	tests := map[string]*MultipartResponse{
+		"no parts":       {},
+		"bad boundary":   {Boundary: "a b c ", Parts: []ResponsePart{{Body: "x"}}},
+		"boundary":       {Boundary: "b", Parts: []ResponsePart{{Body: "x\r\n--b\r\n"}}},
+		"status code":    {Parts: []ResponsePart{{StatusCode: 42}}},
+		"nested parts":   {Parts: []ResponsePart{{Multipart: &MultipartResponse{}}}},
+		"invalid values": {Parts: []ResponsePart{{Body: map[string]interface{}{"f": func() {}}}}},
+	}
+	for name, response := range tests {
+		if _, _, err := response.encode(nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
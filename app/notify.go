@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server events that can trigger notifications
+const (
+	EventUnmatchedRequest   = "unmatched_request"
+	EventPluginReloadFailed = "plugin_reload_failed"
+	EventConfigReloadFailed = "config_reload_failed"
+	EventFaultInjected      = "fault_injected"
+)
+
+// Notification represents a hook called when server events occur
+type Notification struct {
+	URL      string   `json:"url"`
+	Type     string   `json:"type,omitempty"`     // webhook (default) or slack
+	Events   []string `json:"events,omitempty"`   // events to notify about (default: all)
+	Throttle *int     `json:"throttle,omitempty"` // milliseconds before repeating the same notification (default: 60000)
+}
+
+// notificationPayload is the body sent to generic webhooks
+type notificationPayload struct {
+	Event     string            `json:"event"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// notifier sends notifications, suppressing repeats within the throttle window
+type notifier struct {
+	mutex    sync.Mutex
+	hooks    []Notification
+	lastSent map[string]time.Time
+	client   *http.Client
+}
+
+// newNotifier creates a notifier without hooks
+func newNotifier() *notifier {
+	return &notifier{
+		lastSent: make(map[string]time.Time),
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// configure replaces the notification hooks
+func (n *notifier) configure(hooks []Notification) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.hooks = hooks
+}
+
+// notify sends an event to every hook subscribed to it
+func (n *notifier) notify(event, message string, details map[string]string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := time.Now()
+	if len(n.lastSent) > 10000 {
+		n.lastSent = make(map[string]time.Time)
+	}
+	for i, hook := range n.hooks {
+		if !hook.subscribed(event) {
+			continue
+		}
+
+		throttle := 60 * time.Second
+		if hook.Throttle != nil {
+			throttle = time.Duration(*hook.Throttle) * time.Millisecond
+		}
+		key := fmt.Sprintf("%d %s %s", i, event, message)
+		if last, ok := n.lastSent[key]; ok && now.Sub(last) < throttle {
+			continue
+		}
+		n.lastSent[key] = now
+
+		go n.send(hook, notificationPayload{
+			Event:     event,
+			Message:   message,
+			Details:   details,
+			Timestamp: now,
+		})
+	}
+}
+
+// subscribed reports whether a hook wants an event
+func (hook Notification) subscribed(event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// send posts a notification to a hook
+func (n *notifier) send(hook Notification, payload notificationPayload) {
+	var body interface{} = payload
+	if hook.Type == "slack" {
+		body = map[string]string{"text": "[nmock] " + payload.Message}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Failed to encode notification: %v", err)
+		return
+	}
+
+	resp, err := n.client.Post(hook.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to send notification to %s: %v", hook.URL, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Notification to %s failed with status %d", hook.URL, resp.StatusCode)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestNotifications tests notification hooks on unmatched requests
+func TestNotifications(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer hook.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Notifications: []Notification{
+			{URL: hook.URL, Events: []string{EventUnmatchedRequest}},
+			{URL: hook.URL, Type: "slack", Events: []string{EventConfigReloadFailed}},
+		},
+	}
+	server.SetupRoutes()
+
+	// Repeated requests to the same path are throttled
+	for i := 0; i < 3; i++ {
+		server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/missing", nil))
+	}
+
+	select {
+	case payload := <-received:
+		if payload["event"] != EventUnmatchedRequest || payload["message"] != "Unmatched request: GET /api/missing" {
+			t.Errorf("Unexpected payload: %v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a notification")
+	}
+
+	server.notifier.notify(EventConfigReloadFailed, "Failed to reload config: bad json", nil)
+	select {
+	case payload := <-received:
+		if payload["text"] != "[nmock] Failed to reload config: bad json" {
+			t.Errorf("Unexpected Slack payload: %v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a Slack notification")
+	}
+
+	select {
+	case payload := <-received:
+		t.Errorf("Expected throttled notifications to be dropped, got %v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestFaultNotifications tests notifying hooks about injected faults
+func TestFaultNotifications(t *testing.T) {
+	received := make(chan notificationPayload, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notificationPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer hook.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:            "9000",
+		PluginsDir:      "plugins",
+		Notifications:   []Notification{{URL: hook.URL, Events: []string{EventFaultInjected}}},
+		HeaderOverrides: true,
+		Endpoints: []Endpoint{
+			{Path: "/flaky", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: FaultRandom500}},
+			{Path: "/cut", Method: "GET", StatusCode: 200, Response: "0123456789", Truncate: &TruncateConfig{Bytes: 4}},
+			{Path: "/ok", Method: "GET", StatusCode: 200, Response: "ok"},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, path := range []string{"/flaky", "/cut", "/ok"} {
+		if resp, err := http.Get(ts.URL + path); err == nil {
+			resp.Body.Close()
+		}
+	}
+	req, _ := http.NewRequest("GET", ts.URL+"/ok", nil)
+	req.Header.Set(faultHeader, faultReset)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	faults := map[string]string{}
+	for i := 0; i < 3; i++ {
+		select {
+		case payload := <-received:
+			if payload.Event != EventFaultInjected {
+				t.Errorf("Unexpected event %s", payload.Event)
+			}
+			faults[payload.Details["path"]] = payload.Details["fault"]
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected 3 notifications, got %v", faults)
+		}
+	}
+	if faults["/flaky"] != FaultRandom500 || faults["/cut"] != faultTruncate || faults["/ok"] != FaultConnectionReset {
+		t.Errorf("Unexpected faults: %v", faults)
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("Expected no notification without a fault, got %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// queryOptions is the OData subset applied to collections:
+// $filter, $orderby, $skip and $top
+type queryOptions struct {
+	filter  rowPredicate
+	orderBy []orderKey
+	skip    int
+	top     int // -1 for no limit
+}
+
+// rowPredicate reports whether a row matches a $filter expression
+type rowPredicate func(row map[string]interface{}) bool
+
+// orderKey is one field of an $orderby option
+type orderKey struct {
+	field      string
+	descending bool
+}
+
+// parseQueryOptions parses the OData options of a query. It returns nil if
+// the query has none.
+func parseQueryOptions(query url.Values) (*queryOptions, error) {
+	if !query.Has("$filter") && !query.Has("$orderby") && !query.Has("$skip") && !query.Has("$top") {
+		return nil, nil
+	}
+
+	options := &queryOptions{top: -1}
+	if filter := strings.TrimSpace(query.Get("$filter")); filter != "" {
+		predicate, err := parseFilter(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $filter: %v", err)
+		}
+		options.filter = predicate
+	}
+
+	for _, part := range strings.Split(query.Get("$orderby"), ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		key := orderKey{field: fields[0]}
+		if len(fields) > 2 || (len(fields) == 2 && fields[1] != "asc" && fields[1] != "desc") {
+			return nil, fmt.Errorf("invalid $orderby: %q", strings.TrimSpace(part))
+		}
+		key.descending = len(fields) == 2 && fields[1] == "desc"
+		options.orderBy = append(options.orderBy, key)
+	}
+
+	for name, target := range map[string]*int{"$skip": &options.skip, "$top": &options.top} {
+		if !query.Has(name) {
+			continue
+		}
+		n, err := strconv.Atoi(query.Get(name))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", name, query.Get(name))
+		}
+		*target = n
+	}
+	return options, nil
+}
+
+// apply filters, sorts and pages rows. The input slice is not modified.
+func (o *queryOptions) apply(rows []map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if o.filter == nil || o.filter(row) {
+			result = append(result, row)
+		}
+	}
+
+	if len(o.orderBy) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, key := range o.orderBy {
+				c := orderValues(fieldValue(result[i], key.field), fieldValue(result[j], key.field))
+				if c != 0 {
+					return (c < 0) != key.descending
+				}
+			}
+			return false
+		})
+	}
+
+	if o.skip >= len(result) {
+		return result[:0]
+	}
+	result = result[o.skip:]
+	if o.top >= 0 && o.top < len(result) {
+		result = result[:o.top]
+	}
+	return result
+}
+
+// fieldValue returns a field of a row; nested fields are separated by '/'
+func fieldValue(row map[string]interface{}, field string) interface{} {
+	var value interface{} = row
+	for _, name := range strings.Split(field, "/") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// orderValues compares two field values for sorting. Missing values come
+// first, and numeric strings (e.g. from CSV files) are compared as numbers.
+func orderValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toNumber converts numbers and numeric strings to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// filterToken is a token of a $filter expression
+type filterToken struct {
+	kind  byte // 'i' identifier, 's' string, 'n' number, or the punctuation itself
+	text  string
+	value interface{}
+}
+
+// tokenizeFilter splits a $filter expression into tokens
+func tokenizeFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, filterToken{kind: c, text: string(c)})
+			i++
+		case c == '\'':
+			// Quotes inside strings are doubled: 'O''Brien'
+			var text strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if input[i] == '\'' {
+					if i+1 < len(input) && input[i+1] == '\'' {
+						text.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: 's', text: text.String(), value: text.String()})
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i++; i < len(input) && strings.IndexByte("0123456789.eE+-", input[i]) >= 0; i++ {
+			}
+			n, err := strconv.ParseFloat(input[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", input[start:i])
+			}
+			tokens = append(tokens, filterToken{kind: 'n', text: input[start:i], value: n})
+		case c == '_' || c == '/' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i++; i < len(input); i++ {
+				c := input[i]
+				if c != '_' && c != '/' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+					break
+				}
+			}
+			tokens = append(tokens, filterToken{kind: 'i', text: input[start:i]})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser for $filter expressions:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | function | comparison
+//	function   = ("contains" | "startswith" | "endswith") "(" field "," string ")"
+//	comparison = field ("eq" | "ne" | "gt" | "ge" | "lt" | "le") literal
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter compiles a $filter expression into a predicate
+func parseFilter(input string) (rowPredicate, error) {
+	tokens, err := tokenizeFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	predicate, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return predicate, nil
+}
+
+// next returns the next token, or a zero token at the end of the input
+func (p *filterParser) next() filterToken {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// accept consumes the next token if it is the given keyword
+func (p *filterParser) accept(keyword string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == 'i' && p.tokens[p.pos].text == keyword {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the next token, failing if it is not of the given kind
+func (p *filterParser) expect(kind byte) (filterToken, error) {
+	token := p.next()
+	if token.kind != kind {
+		if token.kind == 0 {
+			return token, fmt.Errorf("unexpected end of expression")
+		}
+		return token, fmt.Errorf("unexpected %q", token.text)
+	}
+	return token, nil
+}
+
+func (p *filterParser) expr() (rowPredicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]interface{}) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (rowPredicate, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]interface{}) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (rowPredicate, error) {
+	if p.accept("not") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(row map[string]interface{}) bool { return !inner(row) }, nil
+	}
+
+	token := p.next()
+	switch {
+	case token.kind == '(':
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case token.kind == 'i' && (token.text == "contains" || token.text == "startswith" || token.text == "endswith"):
+		return p.function(token.text)
+
+	case token.kind == 'i':
+		return p.comparison(token.text)
+
+	case token.kind == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+func (p *filterParser) function(name string) (rowPredicate, error) {
+	if _, err := p.expect('('); err != nil {
+		return nil, err
+	}
+	field, err := p.expect('i')
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(','); err != nil {
+		return nil, err
+	}
+	arg, err := p.expect('s')
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(')'); err != nil {
+		return nil, err
+	}
+
+	match := map[string]func(s, substr string) bool{
+		"contains":   strings.Contains,
+		"startswith": strings.HasPrefix,
+		"endswith":   strings.HasSuffix,
+	}[name]
+	return func(row map[string]interface{}) bool {
+		value, ok := fieldValue(row, field.text).(string)
+		return ok && match(value, arg.text)
+	}, nil
+}
+
+func (p *filterParser) comparison(field string) (rowPredicate, error) {
+	op, err := p.expect('i')
+	if err != nil {
+		return nil, err
+	}
+	literal := p.next()
+	switch {
+	case literal.kind == 's' || literal.kind == 'n':
+	case literal.kind == 'i' && literal.text == "true":
+		literal.value = true
+	case literal.kind == 'i' && literal.text == "false":
+		literal.value = false
+	case literal.kind == 'i' && literal.text == "null":
+		literal.value = nil
+	case literal.kind == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("expected a literal, got %q", literal.text)
+	}
+
+	var test func(c int) bool
+	switch op.text {
+	case "eq":
+		test = func(c int) bool { return c == 0 }
+	case "ne":
+		test = func(c int) bool { return c != 0 }
+	case "gt":
+		test = func(c int) bool { return c > 0 }
+	case "ge":
+		test = func(c int) bool { return c >= 0 }
+	case "lt":
+		test = func(c int) bool { return c < 0 }
+	case "le":
+		test = func(c int) bool { return c <= 0 }
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op.text)
+	}
+
+	// Values that can't be compared with the literal only match ne
+	return func(row map[string]interface{}) bool {
+		c, ok := compareLiteral(fieldValue(row, field), literal.value)
+		if !ok {
+			return op.text == "ne"
+		}
+		return test(c)
+	}, nil
+}
+
+// compareLiteral compares a field value with a $filter literal. Numeric and
+// boolean strings, as found in CSV files, are compared as their values.
+func compareLiteral(value, literal interface{}) (int, bool) {
+	switch l := literal.(type) {
+	case nil:
+		if value == nil {
+			return 0, true
+		}
+		return 1, true
+	case float64:
+		n, ok := toNumber(value)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case n < l:
+			return -1, true
+		case n > l:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		b, ok := value.(bool)
+		if s, isString := value.(string); isString {
+			parsed, err := strconv.ParseBool(s)
+			b, ok = parsed, err == nil
+		}
+		if !ok {
+			return 0, false
+		}
+		if b == l {
+			return 0, true
+		}
+		return 1, true
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(s, l), true
+	}
+	return 0, false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestQueryOptions tests $filter, $orderby, $skip and $top on rows
+func TestQueryOptions(t *testing.T) {
+	var rows []map[string]interface{}
+	json.Unmarshal([]byte(`[
+		{"id": 1, "name": "Alice", "age": 31, "active": true, "address": {"city": "Paris"}},
+		{"id": 2, "name": "Bob", "age": 25, "active": false, "address": {"city": "Berlin"}},
+		{"id": 3, "name": "Carol", "age": 42, "active": true},
+		{"id": 4, "name": "O'Brien", "age": 25, "active": true, "address": {"city": "Dublin"}}
+	]`), &rows)
+
+	tests := []struct {
+		query string
+		ids   string
+	}{
+		{"$filter=age gt 30", "1,3"},
+		{"$filter=age eq 25 and active eq true", "4"},
+		{"$filter=name eq 'Bob' or name eq 'O''Brien'", "2,4"},
+		{"$filter=not (age lt 30)", "1,3"},
+		{"$filter=address/city eq 'Berlin'", "2"},
+		{"$filter=address eq null", "3"},
+		{"$filter=startswith(name, 'C') or contains(name, 'ic')", "1,3"},
+		{"$orderby=age desc", "3,1,2,4"},
+		{"$orderby=age, name desc", "4,2,1,3"},
+		{"$orderby=id&$skip=1&$top=2", "2,3"},
+		{"$skip=10", ""},
+		{"$top=0", ""},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(strings.ReplaceAll(test.query, " ", "%20"))
+		options, err := parseQueryOptions(query)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", test.query, err)
+			continue
+		}
+		var ids []string
+		for _, row := range options.apply(rows) {
+			ids = append(ids, itemID(row["id"]))
+		}
+		if got := strings.Join(ids, ","); got != test.ids {
+			t.Errorf("Expected %s to select %s, got %s", test.query, test.ids, got)
+		}
+	}
+
+	if options, _ := parseQueryOptions(url.Values{"page": {"2"}}); options != nil {
+		t.Error("Expected no options without OData parameters")
+	}
+	for _, query := range []string{"$top=-1", "$skip=x", "$orderby=age up", "$filter=age", "$filter=age like 3", "$filter=(age eq 3", "$filter=name eq 'x"} {
+		values, _ := url.ParseQuery(strings.ReplaceAll(query, " ", "%20"))
+		if _, err := parseQueryOptions(values); err == nil {
+			t.Errorf("Expected an error for %s", query)
+		}
+	}
+}
+
+// TestQueryOptionsEndpoints tests query options on dataset and resource collections
+func TestQueryOptionsEndpoints(t *testing.T) {
+	usersFile := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(usersFile, []byte("id,name,age\n1,Alice,31\n2,Bob,9\n3,Carol,100\n"), 0644); err != nil {
+		t.Fatalf("Failed to write dataset: %v", err)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/api/users", Method: "GET", Dataset: &Dataset{File: usersFile, Key: "id"}}},
+	}
+	server.resources.configure([]Resource{{Name: "items", Path: "/api/items", Seed: []map[string]interface{}{
+		{"id": float64(1), "price": float64(5)}, {"id": float64(2), "price": float64(15)}, {"id": float64(3), "price": float64(25)},
+	}}})
+	server.SetupRoutes()
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/api/users?$filter=age%20ge%2031&$orderby=age%20desc", 200, `[{"age":"100","id":"3","name":"Carol"},{"age":"31","id":"1","name":"Alice"}]`},
+		{"/api/users?$top=1", 200, `[{"age":"31","id":"1","name":"Alice"}]`},
+		{"/api/users?$top=x", 400, `{"error":"invalid $top: \"x\""}`},
+		{"/api/items?$filter=price%20gt%2010&$top=1", 200, `[{"id":2,"price":15}]`},
+		{"/api/items?$orderby=price%20desc&$skip=2", 200, `[{"id":1,"price":5}]`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+			t.Errorf("Expected %s to respond %d %s, got %d %s", test.path, test.status, test.body, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPIMethods are the operations of an OpenAPI path item, in output order
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPIMaxDepth limits the nesting of generated samples
+const openAPIMaxDepth = 10
+
+// openAPISpec is an OpenAPI 3 document decoded without a fixed structure so
+// that references can be resolved anywhere in it
+type openAPISpec struct {
+	root     map[string]interface{}
+	warnings []string
+}
+
+// importOpenAPI generates a plugin with one endpoint per operation of an
+// OpenAPI 3 document in JSON. Responses use the first success response of
+// each operation, with its example or a sample generated from its schema.
+func importOpenAPI(data []byte, name string) (*Plugin, []string, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	version, _ := root["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, nil, fmt.Errorf("unsupported OpenAPI version %q, expected 3.x", version)
+	}
+	spec := &openAPISpec{root: root}
+
+	info, _ := root["info"].(map[string]interface{})
+	title, _ := info["title"].(string)
+	if name == "" {
+		name = pluginSlug(title)
+	}
+
+	// The path of the first server prefixes every endpoint
+	basePath := ""
+	if servers, _ := root["servers"].([]interface{}); len(servers) > 0 {
+		server, _ := servers[0].(map[string]interface{})
+		serverURL, _ := server["url"].(string)
+		if parsed, err := url.Parse(serverURL); err == nil {
+			basePath = strings.TrimSuffix(parsed.Path, "/")
+		}
+	}
+
+	paths, _ := root["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for path := range paths {
+		pathNames = append(pathNames, path)
+	}
+	sort.Strings(pathNames)
+
+	plugin := &Plugin{Name: name, Description: "Imported from OpenAPI", Enabled: true, Endpoints: []Endpoint{}}
+	if title != "" {
+		plugin.Description = "Imported from OpenAPI: " + title
+	}
+	for _, path := range pathNames {
+		item, _ := spec.resolve(paths[path]).(map[string]interface{})
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			endpoint := spec.endpoint(basePath+path, strings.ToUpper(method), operation)
+			plugin.Endpoints = append(plugin.Endpoints, endpoint)
+		}
+	}
+	if len(plugin.Endpoints) == 0 {
+		return nil, spec.warnings, fmt.Errorf("no operations found in OpenAPI document")
+	}
+	return plugin, spec.warnings, nil
+}
+
+// endpoint returns the endpoint of an operation
+func (spec *openAPISpec) endpoint(path, method string, operation map[string]interface{}) Endpoint {
+	endpoint := Endpoint{Path: path, Method: method, StatusCode: 200}
+	if operationID, _ := operation["operationId"].(string); validEndpointID.MatchString(operationID) {
+		endpoint.ID = operationID
+	}
+
+	responses, _ := operation["responses"].(map[string]interface{})
+	code, response := openAPIResponse(responses)
+	if response == nil {
+		spec.warnings = append(spec.warnings, fmt.Sprintf("%s %s: no responses, answering 200 without a body", method, path))
+		return endpoint
+	}
+	endpoint.StatusCode = code
+
+	resolved, _ := spec.resolve(response).(map[string]interface{})
+	content, _ := resolved["content"].(map[string]interface{})
+	mediaType, media := openAPIMediaType(content)
+	if media == nil {
+		return endpoint
+	}
+	if !strings.Contains(mediaType, "json") {
+		endpoint.ContentType = mediaType
+	}
+
+	body := spec.example(media)
+	if body == nil {
+		body = spec.sample(media["schema"], 0, map[string]bool{})
+	}
+	if endpoint.ContentType != "" {
+		// Bodies of other media types are written as text
+		if _, isString := body.(string); !isString && body != nil {
+			encoded, _ := json.Marshal(body)
+			body = string(encoded)
+		}
+	}
+	endpoint.Response = body
+	return endpoint
+}
+
+// openAPIResponse returns the first success response of an operation by
+// status code, or the default response answered with 200
+func openAPIResponse(responses map[string]interface{}) (int, interface{}) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			status, err := strconv.Atoi(code)
+			if err != nil {
+				status = 200 // ranges such as 2XX
+			}
+			return status, responses[code]
+		}
+	}
+	if response, ok := responses["default"]; ok {
+		return 200, response
+	}
+	return 0, nil
+}
+
+// openAPIMediaType returns the JSON media type of a response content, or
+// the first one in name order
+func openAPIMediaType(content map[string]interface{}) (string, map[string]interface{}) {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		iJSON, jJSON := strings.Contains(types[i], "json"), strings.Contains(types[j], "json")
+		if iJSON != jJSON {
+			return iJSON
+		}
+		return types[i] < types[j]
+	})
+	for _, mediaType := range types {
+		if media, ok := content[mediaType].(map[string]interface{}); ok {
+			return mediaType, media
+		}
+	}
+	return "", nil
+}
+
+// example returns the example of a media type or the first of its named
+// examples, in name order
+func (spec *openAPISpec) example(media map[string]interface{}) interface{} {
+	if example, ok := media["example"]; ok {
+		return example
+	}
+	if examples, _ := media["examples"].(map[string]interface{}); len(examples) > 0 {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if example, ok := spec.resolve(examples[names[0]]).(map[string]interface{}); ok {
+			if value, ok := example["value"]; ok {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// resolve follows a local reference such as #/components/schemas/User.
+// Other values are returned unchanged; unresolvable references give nil.
+func (spec *openAPISpec) resolve(value interface{}) interface{} {
+	for i := 0; i < openAPIMaxDepth; i++ {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return value
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			spec.warnings = append(spec.warnings, fmt.Sprintf("external reference %s is not supported", ref))
+			return nil
+		}
+		var target interface{} = spec.root
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			container, _ := target.(map[string]interface{})
+			target = container[token]
+		}
+		if target == nil {
+			spec.warnings = append(spec.warnings, fmt.Sprintf("reference %s not found", ref))
+			return nil
+		}
+		value = target
+	}
+	return value
+}
+
+// sample generates a value matching a schema. Schemas referenced while
+// already being generated give nil, which cuts recursion.
+func (spec *openAPISpec) sample(value interface{}, depth int, expanding map[string]bool) interface{} {
+	if object, ok := value.(map[string]interface{}); ok {
+		if ref, ok := object["$ref"].(string); ok {
+			if expanding[ref] || depth >= openAPIMaxDepth {
+				return nil
+			}
+			expanding[ref] = true
+			defer delete(expanding, ref)
+		}
+	}
+	schema, ok := spec.resolve(value).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, key := range []string{"example", "default", "const"} {
+		if example, ok := schema[key]; ok {
+			return example
+		}
+	}
+	if enum, _ := schema["enum"].([]interface{}); len(enum) > 0 {
+		return enum[0]
+	}
+	if allOf, _ := schema["allOf"].([]interface{}); len(allOf) > 0 {
+		merged := map[string]interface{}{}
+		for _, part := range allOf {
+			if object, ok := spec.sample(part, depth+1, expanding).(map[string]interface{}); ok {
+				for key, value := range object {
+					merged[key] = value
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives, _ := schema[key].([]interface{}); len(alternatives) > 0 {
+			return spec.sample(alternatives[0], depth+1, expanding)
+		}
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]interface{}); ok && len(types) > 0 {
+		// OpenAPI 3.1 type lists such as ["string", "null"]
+		schemaType, _ = types[0].(string)
+	}
+	if schemaType == "" {
+		if _, ok := schema["properties"]; ok {
+			schemaType = "object"
+		} else if _, ok := schema["items"]; ok {
+			schemaType = "array"
+		}
+	}
+
+	switch schemaType {
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		object := make(map[string]interface{}, len(properties))
+		for name, property := range properties {
+			if value := spec.sample(property, depth+1, expanding); value != nil {
+				object[name] = value
+			}
+		}
+		return object
+	case "array":
+		if item := spec.sample(schema["items"], depth+1, expanding); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "string":
+		switch format, _ := schema["format"].(string); format {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "date":
+			return "2024-01-01"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "uri", "url":
+			return "http://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+// pluginSlug turns a title into a plugin name usable as a file name
+func pluginSlug(title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(slug.String(), "-")
+}
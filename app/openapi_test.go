@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testOpenAPI is an OpenAPI 3 document using references, examples and schemas
+const testOpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Pet Store API", "version": "1.0"},
+  "servers": [{"url": "https://api.example.com/v1/"}],
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "responses": {
+          "200": {
+            "description": "Pets",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "createPet",
+        "responses": {
+          "201": {
+            "description": "Created",
+            "content": {"application/json": {"examples": {"rex": {"value": {"id": 7, "name": "Rex"}}}}}
+          }
+        }
+      }
+    },
+    "/pets/{id}": {
+      "delete": {"operationId": "delete pet", "responses": {"204": {"description": "Deleted"}}},
+      "get": {
+        "responses": {
+          "200": {
+            "description": "A pet as text",
+            "content": {"text/plain": {"example": "Rex the dog"}}
+          }
+        }
+      }
+    },
+    "/health": {"get": {"responses": {}}}
+  },
+  "components": {
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer"},
+          "name": {"type": "string", "example": "Fido"},
+          "status": {"type": "string", "enum": ["available", "sold"]},
+          "born": {"type": "string", "format": "date"},
+          "parent": {"$ref": "#/components/schemas/Pet"},
+          "owner": {"allOf": [{"$ref": "#/components/schemas/Named"}, {"properties": {"email": {"type": "string", "format": "email"}}}]}
+        }
+      },
+      "Named": {"type": "object", "properties": {"name": {"type": "string"}}}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"type": "object"}}}}
+    }
+  }
+}`
+
+// TestImportOpenAPI tests generating endpoints from an OpenAPI document
+func TestImportOpenAPI(t *testing.T) {
+	plugin, warnings, err := importSpec([]byte(testOpenAPI), "")
+	if err != nil {
+		t.Fatalf("Failed to import OpenAPI: %v", err)
+	}
+	if plugin.Name != "pet-store-api" || len(plugin.Endpoints) != 5 {
+		t.Fatalf("Expected plugin pet-store-api with 5 endpoints, got %s with %d", plugin.Name, len(plugin.Endpoints))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "GET /v1/health: no responses") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	endpoints := make(map[string]Endpoint)
+	for _, endpoint := range plugin.Endpoints {
+		endpoints[endpoint.Method+" "+endpoint.Path] = endpoint
+	}
+
+	list := endpoints["GET /v1/pets"]
+	expected := []interface{}{map[string]interface{}{
+		"id":     1,
+		"name":   "Fido",
+		"status": "available",
+		"born":   "2024-01-01",
+		"owner":  map[string]interface{}{"name": "string", "email": "user@example.com"},
+	}}
+	if list.ID != "listPets" || list.StatusCode != 200 || !reflect.DeepEqual(list.Response, expected) {
+		t.Errorf("Unexpected list endpoint: %+v", list)
+	}
+
+	create := endpoints["POST /v1/pets"]
+	if create.StatusCode != 201 || !reflect.DeepEqual(create.Response, map[string]interface{}{"id": 7.0, "name": "Rex"}) {
+		t.Errorf("Unexpected create endpoint: %+v", create)
+	}
+
+	remove := endpoints["DELETE /v1/pets/{id}"]
+	if remove.ID != "" || remove.StatusCode != 204 || remove.Response != nil {
+		t.Errorf("Unexpected delete endpoint: %+v", remove)
+	}
+
+	get := endpoints["GET /v1/pets/{id}"]
+	if get.ContentType != "text/plain" || get.Response != "Rex the dog" {
+		t.Errorf("Unexpected text endpoint: %+v", get)
+	}
+
+	if _, _, err := importSpec([]byte(`{"swagger": "2.0"}`), ""); err == nil || !strings.Contains(err.Error(), "expected 3.x") {
+		t.Errorf("Expected Swagger 2.0 to be rejected, got %v", err)
+	}
+}
+
+// TestImportAPI tests importing a spec through the admin API
+func TestImportAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: filepath.Join(t.TempDir(), "plugins")}
+	server.pluginsDir = server.config.PluginsDir
+	server.SetupRoutes()
+
+	post := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("POST", "/_admin/plugins/import"+query, strings.NewReader(body)))
+		return w
+	}
+
+	// A dry run returns the plugin without loading it
+	w := post("?dry_run=true", testOpenAPI)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"name":"pet-store-api"`) {
+		t.Errorf("Unexpected dry run: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(server.pluginsDir, "pet-store-api.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no plugin file after a dry run, got %v", err)
+	}
+
+	w = post("?name=pets", testOpenAPI)
+	var result struct {
+		Plugin    string   `json:"plugin"`
+		Endpoints int      `json:"endpoints"`
+		Warnings  []string `json:"warnings"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 201 || result.Plugin != "pets" || result.Endpoints != 5 || len(result.Warnings) != 1 {
+		t.Fatalf("Unexpected import: %d %+v", w.Code, result)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/v1/pets", nil))
+	if w.Code != 201 || !strings.Contains(w.Body.String(), `"name":"Rex"`) {
+		t.Errorf("Expected the imported endpoint to answer, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := post("?name=pets", testOpenAPI); w.Code != 409 {
+		t.Errorf("Expected status 409 for an existing plugin, got %d", w.Code)
+	}
+	if w := post("?name=pets&replace=true", testOpenAPI); w.Code != 201 {
+		t.Errorf("Expected status 201 when replacing, got %d", w.Code)
+	}
+	if w := post("?name=../pets", testOpenAPI); w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid name, got %d", w.Code)
+	}
+	if w := post("", "openapi: 3.0.0"); w.Code != 400 {
+		t.Errorf("Expected status 400 for a YAML spec, got %d", w.Code)
+	}
+}
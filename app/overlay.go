@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// validateOverrides checks the plugins an overlay plugin overrides. Only
+// plugins can be overridden, since the main configuration and runtime
+// endpoints are always matched first.
+func validateOverrides(plugin *Plugin) error {
+	for _, target := range plugin.Overrides {
+		switch target {
+		case "", "main", "runtime":
+			return fmt.Errorf("invalid override %q, expected the name of another plugin", target)
+		case plugin.Name:
+			return fmt.Errorf("plugin %s can't override itself", plugin.Name)
+		}
+	}
+	return nil
+}
+
+// overrides reports whether the routes of a source were replaced on purpose
+// by an overlay plugin
+func (rs *routeSnapshot) overrides(overlay, source string) bool {
+	group, exists := rs.plugins[overlay]
+	return exists && slices.Contains(group.overrides, source)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOverlayPlugin tests a plugin replacing endpoints of another plugin
+// and being toggled as a unit
+func TestOverlayPlugin(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: t.TempDir()}
+	server.pluginsDir = server.config.PluginsDir
+	server.plugins["payments"] = &Plugin{Name: "payments", Enabled: true, Endpoints: []Endpoint{
+		{Path: "/api/payments", Method: "POST", StatusCode: 201, Response: "paid"},
+		{Path: "/api/refunds", Method: "POST", StatusCode: 201, Response: "refunded"},
+	}}
+	server.plugins["zz-chaos"] = &Plugin{Name: "zz-chaos", Enabled: true, Overrides: []string{"payments"}, Endpoints: []Endpoint{
+		{Path: "/api/payments", Method: "POST", StatusCode: 503, Response: "unavailable"},
+	}}
+	server.SetupRoutes()
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := call("POST", "/api/payments"); w.Code != 503 {
+		t.Errorf("Expected the overlay to answer, got %d %s", w.Code, w.Body.String())
+	}
+	if w := call("POST", "/api/refunds"); w.Code != 201 {
+		t.Errorf("Expected endpoints without override to be kept, got %d", w.Code)
+	}
+	summary := server.routes.snapshot.Load().summary()
+	if !strings.Contains(summary, "Override: POST /api/payments from payments is replaced by zz-chaos") || strings.Contains(summary, "Conflict:") {
+		t.Errorf("Expected the override in the summary, got:\n%s", summary)
+	}
+
+	call("POST", "/_admin/plugins/zz-chaos/toggle")
+	if w := call("POST", "/api/payments"); w.Code != 201 {
+		t.Errorf("Expected the happy path after disabling the overlay, got %d", w.Code)
+	}
+	call("POST", "/_admin/plugins/zz-chaos/toggle")
+	if w := call("POST", "/api/payments"); w.Code != 503 {
+		t.Errorf("Expected the overlay after enabling it again, got %d", w.Code)
+	}
+}
+
+// TestOverlayOrder tests the matching order of plugins with overlays
+func TestOverlayOrder(t *testing.T) {
+	snapshot := &routeSnapshot{plugins: map[string]*routeGroup{
+		"a-orders":   {},
+		"b-chaos":    {overrides: []string{"c-payments"}},
+		"c-payments": {},
+		"d-slow":     {overrides: []string{"a-orders", "c-payments"}},
+		"x":          {overrides: []string{"y"}},
+		"y":          {overrides: []string{"x"}},
+	}}
+	snapshot.sortPlugins()
+	if order := strings.Join(snapshot.pluginOrder, " "); order != "d-slow a-orders b-chaos c-payments y x" {
+		t.Errorf("Unexpected order %s", order)
+	}
+}
+
+// TestValidateOverrides tests the checks of overlay targets
+func TestValidateOverrides(t *testing.T) {
+	for _, overrides := range [][]string{{"main"}, {"runtime"}, {""}, {"chaos"}} {
+		if err := validateOverrides(&Plugin{Name: "chaos", Overrides: overrides}); err == nil {
+			t.Errorf("Expected an error for %v", overrides)
+		}
+	}
+	if err := validateOverrides(&Plugin{Name: "chaos", Overrides: []string{"payments", "orders"}}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request headers overriding the behavior of an endpoint when
+// header_overrides is enabled
+const (
+	delayHeader    = "X-Nmock-Delay"    // delay in milliseconds
+	faultHeader    = "X-Nmock-Fault"    // fault to inject instead of the response
+	responseHeader = "X-Nmock-Response" // name of a response variant of the endpoint
+)
+
+// faultReset resets the connection without a response
+const faultReset = "reset"
+
+// maxOverrideDelay caps the delay a client can request, so that a typo
+// doesn't hold a connection for hours
+const maxOverrideDelay = 60000
+
+// requestOverrides are the changes a client requested for one request
+type requestOverrides struct {
+	delay    *int
+	fault    string
+	response string
+}
+
+// parseRequestOverrides reads the override headers of a request
+func parseRequestOverrides(r *http.Request) (requestOverrides, error) {
+	var overrides requestOverrides
+	if value := r.Header.Get(delayHeader); value != "" {
+		delay, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || delay < 0 || delay > maxOverrideDelay {
+			return overrides, fmt.Errorf("invalid %s %q, expected milliseconds between 0 and %d", delayHeader, value, maxOverrideDelay)
+		}
+		overrides.delay = &delay
+	}
+	if value := r.Header.Get(faultHeader); value != "" {
+		fault := strings.ToLower(strings.TrimSpace(value))
+		if fault != faultReset {
+			return overrides, fmt.Errorf("invalid %s %q, expected %s", faultHeader, value, faultReset)
+		}
+		overrides.fault = fault
+	}
+	overrides.response = strings.TrimSpace(r.Header.Get(responseHeader))
+	return overrides, nil
+}
+
+// encodeVariants encodes the named response variants of an endpoint
+func encodeVariants(variants map[string]MappedResponse) (map[string]encodedResponse, error) {
+	encoded := make(map[string]encodedResponse, len(variants))
+	for name, variant := range variants {
+		if err := validateStatusCode(variant.StatusCode); err != nil {
+			return nil, fmt.Errorf("variant %q: %v", name, err)
+		}
+		body, err := encodeResponse(variant.Response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode variant %q: %v", name, err)
+		}
+		encoded[name] = encodedResponse{statusCode: variant.StatusCode, body: body}
+	}
+	return encoded, nil
+}
+
+// selectVariant returns the response variant a client asked for
+func selectVariant(variants map[string]encodedResponse, name string) (*encodedResponse, error) {
+	variant, found := variants[name]
+	if !found {
+		names := make([]string, 0, len(variants))
+		for name := range variants {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown %s %q, expected one of [%s]", responseHeader, name, strings.Join(names, ", "))
+	}
+	return &variant, nil
+}
+
+// resetConnection aborts a request: the TCP connection is closed with a
+// reset instead of a response
+func resetConnection(w http.ResponseWriter) {
+	// HTTP/2 connections can't be hijacked, so the stream is reset instead
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHeaderOverrides tests overriding the delay and injecting faults with
+// request headers
+func TestHeaderOverrides(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:            "9000",
+		PluginsDir:      "plugins",
+		HeaderOverrides: true,
+		Endpoints:       []Endpoint{{Path: "/api/users", Method: "GET", Response: "users", Delay: 1000}},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	get := func(headers map[string]string) (*http.Response, error) {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/users", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	// The configured delay of one second is replaced
+	start := time.Now()
+	resp, err := get(map[string]string{delayHeader: "0"})
+	if err != nil {
+		t.Fatalf("Failed to request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "users" || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected an immediate response, got %q after %v", body, time.Since(start))
+	}
+
+	if _, err := get(map[string]string{delayHeader: "0", faultHeader: "reset"}); err == nil {
+		t.Error("Expected the connection to be reset")
+	}
+
+	for _, headers := range []map[string]string{{delayHeader: "-1"}, {delayHeader: "soon"}, {faultHeader: "explode"}} {
+		resp, err := get(headers)
+		if err != nil {
+			t.Fatalf("Failed to request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, got %d", headers, resp.StatusCode)
+		}
+	}
+
+	// Without header_overrides the headers are ignored
+	server.config.HeaderOverrides = false
+	server.config.Endpoints[0].Delay = 0
+	server.SetupRoutes()
+	resp, err = get(map[string]string{faultHeader: "reset"})
+	if err != nil {
+		t.Fatalf("Expected the header to be ignored, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestResponseVariants tests picking a named response with a request header
+func TestResponseVariants(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:            "9000",
+		PluginsDir:      "plugins",
+		HeaderOverrides: true,
+		Endpoints: []Endpoint{{
+			Path:     "/api/cart",
+			Method:   "GET",
+			Response: map[string]interface{}{"items": 2},
+			Variants: map[string]MappedResponse{
+				"empty":      {Response: map[string]interface{}{"items": 0}},
+				"error-case": {StatusCode: 503, Response: map[string]interface{}{"error": "unavailable"}},
+			},
+		}},
+	}
+	server.SetupRoutes()
+
+	get := func(variant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/cart", nil)
+		if variant != "" {
+			req.Header.Set(responseHeader, variant)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		variant string
+		status  int
+		body    string
+	}{
+		{"", 200, `{"items":2}`},
+		{"empty", 200, `{"items":0}`},
+		{"error-case", 503, `{"error":"unavailable"}`},
+		{"missing", 400, `{"error":"unknown X-Nmock-Response \"missing\", expected one of [empty, error-case]"}`},
+	}
+	for _, test := range tests {
+		w := get(test.variant)
+		if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+			t.Errorf("%q: expected %d %s, got %d %s", test.variant, test.status, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// Without header_overrides the endpoint's response is always sent
+	server.config.HeaderOverrides = false
+	server.SetupRoutes()
+	if w := get("error-case"); w.Code != 200 {
+		t.Errorf("Expected the header to be ignored, got %d", w.Code)
+	}
+}
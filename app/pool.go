@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which buffers are dropped instead
+// of pooled, so that a single large body doesn't stay in memory
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds buffers reused for reading and encoding bodies
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool. The buffer must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// ownedBytes copies the contents of a pooled buffer into a slice of exactly
+// the right size, or returns nil if the buffer is empty
+func ownedBytes(buf *bytes.Buffer) []byte {
+	if buf.Len() == 0 {
+		return nil
+	}
+	return bytes.Clone(buf.Bytes())
+}
+
+// pooledEncoder is a JSON encoder writing to a reusable buffer
+type pooledEncoder struct {
+	buf     bytes.Buffer
+	encoder *json.Encoder
+}
+
+// encoderPool holds JSON encoders reused for encoding responses
+var encoderPool = sync.Pool{
+	New: func() any {
+		pe := &pooledEncoder{}
+		pe.encoder = json.NewEncoder(&pe.buf)
+		return pe
+	},
+}
+
+// recorderPool holds response recorders reused across requests
+var recorderPool = sync.Pool{
+	New: func() any { return new(recordingWriter) },
+}
+
+// getRecorder returns a recorder from the pool wrapping a response writer
+func getRecorder(w http.ResponseWriter) *recordingWriter {
+	recorder := recorderPool.Get().(*recordingWriter)
+	recorder.ResponseWriter = w
+	return recorder
+}
+
+// putRecorder resets a recorder and returns it to the pool. Headers and
+// bodies handed out by the recorder must have been copied before.
+func putRecorder(recorder *recordingWriter) {
+	if recorder.body.Cap() > maxPooledBuffer || recorder.requestBody.Cap() > maxPooledBuffer {
+		return
+	}
+	recorder.ResponseWriter = nil
+	recorder.statusCode = 0
+	recorder.headers = nil
+	recorder.body.Reset()
+	recorder.limit = 0
+	recorder.truncated = false
+	recorder.requestBody.Reset()
+	recorder.requestTruncated = false
+	recorder.replay.Reset(nil)
+	recorder.info = requestInfo{}
+	recorderPool.Put(recorder)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPooledRecording tests that recorded requests keep their own bodies
+// while recorders and buffers are reused
+func TestPooledRecording(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/echo", Method: "POST", Response: map[string]string{"status": "ok"}, Headers: map[string]string{"x-mock": "yes"}},
+			{Path: "/short", Method: "POST", Response: "s"},
+		},
+	}
+	server.SetupRoutes()
+
+	for _, request := range []struct{ path, body string }{
+		{"/echo", strings.Repeat("a", 1000)},
+		{"/short", "b"},
+		{"/echo", ""},
+	} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("POST", request.path, strings.NewReader(request.body)))
+		if w.Code != 200 {
+			t.Fatalf("Expected status 200 for %s, got %d", request.path, w.Code)
+		}
+	}
+
+	entries := server.history.list()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 recorded requests, got %d", len(entries))
+	}
+	if string(entries[0].RequestBody) != strings.Repeat("a", 1000) || string(entries[0].ResponseBody) != "{\"status\":\"ok\"}\n" {
+		t.Errorf("Expected the first request to keep its bodies, got '%.20s' and '%s'", entries[0].RequestBody, entries[0].ResponseBody)
+	}
+	if string(entries[1].RequestBody) != "b" || string(entries[1].ResponseBody) != "s" {
+		t.Errorf("Expected the second request to keep its bodies, got '%s' and '%s'", entries[1].RequestBody, entries[1].ResponseBody)
+	}
+	if entries[2].RequestBody != nil || entries[0].ResponseHeaders.Get("X-Mock") != "yes" || entries[1].ResponseHeaders.Get("X-Mock") != "" {
+		t.Errorf("Expected headers and empty bodies not to leak between requests, got %+v", entries[2])
+	}
+
+	first, _ := encodeResponse(map[string]int{"a": 1})
+	encodeResponse(map[string]int{"b": 2})
+	if string(first) != "{\"a\":1}\n" {
+		t.Errorf("Expected an encoded response not to change when the encoder is reused, got '%s'", first)
+	}
+}
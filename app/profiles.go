@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+// validateHeaderProfiles checks that the endpoints of the main configuration
+// only reference header profiles it defines
+func validateHeaderProfiles(config *Config) error {
+	for _, ep := range config.Endpoints {
+		for _, name := range ep.HeaderProfiles {
+			if _, found := config.HeaderProfiles[name]; !found {
+				return fmt.Errorf("unknown header profile %q referenced by %s %s", name, ep.Method, ep.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// applyHeaderProfiles adds the headers of the profiles of an endpoint and
+// its plugin. Profiles of the endpoint override those of the plugin, later
+// profiles override earlier ones, and the endpoint's own headers override
+// all of them. Must be called with ms.mutex held.
+func (ms *MockServer) applyHeaderProfiles(ep Endpoint, source string) (Endpoint, error) {
+	var names []string
+	if plugin, exists := ms.plugins[source]; exists {
+		names = append(names, plugin.HeaderProfiles...)
+	}
+	names = append(names, ep.HeaderProfiles...)
+	if len(names) == 0 {
+		return ep, nil
+	}
+
+	headers := make(map[string]string)
+	for _, name := range names {
+		var profile map[string]string
+		found := false
+		if ms.config != nil {
+			profile, found = ms.config.HeaderProfiles[name]
+		}
+		if !found {
+			return ep, fmt.Errorf("unknown header profile %q", name)
+		}
+		for key, value := range profile {
+			headers[key] = value
+		}
+	}
+	for key, value := range ep.Headers {
+		headers[key] = value
+	}
+	ep.Headers = headers
+	return ep, nil
+}
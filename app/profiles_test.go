@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHeaderProfiles tests endpoints and plugins referencing header profiles
+func TestHeaderProfiles(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	writeConfig(`{
+		"plugins_dir": "` + filepath.Join(dir, "plugins") + `",
+		"header_profiles": {
+			"json-cors": {"Access-Control-Allow-Origin": "*", "Cache-Control": "no-store"},
+			"cache-1h": {"Cache-Control": "max-age=3600"}
+		},
+		"endpoints": [
+			{"path": "/api/users", "method": "GET", "response": [], "header_profiles": ["json-cors", "cache-1h"]},
+			{"path": "/api/me", "method": "GET", "response": {}, "header_profiles": ["json-cors"], "headers": {"Cache-Control": "private"}}
+		]
+	}`)
+
+	server := NewMockServer(configPath)
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true, HeaderProfiles: []string{"json-cors"}, Endpoints: []Endpoint{
+		{Path: "/api/invoices", Method: "GET", Response: []interface{}{}},
+		{Path: "/api/receipts", Method: "GET", Response: []interface{}{}, HeaderProfiles: []string{"cache-1h"}},
+		{Path: "/api/refunds", Method: "GET", Response: []interface{}{}, HeaderProfiles: []string{"unknown"}},
+	}}
+	server.SetupRoutes()
+
+	tests := []struct {
+		path, origin, cache string
+	}{
+		{"/api/users", "*", "max-age=3600"},
+		{"/api/me", "*", "private"},
+		{"/api/invoices", "*", "no-store"},
+		{"/api/receipts", "*", "max-age=3600"},
+		{"/api/refunds", "", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if origin, cache := w.Header().Get("Access-Control-Allow-Origin"), w.Header().Get("Cache-Control"); origin != test.origin || cache != test.cache {
+			t.Errorf("%s: expected %q and %q, got %q and %q", test.path, test.origin, test.cache, origin, cache)
+		}
+	}
+
+	// Unknown profiles in the configuration are rejected
+	writeConfig(`{"endpoints": [{"path": "/api/users", "method": "GET", "response": [], "header_profiles": ["cors"]}]}`)
+	if err := server.LoadConfig(); err == nil || !strings.Contains(err.Error(), `unknown header profile "cors"`) {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
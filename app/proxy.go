@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// validateFallbackProxy checks the fallback_proxy URL of a configuration
+func validateFallbackProxy(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid fallback_proxy %q, expected an http or https URL", raw)
+	}
+	return nil
+}
+
+// fallbackProxyHandler forwards requests that match no endpoint to the
+// configured backend, so that only some of its endpoints are mocked.
+// Unmatched admin API requests are passed to next.
+func (ms *MockServer) fallbackProxyHandler(next http.Handler) http.Handler {
+	target, err := url.Parse(ms.config.FallbackProxy)
+	if err != nil {
+		log.Printf("Invalid fallback_proxy, answering unmatched requests: %v", err)
+		return next
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Fallback proxy failed",
+				"path":  r.URL.Path,
+			})
+			log.Printf("Fallback proxy to %s failed: %v", target.Host, err)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if info := requestInfoFrom(r); info != nil {
+			info.Source = "proxy"
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		proxy.ServeHTTP(sw, r)
+		log.Printf("%s %s - %d (Proxied to %s)", r.Method, r.URL.Path, sw.statusCode, target.Host)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFallbackProxy tests forwarding unmatched requests to a real backend
+func TestFallbackProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Backend", "real")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.Method + " " + r.URL.RequestURI() + " " + r.Host + " " + string(body)))
+	}))
+	defer backend.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:          "9000",
+		PluginsDir:    "plugins",
+		FallbackProxy: backend.URL,
+		Endpoints: []Endpoint{
+			{Path: "/users", Method: "GET", Response: "mocked"},
+		},
+	}
+	server.SetupRoutes()
+
+	call := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	if w := call("GET", "/users", ""); w.Body.String() != "mocked" {
+		t.Errorf("Expected the mocked endpoint to be served, got %d %s", w.Code, w.Body.String())
+	}
+
+	host := strings.TrimPrefix(backend.URL, "http://")
+	tests := []struct {
+		method, target, body string
+	}{
+		{"GET", "/orders?page=2", ""},
+		{"POST", "/users", `{"name":"x"}`}, // method not mocked
+	}
+	for _, test := range tests {
+		w := call(test.method, test.target, test.body)
+		expected := test.method + " " + test.target + " " + host + " " + test.body
+		if w.Code != http.StatusAccepted || w.Header().Get("X-Backend") != "real" || w.Body.String() != expected {
+			t.Errorf("%s %s: expected the proxied response %q, got %d %q", test.method, test.target, expected, w.Code, w.Body.String())
+		}
+	}
+
+	// Unknown admin routes are not forwarded
+	if w := call("GET", "/_admin/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected admin routes not to be proxied, got %d", w.Code)
+	}
+
+	// An unreachable backend is a bad gateway
+	backend.Close()
+	if w := call("GET", "/orders", ""); w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "Fallback proxy failed") {
+		t.Errorf("Expected a bad gateway, got %d %s", w.Code, w.Body.String())
+	}
+
+	for _, raw := range []string{"ftp://example.com", "localhost:8080", "http://"} {
+		if validateFallbackProxy(raw) == nil {
+			t.Errorf("Expected %q to be rejected", raw)
+		}
+	}
+}
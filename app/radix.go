@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Matching backends selectable with the router configuration setting
+const (
+	routerMux   = "mux"
+	routerRadix = "radix"
+)
+
+// radixNode is a node of a tree keyed by path segments. Static segments are
+// looked up by name; segments with variables, such as {id} or
+// v{version:[0-9]+}, are tried in the order they were added.
+type radixNode struct {
+	static  map[string]*radixNode
+	dynamic []*radixNode
+
+	segment string         // template of a dynamic segment
+	pattern *regexp.Regexp // matcher of a dynamic segment
+	names   []string       // variables of a dynamic segment
+
+	routes []radixEntry // routes whose path ends at this node
+}
+
+// radixEntry is a route with its position within its group
+type radixEntry struct {
+	route *endpointRoute
+	seq   int
+}
+
+// radixSegment is a parsed segment of a path template
+type radixSegment struct {
+	template string
+	pattern  *regexp.Regexp // nil for static segments
+	names    []string
+}
+
+// radixMatch is a route whose path matched a request
+type radixMatch struct {
+	radixEntry
+	vars map[string]string
+}
+
+// newRadixNode creates an empty tree node
+func newRadixNode() *radixNode {
+	return &radixNode{static: make(map[string]*radixNode)}
+}
+
+// parseRadixTemplate splits a path template into segments. It fails for
+// templates the tree can't represent, e.g. variables whose pattern can match
+// a slash; such routes are matched one by one instead.
+func parseRadixTemplate(template string) ([]radixSegment, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("path must start with a slash")
+	}
+
+	// Split at slashes outside of braces
+	var parts []string
+	depth, start := 0, 1
+	for i := 1; i < len(template); i++ {
+		switch template[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				parts = append(parts, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces")
+	}
+	parts = append(parts, template[start:])
+
+	segments := make([]radixSegment, 0, len(parts))
+	for _, part := range parts {
+		segment, err := parseRadixSegment(part)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// parseRadixSegment compiles a segment with variables into an anchored regexp
+func parseRadixSegment(part string) (radixSegment, error) {
+	if !strings.Contains(part, "{") {
+		return radixSegment{template: part}, nil
+	}
+	template := part
+
+	var expr strings.Builder
+	var names []string
+	expr.WriteString("^")
+	for len(part) > 0 {
+		open := strings.Index(part, "{")
+		if open < 0 {
+			expr.WriteString(regexp.QuoteMeta(part))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(part[:open]))
+
+		depth, end := 0, -1
+		for i := open; i < len(part) && end < 0; i++ {
+			switch part[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return radixSegment{}, fmt.Errorf("unbalanced braces")
+		}
+
+		name, pattern, found := strings.Cut(part[open+1:end], ":")
+		if !found {
+			pattern = "[^/]+"
+		}
+		parsed, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return radixSegment{}, err
+		}
+		if matchesSlash(parsed) {
+			return radixSegment{}, fmt.Errorf("pattern of variable %s can match a slash", name)
+		}
+		names = append(names, strings.TrimSpace(name))
+		expr.WriteString("(" + pattern + ")")
+		part = part[end+1:]
+	}
+	expr.WriteString("$")
+
+	pattern, err := regexp.Compile(expr.String())
+	if err != nil {
+		return radixSegment{}, err
+	}
+	if pattern.NumSubexp() != len(names) {
+		return radixSegment{}, fmt.Errorf("patterns must not contain capture groups")
+	}
+	return radixSegment{template: template, pattern: pattern, names: names}, nil
+}
+
+// matchesSlash reports whether a regular expression can match a slash
+func matchesSlash(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpLiteral:
+		return strings.ContainsRune(string(re.Rune), '/')
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '/' && '/' <= re.Rune[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sub := range re.Sub {
+		if matchesSlash(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds a route ending at the path of the segments
+func (n *radixNode) insert(segments []radixSegment, entry radixEntry) {
+	node := n
+	for _, segment := range segments {
+		node = node.child(segment)
+	}
+	node.routes = append(node.routes, entry)
+}
+
+// child returns the child node of a segment, creating it if needed
+func (n *radixNode) child(segment radixSegment) *radixNode {
+	if segment.pattern == nil {
+		child, exists := n.static[segment.template]
+		if !exists {
+			child = newRadixNode()
+			n.static[segment.template] = child
+		}
+		return child
+	}
+
+	for _, child := range n.dynamic {
+		if child.segment == segment.template {
+			return child
+		}
+	}
+	child := newRadixNode()
+	child.segment = segment.template
+	child.pattern = segment.pattern
+	child.names = segment.names
+	n.dynamic = append(n.dynamic, child)
+	return child
+}
+
+// with returns a copy of the node with a route ending at the path of the
+// segments, replacing the route added at the same position. Only the nodes
+// on the path are copied; the node itself is left unchanged.
+func (n *radixNode) with(segments []radixSegment, entry radixEntry) *radixNode {
+	next := n.copy()
+	if len(segments) == 0 {
+		next.routes = make([]radixEntry, 0, len(n.routes)+1)
+		for _, existing := range n.routes {
+			if existing.seq != entry.seq {
+				next.routes = append(next.routes, existing)
+			}
+		}
+		next.routes = append(next.routes, entry)
+		return next
+	}
+
+	segment := segments[0]
+	if segment.pattern == nil {
+		child, exists := n.static[segment.template]
+		if !exists {
+			child = newRadixNode()
+		}
+		next.static[segment.template] = child.with(segments[1:], entry)
+		return next
+	}
+	for i, child := range n.dynamic {
+		if child.segment == segment.template {
+			next.dynamic[i] = child.with(segments[1:], entry)
+			return next
+		}
+	}
+	child := newRadixNode()
+	child.segment = segment.template
+	child.pattern = segment.pattern
+	child.names = segment.names
+	next.dynamic = append(next.dynamic, child.with(segments[1:], entry))
+	return next
+}
+
+// without returns a copy of the node without the route added at a position
+// ending at the path of the segments. Nodes left without routes or children
+// are dropped, and nil is returned if the node itself is left empty.
+func (n *radixNode) without(segments []radixSegment, seq int) *radixNode {
+	next := n.copy()
+	if len(segments) == 0 {
+		next.routes = make([]radixEntry, 0, len(n.routes))
+		for _, existing := range n.routes {
+			if existing.seq != seq {
+				next.routes = append(next.routes, existing)
+			}
+		}
+	} else if segment := segments[0]; segment.pattern == nil {
+		if child, exists := n.static[segment.template]; exists {
+			if child = child.without(segments[1:], seq); child != nil {
+				next.static[segment.template] = child
+			} else {
+				delete(next.static, segment.template)
+			}
+		}
+	} else {
+		for i, child := range n.dynamic {
+			if child.segment != segment.template {
+				continue
+			}
+			if child = child.without(segments[1:], seq); child != nil {
+				next.dynamic[i] = child
+			} else {
+				next.dynamic = append(next.dynamic[:i], next.dynamic[i+1:]...)
+			}
+			break
+		}
+	}
+
+	if len(next.routes) == 0 && len(next.static) == 0 && len(next.dynamic) == 0 {
+		return nil
+	}
+	return next
+}
+
+// copy returns a shallow copy of the node whose children and routes can be
+// changed without changing the node
+func (n *radixNode) copy() *radixNode {
+	next := *n
+	next.static = make(map[string]*radixNode, len(n.static)+1)
+	for template, child := range n.static {
+		next.static[template] = child
+	}
+	next.dynamic = append([]*radixNode{}, n.dynamic...)
+	return &next
+}
+
+// collect appends the routes whose template matches the path segments
+func (n *radixNode) collect(segments []string, vars []string, matches []radixMatch) []radixMatch {
+	if len(segments) == 0 {
+		for _, entry := range n.routes {
+			match := radixMatch{radixEntry: entry, vars: make(map[string]string, len(vars)/2)}
+			for i := 0; i < len(vars); i += 2 {
+				match.vars[vars[i]] = vars[i+1]
+			}
+			matches = append(matches, match)
+		}
+		return matches
+	}
+
+	if child, exists := n.static[segments[0]]; exists {
+		matches = child.collect(segments[1:], vars, matches)
+	}
+	for _, child := range n.dynamic {
+		values := child.pattern.FindStringSubmatch(segments[0])
+		if values == nil {
+			continue
+		}
+		childVars := vars
+		for i, name := range child.names {
+			childVars = append(childVars, name, values[i+1])
+		}
+		matches = child.collect(segments[1:], childVars, matches)
+	}
+	return matches
+}
+
+// matchRadix finds the first route of a group handling a request using the
+// tree, and reports whether a route matched the path but not the method
+func (g *routeGroup) matchRadix(r *http.Request) (*endpointRoute, map[string]string, bool) {
+	var found *radixEntry
+	var vars map[string]string
+	mismatch := false
+
+	consider := func(entry radixEntry, entryVars map[string]string) {
+		if entry.route.method != r.Method {
+			mismatch = true
+			return
+		}
+		if found == nil || entry.seq < found.seq {
+			found, vars = &entry, entryVars
+		}
+	}
+
+	if path, ok := strings.CutPrefix(r.URL.Path, "/"); ok {
+		for _, match := range g.tree.collect(strings.Split(path, "/"), nil, nil) {
+			consider(match.radixEntry, match.vars)
+		}
+	}
+	for _, entry := range g.linear {
+		var match mux.RouteMatch
+		if entry.route.route.Match(r, &match) {
+			consider(entry, match.Vars)
+		} else if match.MatchErr == mux.ErrMethodMismatch {
+			mismatch = true
+		}
+	}
+
+	if found == nil {
+		return nil, nil, mismatch
+	}
+	return found.route, vars, false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRadixRouterMatchesMux tests that the radix router answers like the default router
+func TestRadixRouterMatchesMux(t *testing.T) {
+	endpoints := []Endpoint{
+		{Path: "/users", Method: "GET", Response: "list users"},
+		{Path: "/users", Method: "POST", StatusCode: 201, Response: "create user"},
+		{Path: "/users/me", Method: "GET", Response: "me"},
+		{Path: "/users/{id:[0-9]+}", Method: "GET", Response: "user by id"},
+		{Path: "/users/{name}", Method: "GET", Response: "user by name"},
+		{Path: "/users/{id}/orders/{order}", Method: "GET", Response: "order"},
+		{Path: "/files/{name}.json", Method: "GET", Response: "json file"},
+		{Path: "/files/{path:.*}", Method: "GET", Response: "any file"},
+		{Path: "/v{version:[0-9]}/status", Method: "GET", Response: "status"},
+		{Path: "/", Method: "GET", Response: "root"},
+		{Path: "/trailing/", Method: "GET", Response: "trailing"},
+	}
+	requests := []string{
+		"GET /users", "POST /users", "PUT /users", "GET /users/me", "GET /users/42", "GET /users/bob",
+		"GET /users/42/orders/7", "GET /users/42/orders", "GET /files/a.json", "GET /files/a.txt",
+		"GET /files/a/b.json", "GET /v1/status", "GET /v10/status", "GET /", "GET /trailing/",
+		"GET /trailing", "GET /missing", "DELETE /users/42", "GET /users/",
+	}
+
+	responses := make(map[string][]string)
+	for _, router := range []string{routerMux, routerRadix} {
+		server := NewMockServer("")
+		server.config = &Config{Port: "9000", PluginsDir: "plugins", Router: router, AutoHead: true, Endpoints: endpoints}
+		server.SetupRoutes()
+
+		for _, request := range append(requests, "HEAD /users/42") {
+			var method, path string
+			fmt.Sscan(request, &method, &path)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			responses[router] = append(responses[router], fmt.Sprintf("%s -> %d %s %s", request, w.Code, w.Header().Get("Allow"), w.Body.String()))
+		}
+	}
+
+	for i := range responses[routerMux] {
+		if responses[routerMux][i] != responses[routerRadix][i] {
+			t.Errorf("Expected '%s', got '%s'", responses[routerMux][i], responses[routerRadix][i])
+		}
+	}
+}
+
+// TestRadixVars tests path variables and route updates in a radix group
+func TestRadixVars(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins", Router: routerRadix}
+	server.SetupRoutes()
+
+	var routes []*endpointRoute
+	for _, path := range []string{"/users/{id}/orders/{order:[0-9]+}", "/files/{path:.+}"} {
+		route, err := server.compileRoute(Endpoint{Path: path, Method: "GET"}, "test")
+		if err != nil {
+			t.Fatalf("Failed to compile route: %v", err)
+		}
+		routes = append(routes, route)
+	}
+	group := newRouteGroup(routes, true)
+
+	route, vars, _ := group.match(httptest.NewRequest("GET", "/users/bob/orders/7", nil))
+	if route == nil || vars["id"] != "bob" || vars["order"] != "7" {
+		t.Errorf("Expected id 'bob' and order '7', got %v", vars)
+	}
+	route, vars, _ = group.match(httptest.NewRequest("GET", "/files/a/b.txt", nil))
+	if route == nil || len(group.linear) != 1 || vars["path"] != "a/b.txt" {
+		t.Errorf("Expected the linear route to match path 'a/b.txt', got %v", vars)
+	}
+
+	smaller, removed := group.without("get", "/users/{id}/orders/{order:[0-9]+}")
+	if !removed || len(smaller.tree.static) != 0 || len(smaller.routes) != 1 {
+		t.Errorf("Expected the route to be removed from the copy, got %d routes", len(smaller.routes))
+	}
+	if route, _, _ := group.match(httptest.NewRequest("GET", "/users/bob/orders/7", nil)); route == nil {
+		t.Error("Expected the original group to be unchanged")
+	}
+
+	// Adding, replacing and removing routes copies only the nodes on their path
+	compile := func(method, path string) *endpointRoute {
+		route, err := server.compileRoute(Endpoint{Path: path, Method: method}, "test")
+		if err != nil {
+			t.Fatalf("Failed to compile route: %v", err)
+		}
+		return route
+	}
+	larger, replaced := group.with(compile("GET", "/teams/{id}"))
+	if replaced || len(larger.routes) != 3 || larger.tree.static["users"] != group.tree.static["users"] {
+		t.Errorf("Expected the route to be added next to the unchanged subtree, got %d routes", len(larger.routes))
+	}
+	if len(group.routes) != 2 || len(group.tree.static) != 1 {
+		t.Errorf("Expected the original group to keep its routes, got %d", len(group.routes))
+	}
+	replacement := compile("GET", "/users/{id}/orders/{order:[0-9]+}")
+	larger, replaced = larger.with(replacement)
+	if route, _, _ := larger.match(httptest.NewRequest("GET", "/users/bob/orders/7", nil)); !replaced || route != replacement || larger.routes[0] != replacement {
+		t.Error("Expected the route to be replaced in place")
+	}
+
+	// Routes added after a removal are still matched after earlier ones
+	larger, _ = larger.without("GET", "/teams/{id}")
+	larger, _ = larger.with(compile("GET", "/{any}/orders/{order}"))
+	larger, _ = larger.with(compile("GET", "/teams/{id}"))
+	if route, _, _ := larger.match(httptest.NewRequest("GET", "/users/bob/orders/7", nil)); route != replacement {
+		t.Errorf("Expected the earlier route to win, got %v", route)
+	}
+	if route, _, _ := larger.match(httptest.NewRequest("GET", "/teams/red", nil)); route == nil || route.path != "/teams/{id}" {
+		t.Errorf("Expected the added route to match, got %v", route)
+	}
+	larger, _ = larger.without("GET", "/files/{path:.+}")
+	if len(larger.linear) != 0 || len(larger.routes) != 3 || larger.routes[2].path != "/teams/{id}" {
+		t.Errorf("Expected the linear route to be removed, got %d routes", len(larger.routes))
+	}
+}
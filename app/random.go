@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// maxGeneratedSeed bounds generated seeds to integers that JSON clients,
+// such as JavaScript, read exactly
+const maxGeneratedSeed = 1 << 53
+
+// randomness derives the random numbers of a run from a single seed. The
+// nth request to an endpoint gets numbers that depend only on the seed, the
+// endpoint's method and path and n, so a run with the same seed and the
+// same requests makes the same random choices.
+type randomness struct {
+	mutex   sync.Mutex
+	runSeed int64 // generated on startup, used when no seed is configured
+	seed    int64
+	counts  map[string]uint64 // requests that took random numbers, by endpoint
+	logged  bool              // the seed was logged
+}
+
+// newRandomness creates the randomness of a run with a generated seed
+func newRandomness() *randomness {
+	seed := rand.Int64N(maxGeneratedSeed)
+	return &randomness{runSeed: seed, seed: seed, counts: make(map[string]uint64)}
+}
+
+// configure applies the configured seed, or the generated seed of the run
+// without one. Changing the seed starts counting requests again. The seed
+// is logged, so that a run can be reproduced with --seed.
+func (rn *randomness) configure(seed *int64) {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+
+	next := rn.runSeed
+	if seed != nil {
+		next = *seed
+	}
+	if next != rn.seed {
+		rn.seed = next
+		rn.counts = make(map[string]uint64)
+		rn.logged = false
+	}
+	if !rn.logged {
+		rn.logged = true
+		log.Printf("Random seed: %d", next)
+	}
+}
+
+// current returns the seed in use
+func (rn *randomness) current() int64 {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+	return rn.seed
+}
+
+// forRequest returns the random numbers of the next request to an endpoint
+func (rn *randomness) forRequest(endpoint string) *rand.Rand {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+
+	n := rn.counts[endpoint]
+	rn.counts[endpoint] = n + 1
+	return rand.New(rand.NewPCG(uint64(rn.seed), splitMix64(randomKey(endpoint)+n)))
+}
+
+// forClient returns the random numbers of a request by a client, which are
+// the same for every request of the client to an endpoint, so that clients
+// are bucketed like by an A/B testing backend
+func (rn *randomness) forClient(endpoint, client string) *rand.Rand {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+	return rand.New(rand.NewPCG(uint64(rn.seed), splitMix64(randomKey(endpoint)^splitMix64(randomKey(client)))))
+}
+
+// forEndpoint returns random numbers that are the same for every request to
+// an endpoint, e.g. for choices made when its routes are built
+func (rn *randomness) forEndpoint(endpoint string) *rand.Rand {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+	return rand.New(rand.NewPCG(uint64(rn.seed), ^splitMix64(randomKey(endpoint))))
+}
+
+// randomKey hashes the name of an endpoint
+func randomKey(endpoint string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(endpoint))
+	return h.Sum64()
+}
+
+// randomBoundary returns a multipart boundary drawn from random numbers
+func randomBoundary(random *rand.Rand) string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(random.Uint32())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// buildVersion returns the version of the module nmock was built from
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// setupVersionAPI registers the admin API of the build and run
+func (ms *MockServer) setupVersionAPI() {
+	// Version of the build and the random seed of the run, to reproduce it
+	ms.router.HandleFunc("/_admin/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"version":    buildVersion(),
+			"go_version": runtime.Version(),
+			"seed":       ms.random.current(),
+		})
+	}).Methods("GET")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSeededRandomness tests reproducing the random choices of a run with
+// its seed
+func TestSeededRandomness(t *testing.T) {
+	run := func(seed *int64) (statuses string, boundary string, reported int64) {
+		server := NewMockServer("")
+		server.config = &Config{
+			Port:       "9000",
+			PluginsDir: "plugins",
+			Seed:       seed,
+			Upstreams:  map[string]UpstreamConfig{"flaky": {ErrorRate: 0.5}},
+			Endpoints: []Endpoint{
+				{Path: "/orders", Method: "GET", StatusCode: 200, Response: "ok", Upstream: "flaky"},
+				{Path: "/parts", Method: "GET", StatusCode: 200, Multipart: &MultipartResponse{Parts: []ResponsePart{{Body: "a"}}}},
+			},
+		}
+		server.random.configure(seed)
+		server.upstreams.configure(server.config.Upstreams)
+		server.SetupRoutes()
+
+		var codes strings.Builder
+		for i := 0; i < 32; i++ {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest("GET", "/orders", nil))
+			codes.WriteString(map[bool]string{true: "E", false: "."}[w.Code != 200])
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/parts", nil))
+		_, boundary, _ = strings.Cut(w.Header().Get("Content-Type"), "boundary=")
+
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/version", nil))
+		var version struct {
+			Version string `json:"version"`
+			Seed    int64  `json:"seed"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &version); err != nil || version.Version == "" {
+			t.Fatalf("Invalid version response: %v %s", err, w.Body.String())
+		}
+		return codes.String(), boundary, version.Seed
+	}
+
+	seed := int64(42)
+	first, firstBoundary, reported := run(&seed)
+	if reported != 42 {
+		t.Errorf("Expected the configured seed, got %d", reported)
+	}
+	if !strings.Contains(first, "E") || !strings.Contains(first, ".") {
+		t.Errorf("Expected errors and successes, got %s", first)
+	}
+	again, againBoundary, _ := run(&seed)
+	if again != first || againBoundary != firstBoundary {
+		t.Errorf("Expected the same choices with the same seed, got %s and %s, boundaries %s and %s", first, again, firstBoundary, againBoundary)
+	}
+
+	// A run without a seed reports its generated seed, which reproduces it
+	generated, generatedBoundary, reported := run(nil)
+	replayed, replayedBoundary, _ := run(&reported)
+	if replayed != generated || replayedBoundary != generatedBoundary {
+		t.Errorf("Expected seed %d to reproduce %s, got %s", reported, generated, replayed)
+	}
+}
+
+// TestRandomnessDerivation tests that requests to different endpoints don't
+// affect each other's random numbers, and that a new seed starts over
+func TestRandomnessDerivation(t *testing.T) {
+	seed := int64(7)
+	rn := newRandomness()
+	rn.configure(&seed)
+	first := rn.forRequest("GET /a").Uint64()
+	second := rn.forRequest("GET /a").Uint64()
+	if first == second {
+		t.Error("Expected consecutive requests to get different numbers")
+	}
+
+	other := newRandomness()
+	other.configure(&seed)
+	other.forRequest("GET /b")
+	if other.forRequest("GET /a").Uint64() != first {
+		t.Error("Expected requests to another endpoint not to change the numbers")
+	}
+
+	changed := int64(8)
+	rn.configure(&changed)
+	rn.configure(&seed)
+	if rn.forRequest("GET /a").Uint64() != first {
+		t.Error("Expected a changed seed to start counting requests again")
+	}
+
+	// --seed and NMOCK_SEED override the configuration file
+	config := &Config{Seed: &changed}
+	settings{Seed: "123"}.apply(config)
+	if config.Seed == nil || *config.Seed != 123 {
+		t.Errorf("Expected seed 123, got %v", config.Seed)
+	}
+	if err := settingEnv["NMOCK_SEED"](&settings{}, "abc"); err == nil {
+		t.Error("Expected an invalid NMOCK_SEED to be rejected")
+	}
+}
+
+// TestStickyRandomness tests clients keeping their random choices across
+// calls
+func TestStickyRandomness(t *testing.T) {
+	seed := int64(3)
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Seed:       &seed,
+		Sticky:     "header:X-User-Id",
+		Endpoints: []Endpoint{
+			{Path: "/checkout", Method: "GET", StatusCode: 200, Response: "ok", Fault: &FaultConfig{Mode: FaultRandom500, Probability: 0.5}},
+			{Path: "/cart", Method: "GET", StatusCode: 200, Response: "ok", Sticky: "query:user", Fault: &FaultConfig{Mode: FaultRandom500, Probability: 0.5}},
+		},
+	}
+	server.random.configure(&seed)
+	server.SetupRoutes()
+
+	call := func(target, user string) int {
+		r := httptest.NewRequest("GET", target, nil)
+		if user != "" {
+			r.Header.Set("X-User-Id", user)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	buckets := map[int]int{}
+	for i := 0; i < 20; i++ {
+		user := "user-" + strconv.Itoa(i)
+		first := call("/checkout", user)
+		for j := 0; j < 5; j++ {
+			if code := call("/checkout", user); code != first {
+				t.Fatalf("Expected %s to get %d on every call, got %d", user, first, code)
+			}
+			if call("/cart?user="+user, "") != call("/cart?user="+user, "other") {
+				t.Fatalf("Expected the endpoint's own key for %s", user)
+			}
+		}
+		buckets[first]++
+	}
+	if buckets[200] == 0 || buckets[500] == 0 {
+		t.Errorf("Expected clients in both buckets, got %v", buckets)
+	}
+
+	// Requests without the key get the choices of the request
+	codes := map[int]bool{}
+	for i := 0; i < 20; i++ {
+		codes[call("/checkout", "")] = true
+	}
+	if !codes[200] || !codes[500] {
+		t.Errorf("Expected requests without a key to vary, got %v", codes)
+	}
+}
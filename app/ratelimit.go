@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit represents a per-client rate limit applied to an endpoint
+type RateLimit struct {
+	Requests   int    `json:"requests"`
+	Window     int    `json:"window"`                // window length in milliseconds
+	Key        string `json:"key,omitempty"`         // "ip" (default), "header:<name>", "query:<name>" or a template
+	StatusCode int    `json:"status_code,omitempty"` // status returned when the limit is exceeded (default: 429)
+}
+
+// rateBucket holds the counter of a single client within the current window
+type rateBucket struct {
+	Count   int       `json:"count"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// rateLimiter enforces a RateLimit with an independent bucket per client key
+type rateLimiter struct {
+	limit   RateLimit
+	key     keyFunc
+	mutex   sync.Mutex
+	buckets map[string]*rateBucket
+	pruneAt time.Time // when expired buckets are dropped next
+}
+
+// newRateLimiter creates a rate limiter for the given configuration
+func newRateLimiter(limit RateLimit) (*rateLimiter, error) {
+	if limit.Requests <= 0 {
+		return nil, fmt.Errorf("rate_limit.requests must be greater than 0")
+	}
+	if limit.Window <= 0 {
+		limit.Window = 1000
+	}
+	if limit.StatusCode == 0 {
+		limit.StatusCode = http.StatusTooManyRequests
+	}
+	key, err := compileKey(limit.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimiter{
+		limit:   limit,
+		key:     key,
+		buckets: make(map[string]*rateBucket),
+	}, nil
+}
+
+// allow records a request and reports whether it is within the limit.
+// Rate limit headers are added to the response in both cases.
+func (rl *rateLimiter) allow(w http.ResponseWriter, r *http.Request) bool {
+	key := rl.key(r)
+	now := time.Now()
+
+	rl.mutex.Lock()
+	bucket, exists := rl.buckets[key]
+	if !exists || !now.Before(bucket.ResetAt) {
+		window := time.Duration(rl.limit.Window) * time.Millisecond
+		if !now.Before(rl.pruneAt) {
+			rl.prune(now)
+			rl.pruneAt = now.Add(window)
+		}
+		bucket = &rateBucket{ResetAt: now.Add(window)}
+		rl.buckets[key] = bucket
+	}
+	bucket.Count++
+	count, resetAt := bucket.Count, bucket.ResetAt
+	rl.mutex.Unlock()
+
+	remaining := rl.limit.Requests - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.limit.Requests))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+	if count <= rl.limit.Requests {
+		return true
+	}
+
+	retryAfter := int(time.Until(resetAt).Seconds() + 0.999)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rl.limit.StatusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded"})
+	return false
+}
+
+// prune drops the buckets of clients idle for a whole window, at most once
+// per window, so that counters of past clients don't pile up. The caller
+// must hold the mutex.
+func (rl *rateLimiter) prune(now time.Time) {
+	for key, bucket := range rl.buckets {
+		if !now.Before(bucket.ResetAt) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// snapshot returns the active buckets of the limiter
+func (rl *rateLimiter) snapshot() map[string]interface{} {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	clients := make(map[string]rateBucket)
+	for key, bucket := range rl.buckets {
+		if now.Before(bucket.ResetAt) {
+			clients[key] = *bucket
+		}
+	}
+	return map[string]interface{}{
+		"requests": rl.limit.Requests,
+		"window":   rl.limit.Window,
+		"key":      rl.limit.Key,
+		"clients":  clients,
+	}
+}
+
+// reset clears all counters of the limiter
+func (rl *rateLimiter) reset() {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.buckets = make(map[string]*rateBucket)
+}
+
+// rateLimiterFor returns the limiter of an endpoint, keeping existing counters
+// across route rebuilds as long as the limit configuration is unchanged
+func (ms *MockServer) rateLimiterFor(routeKey string, limit RateLimit) (*rateLimiter, error) {
+	limiter, err := newRateLimiter(limit)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := ms.rateLimiters[routeKey]; ok && existing.limit == limiter.limit {
+		return existing, nil
+	}
+	ms.rateLimiters[routeKey] = limiter
+	return limiter, nil
+}
+
+// pruneRateLimiters drops the limiters of endpoints that were removed or no
+// longer have a rate limit. Must be called with ms.mutex held.
+func (ms *MockServer) pruneRateLimiters() {
+	limited := ms.routeKeys(func(ep *Endpoint) bool { return ep.RateLimit != nil })
+	for routeKey := range ms.rateLimiters {
+		if !limited[routeKey] {
+			delete(ms.rateLimiters, routeKey)
+		}
+	}
+}
+
+// setupRateLimitAPI sets up the rate limit management endpoints
+func (ms *MockServer) setupRateLimitAPI() {
+	// List rate limit counters per endpoint and client
+	ms.router.HandleFunc("/_admin/ratelimits", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		// Counters are kept per method and path, which routes of any
+		// source with the tag may share
+		var tagged map[string]bool
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			tagged = make(map[string]bool)
+			ms.routes.snapshot.Load().each(func(route *endpointRoute) bool {
+				if matchTag(route.tags, tag) {
+					tagged[route.key()] = true
+				}
+				return true
+			})
+		}
+
+		result := make(map[string]interface{})
+		for routeKey, limiter := range ms.rateLimiters {
+			if tagged == nil || tagged[routeKey] {
+				result[routeKey] = limiter.snapshot()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Reset all rate limit counters
+	ms.router.HandleFunc("/_admin/ratelimits", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		for _, limiter := range ms.rateLimiters {
+			limiter.reset()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Rate limits reset"})
+	}).Methods("DELETE")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimitPerClient tests that each client key gets an independent counter
+func TestRateLimitPerClient(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path:       "/limited",
+				Method:     "GET",
+				StatusCode: 200,
+				Response:   map[string]string{"message": "ok"},
+				RateLimit:  &RateLimit{Requests: 2, Window: 60000, Key: "header:X-API-Key"},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	call := func(apiKey string) int {
+		req := httptest.NewRequest("GET", "/limited", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := call("tenant-a"); code != 200 {
+			t.Errorf("Expected status 200 for request %d, got %d", i+1, code)
+		}
+	}
+
+	if code := call("tenant-a"); code != 429 {
+		t.Errorf("Expected status 429 after exceeding limit, got %d", code)
+	}
+
+	if code := call("tenant-b"); code != 200 {
+		t.Errorf("Expected status 200 for a different client, got %d", code)
+	}
+
+	// Counters are exposed via the admin API
+	req := httptest.NewRequest("GET", "/_admin/ratelimits", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var response map[string]struct {
+		Clients map[string]rateBucket `json:"clients"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	clients := response["GET /limited"].Clients
+	if clients["tenant-a"].Count != 3 {
+		t.Errorf("Expected tenant-a count 3, got %d", clients["tenant-a"].Count)
+	}
+	if clients["tenant-b"].Count != 1 {
+		t.Errorf("Expected tenant-b count 1, got %d", clients["tenant-b"].Count)
+	}
+
+	// Counters can be reset
+	req = httptest.NewRequest("DELETE", "/_admin/ratelimits", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if code := call("tenant-a"); code != 200 {
+		t.Errorf("Expected status 200 after reset, got %d", code)
+	}
+}
+
+// TestRateLimitPruning tests dropping the buckets of idle clients and the
+// limiters of removed endpoints
+func TestRateLimitPruning(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/limited", Method: "GET", StatusCode: 200, Response: "ok", RateLimit: &RateLimit{Requests: 5, Window: 20, Key: "query:client"}},
+			{Path: "/other", Method: "GET", StatusCode: 200, Response: "ok", RateLimit: &RateLimit{Requests: 5, Window: 60000}},
+		},
+	}
+	server.SetupRoutes()
+
+	call := func(target string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	}
+	for i := 0; i < 100; i++ {
+		call(fmt.Sprintf("/limited?client=%d", i))
+	}
+	call("/other")
+
+	server.mutex.RLock()
+	limiter := server.rateLimiters["GET /limited"]
+	server.mutex.RUnlock()
+	time.Sleep(30 * time.Millisecond)
+	call("/limited?client=new")
+	limiter.mutex.Lock()
+	buckets := len(limiter.buckets)
+	limiter.mutex.Unlock()
+	if buckets != 1 {
+		t.Errorf("Expected the buckets of idle clients to be dropped, got %d", buckets)
+	}
+
+	// Removing an endpoint or its rate limit drops its limiter
+	server.config.Endpoints = server.config.Endpoints[:1]
+	server.config.Endpoints[0].RateLimit = nil
+	server.SetupRoutes()
+	server.mutex.RLock()
+	remaining := len(server.rateLimiters)
+	server.mutex.RUnlock()
+	if remaining != 0 {
+		t.Errorf("Expected no rate limiters, got %d", remaining)
+	}
+}
+
+// TestCompileKeyTemplate tests template based rate limit keys
+func TestCompileKeyTemplate(t *testing.T) {
+	key, err := compileKey(`{{.Headers.Get "X-Tenant"}}:{{.Query.Get "user"}}`)
+	if err != nil {
+		t.Fatalf("Failed to compile key: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/test?user=42", nil)
+	req.Header.Set("X-Tenant", "acme")
+
+	if got := key(req); got != "acme:42" {
+		t.Errorf("Expected key 'acme:42', got '%s'", got)
+	}
+
+	if _, err := compileKey("cookie:session"); err == nil {
+		t.Error("Expected error for unsupported key")
+	}
+}
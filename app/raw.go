@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// writeRaw writes bytes to the connection of a request, bypassing the
+// response handling of net/http, and closes the connection. This only
+// works for HTTP/1.x connections.
+func writeRaw(w http.ResponseWriter, raw string) error {
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fmt.Errorf("raw responses require HTTP/1.x: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := buffered.WriteString(raw); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
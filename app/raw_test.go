@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRawResponse tests writing responses byte for byte
+func TestRawResponse(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nbroken\r\n0\r\n\r\n"
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/broken", Method: "GET", RawResponse: raw}},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /broken HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	if data, err := io.ReadAll(conn); err != nil || string(data) != raw {
+		t.Errorf("Expected the raw response %q, got %q (%v)", raw, data, err)
+	}
+
+	// Clients see the malformed chunk size
+	conn, _ = net.Dial("tcp", ts.Listener.Addr().String())
+	defer conn.Close()
+	conn.Write([]byte("GET /broken HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("Expected an error for the malformed chunk")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// errReadOnly is returned by file writes of a read-only server
+var errReadOnly = errors.New("server is read-only")
+
+// readsOnly reports whether an admin API request leaves the server as it
+// is: GET, HEAD and OPTIONS requests, and verifications, which are posted
+// but only read the request history
+func readsOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return r.Method == http.MethodPost && r.URL.Path == "/_admin/verify"
+}
+
+// allowChange rejects admin API requests that may change something when the
+// server runs with --read-only. It returns false if the request was denied
+// and the response has been written.
+func (ms *MockServer) allowChange(w http.ResponseWriter, r *http.Request) bool {
+	if !ms.readOnly || readsOnly(r) {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Server is read-only"})
+	return false
+}
+
+// memoryOnly drops the files the audit log and the request history append
+// to when the server runs with --read-only, so that both are kept in memory
+func (ms *MockServer) memoryOnly(audit *AuditConfig, history *HistoryConfig) (*AuditConfig, *HistoryConfig) {
+	if !ms.readOnly {
+		return audit, history
+	}
+	if audit != nil && audit.File != "" {
+		log.Printf("Warning: Not writing audit file %s in read-only mode", audit.File)
+		audit = nil
+	}
+	if history != nil && history.SpillFile != "" {
+		log.Printf("Warning: Not writing history spill file %s in read-only mode", history.SpillFile)
+		memory := *history
+		memory.SpillFile = ""
+		history = &memory
+	}
+	return audit, history
+}
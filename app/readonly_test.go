@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReadOnlyMode tests rejecting admin API changes and file writes
+func TestReadOnlyMode(t *testing.T) {
+	pluginsDir := t.TempDir()
+	pluginFile := filepath.Join(pluginsDir, "users.json")
+	original := `{"name": "users", "enabled": true, "endpoints": [{"path": "/api/users", "method": "GET", "response": []}]}`
+	if err := os.WriteFile(pluginFile, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewMockServer("")
+	server.readOnly = true
+	server.config = &Config{Port: "9000"}
+	server.pluginsDir = pluginsDir
+	if err := server.LoadPlugins(); err != nil {
+		t.Fatalf("Failed to load plugins: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := call("GET", "/_admin/plugins/users", ""); code != 200 {
+		t.Errorf("Expected plugins to be readable, got status %d", code)
+	}
+	if code := call("POST", "/_admin/plugins/users/toggle", ""); code != 403 {
+		t.Errorf("Expected toggling to be rejected, got status %d", code)
+	}
+	if code := call("POST", "/_admin/endpoints", `{"path": "/api/new", "method": "GET"}`); code != 403 {
+		t.Errorf("Expected adding endpoints to be rejected, got status %d", code)
+	}
+	if code := call("GET", "/api/users", ""); code != 200 {
+		t.Errorf("Expected the plugin to stay enabled, got status %d", code)
+	}
+	if code := call("POST", "/_admin/verify", `{"path": "/api/users", "times": 1}`); code != 200 {
+		t.Errorf("Expected verifications to be allowed, got status %d", code)
+	}
+
+	if err := server.savePlugin("users", &Plugin{Name: "users"}); err != errReadOnly {
+		t.Errorf("Expected saving a plugin to fail, got %v", err)
+	}
+	if _, _, err := server.importBundle(nil); err != errReadOnly {
+		t.Errorf("Expected importing a bundle to fail, got %v", err)
+	}
+	if data, _ := os.ReadFile(pluginFile); string(data) != original {
+		t.Errorf("Expected the plugin file to be unchanged, got %s", data)
+	}
+}
+
+// TestReadOnlyFiles tests keeping the audit log and evicted requests in
+// memory, and refusing writes over S3
+func TestReadOnlyFiles(t *testing.T) {
+	dir := t.TempDir()
+	auditFile := filepath.Join(dir, "audit.jsonl")
+	spillFile := filepath.Join(dir, "spill.jsonl")
+	configPath := filepath.Join(dir, "config.json")
+	config := `{"port": "9000", "plugins_dir": "` + filepath.Join(dir, "plugins") + `",
+		"audit": {"file": "` + auditFile + `"}, "history": {"max_entries": 1, "spill_file": "` + spillFile + `"},
+		"endpoints": [{"path": "/ping", "method": "GET", "response": "pong"}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewMockServer(configPath)
+	server.readOnly = true
+	if err := server.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	server.SetupRoutes()
+	for _, method := range []string{"GET", "GET", "POST"} {
+		path := "/ping"
+		if method == "POST" {
+			path = "/_admin/reload"
+		}
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+	server.history.flushSpills()
+	for _, file := range []string{auditFile, spillFile} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be written, got %v", file, err)
+		}
+	}
+	if entries := server.audit.list(); len(entries) != 1 || entries[0].Status != 403 {
+		t.Errorf("Expected the denied change in the audit log in memory, got %+v", entries)
+	}
+
+	// S3 answers reads, and refuses writes with AccessDenied
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "photos"), 0755)
+	os.WriteFile(filepath.Join(root, "photos", "cat.txt"), []byte("meow"), 0644)
+	s3 := &s3Handler{root: root, readOnly: true}
+	for _, tt := range []struct {
+		method, path string
+		expected     int
+	}{
+		{"GET", "/photos/cat.txt", 200},
+		{"PUT", "/photos/dog.txt", 403},
+		{"DELETE", "/photos/cat.txt", 403},
+		{"PUT", "/videos", 403},
+	} {
+		w := httptest.NewRecorder()
+		s3.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader("woof")))
+		if w.Code != tt.expected || (tt.expected == 403 && !strings.Contains(w.Body.String(), "<Code>AccessDenied</Code>")) {
+			t.Errorf("%s %s: expected status %d, got %d %s", tt.method, tt.path, tt.expected, w.Code, w.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "photos", "cat.txt")); err != nil {
+		t.Errorf("Expected the object to be kept, got %v", err)
+	}
+}
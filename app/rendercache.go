@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// renderCacheLimit is the default number of rendered responses kept
+const renderCacheLimit = 1000
+
+// TemplateCacheConfig keeps rendered response templates, so that requests
+// with the same values for everything the template reads get the same
+// response without rendering it again
+type TemplateCacheConfig struct {
+	TTL        int `json:"ttl"`                   // milliseconds a rendered response is kept
+	MaxEntries int `json:"max_entries,omitempty"` // rendered responses kept (default: 1000)
+}
+
+// templateInputs are the request values a body template reads
+type templateInputs struct {
+	id        int             // distinguishes the bodies of an endpoint in cache keys
+	cacheable bool            // false if what the template reads can't be told
+	fields    map[string]bool // request data fields read as a whole
+	headers   []string        // headers read with .Headers.Get
+	query     []string        // parameters read with .Query.Get
+	vars      []string        // path variables read as .Vars.<name> or .PathParams.<name>
+}
+
+// renderedResponse is a rendered body kept until it expires
+type renderedResponse struct {
+	body    []byte
+	expires time.Time
+}
+
+// renderCache keeps the rendered bodies of an endpoint. It belongs to the
+// routes it was built with, so a reload starts with an empty cache.
+type renderCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	inputs     map[string]*templateInputs // body to the values it reads
+	entries    map[string]renderedResponse
+}
+
+// newRenderCache checks a template cache setting and creates the cache
+func newRenderCache(config *TemplateCacheConfig) (*renderCache, error) {
+	if config.TTL <= 0 {
+		return nil, fmt.Errorf("ttl must be positive")
+	}
+	if config.MaxEntries < 0 {
+		return nil, fmt.Errorf("max_entries must not be negative")
+	}
+	maxEntries := config.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = renderCacheLimit
+	}
+	return &renderCache{
+		ttl:        time.Duration(config.TTL) * time.Millisecond,
+		maxEntries: maxEntries,
+		inputs:     make(map[string]*templateInputs),
+		entries:    make(map[string]renderedResponse),
+	}, nil
+}
+
+// key returns the cache key of a body for a request, or false if the
+// rendered body can't be cached
+func (rc *renderCache) key(r *http.Request, data requestData, body []byte, texts func() []string) (string, bool) {
+	rc.mutex.Lock()
+	inputs, ok := rc.inputs[string(body)]
+	if !ok {
+		inputs = readTemplateInputs(texts())
+		inputs.id = len(rc.inputs)
+		rc.inputs[string(body)] = inputs
+	}
+	rc.mutex.Unlock()
+	if !inputs.cacheable {
+		return "", false
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%d", inputs.id)
+	add := func(name, value string) {
+		key.WriteString("\x00" + name + "=" + value)
+	}
+	for _, field := range sortedKeys(inputs.fields) {
+		switch field {
+		case "Method":
+			add(field, r.Method)
+		case "Path":
+			add(field, r.URL.Path)
+		case "IP":
+			add(field, data.IP)
+		case "Query":
+			add(field, r.URL.RawQuery)
+		case "Vars", "PathParams":
+			for _, name := range sortedKeys(data.Vars) {
+				add("var:"+name, data.Vars[name])
+			}
+		case "BaseURL", "URL":
+			add(field, data.URL)
+		case "Headers", "SOAPAction":
+			for _, name := range sortedKeys(r.Header) {
+				add("header:"+name, strings.Join(r.Header[name], "\x01"))
+			}
+		case "Body", "BodyField", "JSON", "XPath":
+			add("body", data.Body())
+		default:
+			return "", false
+		}
+	}
+	for _, name := range inputs.headers {
+		add("header:"+name, strings.Join(r.Header.Values(name), "\x01"))
+	}
+	for _, name := range inputs.query {
+		add("query:"+name, strings.Join(data.Query[name], "\x01"))
+	}
+	for _, name := range inputs.vars {
+		add("var:"+name, data.Vars[name])
+	}
+	return key.String(), true
+}
+
+// get returns a rendered body that hasn't expired
+func (rc *renderCache) get(key string) ([]byte, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// put keeps a rendered body, dropping expired entries, or any entry, when
+// the cache is full
+func (rc *renderCache) put(key string, body []byte) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	now := time.Now()
+	if len(rc.entries) >= rc.maxEntries {
+		for key, entry := range rc.entries {
+			if now.After(entry.expires) {
+				delete(rc.entries, key)
+			}
+		}
+	}
+	for key := range rc.entries {
+		if len(rc.entries) < rc.maxEntries {
+			break
+		}
+		delete(rc.entries, key)
+	}
+	rc.entries[key] = renderedResponse{body: body, expires: now.Add(rc.ttl)}
+}
+
+// readTemplateInputs finds the request values templates read. Templates
+// that move the dot with range or with, pass it to a function, or call
+// other templates are not cacheable, as their inputs can't be told.
+func readTemplateInputs(texts []string) *templateInputs {
+	inputs := &templateInputs{cacheable: true, fields: make(map[string]bool)}
+	headers, query, vars := map[string]bool{}, map[string]bool{}, map[string]bool{}
+
+	// field records a field chain read from the request data, with the
+	// string argument it is called with, if any
+	field := func(ident []string, arg *parse.StringNode) {
+		switch {
+		case len(ident) == 2 && ident[0] == "Headers" && ident[1] == "Get" && arg != nil:
+			headers[http.CanonicalHeaderKey(arg.Text)] = true
+		case len(ident) == 2 && ident[0] == "Query" && ident[1] == "Get" && arg != nil:
+			query[arg.Text] = true
+		case len(ident) == 2 && (ident[0] == "Vars" || ident[0] == "PathParams"):
+			vars[ident[1]] = true
+		default:
+			inputs.fields[ident[0]] = true
+		}
+	}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		if !inputs.cacheable || node == nil {
+			return
+		}
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for i, arg := range n.Args {
+				var next *parse.StringNode
+				if i+1 < len(n.Args) {
+					next, _ = n.Args[i+1].(*parse.StringNode)
+				}
+				switch a := arg.(type) {
+				case *parse.FieldNode:
+					field(a.Ident, next)
+				case *parse.VariableNode:
+					if a.Ident[0] == "$" && len(a.Ident) > 1 {
+						field(a.Ident[1:], next)
+					}
+				default:
+					walk(arg)
+				}
+			}
+		case *parse.ChainNode, *parse.DotNode, *parse.RangeNode, *parse.WithNode, *parse.TemplateNode:
+			inputs.cacheable = false
+		}
+	}
+
+	for _, text := range texts {
+		tmpl, err := template.New("response").Funcs(responseTemplateFuncs).Parse(text)
+		if err != nil {
+			continue // sent as it is
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Name() != "response" {
+				inputs.cacheable = false
+			} else if t.Tree != nil {
+				walk(t.Tree.Root)
+			}
+		}
+	}
+
+	inputs.headers, inputs.query, inputs.vars = sortedKeys(headers), sortedKeys(query), sortedKeys(vars)
+	return inputs
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
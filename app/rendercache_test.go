@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTemplateCache tests keeping rendered responses per request values
+func TestTemplateCache(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/users/{id}", Method: "GET", StatusCode: 200, ResponseTemplate: true, TemplateCache: &TemplateCacheConfig{TTL: 60000},
+				Response: map[string]interface{}{"id": "{{.Vars.id}}", "tenant": `{{.Headers.Get "X-Tenant" | default "public"}}`}},
+			{Path: "/api/echo", Method: "POST", StatusCode: 200, ResponseTemplate: true, TemplateCache: &TemplateCacheConfig{TTL: 60000},
+				Response: `{{range $k, $v := .Query}}{{$k}}{{end}}`},
+			{Path: "/api/invalid", Method: "GET", StatusCode: 200, ResponseTemplate: true, TemplateCache: &TemplateCacheConfig{},
+				Response: "{{.Path}}"},
+		},
+	}
+	server.SetupRoutes()
+
+	call := func(method, target, tenant string) string {
+		r := httptest.NewRequest(method, target, nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	// Requests differing only in values the template doesn't read share
+	// a rendered response
+	if body := call("GET", "/api/users/1?page=2", "acme"); body != `{"id":"1","tenant":"acme"}` {
+		t.Fatalf("Unexpected response: %s", body)
+	}
+	if body := call("GET", "/api/users/2", "acme"); body != `{"id":"2","tenant":"acme"}` {
+		t.Errorf("Expected another path variable to be rendered, got %s", body)
+	}
+	if body := call("GET", "/api/users/1", ""); body != `{"id":"1","tenant":"public"}` {
+		t.Errorf("Expected another header to be rendered, got %s", body)
+	}
+
+	// Keys leave out what the template doesn't read
+	cache, err := newRenderCache(&TemplateCacheConfig{TTL: 1, MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{{.Query.Get "page"}}`)
+	key := func(target, tenant string) string {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("X-Tenant", tenant)
+		key, cacheable := cache.key(r, newRequestData(r), body, func() []string { return []string{string(body)} })
+		if !cacheable {
+			t.Fatalf("Expected %s to be cacheable", body)
+		}
+		return key
+	}
+	if key("/a?page=1", "acme") != key("/b?page=1&sort=id", "other") {
+		t.Error("Expected requests with the same page to share a key")
+	}
+	if key("/a?page=1", "acme") == key("/a?page=2", "acme") {
+		t.Error("Expected requests with another page to get another key")
+	}
+
+	inputs := readTemplateInputs([]string{"{{.Vars.id}}", `{{.Headers.Get "x-tenant" | default "public"}}`})
+	if !inputs.cacheable || strings.Join(inputs.vars, ",") != "id" || strings.Join(inputs.headers, ",") != "X-Tenant" || len(inputs.fields) != 0 {
+		t.Errorf("Unexpected template inputs: %+v", inputs)
+	}
+	for _, text := range []string{`{{range .Query}}{{.}}{{end}}`, `{{json .}}`, `{{with .JSON}}{{.name}}{{end}}`} {
+		if readTemplateInputs([]string{text}).cacheable {
+			t.Errorf("Expected %s not to be cacheable", text)
+		}
+	}
+	if inputs := readTemplateInputs([]string{`{{.JSON.user.name}} {{.Query.Get "page"}}`}); !inputs.fields["JSON"] || strings.Join(inputs.query, ",") != "page" {
+		t.Errorf("Unexpected template inputs: %+v", inputs)
+	}
+
+	// Entries expire after the TTL
+	cache.put("a", []byte("a"))
+	if body, found := cache.get("a"); !found || string(body) != "a" {
+		t.Errorf("Expected a cached body, got %q", body)
+	}
+	cache.put("b", []byte("b"))
+	cache.put("c", []byte("c"))
+	if len(cache.entries) != 2 {
+		t.Errorf("Expected at most 2 entries, got %d", len(cache.entries))
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, found := cache.get("c"); found {
+		t.Error("Expected the entry to expire")
+	}
+
+	// Templates whose inputs can't be told are rendered every time
+	if body := call("POST", "/api/echo?b=1&a=2", ""); body != "ab" {
+		t.Errorf("Unexpected response: %s", body)
+	}
+	if body := call("POST", "/api/echo?c=1", ""); body != "c" {
+		t.Errorf("Expected the uncacheable template to be rendered again, got %s", body)
+	}
+
+	// An invalid setting is logged and the template rendered every time
+	if body := call("GET", "/api/invalid", ""); body != "/api/invalid" {
+		t.Errorf("Unexpected response: %s", body)
+	}
+	if _, err := newRenderCache(&TemplateCacheConfig{TTL: 0}); err == nil {
+		t.Error("Expected a missing ttl to be rejected")
+	}
+}
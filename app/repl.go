@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replHelp describes the REPL commands
+const replHelp = `Commands:
+  add METHOD PATH [STATUS] [BODY]   Add or replace an endpoint, e.g. add GET /api/foo 200 '{"ok":true}'
+  endpoints                         List endpoints added at runtime
+  routes                            List all active routes with their sources and hits
+  hits PATH                         Count requests to a path (glob patterns such as /api/* work)
+  plugins                           List plugins
+  toggle PLUGIN                     Enable or disable a plugin
+  reload                            Reload plugins from disk
+  help                              Show this help
+  exit                              Leave the REPL`
+
+// replClient sends REPL commands to the admin API of a running server
+type replClient struct {
+	baseURL string
+	token   string // admin token sent as a bearer token, if any
+	client  *http.Client
+	out     io.Writer
+}
+
+// adminTokenFlag defines the --token flag of the clients of the admin API,
+// which defaults to NMOCK_ADMIN_TOKEN, so the token stays out of the shell
+// history
+func adminTokenFlag(flags *flag.FlagSet) *string {
+	return flags.String("token", os.Getenv("NMOCK_ADMIN_TOKEN"), "Admin token of a server with admin_tokens (default: $NMOCK_ADMIN_TOKEN)")
+}
+
+// runREPL implements the repl command and returns the exit code
+func runREPL(args []string, in io.Reader, out io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	serverURL := flags.String("url", "http://localhost:9000", "URL of the running nmock server")
+	token := adminTokenFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	rc := &replClient{
+		baseURL: strings.TrimSuffix(*serverURL, "/"),
+		token:   *token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		out:     out,
+	}
+
+	fmt.Fprintf(out, "Connected to %s, type help for commands\n", rc.baseURL)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "nmock> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return 0
+		}
+
+		words, err := splitCommandLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			return 0
+		}
+		if err := rc.execute(words[0], words[1:]); err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+	}
+}
+
+// execute runs a single REPL command
+func (rc *replClient) execute(command string, args []string) error {
+	switch command {
+	case "help":
+		fmt.Fprintln(rc.out, replHelp)
+		return nil
+
+	case "add":
+		if len(args) < 2 || len(args) > 4 {
+			return fmt.Errorf("usage: add METHOD PATH [STATUS] [BODY]")
+		}
+		endpoint := Endpoint{Method: strings.ToUpper(args[0]), Path: args[1], StatusCode: http.StatusOK}
+		if len(args) > 2 {
+			status, err := strconv.Atoi(args[2])
+			if err != nil {
+				return fmt.Errorf("invalid status code %q", args[2])
+			}
+			endpoint.StatusCode = status
+		}
+		if len(args) > 3 {
+			endpoint.Response = parseResponse(args[3])
+		}
+		return rc.call("POST", "/_admin/endpoints", endpoint, nil)
+
+	case "endpoints":
+		var endpoints []Endpoint
+		if err := rc.call("GET", "/_admin/endpoints", nil, &endpoints); err != nil {
+			return err
+		}
+		if len(endpoints) == 0 {
+			fmt.Fprintln(rc.out, "No runtime endpoints")
+		}
+		for _, endpoint := range endpoints {
+			status := endpoint.StatusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			fmt.Fprintf(rc.out, "%-7s %s -> %d\n", endpoint.Method, endpoint.Path, status)
+		}
+		return nil
+
+	case "routes":
+		var routes []routeInfo
+		if err := rc.call("GET", "/_admin/routes", nil, &routes); err != nil {
+			return err
+		}
+		if len(routes) == 0 {
+			fmt.Fprintln(rc.out, "No routes")
+		}
+		for _, route := range routes {
+			fmt.Fprintf(rc.out, "%-7s %s [%s] %d hits\n", route.Method, route.Path, route.Source, route.Hits)
+		}
+		return nil
+
+	case "hits":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: hits PATH")
+		}
+		var buf bytes.Buffer
+		if err := rc.call("GET", "/_admin/requests/export?format=jsonl&path="+url.QueryEscape(args[0]), nil, &buf); err != nil {
+			return err
+		}
+
+		total := 0
+		byStatus := make(map[int]int)
+		decoder := json.NewDecoder(&buf)
+		for {
+			var record exportRecord
+			if err := decoder.Decode(&record); err != nil {
+				break
+			}
+			total++
+			byStatus[record.StatusCode]++
+		}
+
+		statuses := make([]int, 0, len(byStatus))
+		for status := range byStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		parts := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			parts = append(parts, fmt.Sprintf("%d: %d", status, byStatus[status]))
+		}
+
+		fmt.Fprintf(rc.out, "%d hits on %s", total, args[0])
+		if len(parts) > 0 {
+			fmt.Fprintf(rc.out, " (%s)", strings.Join(parts, ", "))
+		}
+		fmt.Fprintln(rc.out)
+		return nil
+
+	case "plugins":
+		var plugins map[string]*Plugin
+		if err := rc.call("GET", "/_admin/plugins", nil, &plugins); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(plugins))
+		for name := range plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			state := "disabled"
+			if plugins[name].Enabled {
+				state = "enabled"
+			}
+			fmt.Fprintf(rc.out, "%-24s %-8s %d endpoints\n", name, state, len(plugins[name].allEndpoints()))
+		}
+		return nil
+
+	case "toggle":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: toggle PLUGIN")
+		}
+		return rc.call("POST", "/_admin/plugins/"+url.PathEscape(args[0])+"/toggle", nil, nil)
+
+	case "reload":
+		return rc.call("POST", "/_admin/reload", nil, nil)
+
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", command)
+	}
+}
+
+// call sends a request to the admin API. The response is decoded into result,
+// copied into it if it is a buffer, or its message printed if result is nil.
+func (rc *replClient) call(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, rc.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("server not reachable: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var message struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if resp.StatusCode >= 400 {
+		if json.Unmarshal(data, &message) == nil && message.Error != "" {
+			return fmt.Errorf("%s", message.Error)
+		}
+		return fmt.Errorf("server responded with %s", resp.Status)
+	}
+
+	switch target := result.(type) {
+	case nil:
+		if json.Unmarshal(data, &message) == nil && message.Message != "" {
+			fmt.Fprintln(rc.out, message.Message)
+		}
+		return nil
+	case *bytes.Buffer:
+		target.Write(data)
+		return nil
+	default:
+		return json.Unmarshal(data, result)
+	}
+}
+
+// splitCommandLine splits a line into words, honoring single and double quotes
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	var quote rune
+	inWord := false
+
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
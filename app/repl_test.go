@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestREPL tests REPL commands against a running server
+func TestREPL(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	input := strings.Join([]string{
+		`add GET /api/foo 201 '{"ok": true}'`,
+		`endpoints`,
+		`routes`,
+		`hits /api/foo`,
+		`unknown`,
+		`add GET "/api/unterminated`,
+		`exit`,
+	}, "\n")
+
+	// toggle saves the plugin file, so it is tested separately via the admin API
+	var out bytes.Buffer
+	if code := runREPL([]string{"--url", ts.URL}, strings.NewReader(input), &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/api/foo")
+	if err != nil || resp.StatusCode != 201 {
+		t.Fatalf("Expected added endpoint to answer 201, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	output := out.String()
+	for _, expected := range []string{
+		"Endpoint GET /api/foo added",
+		"GET     /api/foo -> 201",
+		"GET     /api/foo [runtime] 0 hits",
+		"0 hits on /api/foo",
+		`Error: unknown command "unknown"`,
+		"Error: unterminated \" quote",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	out.Reset()
+	runREPL([]string{"--url", ts.URL}, strings.NewReader("hits /api/*\nplugins\n"), &out)
+	if !strings.Contains(out.String(), "1 hits on /api/* (201: 1)") || !strings.Contains(out.String(), "billing") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+// TestSplitCommandLine tests quoting in REPL commands
+func TestSplitCommandLine(t *testing.T) {
+	words, err := splitCommandLine(`add POST /api/x 200 '{"a": "b c"}' "it's"`)
+	expected := []string{"add", "POST", "/api/x", "200", `{"a": "b c"}`, "it's"}
+	if err != nil || strings.Join(words, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q (%v)", expected, words, err)
+	}
+}
+
+// TestREPLToken tests the REPL against a server with admin tokens
+func TestREPLToken(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:        "9000",
+		PluginsDir:  "plugins",
+		AdminTokens: []AdminToken{{Name: "ci", Token: "ci-91bc", Role: RoleOperator}},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	input := `add GET /api/foo 200 '{"ok": true}'` + "\n"
+	var out bytes.Buffer
+	runREPL([]string{"--url", ts.URL}, strings.NewReader(input), &out)
+	if !strings.Contains(out.String(), "Error: Admin token required") {
+		t.Errorf("Expected the request without a token to be rejected, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	runREPL([]string{"--url", ts.URL, "--token", "ci-91bc"}, strings.NewReader(input), &out)
+	if !strings.Contains(out.String(), "Endpoint GET /api/foo added") {
+		t.Errorf("Expected the endpoint to be added with the token, got:\n%s", out.String())
+	}
+
+	// The token is taken from NMOCK_ADMIN_TOKEN without --token
+	t.Setenv("NMOCK_ADMIN_TOKEN", "ci-91bc")
+	out.Reset()
+	runREPL([]string{"--url", ts.URL}, strings.NewReader("endpoints\n"), &out)
+	if strings.Contains(out.String(), "Error:") || !strings.Contains(out.String(), "/api/foo") {
+		t.Errorf("Expected the token from the environment to be sent, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// replayOptions control how recorded requests are sent and compared
+type replayOptions struct {
+	pace    string          // "none", "recorded" or a fixed interval such as 100ms
+	headers []string        // response headers compared in addition to the status and body
+	ignore  map[string]bool // JSON fields ignored at any depth, such as timestamps
+}
+
+// replayResult is the outcome of replaying one recorded request
+type replayResult struct {
+	index       int
+	method      string
+	path        string
+	differences []string
+	err         error
+}
+
+// skippedReplayHeaders are request headers that the client sets itself
+var skippedReplayHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Connection": true, "Accept-Encoding": true,
+	"Transfer-Encoding": true, "Keep-Alive": true, "Upgrade": true, "Te": true, "Trailer": true,
+}
+
+// runReplay implements the replay command and returns the exit code
+func runReplay(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := flags.String("from", "", "HAR file with the recorded requests, e.g. from /_admin/requests/export")
+	target := flags.String("target", ":9000", "Address or URL of the server to replay the requests against")
+	pace := flags.String("pace", "none", `Time between requests: "none", "recorded" or an interval such as 100ms`)
+	headers := flags.String("headers", "Content-Type", "Comma-separated response headers to compare")
+	ignore := flags.String("ignore", "", "Comma-separated JSON fields to ignore at any depth, such as timestamps")
+	timeout := flags.Duration("timeout", 30*time.Second, "Timeout of each request")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "replay: --from is required")
+		return 2
+	}
+	if *pace != "none" && *pace != "recorded" {
+		if interval, err := time.ParseDuration(*pace); err != nil || interval < 0 {
+			fmt.Fprintf(os.Stderr, "replay: invalid --pace %q, expected none, recorded or an interval\n", *pace)
+			return 2
+		}
+	}
+
+	entries, err := readHAR(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 2
+	}
+
+	options := replayOptions{pace: *pace, headers: splitList(*headers), ignore: make(map[string]bool)}
+	for _, field := range splitList(*ignore) {
+		options.ignore[field] = true
+	}
+
+	baseURL := benchURL(*target)
+	client := &http.Client{
+		Timeout: *timeout,
+		// Redirects are compared, not followed
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	fmt.Fprintf(stdout, "Replaying %d requests from %s against %s\n", len(entries), *from, baseURL)
+	matched, differed, failed := 0, 0, 0
+	for _, result := range replayEntries(client, baseURL, entries, options) {
+		switch {
+		case result.err != nil:
+			failed++
+			fmt.Fprintf(stdout, "#%d %s %s: %v\n", result.index, result.method, result.path, result.err)
+		case len(result.differences) > 0:
+			differed++
+			for _, difference := range result.differences {
+				fmt.Fprintf(stdout, "#%d %s %s: %s\n", result.index, result.method, result.path, difference)
+			}
+		default:
+			matched++
+		}
+	}
+	fmt.Fprintf(stdout, "Results:     %d matched, %d differed, %d errors\n", matched, differed, failed)
+
+	if differed > 0 || failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readHAR reads the entries of a HAR file
+func readHAR(path string) ([]harEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %v", path, err)
+	}
+	return har.Log.Entries, nil
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// replayEntries sends the recorded requests one after the other, paced as
+// requested, and compares the responses to the recorded ones
+func replayEntries(client *http.Client, baseURL string, entries []harEntry, options replayOptions) []replayResult {
+	results := make([]replayResult, 0, len(entries))
+	var previous time.Time
+	for i, entry := range entries {
+		if i > 0 {
+			time.Sleep(replayGap(options.pace, previous, entry))
+		}
+		previous, _ = time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+		results = append(results, replayEntry(client, baseURL, i+1, entry, options))
+	}
+	return results
+}
+
+// replayGap returns the time to wait before sending an entry
+func replayGap(pace string, previous time.Time, entry harEntry) time.Duration {
+	switch pace {
+	case "none":
+		return 0
+	case "recorded":
+		started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+		if err != nil || previous.IsZero() || started.Before(previous) {
+			return 0
+		}
+		return started.Sub(previous)
+	}
+	interval, _ := time.ParseDuration(pace)
+	return interval
+}
+
+// replayEntry sends one recorded request and compares the response
+func replayEntry(client *http.Client, baseURL string, index int, entry harEntry, options replayOptions) replayResult {
+	result := replayResult{index: index, method: entry.Request.Method}
+	recordedURL, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		result.err = fmt.Errorf("invalid recorded URL: %v", err)
+		return result
+	}
+	result.path = recordedURL.RequestURI()
+
+	var body io.Reader
+	if entry.Request.PostData != nil {
+		data, err := harDecode(entry.Request.PostData.Text, entry.Request.PostData.Encoding)
+		if err != nil {
+			result.err = fmt.Errorf("invalid recorded request body: %v", err)
+			return result
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(entry.Request.Method, baseURL+result.path, body)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	for _, header := range entry.Request.Headers {
+		if !skippedReplayHeaders[http.CanonicalHeaderKey(header.Name)] {
+			req.Header.Add(header.Name, header.Value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	actual, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		result.err = fmt.Errorf("failed to read response: %v", err)
+		return result
+	}
+
+	recorded, err := harDecode(entry.Response.Content.Text, entry.Response.Content.Encoding)
+	if err != nil {
+		result.err = fmt.Errorf("invalid recorded response body: %v", err)
+		return result
+	}
+
+	if resp.StatusCode != entry.Response.Status {
+		result.differences = append(result.differences, fmt.Sprintf("status %d, recorded %d", resp.StatusCode, entry.Response.Status))
+	}
+	recordedHeaders := make(http.Header)
+	for _, header := range entry.Response.Headers {
+		recordedHeaders.Add(header.Name, header.Value)
+	}
+	for _, name := range options.headers {
+		if got, want := resp.Header.Get(name), recordedHeaders.Get(name); got != want {
+			result.differences = append(result.differences, fmt.Sprintf("header %s %q, recorded %q", http.CanonicalHeaderKey(name), got, want))
+		}
+	}
+	if difference := compareBodies(actual, recorded, options.ignore); difference != "" {
+		result.differences = append(result.differences, difference)
+	}
+	return result
+}
+
+// harDecode returns the bytes of a HAR text, which may be base64 encoded
+func harDecode(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// compareBodies describes the first difference between two bodies, or
+// returns an empty string if they match. JSON bodies are compared by value.
+func compareBodies(actual, recorded []byte, ignore map[string]bool) string {
+	var actualJSON, recordedJSON interface{}
+	if json.Unmarshal(actual, &actualJSON) == nil && json.Unmarshal(recorded, &recordedJSON) == nil {
+		return compareJSON("$", actualJSON, recordedJSON, ignore)
+	}
+	if !bytes.Equal(actual, recorded) {
+		return fmt.Sprintf("body of %d bytes differs from the recorded %d bytes", len(actual), len(recorded))
+	}
+	return ""
+}
+
+// compareJSON describes the first difference between two decoded JSON
+// values at a path such as $.items[0].name
+func compareJSON(path string, actual, recorded interface{}, ignore map[string]bool) string {
+	switch recordedValue := recorded.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(recordedValue)+len(actualValue))
+		for key := range recordedValue {
+			keys = append(keys, key)
+		}
+		for key := range actualValue {
+			if _, exists := recordedValue[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ignore[key] {
+				continue
+			}
+			a, inActual := actualValue[key]
+			r, inRecorded := recordedValue[key]
+			switch {
+			case !inActual:
+				return fmt.Sprintf("body is missing %s.%s", path, key)
+			case !inRecorded:
+				return fmt.Sprintf("body has unexpected %s.%s", path, key)
+			}
+			if difference := compareJSON(path+"."+key, a, r, ignore); difference != "" {
+				return difference
+			}
+		}
+		return ""
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(actualValue) != len(recordedValue) {
+			return fmt.Sprintf("body has %d items at %s, recorded %d", len(actualValue), path, len(recordedValue))
+		}
+		for i := range recordedValue {
+			if difference := compareJSON(fmt.Sprintf("%s[%d]", path, i), actualValue[i], recordedValue[i], ignore); difference != "" {
+				return difference
+			}
+		}
+		return ""
+	}
+	if !reflect.DeepEqual(actual, recorded) {
+		actualJSON, _ := json.Marshal(actual)
+		recordedJSON, _ := json.Marshal(recorded)
+		return fmt.Sprintf("body has %s at %s, recorded %s", actualJSON, path, recordedJSON)
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReplay tests replaying recorded requests and reporting differences
+func TestReplay(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/api/users", Method: "GET", Response: []interface{}{map[string]interface{}{"id": 1, "name": "Alice", "updated_at": "2024-01-01"}}},
+		{Path: "/api/users", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 2}},
+		{Path: "/api/orders", Method: "GET", Response: []interface{}{}},
+	}}
+	server.SetupRoutes()
+
+	// Record requests and export them as HAR
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users?active=true", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"name": "Bob"}`)))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/orders", nil))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/requests/export?format=har", nil))
+	harPath := filepath.Join(t.TempDir(), "snapshot.har")
+	if err := os.WriteFile(harPath, w.Body.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write HAR file: %v", err)
+	}
+
+	// The target changed a name, a timestamp and the status of an endpoint
+	target := NewMockServer("")
+	target.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/api/users", Method: "GET", Response: []interface{}{map[string]interface{}{"id": 1, "name": "Alicia", "updated_at": "2024-02-01"}}},
+		{Path: "/api/users", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 2}},
+		{Path: "/api/orders", Method: "GET", StatusCode: 500, Response: []interface{}{}},
+	}}
+	target.SetupRoutes()
+	ts := httptest.NewServer(target)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	code := runReplay([]string{"--from", harPath, "--target", ts.URL, "--ignore", "updated_at", "--pace", "1ms"}, &out)
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	for _, expected := range []string{
+		"Replaying 3 requests",
+		`#1 GET /api/users?active=true: body has "Alicia" at $[0].name, recorded "Alice"`,
+		"#3 GET /api/orders: status 500, recorded 200",
+		"Results:     1 matched, 2 differed, 0 errors",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "updated_at") {
+		t.Errorf("Expected ignored fields not to be compared:\n%s", out.String())
+	}
+
+	// The POST body was replayed
+	if entries := target.history.list(); len(entries) != 3 || string(entries[1].RequestBody) != `{"name": "Bob"}` {
+		t.Errorf("Expected the recorded request body to be replayed, got %+v", entries)
+	}
+}
+
+// TestCompareJSON tests describing differences between JSON values
+func TestCompareJSON(t *testing.T) {
+	tests := []struct {
+		actual, recorded string
+		expected         string
+	}{
+		{`{"a": 1, "b": [1, 2]}`, `{"b": [1, 2], "a": 1}`, ""},
+		{`{"a": 1}`, `{"a": 1, "b": 2}`, "body is missing $.b"},
+		{`{"a": 1, "c": 3}`, `{"a": 1}`, "body has unexpected $.c"},
+		{`[1, 2, 3]`, `[1, 2]`, "body has 3 items at $, recorded 2"},
+		{`{"a": {"b": "x"}}`, `{"a": {"b": "y"}}`, `body has "x" at $.a.b, recorded "y"`},
+		{`plain`, `text`, "body of 5 bytes differs from the recorded 4 bytes"},
+	}
+	for _, test := range tests {
+		if difference := compareBodies([]byte(test.actual), []byte(test.recorded), nil); difference != test.expected {
+			t.Errorf("%s vs %s: expected %q, got %q", test.actual, test.recorded, test.expected, difference)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/gorilla/mux"
+)
+
+// requestData is the data made available to template expressions
+type requestData struct {
+	Method     string
+	Path       string
+	IP         string
+	Headers    http.Header
+	Query      url.Values
+	Vars       map[string]string // path variables
+	PathParams map[string]string // path variables, as Vars
+	BaseURL    string            // scheme and host used by the client, e.g. http://localhost:8080
+	URL        string            // absolute URL of the request
+
+	request *http.Request
+}
+
+// newRequestData collects template data from an incoming request
+func newRequestData(r *http.Request) requestData {
+	vars := mux.Vars(r)
+	return requestData{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		IP:         clientIP(r),
+		Headers:    r.Header,
+		Query:      r.URL.Query(),
+		Vars:       vars,
+		PathParams: vars,
+		BaseURL:    requestBaseURL(r),
+		URL:        requestBaseURL(r) + r.URL.RequestURI(),
+		request:    r,
+	}
+}
+
+// clientIP returns the IP address of the client without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keyFunc extracts a key from a request
+type keyFunc func(r *http.Request) string
+
+// compileKey compiles a key specification into a keyFunc.
+// Supported forms are "ip", "header:<name>", "query:<name>", "path:<name>",
+// "body:<field>", "xpath:<expression>" and template expressions such as
+// "{{.Headers.Get \"X-Tenant\"}}-{{.IP}}".
+func compileKey(spec string) (keyFunc, error) {
+	switch {
+	case spec == "" || spec == "ip":
+		return clientIP, nil
+	case strings.HasPrefix(spec, "header:"):
+		name := strings.TrimSpace(strings.TrimPrefix(spec, "header:"))
+		return func(r *http.Request) string { return r.Header.Get(name) }, nil
+	case strings.HasPrefix(spec, "query:"):
+		name := strings.TrimSpace(strings.TrimPrefix(spec, "query:"))
+		return func(r *http.Request) string { return r.URL.Query().Get(name) }, nil
+	case strings.HasPrefix(spec, "path:"):
+		name := strings.TrimSpace(strings.TrimPrefix(spec, "path:"))
+		return func(r *http.Request) string { return mux.Vars(r)[name] }, nil
+	case strings.HasPrefix(spec, "body:"):
+		field := strings.TrimSpace(strings.TrimPrefix(spec, "body:"))
+		return func(r *http.Request) string { return bodyField(r, field) }, nil
+	case strings.HasPrefix(spec, "xpath:"):
+		x, err := compileXPath(strings.TrimPrefix(spec, "xpath:"))
+		if err != nil {
+			return nil, err
+		}
+		return func(r *http.Request) string { return bodyXPath(r, x) }, nil
+	case strings.Contains(spec, "{{"):
+		tmpl, err := template.New("key").Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key template: %v", err)
+		}
+		return func(r *http.Request) string {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, newRequestData(r)); err != nil {
+				return ""
+			}
+			return buf.String()
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key %q", spec)
+}
+
+// bodyField returns a field of a JSON request body, with dots separating
+// the names of nested fields (e.g. "user.id"). The body stays readable.
+func bodyField(r *http.Request, field string) string {
+	data, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return ""
+	}
+	for _, name := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
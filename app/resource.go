@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Resource is a REST collection whose items are kept in memory, so that
+// created items can be read, updated and deleted again
+type Resource struct {
+	Name    string                   `json:"name"`
+	Path    string                   `json:"path"`               // collection path, e.g. /api/users
+	IDField string                   `json:"id_field,omitempty"` // default: id
+	Seed    []map[string]interface{} `json:"seed,omitempty"`     // items present on startup and after a reset
+	Parent  *ResourceParent          `json:"parent,omitempty"`
+	Format  string                   `json:"format,omitempty"` // "jsonapi" for JSON:API documents, default: plain JSON
+
+	RequireIfMatch bool `json:"require_if_match,omitempty"` // reject changes of items without If-Match with 428
+
+	SoftDelete   bool   `json:"soft_delete,omitempty"`   // DELETE marks items as deleted instead of removing them
+	DeletedField string `json:"deleted_field,omitempty"` // field holding the deletion time of soft-deleted items (default: deleted_at)
+
+	Bulk      bool `json:"bulk,omitempty"`       // create, update and delete several items with an array body on the collection path
+	BulkLimit int  `json:"bulk_limit,omitempty"` // maximum items of a bulk request (default: unlimited)
+}
+
+// ResourceParent links the items of a resource to the items of another
+// resource. Children are listed and created under the parent's item path,
+// e.g. /api/users/{id}/orders, and deleted with their parent.
+type ResourceParent struct {
+	Resource string `json:"resource"` // name of the parent resource
+	Field    string `json:"field"`    // field of the children holding the parent id, e.g. user_id
+}
+
+// resourceItem is a stored item of a resource
+type resourceItem = map[string]interface{}
+
+// collection holds the items of a resource in creation order
+type collection struct {
+	config Resource
+	items  []resourceItem
+	nextID int
+}
+
+// resourceStore holds the items of all resources
+type resourceStore struct {
+	mutex       sync.Mutex
+	collections map[string]*collection
+	order       []string
+}
+
+// newResourceStore creates a store without resources
+func newResourceStore() *resourceStore {
+	return &resourceStore{collections: make(map[string]*collection)}
+}
+
+// idField returns the field holding the ids of a resource's items
+func (r Resource) idField() string {
+	if r.IDField == "" {
+		return "id"
+	}
+	return r.IDField
+}
+
+// itemID converts an id value to the string used to compare ids
+func itemID(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// validateResources checks names, paths and parent links of resources
+func validateResources(resources []Resource) error {
+	byName := make(map[string]Resource, len(resources))
+	for i, resource := range resources {
+		if resource.Name == "" || resource.Path == "" {
+			return fmt.Errorf("invalid resource %d: name and path are required", i)
+		}
+		if !strings.HasPrefix(resource.Path, "/") || strings.Contains(resource.Path, "{") {
+			return fmt.Errorf("invalid resource %s: path must start with a slash and can't contain variables", resource.Name)
+		}
+		if resource.Format != "" && resource.Format != "jsonapi" {
+			return fmt.Errorf("invalid resource %s: unknown format %q", resource.Name, resource.Format)
+		}
+		if resource.SoftDelete && resource.deletedField() == resource.idField() {
+			return fmt.Errorf("invalid resource %s: deleted_field can't be the id field", resource.Name)
+		}
+		if resource.Bulk && (resource.Format == "jsonapi" || resource.RequireIfMatch) {
+			return fmt.Errorf("invalid resource %s: bulk can't be combined with the jsonapi format or require_if_match", resource.Name)
+		}
+		if resource.BulkLimit < 0 {
+			return fmt.Errorf("invalid resource %s: bulk_limit must not be negative", resource.Name)
+		}
+		if _, exists := byName[resource.Name]; exists {
+			return fmt.Errorf("duplicate resource %s", resource.Name)
+		}
+		byName[resource.Name] = resource
+	}
+
+	for _, resource := range resources {
+		seen := map[string]bool{resource.Name: true}
+		for current := resource; current.Parent != nil; {
+			parent, exists := byName[current.Parent.Resource]
+			if !exists {
+				return fmt.Errorf("invalid resource %s: unknown parent resource %q", current.Name, current.Parent.Resource)
+			}
+			if current.Parent.Field == "" {
+				return fmt.Errorf("invalid resource %s: parent field is required", current.Name)
+			}
+			if seen[parent.Name] {
+				return fmt.Errorf("invalid resource %s: parent resources form a cycle", resource.Name)
+			}
+			seen[parent.Name] = true
+			current = parent
+		}
+	}
+	return nil
+}
+
+// configure replaces the resource definitions. Items of resources that
+// still exist are kept, so that a config reload doesn't lose them; new
+// resources start with their seed items.
+func (rs *resourceStore) configure(resources []Resource) error {
+	if err := validateResources(resources); err != nil {
+		return err
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	collections := make(map[string]*collection, len(resources))
+	rs.order = rs.order[:0]
+	for _, resource := range resources {
+		if existing, exists := rs.collections[resource.Name]; exists {
+			existing.config = resource
+			collections[resource.Name] = existing
+		} else {
+			collections[resource.Name] = newCollection(resource)
+		}
+		rs.order = append(rs.order, resource.Name)
+	}
+	rs.collections = collections
+	return nil
+}
+
+// newCollection creates a collection holding copies of the seed items
+func newCollection(resource Resource) *collection {
+	c := &collection{config: resource, nextID: 1}
+	for _, item := range resource.Seed {
+		c.insert(copyItem(item))
+	}
+	return c
+}
+
+// copyItem returns a shallow copy of an item
+func copyItem(item resourceItem) resourceItem {
+	copied := make(resourceItem, len(item))
+	for key, value := range item {
+		copied[key] = value
+	}
+	return copied
+}
+
+// insert adds an item, assigning the next numeric id if it has none. It
+// returns false if an item with the same id exists.
+func (c *collection) insert(item resourceItem) bool {
+	field := c.config.idField()
+	if itemID(item[field]) == "" {
+		item[field] = c.nextID
+	} else if c.find(itemID(item[field])) >= 0 {
+		return false
+	}
+	if id, err := strconv.Atoi(itemID(item[field])); err == nil && id >= c.nextID {
+		c.nextID = id + 1
+	}
+	c.items = append(c.items, item)
+	return true
+}
+
+// find returns the index of the item with an id, or -1
+func (c *collection) find(id string) int {
+	field := c.config.idField()
+	for i, item := range c.items {
+		if itemID(item[field]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// children returns the items whose parent field holds an id
+func (c *collection) children(parentID string) []resourceItem {
+	children := []resourceItem{}
+	for _, item := range c.items {
+		if itemID(item[c.config.Parent.Field]) == parentID {
+			children = append(children, item)
+		}
+	}
+	return children
+}
+
+// remove deletes the item at an index and, recursively, its children in
+// other resources. It must be called with the store mutex held.
+func (rs *resourceStore) remove(c *collection, index int) {
+	id := itemID(c.items[index][c.config.idField()])
+	c.items = append(c.items[:index], c.items[index+1:]...)
+
+	for _, child := range rs.childCollections(c) {
+		for i := len(child.items) - 1; i >= 0; i-- {
+			if itemID(child.items[i][child.config.Parent.Field]) == id {
+				rs.remove(child, i)
+			}
+		}
+	}
+}
+
+// hasParent reports whether the parent of an item exists. Items without a
+// parent resource or without a parent id are always accepted. It must be
+// called with the store mutex held.
+func (rs *resourceStore) hasParent(c *collection, item resourceItem) bool {
+	if c.config.Parent == nil {
+		return true
+	}
+	parentID := itemID(item[c.config.Parent.Field])
+	if parentID == "" {
+		return true
+	}
+	return rs.collections[c.config.Parent.Resource].findVisible(parentID, false) >= 0
+}
+
+// update replaces the fields of the item at an index, or merges them into
+// it. The id can't be changed. It returns false if the parent of the
+// changed item doesn't exist. It must be called with the store mutex held.
+func (rs *resourceStore) update(c *collection, index int, changes resourceItem, merge bool) (resourceItem, bool) {
+	item := changes
+	if merge {
+		item = copyItem(c.items[index])
+		for key, value := range changes {
+			item[key] = value
+		}
+	}
+	item[c.config.idField()] = c.items[index][c.config.idField()]
+	if !rs.hasParent(c, item) {
+		return nil, false
+	}
+	c.items[index] = item
+	return item, true
+}
+
+// reset replaces the items of all resources by their seed items
+func (rs *resourceStore) reset() {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for name, c := range rs.collections {
+		rs.collections[name] = newCollection(c.config)
+	}
+}
+
+// snapshot returns copies of the items of all resources
+func (rs *resourceStore) snapshot() map[string][]resourceItem {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	result := make(map[string][]resourceItem, len(rs.collections))
+	for name, c := range rs.collections {
+		items := make([]resourceItem, 0, len(c.items))
+		for _, item := range c.items {
+			items = append(items, copyItem(item))
+		}
+		result[name] = items
+	}
+	return result
+}
+
+// restore replaces the items of the resources present in a snapshot
+func (rs *resourceStore) restore(items map[string][]resourceItem) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for name, stored := range items {
+		c, exists := rs.collections[name]
+		if !exists {
+			continue
+		}
+		c.items, c.nextID = nil, 1
+		for _, item := range stored {
+			c.insert(item)
+		}
+	}
+}
+
+// writeResourceJSON writes a JSON response for a resource request
+func writeResourceJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error response for a resource request
+func (c *collection) writeError(w http.ResponseWriter, status int, message string) {
+	if c.config.Format == "jsonapi" {
+		writeJSONAPI(w, status, map[string]interface{}{
+			"errors": []map[string]string{{"status": strconv.Itoa(status), "title": message}},
+		})
+		return
+	}
+	writeResourceJSON(w, status, map[string]string{"error": message})
+}
+
+// writeItem writes a single item to the buffered response of a request.
+// It must be called with the store mutex held.
+func (rs *resourceStore) writeItem(w http.ResponseWriter, r *http.Request, c *collection, status int, item resourceItem) {
+	w.Header().Set("ETag", itemETag(item))
+	if c.config.Format == "jsonapi" {
+		writeJSONAPI(w, status, rs.jsonAPIDocument(r, c, item))
+		return
+	}
+	writeResourceJSON(w, status, item)
+}
+
+// writeItems writes a list of items to the buffered response of a request,
+// applying its OData query options. It must be called with the store mutex
+// held.
+func (rs *resourceStore) writeItems(w http.ResponseWriter, r *http.Request, c *collection, items []resourceItem) int {
+	options, err := parseQueryOptions(r.URL.Query())
+	if err != nil {
+		c.writeError(w, http.StatusBadRequest, err.Error())
+		return http.StatusBadRequest
+	}
+	if options != nil {
+		items = options.apply(items)
+	}
+	if c.config.Format == "jsonapi" {
+		return rs.writeJSONAPIList(w, r, c, items)
+	}
+	writeResourceJSON(w, http.StatusOK, append([]resourceItem{}, items...))
+	return http.StatusOK
+}
+
+// decode reads an item from a request body
+func (res Resource) decode(r *http.Request) (resourceItem, error) {
+	if res.Format == "jsonapi" {
+		return res.decodeJSONAPI(r)
+	}
+	var item resourceItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %v", err)
+	}
+	if item == nil {
+		return nil, fmt.Errorf("invalid JSON object: null")
+	}
+	return item, nil
+}
+
+// resourceBody is the body of a resource request, read before the store
+// mutex is taken, so that slow clients don't hold up other requests
+type resourceBody struct {
+	item    resourceItem      // a single item
+	entries []json.RawMessage // the entries of a bulk request
+	bulk    bool
+	err     error
+}
+
+// readItem reads a single item from a request body
+func (res Resource) readItem(r *http.Request) resourceBody {
+	item, err := res.decode(r)
+	return resourceBody{item: item, err: err}
+}
+
+// readItems reads a single item, or the entries of a bulk request if the
+// resource accepts them
+func (res Resource) readItems(r *http.Request) resourceBody {
+	if res.Bulk {
+		entries, bulk, err := readBulk(r)
+		if err != nil || bulk {
+			return resourceBody{entries: entries, bulk: bulk, err: err}
+		}
+	}
+	return res.readItem(r)
+}
+
+// readBulkOnly reads the entries of a bulk request, which must be an array
+func (res Resource) readBulkOnly(r *http.Request) resourceBody {
+	entries, bulk, err := readBulk(r)
+	if err == nil && !bulk {
+		err = fmt.Errorf("expected a JSON array")
+	}
+	return resourceBody{entries: entries, bulk: bulk, err: err}
+}
+
+// bufferedResponse holds a response written with the store mutex held, so
+// that it is sent to the client after the mutex is released
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (br *bufferedResponse) WriteHeader(status int) {
+	if br.status == 0 {
+		br.status = status
+	}
+}
+
+// Write implements http.ResponseWriter
+func (br *bufferedResponse) Write(data []byte) (int, error) {
+	br.WriteHeader(http.StatusOK)
+	return br.body.Write(data)
+}
+
+// send writes the buffered response to the client
+func (br *bufferedResponse) send(w http.ResponseWriter) {
+	for name, values := range br.header {
+		w.Header()[name] = values
+	}
+	if br.status != 0 {
+		w.WriteHeader(br.status)
+	}
+	w.Write(br.body.Bytes())
+}
+
+// resourceRoutes builds the routes of the configured resources
+func (ms *MockServer) resourceRoutes() []*endpointRoute {
+	ms.resources.mutex.Lock()
+	names := append([]string{}, ms.resources.order...)
+	configs := make(map[string]Resource, len(names))
+	for _, name := range names {
+		configs[name] = ms.resources.collections[name].config
+	}
+	ms.resources.mutex.Unlock()
+
+	var routes []*endpointRoute
+	// Requests with a body read it before taking the store mutex, which is
+	// held only while the data is read or changed. The response is built
+	// meanwhile and sent after the mutex is released.
+	type handleFunc func(w http.ResponseWriter, r *http.Request, c *collection, body resourceBody) int
+	add := func(method, routePath, name string, read func(r *http.Request) resourceBody, handle handleFunc) {
+		source := "resource " + name
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if info := requestInfoFrom(r); info != nil {
+				info.Route = method + " " + routePath
+				info.Source = source
+			}
+
+			var body resourceBody
+			if read != nil {
+				body = read(r)
+			}
+
+			response := &bufferedResponse{header: make(http.Header)}
+			ms.resources.mutex.Lock()
+			c, exists := ms.resources.collections[name]
+			var status int
+			if exists {
+				status = handle(response, r, c, body)
+			} else {
+				status = http.StatusNotFound
+				writeResourceJSON(response, status, map[string]string{"error": "Resource not found"})
+			}
+			ms.resources.mutex.Unlock()
+			response.send(w)
+
+			log.Printf("%s %s - %d [%s]", r.Method, r.URL.Path, status, source)
+		})
+		route, err := newEndpointRoute(method, routePath, handler)
+		if err != nil {
+			log.Printf("Invalid path for %s %s [%s]: %v", method, routePath, source, err)
+			return
+		}
+		route.source = source
+		routes = append(routes, route)
+	}
+
+	for _, name := range names {
+		config := configs[name]
+		itemPath := strings.TrimSuffix(config.Path, "/") + "/{id}"
+
+		add("GET", config.Path, name, nil, func(w http.ResponseWriter, r *http.Request, c *collection, _ resourceBody) int {
+			return ms.resources.writeItems(w, r, c, c.visible(c.items, includeDeleted(r)))
+		})
+
+		add("POST", config.Path, name, config.readItems, func(w http.ResponseWriter, r *http.Request, c *collection, body resourceBody) int {
+			if body.err != nil {
+				c.writeError(w, http.StatusBadRequest, body.err.Error())
+				return http.StatusBadRequest
+			}
+			if body.bulk {
+				return ms.resources.bulkCreate(w, c, body.entries)
+			}
+			return ms.createItem(w, r, c, body.item, itemPath)
+		})
+
+		// Bulk changes with an array of items or ids
+		if config.Bulk {
+			for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+				add(method, config.Path, name, config.readBulkOnly, func(w http.ResponseWriter, r *http.Request, c *collection, body resourceBody) int {
+					if body.err != nil {
+						c.writeError(w, http.StatusBadRequest, body.err.Error())
+						return http.StatusBadRequest
+					}
+					if r.Method == "DELETE" {
+						return ms.resources.bulkDelete(w, c, body.entries, r.URL.Query().Get("permanent") == "true")
+					}
+					return ms.resources.bulkUpdate(w, c, body.entries, r.Method == "PATCH")
+				})
+			}
+		}
+
+		add("GET", itemPath, name, nil, func(w http.ResponseWriter, r *http.Request, c *collection, _ resourceBody) int {
+			i := c.findVisible(mux.Vars(r)["id"], includeDeleted(r))
+			if i < 0 {
+				c.writeError(w, http.StatusNotFound, "Item not found")
+				return http.StatusNotFound
+			}
+			etag := itemETag(c.items[i])
+			if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+				w.Header().Set("ETag", etag)
+				w.WriteHeader(http.StatusNotModified)
+				return http.StatusNotModified
+			}
+			ms.resources.writeItem(w, r, c, http.StatusOK, c.items[i])
+			return http.StatusOK
+		})
+
+		for _, method := range []string{"PUT", "PATCH"} {
+			add(method, itemPath, name, config.readItem, func(w http.ResponseWriter, r *http.Request, c *collection, body resourceBody) int {
+				i := c.findVisible(mux.Vars(r)["id"], false)
+				if i < 0 {
+					c.writeError(w, http.StatusNotFound, "Item not found")
+					return http.StatusNotFound
+				}
+				if status := c.checkPreconditions(w, r, c.items[i]); status != 0 {
+					return status
+				}
+				if body.err != nil {
+					c.writeError(w, http.StatusBadRequest, body.err.Error())
+					return http.StatusBadRequest
+				}
+
+				item, ok := ms.resources.update(c, i, body.item, r.Method == "PATCH")
+				if !ok {
+					c.writeError(w, http.StatusUnprocessableEntity, "Parent item not found")
+					return http.StatusUnprocessableEntity
+				}
+				ms.resources.writeItem(w, r, c, http.StatusOK, item)
+				return http.StatusOK
+			})
+		}
+
+		// Soft-deleted items can still be deleted permanently
+		add("DELETE", itemPath, name, nil, func(w http.ResponseWriter, r *http.Request, c *collection, _ resourceBody) int {
+			permanent := r.URL.Query().Get("permanent") == "true"
+			i := c.findVisible(mux.Vars(r)["id"], permanent)
+			if i < 0 {
+				c.writeError(w, http.StatusNotFound, "Item not found")
+				return http.StatusNotFound
+			}
+			if status := c.checkPreconditions(w, r, c.items[i]); status != 0 {
+				return status
+			}
+			if c.config.SoftDelete && !permanent {
+				c.softDelete(i)
+			} else {
+				ms.resources.remove(c, i)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return http.StatusNoContent
+		})
+
+		if config.SoftDelete {
+			add("POST", itemPath+"/restore", name, nil, func(w http.ResponseWriter, r *http.Request, c *collection, _ resourceBody) int {
+				i := c.find(mux.Vars(r)["id"])
+				if i < 0 {
+					c.writeError(w, http.StatusNotFound, "Item not found")
+					return http.StatusNotFound
+				}
+				if !c.isDeleted(c.items[i]) {
+					c.writeError(w, http.StatusConflict, "Item is not deleted")
+					return http.StatusConflict
+				}
+				if status := c.checkPreconditions(w, r, c.items[i]); status != 0 {
+					return status
+				}
+				ms.resources.writeItem(w, r, c, http.StatusOK, c.restore(i))
+				return http.StatusOK
+			})
+		}
+
+		// Children listed and created under the items of the parent
+		if config.Parent == nil {
+			continue
+		}
+		parent := configs[config.Parent.Resource]
+		nestedPath := strings.TrimSuffix(parent.Path, "/") + "/{parent_id}/" + path.Base(config.Path)
+
+		add("GET", nestedPath, name, nil, func(w http.ResponseWriter, r *http.Request, c *collection, _ resourceBody) int {
+			parentID := mux.Vars(r)["parent_id"]
+			if ms.resources.collections[c.config.Parent.Resource].findVisible(parentID, false) < 0 {
+				c.writeError(w, http.StatusNotFound, "Parent item not found")
+				return http.StatusNotFound
+			}
+			return ms.resources.writeItems(w, r, c, c.visible(c.children(parentID), includeDeleted(r)))
+		})
+
+		add("POST", nestedPath, name, config.readItem, func(w http.ResponseWriter, r *http.Request, c *collection, body resourceBody) int {
+			parents := ms.resources.collections[c.config.Parent.Resource]
+			i := parents.findVisible(mux.Vars(r)["parent_id"], false)
+			if i < 0 {
+				c.writeError(w, http.StatusNotFound, "Parent item not found")
+				return http.StatusNotFound
+			}
+			if body.err != nil {
+				c.writeError(w, http.StatusBadRequest, body.err.Error())
+				return http.StatusBadRequest
+			}
+			item := body.item
+			item[c.config.Parent.Field] = parents.items[i][parents.config.idField()]
+			return ms.createItem(w, r, c, item, itemPath)
+		})
+	}
+	return routes
+}
+
+// createItem stores a new item and writes the buffered response. It must
+// be called with the store mutex held.
+func (ms *MockServer) createItem(w http.ResponseWriter, r *http.Request, c *collection, item resourceItem, itemPath string) int {
+	if !ms.resources.hasParent(c, item) {
+		c.writeError(w, http.StatusUnprocessableEntity, "Parent item not found")
+		return http.StatusUnprocessableEntity
+	}
+	if !c.insert(item) {
+		c.writeError(w, http.StatusConflict, "Item already exists")
+		return http.StatusConflict
+	}
+	w.Header().Set("Location", strings.Replace(itemPath, "{id}", itemID(item[c.config.idField()]), 1))
+	ms.resources.writeItem(w, r, c, http.StatusCreated, item)
+	return http.StatusCreated
+}
+
+// setupResourcesAPI registers the resources admin API
+func (ms *MockServer) setupResourcesAPI() {
+	// Number of items per resource
+	ms.router.HandleFunc("/_admin/resources", func(w http.ResponseWriter, r *http.Request) {
+		counts := make(map[string]int)
+		for name, items := range ms.resources.snapshot() {
+			counts[name] = len(items)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(counts)
+	}).Methods("GET")
+
+	// Restore the seed items of all resources
+	ms.router.HandleFunc("/_admin/resources/reset", func(w http.ResponseWriter, r *http.Request) {
+		ms.resources.reset()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Resources reset"})
+		log.Println("Resources reset via admin API")
+	}).Methods("POST")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResources tests CRUD on resources and parent/child relations
+func TestResources(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	err := server.resources.configure([]Resource{
+		{Name: "users", Path: "/api/users", Seed: []map[string]interface{}{{"id": float64(1), "name": "Alice"}}},
+		{Name: "orders", Path: "/api/orders", Parent: &ResourceParent{Resource: "users", Field: "user_id"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) (int, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	expect := func(method, path, body string, status int, response string) {
+		t.Helper()
+		if code, got := call(method, path, body); code != status || (response != "" && got != response) {
+			t.Errorf("Expected %s %s to respond %d %s, got %d %s", method, path, status, response, code, got)
+		}
+	}
+
+	expect("POST", "/api/users", `{"name": "Bob"}`, 201, `{"id":2,"name":"Bob"}`)
+	expect("POST", "/api/users", `{"id": 2, "name": "Bobby"}`, 409, "")
+	expect("GET", "/api/users/2", "", 200, `{"id":2,"name":"Bob"}`)
+	expect("PATCH", "/api/users/2", `{"email": "bob@example.com"}`, 200, `{"email":"bob@example.com","id":2,"name":"Bob"}`)
+	expect("PUT", "/api/users/2", `{"id": 5, "name": "Robert"}`, 200, `{"id":2,"name":"Robert"}`)
+	expect("GET", "/api/users/3", "", 404, "")
+
+	// Children are created under their parent and filtered by it
+	expect("POST", "/api/users/1/orders", `{"total": 10}`, 201, `{"id":1,"total":10,"user_id":1}`)
+	expect("POST", "/api/users/2/orders", `{"total": 20}`, 201, `{"id":2,"total":20,"user_id":2}`)
+	expect("POST", "/api/orders", `{"total": 30, "user_id": 2}`, 201, "")
+	expect("POST", "/api/orders", `{"total": 40, "user_id": 9}`, 422, "")
+	expect("POST", "/api/users/9/orders", `{"total": 50}`, 404, "")
+	expect("GET", "/api/users/2/orders", "", 200, `[{"id":2,"total":20,"user_id":2},{"id":3,"total":30,"user_id":2}]`)
+	expect("GET", "/api/users/9/orders", "", 404, "")
+
+	// Deleting a parent deletes its children
+	expect("DELETE", "/api/users/2", "", 204, "")
+	expect("GET", "/api/orders", "", 200, `[{"id":1,"total":10,"user_id":1}]`)
+
+	// The state can be saved and restored
+	state := server.captureState()
+	expect("POST", "/_admin/resources/reset", "", 200, "")
+	expect("GET", "/api/orders", "", 200, `[]`)
+	data, _ := json.Marshal(state)
+	var restored runtimeState
+	json.Unmarshal(data, &restored)
+	server.resources.restore(restored.Resources)
+	expect("GET", "/api/orders/1", "", 200, `{"id":1,"total":10,"user_id":1}`)
+	expect("POST", "/api/users", `{"name": "Carol"}`, 201, `{"id":2,"name":"Carol"}`)
+
+	for _, resources := range [][]Resource{
+		{{Name: "users", Path: "/api/users/{id}"}},
+		{{Name: "users", Path: "/api/users", Format: "xml"}},
+		{{Name: "orders", Path: "/api/orders", Parent: &ResourceParent{Resource: "users", Field: "user_id"}}},
+		{{Name: "a", Path: "/a", Parent: &ResourceParent{Resource: "b", Field: "b_id"}}, {Name: "b", Path: "/b", Parent: &ResourceParent{Resource: "a", Field: "a_id"}}},
+	} {
+		if err := validateResources(resources); err == nil {
+			t.Errorf("Expected an error for %+v", resources)
+		}
+	}
+}
+
+// TestResourceSlowClient tests that a client sending its body slowly
+// doesn't hold up requests to the resources meanwhile
+func TestResourceSlowClient(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	if err := server.resources.configure([]Resource{{Name: "users", Path: "/api/users"}}); err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	body, writer := io.Pipe()
+	r := httptest.NewRequest("POST", "/api/users", body)
+	r.Header.Set("Expect", "100-continue")
+	created := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		created <- w.Code
+	}()
+	writer.Write([]byte(`{"name": `))
+
+	listed := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		listed <- w.Code
+	}()
+	select {
+	case code := <-listed:
+		if code != 200 {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the list not to wait for the slow client")
+	}
+
+	writer.Write([]byte(`"Alice"}`))
+	writer.Close()
+	if code := <-created; code != 201 {
+		t.Errorf("Expected status 201, got %d", code)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// routeHits counts the requests answered by each route. Counts are kept by
+// source, method and path, so they survive reloads.
+type routeHits struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// newRouteHits creates empty hit counters
+func newRouteHits() *routeHits {
+	return &routeHits{counts: make(map[string]int64)}
+}
+
+// add counts a request answered by a route given as "METHOD /path"
+func (h *routeHits) add(source, route string) {
+	if route == "" {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[source+" "+route]++
+}
+
+// get returns the number of requests answered by a route
+func (h *routeHits) get(source, route string) int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.counts[source+" "+route]
+}
+
+// routeInfo describes an active route
+type routeInfo struct {
+	ID       string            `json:"id"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Matchers map[string]string `json:"matchers,omitempty"` // patterns of the path variables
+	Source   string            `json:"source"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Hits     int64             `json:"hits"`
+}
+
+// pathMatchers returns the patterns of the variables of a path template;
+// variables without a pattern match a single segment
+func pathMatchers(path string) map[string]string {
+	variables := pathVariable.FindAllString(path, -1)
+	if len(variables) == 0 {
+		return nil
+	}
+	matchers := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		name, pattern, found := strings.Cut(variable[1:len(variable)-1], ":")
+		if !found {
+			pattern = "[^/]+"
+		}
+		matchers[name] = pattern
+	}
+	return matchers
+}
+
+// listRoutes returns the active routes in matching order, only those with a
+// tag if one is given
+func (ms *MockServer) listRoutes(tag string) []routeInfo {
+	routes := []routeInfo{}
+	ms.routes.snapshot.Load().each(func(route *endpointRoute) bool {
+		if tag != "" && !matchTag(route.tags, tag) {
+			return true
+		}
+		routes = append(routes, routeInfo{
+			ID:       route.id,
+			Method:   route.method,
+			Path:     route.path,
+			Matchers: pathMatchers(route.path),
+			Source:   route.source,
+			Tags:     route.tags,
+			Hits:     ms.routeHits.get(route.source, route.key()),
+		})
+		return true
+	})
+	return routes
+}
+
+// setupRoutesAPI registers the routing table admin API
+func (ms *MockServer) setupRoutesAPI() {
+	// Active routes with their hit counts
+	ms.router.HandleFunc("/_admin/routes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ms.listRoutes(r.URL.Query().Get("tag")))
+	}).Methods("GET")
+}
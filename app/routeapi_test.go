@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoutesAPI tests listing the active routes with their hit counts
+func TestRoutesAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:      "9000",
+		Endpoints: []Endpoint{{Path: "/api/users/{id:[0-9]+}", Method: "GET", Response: "user"}},
+		Resources: []Resource{{Name: "orders", Path: "/api/orders"}},
+	}
+	server.resources.configure(server.config.Resources)
+	server.plugins["payments"] = &Plugin{Name: "payments", Enabled: true, Endpoints: []Endpoint{{Path: "/api/payments", Method: "post"}}}
+	server.SetupRoutes()
+
+	for _, path := range []string{"/api/users/1", "/api/users/2", "/api/orders"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Hit counts survive a reload
+	server.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/routes", nil))
+	var routes []routeInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("Failed to parse routes: %v", err)
+	}
+
+	found := make(map[string]routeInfo)
+	for _, route := range routes {
+		found[route.Method+" "+route.Path] = route
+	}
+	if route := found["GET /api/users/{id:[0-9]+}"]; route.Source != "main" || route.Hits != 2 || route.Matchers["id"] != "[0-9]+" {
+		t.Errorf("Unexpected main route: %+v", route)
+	}
+	if route := found["GET /api/orders"]; route.Source != "resource orders" || route.Hits != 1 {
+		t.Errorf("Unexpected resource route: %+v", route)
+	}
+	if route := found["POST /api/payments"]; route.Source != "payments" || route.Hits != 0 || route.Matchers != nil {
+		t.Errorf("Unexpected plugin route: %+v", route)
+	}
+	if len(routes) == 0 || routes[len(routes)-1].Source != "payments" {
+		t.Errorf("Expected plugin routes last, got %+v", routes)
+	}
+}
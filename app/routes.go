@@ -0,0 +1,562 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// routeTable matches requests against the mock endpoints. Endpoints are kept
+// in groups per source, so that a single plugin or route can be replaced
+// without rebuilding the router or the handlers of the other sources. Groups
+// are matched in order: runtime endpoints, the main configuration, then
+// plugins sorted by name, with overlay plugins before the plugins they
+// override.
+//
+// Requests are matched against an immutable snapshot of the table. Updates
+// build a new snapshot sharing the unchanged groups and swap it in
+// atomically, so requests never wait for a reload.
+type routeTable struct {
+	mutex    sync.Mutex // serializes updates
+	snapshot atomic.Pointer[routeSnapshot]
+}
+
+// routeSnapshot is an immutable state of the route table
+type routeSnapshot struct {
+	runtime     *routeGroup
+	main        *routeGroup
+	plugins     map[string]*routeGroup
+	pluginOrder []string
+	autoHead    bool
+	autoOptions bool
+	radix       bool // match with radix trees instead of trying each route
+}
+
+// endpointRoute is an endpoint compiled into a matcher and a handler
+type endpointRoute struct {
+	method   string
+	path     string
+	id       string // stable endpoint ID
+	source   string // config or plugin defining the endpoint
+	tags     map[string]string
+	route    *mux.Route
+	handler  http.Handler
+	cors     *corsPolicy // nil without CORS
+	endpoint *Endpoint   // the endpoint the route serves, nil for generated routes
+}
+
+// key identifies a route within its group
+func (route *endpointRoute) key() string {
+	return route.method + " " + route.path
+}
+
+// routeGroup is an immutable ordered set of routes keyed by method and path.
+// With the radix router, routes are also indexed in a tree; routes the tree
+// can't represent are kept in a list and matched one by one.
+type routeGroup struct {
+	routes []*endpointRoute
+	index  map[string]int // position of a route among the routes ever added
+	next   int            // position of the next route added
+
+	tree   *radixNode
+	linear []radixEntry
+
+	overrides []string // plugins matched after this one
+}
+
+// newRouteGroup creates a group of routes. Like in the router, the first of
+// several routes with the same method and path wins.
+func newRouteGroup(routes []*endpointRoute, radix bool) *routeGroup {
+	group := &routeGroup{index: make(map[string]int, len(routes))}
+	if radix {
+		group.tree = newRadixNode()
+	}
+	for _, route := range routes {
+		if _, exists := group.index[route.key()]; exists {
+			continue
+		}
+		entry := radixEntry{route: route, seq: group.next}
+		group.index[route.key()] = entry.seq
+		group.routes = append(group.routes, route)
+		group.next++
+
+		if group.tree == nil {
+			continue
+		}
+		if segments, err := parseRadixTemplate(route.path); err == nil {
+			group.tree.insert(segments, entry)
+		} else {
+			group.linear = append(group.linear, entry)
+		}
+	}
+	return group
+}
+
+// copy returns a copy of the group sharing its routes and tree, which the
+// copy replaces instead of changing them
+func (g *routeGroup) copy() *routeGroup {
+	next := *g
+	next.index = make(map[string]int, len(g.index)+1)
+	for key, seq := range g.index {
+		next.index[key] = seq
+	}
+	return &next
+}
+
+// position returns where the route added at a position is in the routes
+func (g *routeGroup) position(seq int) int {
+	return sort.Search(len(g.routes), func(i int) bool { return g.index[g.routes[i].key()] >= seq })
+}
+
+// with returns a copy of the group with a route added at the end or replacing
+// the route with the same method and path in place. It reports whether a
+// route was replaced. Only the nodes of the tree on the path of the route
+// are copied.
+func (g *routeGroup) with(route *endpointRoute) (*routeGroup, bool) {
+	next := g.copy()
+	seq, exists := g.index[route.key()]
+	if exists {
+		next.routes = append([]*endpointRoute{}, g.routes...)
+		next.routes[g.position(seq)] = route
+	} else {
+		seq = g.next
+		next.routes = append(g.routes[:len(g.routes):len(g.routes)], route)
+		next.index[route.key()] = seq
+		next.next++
+	}
+
+	if g.tree == nil {
+		return next, exists
+	}
+	entry := radixEntry{route: route, seq: seq}
+	if segments, err := parseRadixTemplate(route.path); err == nil {
+		next.tree = g.tree.with(segments, entry)
+		return next, exists
+	}
+	next.linear = make([]radixEntry, 0, len(g.linear)+1)
+	for _, existing := range g.linear {
+		if existing.seq != seq {
+			next.linear = append(next.linear, existing)
+		}
+	}
+	next.linear = append(next.linear, entry)
+	return next, exists
+}
+
+// without returns a copy of the group without the route with a method and
+// path, and reports whether it existed
+func (g *routeGroup) without(method, path string) (*routeGroup, bool) {
+	key := strings.ToUpper(method) + " " + path
+	seq, exists := g.index[key]
+	if !exists {
+		return g, false
+	}
+	next := g.copy()
+	delete(next.index, key)
+	i := g.position(seq)
+	next.routes = append(append([]*endpointRoute{}, g.routes[:i]...), g.routes[i+1:]...)
+
+	if g.tree == nil {
+		return next, true
+	}
+	if segments, err := parseRadixTemplate(path); err == nil {
+		if next.tree = g.tree.without(segments, seq); next.tree == nil {
+			next.tree = newRadixNode()
+		}
+		return next, true
+	}
+	next.linear = make([]radixEntry, 0, len(g.linear))
+	for _, existing := range g.linear {
+		if existing.seq != seq {
+			next.linear = append(next.linear, existing)
+		}
+	}
+	return next, true
+}
+
+// match finds the first route of the group handling a request. It reports
+// whether a route matched the path but not the method if none matched.
+func (g *routeGroup) match(r *http.Request) (*endpointRoute, map[string]string, bool) {
+	if g.tree != nil {
+		return g.matchRadix(r)
+	}
+
+	mismatch := false
+	for _, route := range g.routes {
+		var match mux.RouteMatch
+		if route.route.Match(r, &match) {
+			return route, match.Vars, false
+		}
+		if match.MatchErr == mux.ErrMethodMismatch {
+			mismatch = true
+		}
+	}
+	return nil, nil, mismatch
+}
+
+// newRouteTable creates an empty route table
+func newRouteTable() *routeTable {
+	rt := &routeTable{}
+	rt.snapshot.Store(&routeSnapshot{
+		runtime: newRouteGroup(nil, false),
+		main:    newRouteGroup(nil, false),
+		plugins: make(map[string]*routeGroup),
+	})
+	return rt
+}
+
+// compileRoute builds the route of an endpoint. Must be called with ms.mutex held.
+func (ms *MockServer) compileRoute(endpoint Endpoint, source string) (*endpointRoute, error) {
+	route, err := newEndpointRoute(endpoint.Method, endpoint.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	route.handler = ms.endpointHandler(endpoint, source)
+	route.id = endpointID(endpoint)
+	route.source = source
+	route.tags = ms.endpointTagMap(endpoint, source)
+	route.endpoint = &endpoint
+	route.applyCORS(ms.corsPolicyFor(endpoint, source))
+	return route, nil
+}
+
+// newEndpointRoute compiles the matcher of a route served by a handler
+func newEndpointRoute(method, path string, handler http.Handler) (*endpointRoute, error) {
+	method = strings.ToUpper(method)
+	route := mux.NewRouter().NewRoute().Path(path).Methods(method)
+	if err := route.GetError(); err != nil {
+		return nil, err
+	}
+	return &endpointRoute{method: method, path: path, id: routeID(method, path), route: route, handler: handler}, nil
+}
+
+// compileRoutes builds the routes of a list of endpoints. Must be called with
+// ms.mutex held.
+func (ms *MockServer) compileRoutes(endpoints []Endpoint, source string) []*endpointRoute {
+	routes := make([]*endpointRoute, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !ms.endpointEnabled(endpoint) || ms.tagDisabled(endpoint, source) {
+			continue
+		}
+		route, err := ms.compileRoute(endpoint, source)
+		if err != nil {
+			log.Printf("Invalid path for %s %s [%s]: %v", endpoint.Method, endpoint.Path, source, err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// reset replaces all routes at once and applies the routing settings of the configuration
+func (rt *routeTable) reset(runtime, main []*endpointRoute, plugins map[string][]*endpointRoute, overrides map[string][]string, config *Config) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	next := &routeSnapshot{autoHead: config.AutoHead, autoOptions: config.AutoOptions}
+	switch config.Router {
+	case "", routerMux:
+	case routerRadix:
+		next.radix = true
+	default:
+		log.Printf("Unknown router %q, using %s", config.Router, routerMux)
+	}
+
+	next.runtime = newRouteGroup(runtime, next.radix)
+	next.main = newRouteGroup(main, next.radix)
+	next.plugins = make(map[string]*routeGroup, len(plugins))
+	for name, routes := range plugins {
+		next.plugins[name] = newRouteGroup(routes, next.radix)
+		next.plugins[name].overrides = overrides[name]
+	}
+	next.sortPlugins()
+	rt.snapshot.Store(next)
+}
+
+// update publishes a copy of the current snapshot changed by fn
+func (rt *routeTable) update(fn func(next *routeSnapshot)) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	next := *rt.snapshot.Load()
+	next.plugins = make(map[string]*routeGroup, len(next.plugins))
+	for name, group := range rt.snapshot.Load().plugins {
+		next.plugins[name] = group
+	}
+	fn(&next)
+	rt.snapshot.Store(&next)
+}
+
+// setPlugin replaces the routes of a plugin and the plugins it overrides;
+// nil routes remove it
+func (rt *routeTable) setPlugin(name string, routes []*endpointRoute, overrides []string) {
+	rt.update(func(next *routeSnapshot) {
+		if routes == nil {
+			delete(next.plugins, name)
+		} else {
+			next.plugins[name] = newRouteGroup(routes, next.radix)
+			next.plugins[name].overrides = overrides
+		}
+		next.sortPlugins()
+	})
+}
+
+// putRuntime adds or replaces a single runtime route without recompiling
+// the other routes, and reports whether a route was replaced
+func (rt *routeTable) putRuntime(route *endpointRoute) bool {
+	var replaced bool
+	rt.update(func(next *routeSnapshot) {
+		next.runtime, replaced = next.runtime.with(route)
+	})
+	return replaced
+}
+
+// replaceRuntime removes the runtime routes of endpoints and adds a route,
+// if not nil, as a single change of the route table
+func (rt *routeTable) replaceRuntime(route *endpointRoute, removed ...Endpoint) {
+	rt.update(func(next *routeSnapshot) {
+		for _, ep := range removed {
+			next.runtime, _ = next.runtime.without(strings.ToUpper(ep.Method), ep.Path)
+		}
+		if route != nil {
+			next.runtime, _ = next.runtime.with(route)
+		}
+	})
+}
+
+// removeRuntime removes a single runtime route and reports whether it existed
+func (rt *routeTable) removeRuntime(method, path string) bool {
+	var removed bool
+	rt.update(func(next *routeSnapshot) {
+		next.runtime, removed = next.runtime.without(method, path)
+	})
+	return removed
+}
+
+// sortPlugins updates the matching order of plugins: by name, except that
+// overlay plugins come before the plugins they override
+func (rs *routeSnapshot) sortPlugins() {
+	names := make([]string, 0, len(rs.plugins))
+	for name := range rs.plugins {
+		names = append(names, name)
+	}
+	rs.pluginOrder = orderPlugins(names, func(name string) []string { return rs.plugins[name].overrides })
+}
+
+// orderPlugins returns plugin names in matching order: by name, except that
+// overlay plugins come before the plugins they override. A cycle of
+// overlays falls back to the order by name.
+func orderPlugins(names []string, overrides func(name string) []string) []string {
+	sort.Strings(names)
+
+	overlays := make(map[string][]string) // plugin to the plugins overriding it
+	for _, name := range names {
+		for _, target := range overrides(name) {
+			overlays[target] = append(overlays[target], name)
+		}
+	}
+
+	order := make([]string, 0, len(names))
+	visited := make(map[string]bool, len(names))
+	var place func(name string)
+	place = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, overlay := range overlays[name] {
+			place(overlay)
+		}
+		order = append(order, name)
+	}
+	for _, name := range names {
+		place(name)
+	}
+	return order
+}
+
+// groups calls fn for every group in matching order until it returns false
+func (rs *routeSnapshot) groups(fn func(*routeGroup) bool) {
+	if !fn(rs.runtime) || !fn(rs.main) {
+		return
+	}
+	for _, name := range rs.pluginOrder {
+		if !fn(rs.plugins[name]) {
+			return
+		}
+	}
+}
+
+// each calls fn for every route in matching order until it returns false
+func (rs *routeSnapshot) each(fn func(*endpointRoute) bool) {
+	rs.groups(func(group *routeGroup) bool {
+		for _, route := range group.routes {
+			if !fn(route) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// match finds the route handling a request. It reports whether a route
+// matched the path but not the method if none matched completely.
+func (rs *routeSnapshot) match(r *http.Request) (*endpointRoute, map[string]string, bool) {
+	var found *endpointRoute
+	var vars map[string]string
+	mismatch := false
+
+	rs.groups(func(group *routeGroup) bool {
+		route, routeVars, groupMismatch := group.match(r)
+		if route != nil {
+			found, vars = route, routeVars
+			return false
+		}
+		mismatch = mismatch || groupMismatch
+		return true
+	})
+
+	if found != nil {
+		return found, vars, false
+	}
+	return nil, nil, mismatch
+}
+
+// lookup returns the handler of a request, including automatic HEAD and
+// OPTIONS handlers, and reports whether the path matched with another method
+func (rs *routeSnapshot) lookup(r *http.Request) (http.Handler, map[string]string, bool) {
+	route, vars, mismatch := rs.match(r)
+	if route != nil {
+		return route.handler, vars, false
+	}
+	if !mismatch {
+		return nil, nil, false
+	}
+
+	if handler, vars := rs.automaticVerb(r); handler != nil {
+		return handler, vars, false
+	}
+	return nil, nil, true
+}
+
+// allowedMethods returns the methods of the routes matching the request path
+func (rs *routeSnapshot) allowedMethods(r *http.Request) []string {
+	seen := make(map[string]bool)
+	var methods []string
+	rs.each(func(route *endpointRoute) bool {
+		if !seen[route.method] && route.matchesPath(r) {
+			seen[route.method] = true
+			methods = append(methods, route.method)
+		}
+		return true
+	})
+
+	if rs.autoHead && seen[http.MethodGet] && !seen[http.MethodHead] {
+		methods = append(methods, http.MethodHead)
+	}
+	if rs.autoOptions && len(methods) > 0 && !seen[http.MethodOptions] {
+		methods = append(methods, http.MethodOptions)
+	}
+	return methods
+}
+
+// matchesPath reports whether the route matches the request path with any method
+func (route *endpointRoute) matchesPath(r *http.Request) bool {
+	probe := r.Clone(r.Context())
+	probe.Method = route.method
+	var match mux.RouteMatch
+	return route.route.Match(probe, &match)
+}
+
+// endpointsHandler serves requests not handled by the management API from
+// the route table. adminMismatch is set for requests whose path matched a
+// management route with another method.
+func (ms *MockServer) endpointsHandler(adminMismatch bool, notFound, methodNotAllowed http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, vars, mismatch := ms.routes.snapshot.Load().lookup(r)
+		switch {
+		case handler != nil:
+			handler.ServeHTTP(w, mux.SetURLVars(r, vars))
+		case mismatch || adminMismatch:
+			methodNotAllowed.ServeHTTP(w, r)
+		default:
+			notFound.ServeHTTP(w, r)
+		}
+	})
+}
+
+// reloadPlugin re-parses a single plugin file and replaces only its routes.
+// A removed or invalid file unloads the plugin it contained.
+func (ms *MockServer) reloadPlugin(pluginPath string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	previous, loaded := ms.pluginFiles[pluginPath]
+	if loaded {
+		delete(ms.plugins, previous)
+		delete(ms.pluginFiles, pluginPath)
+	}
+
+	var name string
+	if _, err := os.Stat(pluginPath); os.IsNotExist(err) {
+		log.Printf("Plugin file removed: %s", pluginPath)
+	} else if err := ms.loadSinglePlugin(pluginPath); err != nil {
+		log.Printf("Failed to load plugin %s: %v", filepath.Base(pluginPath), err)
+		ms.notifier.notify(EventPluginReloadFailed, fmt.Sprintf("Failed to load plugin %s: %v", filepath.Base(pluginPath), err),
+			map[string]string{"plugin_file": pluginPath, "error": err.Error()})
+	} else {
+		name = ms.pluginFiles[pluginPath]
+	}
+
+	if loaded && previous != name {
+		ms.routes.setPlugin(previous, nil, nil)
+	}
+	if name != "" {
+		ms.updatePluginRoutes(name)
+	}
+	ms.syncTCPListeners()
+	ms.pruneRouteState()
+	ms.logRouteSummary()
+}
+
+// routeKeys returns the method and path of the routes whose endpoint has a
+// setting, e.g. a rate limit. Must be called with ms.mutex held.
+func (ms *MockServer) routeKeys(has func(ep *Endpoint) bool) map[string]bool {
+	keys := make(map[string]bool)
+	ms.routes.snapshot.Load().each(func(route *endpointRoute) bool {
+		if route.endpoint != nil && has(route.endpoint) {
+			keys[route.key()] = true
+		}
+		return true
+	})
+	return keys
+}
+
+// pruneRouteState drops the per-route state, such as rate limit counters,
+// circuit breakers, sequence positions and idempotency keys, of endpoints that were removed or no longer have
+// the setting. Must be called with ms.mutex held after routes changed.
+func (ms *MockServer) pruneRouteState() {
+	ms.pruneRateLimiters()
+	ms.pruneBreakers()
+	ms.pruneSequences()
+	ms.pruneIdempotencyStores()
+}
+
+// updatePluginRoutes recompiles the routes of a plugin after it was loaded,
+// enabled or disabled. Must be called with ms.mutex held.
+func (ms *MockServer) updatePluginRoutes(name string) {
+	plugin, exists := ms.plugins[name]
+	if !exists || !plugin.Enabled {
+		ms.routes.setPlugin(name, nil, nil)
+		return
+	}
+	ms.routes.setPlugin(name, ms.compileRoutes(plugin.allEndpoints(), name), plugin.Overrides)
+}
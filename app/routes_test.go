@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestReloadPlugin tests that a changed plugin file replaces only the routes of that plugin
+func TestReloadPlugin(t *testing.T) {
+	pluginsDir := t.TempDir()
+	writePlugin := func(file string, plugin Plugin) {
+		data, err := json.Marshal(plugin)
+		if err != nil {
+			t.Fatalf("Failed to marshal plugin: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(pluginsDir, file), data, 0644); err != nil {
+			t.Fatalf("Failed to write plugin file: %v", err)
+		}
+	}
+	get := func(server *MockServer, path string) (int, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	writePlugin("users.json", Plugin{Name: "users", Enabled: true, Endpoints: []Endpoint{{Path: "/users", Method: "GET", Response: "v1"}}})
+	writePlugin("orders.json", Plugin{Name: "orders", Enabled: true, Endpoints: []Endpoint{{Path: "/orders", Method: "GET", Response: "orders"}}})
+
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: pluginsDir}
+	server.pluginsDir = pluginsDir
+	if err := server.LoadPlugins(); err != nil {
+		t.Fatalf("Failed to load plugins: %v", err)
+	}
+	server.SetupRoutes()
+
+	router := server.router
+	orders := server.routes.snapshot.Load().plugins["orders"].routes[0]
+
+	// Change one plugin
+	writePlugin("users.json", Plugin{Name: "users", Enabled: true, Endpoints: []Endpoint{
+		{Path: "/users", Method: "GET", Response: "v2"},
+		{Path: "/users/{id}", Method: "GET", Response: "user"},
+	}})
+	server.reloadPlugin(filepath.Join(pluginsDir, "users.json"))
+
+	if _, body := get(server, "/users"); body != "v2" {
+		t.Errorf("Expected the changed response 'v2', got '%s'", body)
+	}
+	if code, _ := get(server, "/users/1"); code != 200 {
+		t.Errorf("Expected the added endpoint to respond with 200, got %d", code)
+	}
+	if server.router != router || server.routes.snapshot.Load().plugins["orders"].routes[0] != orders {
+		t.Error("Expected the router and the routes of other plugins to be kept")
+	}
+
+	// Rename the plugin inside the file
+	writePlugin("users.json", Plugin{Name: "accounts", Enabled: true, Endpoints: []Endpoint{{Path: "/accounts", Method: "GET", Response: "accounts"}}})
+	server.reloadPlugin(filepath.Join(pluginsDir, "users.json"))
+
+	if _, exists := server.plugins["users"]; exists {
+		t.Error("Expected the old plugin name to be unloaded")
+	}
+	if code, _ := get(server, "/users"); code != 404 {
+		t.Errorf("Expected the routes of the old name to be removed, got %d", code)
+	}
+	if _, body := get(server, "/accounts"); body != "accounts" {
+		t.Errorf("Expected the renamed plugin to respond, got '%s'", body)
+	}
+
+	// Break a plugin file
+	if err := os.WriteFile(filepath.Join(pluginsDir, "orders.json"), []byte(`{"name": "orders", "enabled": tru`), 0644); err != nil {
+		t.Fatalf("Failed to write plugin file: %v", err)
+	}
+	server.reloadPlugin(filepath.Join(pluginsDir, "orders.json"))
+
+	if code, _ := get(server, "/orders"); code != 404 {
+		t.Errorf("Expected the invalid plugin to be unloaded, got %d", code)
+	}
+
+	// Remove a plugin file
+	os.Remove(filepath.Join(pluginsDir, "users.json"))
+	server.reloadPlugin(filepath.Join(pluginsDir, "users.json"))
+
+	if len(server.plugins) != 0 {
+		t.Errorf("Expected no plugins left, got %d", len(server.plugins))
+	}
+	if code, _ := get(server, "/accounts"); code != 404 {
+		t.Errorf("Expected the removed plugin's routes to be gone, got %d", code)
+	}
+}
+
+// TestRouteTableOrder tests that routes are matched in source order and that
+// management routes with another method don't hide endpoints
+func TestRouteTableOrder(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/items/{id}", Method: "GET", Response: "main"},
+			{Path: "/health", Method: "POST", Response: "posted"},
+		},
+	}
+	server.plugins = map[string]*Plugin{
+		"b": {Name: "b", Enabled: true, Endpoints: []Endpoint{{Path: "/shared", Method: "GET", Response: "b"}}},
+		"a": {Name: "a", Enabled: true, Endpoints: []Endpoint{
+			{Path: "/items/1", Method: "GET", Response: "plugin"},
+			{Path: "/shared", Method: "GET", Response: "a"},
+		}},
+	}
+	server.runtimeEndpoints = []Endpoint{{Path: "/items/2", Method: "GET", Response: "runtime"}}
+	server.SetupRoutes()
+
+	for path, expected := range map[string]string{"/items/1": "main", "/items/2": "runtime", "/shared": "a"} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != expected {
+			t.Errorf("Expected %s to respond with '%s', got '%s'", path, expected, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/health", nil))
+	if w.Code != 200 || w.Body.String() != "posted" {
+		t.Errorf("Expected POST /health to reach the endpoint, got %d '%s'", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/health", nil))
+	if w.Code != 405 || w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("Expected 405 with Allow 'GET, POST', got %d '%s'", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+// TestRuntimeRoutes tests adding, replacing and removing single runtime routes
+func TestRuntimeRoutes(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/items/{id}", Method: "GET", Response: "main"}},
+	}
+	server.SetupRoutes()
+	router := server.router
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	put := func(endpoint Endpoint) bool {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		route, err := server.compileRoute(endpoint, "runtime")
+		if err != nil {
+			t.Fatalf("Failed to compile route: %v", err)
+		}
+		return server.routes.putRuntime(route)
+	}
+
+	if put(Endpoint{Path: "/items/{id}", Method: "GET", Response: "first"}) {
+		t.Error("Expected a new route not to replace another")
+	}
+	put(Endpoint{Path: "/items/1", Method: "GET", Response: "second"})
+	if body := get("/items/1"); body != "first" {
+		t.Errorf("Expected the first runtime route to win, got '%s'", body)
+	}
+
+	if !put(Endpoint{Path: "/items/{id}", Method: "get", Response: "replaced"}) {
+		t.Error("Expected the route to be replaced")
+	}
+	if body := get("/items/1"); body != "replaced" {
+		t.Errorf("Expected the replaced route to keep its position, got '%s'", body)
+	}
+
+	if !server.routes.removeRuntime("GET", "/items/{id}") || server.routes.removeRuntime("GET", "/items/{id}") {
+		t.Error("Expected the route to be removed exactly once")
+	}
+	if body := get("/items/1"); body != "second" {
+		t.Errorf("Expected the remaining runtime route, got '%s'", body)
+	}
+	server.routes.removeRuntime("GET", "/items/1")
+	if body := get("/items/1"); body != "main" {
+		t.Errorf("Expected the main configuration once runtime routes are gone, got '%s'", body)
+	}
+
+	if server.router != router {
+		t.Error("Expected the router not to be rebuilt")
+	}
+}
+
+// TestServeDuringReload tests that requests are served while a reload holds the server lock
+func TestServeDuringReload(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/ping", Method: "GET", Response: "pong"}},
+	}
+	server.SetupRoutes()
+
+	server.mutex.Lock()
+	done := make(chan string)
+	go func() {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+		done <- w.Body.String()
+	}()
+
+	select {
+	case body := <-done:
+		if body != "pong" {
+			t.Errorf("Expected 'pong', got '%s'", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the request to be served while the server is locked")
+	}
+	server.mutex.Unlock()
+
+	// Reload repeatedly while serving
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				server.SetupRoutes()
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+		if w.Code != 200 {
+			t.Fatalf("Expected status 200 during reloads, got %d", w.Code)
+		}
+	}
+	close(stop)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateWindow is the number of seconds the request rate of rules is
+// averaged over
+const rateWindow = 10
+
+// weekdays are the names of days in rules
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// UpstreamRule replaces the model of an upstream at certain times of day
+// or under load. All conditions of a rule must hold.
+type UpstreamRule struct {
+	Hours   string   `json:"hours,omitempty"`    // time window like "09:00-18:00"; "22:00-06:00" spans midnight
+	Days    []string `json:"days,omitempty"`     // weekdays like "mon" or "sat" (default: every day)
+	MinRate float64  `json:"min_rate,omitempty"` // requests per second to the upstream, averaged over 10 seconds
+
+	Delay     int     `json:"delay,omitempty"`
+	Jitter    int     `json:"jitter,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+}
+
+// upstreamRule is a compiled rule
+type upstreamRule struct {
+	from, to int // minutes since midnight; equal for the whole day
+	hours    bool
+	days     map[time.Weekday]bool // nil for every day
+	minRate  float64
+	model    upstreamModel
+}
+
+// compile checks a rule and parses its conditions
+func (rule UpstreamRule) compile() (upstreamRule, error) {
+	compiled := upstreamRule{
+		minRate: rule.MinRate,
+		model:   upstreamModel{Delay: rule.Delay, Jitter: rule.Jitter, ErrorRate: rule.ErrorRate},
+	}
+	if err := compiled.model.validate(); err != nil {
+		return compiled, err
+	}
+	if rule.Hours == "" && len(rule.Days) == 0 && rule.MinRate == 0 {
+		return compiled, fmt.Errorf("a rule needs hours, days or min_rate")
+	}
+	if rule.MinRate < 0 {
+		return compiled, fmt.Errorf("min_rate must not be negative")
+	}
+
+	if rule.Hours != "" {
+		from, to, found := strings.Cut(rule.Hours, "-")
+		var err error
+		if !found {
+			return compiled, fmt.Errorf("invalid hours %q, expected a window like 09:00-18:00", rule.Hours)
+		}
+		if compiled.from, err = parseClock(from); err != nil {
+			return compiled, err
+		}
+		if compiled.to, err = parseClock(to); err != nil {
+			return compiled, err
+		}
+		compiled.hours = true
+	}
+
+	if len(rule.Days) > 0 {
+		compiled.days = make(map[time.Weekday]bool, len(rule.Days))
+		for _, day := range rule.Days {
+			weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+			if !ok {
+				return compiled, fmt.Errorf("invalid day %q, expected mon, tue, wed, thu, fri, sat or sun", day)
+			}
+			compiled.days[weekday] = true
+		}
+	}
+	return compiled, nil
+}
+
+// parseClock parses a time of day like "09:30" into minutes since midnight.
+// "24:00" is the end of the day.
+func parseClock(value string) (int, error) {
+	var hours, minutes int
+	value = strings.TrimSpace(value)
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || len(value) != 5 ||
+		hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// matches reports whether a rule applies at a local time and request rate
+func (rule upstreamRule) matches(now time.Time, rate float64) bool {
+	if rule.days != nil && !rule.days[now.Weekday()] {
+		return false
+	}
+	if rule.hours {
+		minute := now.Hour()*60 + now.Minute()
+		switch {
+		case rule.from < rule.to:
+			if minute < rule.from || minute >= rule.to {
+				return false
+			}
+		case rule.from > rule.to:
+			if minute < rule.from && minute >= rule.to {
+				return false
+			}
+		}
+	}
+	return rate >= rule.minRate
+}
+
+// rateCounter counts requests per second over the last rateWindow seconds
+type rateCounter struct {
+	mutex   sync.Mutex
+	counts  [rateWindow]int
+	seconds [rateWindow]int64 // the second each count belongs to
+}
+
+// add counts a request
+func (rc *rateCounter) add(now time.Time) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	second := now.Unix()
+	slot := second % rateWindow
+	if rc.seconds[slot] != second {
+		rc.seconds[slot] = second
+		rc.counts[slot] = 0
+	}
+	rc.counts[slot]++
+}
+
+// rate returns the average requests per second over the last rateWindow
+// seconds
+func (rc *rateCounter) rate(now time.Time) float64 {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	second := now.Unix()
+	total := 0
+	for slot, count := range rc.counts {
+		if second-rc.seconds[slot] < rateWindow {
+			total += count
+		}
+	}
+	return float64(total) / rateWindow
+}
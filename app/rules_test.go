@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUpstreamRules tests models selected by time of day, weekday and load
+func TestUpstreamRules(t *testing.T) {
+	u := newUpstream("orders", UpstreamConfig{
+		Delay:    10,
+		Timezone: "UTC",
+		Rules: []UpstreamRule{
+			{MinRate: 5, Delay: 2000, ErrorRate: 0.2},
+			{Hours: "09:00-18:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Delay: 300},
+			{Hours: "22:00-06:00", Delay: 0, ErrorRate: 0.5},
+		},
+	})
+
+	// 2024-01-01 was a Monday
+	tests := []struct {
+		at    string
+		delay int
+		rule  int
+	}{
+		{"2024-01-01T10:30:00Z", 300, 2},
+		{"2024-01-01T18:00:00Z", 10, 0},
+		{"2024-01-06T10:30:00Z", 10, 0}, // Saturday
+		{"2024-01-06T23:15:00Z", 0, 3},
+		{"2024-01-07T05:59:00Z", 0, 3},
+		{"2024-01-07T06:00:00Z", 10, 0},
+	}
+	for _, test := range tests {
+		now, _ := time.Parse(time.RFC3339, test.at)
+		u.now = func() time.Time { return now }
+		if model, rule := u.activeModel(); model.Delay != test.delay || rule != test.rule {
+			t.Errorf("At %s: expected delay %d from rule %d, got %d from rule %d", test.at, test.delay, test.rule, model.Delay, rule)
+		}
+	}
+
+	// 60 requests within 10 seconds are 6 per second, which triggers the load rule
+	now, _ := time.Parse(time.RFC3339, "2024-01-01T10:30:00Z")
+	for i := 0; i < 60; i++ {
+		u.rate.add(now.Add(time.Duration(i%10) * time.Second))
+	}
+	u.now = func() time.Time { return now.Add(9 * time.Second) }
+	if model, rule := u.activeModel(); rule != 1 || model.Delay != 2000 || model.ErrorRate != 0.2 {
+		t.Errorf("Expected the load rule, got %+v from rule %d", model, rule)
+	}
+
+	// Once the requests are older than the window, the time rule applies again
+	u.now = func() time.Time { return now.Add(30 * time.Second) }
+	if _, rule := u.activeModel(); rule != 2 {
+		t.Errorf("Expected the business hours rule after the load, got rule %d", rule)
+	}
+
+	// A model set through the admin API takes precedence over rules
+	u.setOverride(&upstreamModel{Delay: 1})
+	if model, rule := u.activeModel(); model.Delay != 1 || rule != 0 {
+		t.Errorf("Expected the runtime model, got %+v from rule %d", model, rule)
+	}
+}
+
+// TestUpstreamRuleValidation tests rejecting invalid rules
+func TestUpstreamRuleValidation(t *testing.T) {
+	valid := []UpstreamRule{
+		{Hours: "00:00-24:00"},
+		{Days: []string{"Sat", "sun"}},
+		{MinRate: 0.5, ErrorRate: 1},
+	}
+	for _, rule := range valid {
+		if _, err := rule.compile(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", rule, err)
+		}
+	}
+
+	invalid := []UpstreamRule{
+		{},
+		{Hours: "9-17"},
+		{Hours: "09:00"},
+		{Hours: "09:00-25:00"},
+		{Hours: "09:60-10:00"},
+		{Days: []string{"monday"}},
+		{MinRate: -1},
+		{Hours: "09:00-17:00", ErrorRate: 2},
+	}
+	for _, rule := range invalid {
+		if _, err := rule.compile(); err == nil {
+			t.Errorf("Expected %+v to be invalid", rule)
+		}
+	}
+
+	if err := (UpstreamConfig{Timezone: "Mars/Olympus"}).validate(); err == nil {
+		t.Error("Expected an unknown time zone to be rejected")
+	}
+}
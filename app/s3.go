@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config represents the S3-compatible object storage mock
+type S3Config struct {
+	Port    string `json:"port"`               // port of the S3 listener
+	RootDir string `json:"root_dir,omitempty"` // directory holding one folder per bucket (default: s3data)
+}
+
+// s3Handler serves a subset of the S3 API using path-style requests
+// (/{bucket}/{key}) backed by a local directory
+type s3Handler struct {
+	root     string
+	readOnly bool // only reads are allowed
+}
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3Error is an S3 error response body
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+// s3Bucket is a bucket entry of ListAllMyBucketsResult
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+// s3ListBuckets is the ListBuckets response body
+type s3ListBuckets struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+// s3Owner is the owner of buckets and objects
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// s3Object is an object entry of ListBucketResult
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// s3Prefix is a common prefix entry of ListBucketResult
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// s3ListObjects is the ListObjects (v1 and v2) response body
+type s3ListObjects struct {
+	XMLName        xml.Name   `xml:"ListBucketResult"`
+	Xmlns          string     `xml:"xmlns,attr"`
+	Name           string     `xml:"Name"`
+	Prefix         string     `xml:"Prefix"`
+	Delimiter      string     `xml:"Delimiter,omitempty"`
+	MaxKeys        int        `xml:"MaxKeys"`
+	KeyCount       int        `xml:"KeyCount,omitempty"`
+	IsTruncated    bool       `xml:"IsTruncated"`
+	Contents       []s3Object `xml:"Contents"`
+	CommonPrefixes []s3Prefix `xml:"CommonPrefixes,omitempty"`
+}
+
+// startS3 starts the S3-compatible listener
+func (ms *MockServer) startS3(config S3Config) {
+	root := config.RootDir
+	if root == "" {
+		root = "s3data"
+	}
+	if !ms.readOnly {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			log.Printf("Failed to create S3 root directory: %v", err)
+			return
+		}
+	}
+
+	log.Printf("S3 mock available at: http://localhost:%s/ (root: %s)", config.Port, root)
+	if err := http.ListenAndServe(":"+config.Port, &s3Handler{root: root, readOnly: ms.readOnly}); err != nil {
+		log.Printf("S3 listener stopped: %v", err)
+	}
+}
+
+// ServeHTTP dispatches S3 requests
+func (h *s3Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if expired(r) {
+		h.error(w, r, http.StatusForbidden, "AccessDenied", "Request has expired")
+		return
+	}
+	if h.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.error(w, r, http.StatusForbidden, "AccessDenied", "Server is read-only")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		h.listBuckets(w, r)
+	case bucket == "":
+		h.error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	case key == "":
+		h.serveBucket(w, r, bucket)
+	default:
+		h.serveObject(w, r, bucket, key)
+	}
+	log.Printf("%s %s [s3]", r.Method, r.URL.Path)
+}
+
+// expired reports whether a presigned URL is past its expiry. Signatures
+// themselves are not verified.
+func expired(r *http.Request) bool {
+	query := r.URL.Query()
+	date, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return false
+	}
+	return time.Now().After(date.Add(time.Duration(seconds) * time.Second))
+}
+
+// bucketPath returns the directory of a bucket
+func (h *s3Handler) bucketPath(bucket string) (string, bool) {
+	if bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) {
+		return "", false
+	}
+	return filepath.Join(h.root, bucket), true
+}
+
+// objectPath returns the file of an object, rejecting keys escaping the bucket
+func (h *s3Handler) objectPath(bucket, key string) (string, bool) {
+	dir, ok := h.bucketPath(bucket)
+	if !ok {
+		return "", false
+	}
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// listBuckets answers ListBuckets
+func (h *s3Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(h.root)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	result := s3ListBuckets{Xmlns: s3Namespace, Owner: s3Owner{ID: "nmock", DisplayName: "nmock"}}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result.Buckets = append(result.Buckets, s3Bucket{
+			Name:         entry.Name(),
+			CreationDate: info.ModTime().UTC().Format(time.RFC3339),
+		})
+	}
+	h.writeXML(w, http.StatusOK, result)
+}
+
+// serveBucket handles bucket level operations
+func (h *s3Handler) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	dir, ok := h.bucketPath(bucket)
+	if !ok {
+		h.error(w, r, http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid")
+		return
+	}
+
+	_, statErr := os.Stat(dir)
+	exists := statErr == nil
+
+	switch r.Method {
+	case http.MethodPut:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			h.error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.Header().Set("Location", "/"+bucket)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if !exists {
+			h.error(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			h.error(w, r, http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if !exists {
+			h.error(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+			return
+		}
+		h.listObjects(w, r, bucket, dir)
+	default:
+		h.error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+// listObjects answers ListObjects and ListObjectsV2
+func (h *s3Handler) listObjects(w http.ResponseWriter, r *http.Request, bucket, dir string) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := 1000
+	if value, err := strconv.Atoi(query.Get("max-keys")); err == nil && value >= 0 {
+		maxKeys = value
+	}
+
+	result := s3ListObjects{
+		Xmlns:     s3Namespace,
+		Name:      bucket,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+	seenPrefixes := make(map[string]bool)
+
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seenPrefixes[common] {
+					seenPrefixes[common] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{Prefix: common})
+				}
+				return nil
+			}
+		}
+
+		if len(result.Contents) >= maxKeys {
+			result.IsTruncated = true
+			return fs.SkipAll
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		result.Contents = append(result.Contents, s3Object{
+			Key:          key,
+			LastModified: info.ModTime().UTC().Format(time.RFC3339),
+			ETag:         fileETag(path),
+			Size:         info.Size(),
+			StorageClass: "STANDARD",
+		})
+		return nil
+	})
+
+	if query.Get("list-type") == "2" {
+		result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	}
+	h.writeXML(w, http.StatusOK, result)
+}
+
+// serveObject handles object level operations
+func (h *s3Handler) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	path, ok := h.objectPath(bucket, key)
+	if !ok {
+		h.error(w, r, http.StatusBadRequest, "InvalidArgument", "The specified key is not valid")
+		return
+	}
+	dir, _ := h.bucketPath(bucket)
+	if _, err := os.Stat(dir); err != nil {
+		h.error(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.putObject(w, r, path)
+	case http.MethodGet, http.MethodHead:
+		file, err := os.Open(path)
+		if err != nil {
+			h.error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			h.error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", fileETag(path))
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		http.ServeContent(w, r, "", info.ModTime(), file)
+	case http.MethodDelete:
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			h.error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+// putObject stores an object, supporting server-side copies and
+// aws-chunked uploads
+func (h *s3Handler) putObject(w http.ResponseWriter, r *http.Request, path string) {
+	var body io.Reader = r.Body
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		sourceBucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		sourcePath, ok := h.objectPath(sourceBucket, sourceKey)
+		if !ok {
+			h.error(w, r, http.StatusBadRequest, "InvalidArgument", "The copy source is not valid")
+			return
+		}
+		file, err := os.Open(sourcePath)
+		if err != nil {
+			h.error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		defer file.Close()
+		body = file
+	} else if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		body = &awsChunkedReader{reader: bufio.NewReader(r.Body)}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		h.error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	_, err = io.Copy(file, body)
+	file.Close()
+	if err != nil {
+		h.error(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", fileETag(path))
+	w.WriteHeader(http.StatusOK)
+}
+
+// awsChunkedReader decodes the aws-chunked content encoding used by SDKs for
+// streaming uploads, dropping chunk signatures and trailers
+type awsChunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (cr *awsChunkedReader) Read(p []byte) (int, error) {
+	for cr.remaining == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		line, err := cr.reader.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sizeHex, _, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			cr.done = true
+			return 0, io.EOF
+		}
+		cr.remaining = size
+	}
+
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.reader.Read(p)
+	cr.remaining -= int64(n)
+	return n, err
+}
+
+// fileETag returns the quoted MD5 of a file, like S3 does for simple uploads
+func fileETag(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	io.Copy(hash, file)
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+}
+
+// writeXML writes an XML response body
+func (h *s3Handler) writeXML(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(body)
+}
+
+// error writes an S3 error response
+func (h *s3Handler) error(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(statusCode)
+		return
+	}
+	h.writeXML(w, statusCode, s3Error{Code: code, Message: message, Resource: r.URL.Path})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestS3Mock tests bucket and object operations of the S3 mock
+func TestS3Mock(t *testing.T) {
+	server := httptest.NewServer(&s3Handler{root: t.TempDir()})
+	defer server.Close()
+
+	do := func(method, path string, body string, headers map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	if resp, _ := do("PUT", "/photos", "", nil); resp.StatusCode != 200 {
+		t.Fatalf("Expected bucket creation to succeed, got %d", resp.StatusCode)
+	}
+
+	resp, _ := do("PUT", "/photos/2024/cat.txt", "meow", nil)
+	if resp.StatusCode != 200 || resp.Header.Get("ETag") == "" {
+		t.Errorf("Expected object upload with ETag, got %d %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	chunked := "4;chunk-signature=abc\r\nwoof\r\n0;chunk-signature=def\r\n\r\n"
+	do("PUT", "/photos/dog.txt", chunked, map[string]string{"X-Amz-Content-Sha256": "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"})
+	if _, body := do("GET", "/photos/dog.txt", "", nil); body != "woof" {
+		t.Errorf("Expected decoded aws-chunked body, got %q", body)
+	}
+
+	if _, body := do("GET", "/", "", nil); !strings.Contains(body, "<Name>photos</Name>") {
+		t.Errorf("Expected bucket in ListBuckets, got %s", body)
+	}
+
+	_, body := do("GET", "/photos?list-type=2&delimiter=/", "", nil)
+	if !strings.Contains(body, "<Key>dog.txt</Key>") || !strings.Contains(body, "<Prefix>2024/</Prefix>") {
+		t.Errorf("Expected key and common prefix in listing, got %s", body)
+	}
+
+	_, body = do("GET", "/photos?prefix=2024/", "", nil)
+	if !strings.Contains(body, "<Key>2024/cat.txt</Key>") || strings.Contains(body, "dog.txt") {
+		t.Errorf("Expected only prefixed keys, got %s", body)
+	}
+
+	presigned := "/photos/2024/cat.txt?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=x&X-Amz-Expires=300&X-Amz-Date=" +
+		time.Now().UTC().Format("20060102T150405Z")
+	if resp, body := do("GET", presigned, "", nil); resp.StatusCode != 200 || body != "meow" {
+		t.Errorf("Expected presigned GET to succeed, got %d %q", resp.StatusCode, body)
+	}
+
+	expiredURL := "/photos/2024/cat.txt?X-Amz-Expires=60&X-Amz-Date=20200101T000000Z"
+	if resp, _ := do("GET", expiredURL, "", nil); resp.StatusCode != 403 {
+		t.Errorf("Expected expired presigned URL to be rejected, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := do("DELETE", "/photos", "", nil); resp.StatusCode != 409 {
+		t.Errorf("Expected deleting a non-empty bucket to fail, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := do("DELETE", "/photos/dog.txt", "", nil); resp.StatusCode != 204 {
+		t.Errorf("Expected object deletion, got %d", resp.StatusCode)
+	}
+
+	resp, body = do("GET", "/photos/dog.txt", "", nil)
+	if resp.StatusCode != 404 || !strings.Contains(body, "<Code>NoSuchKey</Code>") {
+		t.Errorf("Expected NoSuchKey, got %d %s", resp.StatusCode, body)
+	}
+
+	if resp, _ := do("GET", "/photos/..%2f..%2fetc/passwd", "", nil); resp.StatusCode == 200 {
+		t.Errorf("Expected keys escaping the bucket to be rejected")
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// schemaError is a problem found while validating a configuration file
+type schemaError struct {
+	Pointer string `json:"pointer"` // JSON pointer of the offending value
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// String formats the error with its location
+func (e schemaError) String() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, pointer, e.Message)
+}
+
+// schemaErrors formats validation errors of a file as a single error
+func schemaErrors(file string, errs []schemaError) error {
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, fmt.Sprintf("%s: %s", file, e))
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+// validateJSON checks a JSON document against the structure of a Go type,
+// reporting unknown fields and type mismatches with their location. Field
+// names match case-insensitively, like encoding/json does.
+func validateJSON(data []byte, typ reflect.Type) []schemaError {
+	v := &schemaValidator{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	v.dec.UseNumber()
+
+	// The token stream reports some syntax errors confusingly, so check the
+	// syntax of the whole document first
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return []schemaError{v.syntaxError(err)}
+	}
+
+	if err := v.value(typ, ""); err != nil {
+		return append(v.errors, v.syntaxError(err))
+	}
+	if _, err := v.dec.Token(); err != io.EOF {
+		return append(v.errors, v.errorAt(v.dec.InputOffset(), "", "unexpected data after the top-level value"))
+	}
+	return v.errors
+}
+
+// schemaValidator walks the JSON tokens of a document alongside a Go type
+type schemaValidator struct {
+	data   []byte
+	dec    *json.Decoder
+	errors []schemaError
+}
+
+// errorAt builds an error located at a byte offset of the document
+func (v *schemaValidator) errorAt(offset int64, pointer, message string) schemaError {
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	line, column := 1, 1
+	for _, c := range v.data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return schemaError{Pointer: pointer, Line: line, Column: column, Message: message}
+}
+
+// syntaxError converts a decoding error to a located error
+func (v *schemaValidator) syntaxError(err error) schemaError {
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		return v.errorAt(max(syntax.Offset-1, 0), "", syntax.Error())
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return v.errorAt(int64(len(v.data)), "", "unexpected end of JSON input")
+	}
+	return v.errorAt(v.dec.InputOffset(), "", err.Error())
+}
+
+// add records an error for the token that was just read
+func (v *schemaValidator) add(start int64, pointer, message string) {
+	v.errors = append(v.errors, v.errorAt(start, pointer, message))
+}
+
+// value validates the next value in the stream against typ
+func (v *schemaValidator) value(typ reflect.Type, pointer string) error {
+	start := v.tokenStart()
+	tok, err := v.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if tok == nil || typ.Kind() == reflect.Interface || customJSON(typ) {
+		return v.skip(tok)
+	}
+
+	mismatch := func() error {
+		v.add(start, pointer, fmt.Sprintf("expected %s, got %s", schemaTypeName(typ), tokenTypeName(tok)))
+		return v.skip(tok)
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if tok != json.Delim('{') {
+			return mismatch()
+		}
+		fields := structFields(typ)
+		return v.object(pointer, func(key string, keyStart int64) (reflect.Type, bool) {
+			if field, ok := lookupField(fields, key); ok {
+				return field.Type, true
+			}
+			message := fmt.Sprintf("unknown field %q", key)
+			if suggestion := suggestField(fields, key); suggestion != "" {
+				message += fmt.Sprintf(", did you mean %q?", suggestion)
+			}
+			v.add(keyStart, pointer+"/"+escapePointer(key), message)
+			return nil, false
+		})
+	case reflect.Map:
+		if tok != json.Delim('{') {
+			return mismatch()
+		}
+		return v.object(pointer, func(string, int64) (reflect.Type, bool) {
+			return typ.Elem(), true
+		})
+	case reflect.Slice, reflect.Array:
+		if tok != json.Delim('[') {
+			return mismatch()
+		}
+		for i := 0; v.dec.More(); i++ {
+			if err := v.value(typ.Elem(), fmt.Sprintf("%s/%d", pointer, i)); err != nil {
+				return err
+			}
+		}
+		_, err := v.dec.Token()
+		return err
+	case reflect.String:
+		if tok == json.Delim('{') {
+			// Secret references such as {"$secret": "API_KEY"} stand for strings
+			return v.object(pointer, func(key string, keyStart int64) (reflect.Type, bool) {
+				if key == secretKey {
+					return typ, true
+				}
+				v.add(keyStart, pointer+"/"+escapePointer(key), fmt.Sprintf("unknown field %q, expected a string or a %q reference", key, secretKey))
+				return nil, false
+			})
+		}
+		if _, ok := tok.(string); !ok {
+			return mismatch()
+		}
+	case reflect.Bool:
+		if _, ok := tok.(bool); !ok {
+			return mismatch()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, ok := tok.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		if _, err := number.Int64(); err != nil {
+			v.add(start, pointer, fmt.Sprintf("expected integer, got %s", number))
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := tok.(json.Number); !ok {
+			return mismatch()
+		}
+	}
+	return nil
+}
+
+// object validates the members of an object whose opening brace was read.
+// field returns the type of a member, or false to skip it.
+func (v *schemaValidator) object(pointer string, field func(key string, keyStart int64) (reflect.Type, bool)) error {
+	for v.dec.More() {
+		keyStart := v.tokenStart()
+		tok, err := v.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+
+		typ, ok := field(key, keyStart)
+		if !ok {
+			next, err := v.dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := v.skip(next); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := v.value(typ, pointer+"/"+escapePointer(key)); err != nil {
+			return err
+		}
+	}
+	_, err := v.dec.Token()
+	return err
+}
+
+// skip consumes the rest of a value whose first token was read
+func (v *schemaValidator) skip(tok json.Token) error {
+	if tok != json.Delim('{') && tok != json.Delim('[') {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		next, err := v.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch next {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// tokenStart returns the offset of the next token, skipping whitespace and
+// separators after the current decoder position
+func (v *schemaValidator) tokenStart() int64 {
+	offset := v.dec.InputOffset()
+	for offset < int64(len(v.data)) && strings.IndexByte(" \t\r\n,:", v.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// customJSON reports whether a type decodes itself, in which case its JSON
+// structure can't be derived from its fields
+func customJSON(typ reflect.Type) bool {
+	return reflect.PointerTo(typ).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem())
+}
+
+// escapePointer escapes a key for use in a JSON pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// structFields returns the JSON fields of a struct, flattening embedded structs
+func structFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embedded := range structFields(field.Type) {
+				if _, exists := fields[embeddedName]; !exists {
+					fields[embeddedName] = embedded
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// lookupField finds a field by exact name, then case-insensitively
+func lookupField(fields map[string]reflect.StructField, key string) (reflect.StructField, bool) {
+	if field, ok := fields[key]; ok {
+		return field, true
+	}
+	for name, field := range fields {
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestField returns the known field closest to an unknown one, if any is close
+func suggestField(fields map[string]reflect.StructField, key string) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if distance := editDistance(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance ||
+			(distance == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// schemaTypeName describes a Go type in JSON terms
+func schemaTypeName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "integer"
+	}
+}
+
+// tokenTypeName describes a JSON token
+func tokenTypeName(tok json.Token) string {
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return "object"
+		}
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	default:
+		return "null"
+	}
+}
+
+// jsonSchema generates a JSON Schema (draft 2020-12) for a Go type, with
+// named struct types under $defs
+func jsonSchema(typ reflect.Type, title string) map[string]interface{} {
+	defs := make(map[string]interface{})
+	schema := schemaFor(typ, defs, true)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = title
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema
+}
+
+// schemaFor generates the schema of a type, registering named structs in defs
+func schemaFor(typ reflect.Type, defs map[string]interface{}, root bool) map[string]interface{} {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if customJSON(typ) {
+		return map[string]interface{}{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if !root && typ.Name() != "" {
+			if _, ok := defs[typ.Name()]; !ok {
+				defs[typ.Name()] = nil // placeholder for recursive types
+				defs[typ.Name()] = structSchema(typ, defs)
+			}
+			return map[string]interface{}{"$ref": "#/$defs/" + typ.Name()}
+		}
+		return structSchema(typ, defs)
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(typ.Elem(), defs, false),
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(typ.Elem(), defs, false),
+		}
+	case reflect.String:
+		defs["Secret"] = map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{secretKey: map[string]interface{}{"type": "string"}},
+			"required":             []string{secretKey},
+			"additionalProperties": false,
+		}
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"$ref": "#/$defs/Secret"},
+			},
+		}
+	default:
+		return map[string]interface{}{"type": schemaTypeName(typ)}
+	}
+}
+
+// structSchema generates the schema of a struct type
+func structSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	fields := structFields(typ)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		properties[name] = schemaFor(fields[name].Type, defs, false)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// configSchemas are the published schemas by name
+var configSchemas = map[string]func() map[string]interface{}{
+	"config": func() map[string]interface{} { return jsonSchema(reflect.TypeOf(Config{}), "nmock configuration") },
+	"plugin": func() map[string]interface{} { return jsonSchema(reflect.TypeOf(Plugin{}), "nmock plugin") },
+}
+
+// setupSchemaAPI registers the JSON Schema admin API
+func (ms *MockServer) setupSchemaAPI() {
+	// Get the JSON Schema of configuration or plugin files
+	ms.router.HandleFunc("/_admin/schema/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(mux.Vars(r)["name"], ".json")
+		schema, ok := configSchemas[name]
+		w.Header().Set("Content-Type", "application/schema+json")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown schema, use config or plugin"})
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(schema())
+	}).Methods("GET")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestValidateJSON tests error reporting for configuration files
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{
+			name: "typo in endpoint field",
+			data: `{
+  "endpoints": [
+    {"path": "/api", "method": "GET", "satus_code": 200}
+  ]
+}`,
+			expected: []string{`line 3, column 39: /endpoints/0/satus_code: unknown field "satus_code", did you mean "status_code"?`},
+		},
+		{
+			name:     "wrong type",
+			data:     `{"port": 9000, "endpoints": [{"path": "/a", "delay": "100"}]}`,
+			expected: []string{`line 1, column 10: /port: expected string, got number`, `line 1, column 54: /endpoints/0/delay: expected integer, got string`},
+		},
+		{
+			name:     "non-integer number",
+			data:     `{"read_timeout": 1.5}`,
+			expected: []string{`line 1, column 18: /read_timeout: expected integer, got 1.5`},
+		},
+		{
+			name:     "syntax error",
+			data:     "{\n  \"port\": \"9000\",\n}",
+			expected: []string{`line 3, column 1: /: invalid character '}' looking for beginning of object key string`},
+		},
+		{
+			name:     "free-form values and embedded fields",
+			data:     `{"$schema": "x", "endpoints": [{"path": "/a", "response": {"anything": [1, "two"]}}], "default_response": {"status_code": 200, "path_prefixes": {"/v2/": {"response": null}}}}`,
+			expected: nil,
+		},
+		{
+			name:     "case-insensitive field names",
+			data:     `{"Port": "9000"}`,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		errs := validateJSON([]byte(test.data), reflect.TypeOf(Config{}))
+		var messages []string
+		for _, e := range errs {
+			messages = append(messages, e.String())
+		}
+		if strings.Join(messages, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, messages)
+		}
+	}
+}
+
+// TestBundledConfigsAreValid tests that the shipped configuration files validate
+func TestBundledConfigsAreValid(t *testing.T) {
+	files := []struct {
+		pattern string
+		typ     reflect.Type
+	}{
+		{"config.json", reflect.TypeOf(Config{})},
+		{"plugins/*.json", reflect.TypeOf(Plugin{})},
+		{"test-plugins/*.json", reflect.TypeOf(Plugin{})},
+	}
+
+	for _, f := range files {
+		matches, _ := filepath.Glob(f.pattern)
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", match, err)
+			}
+			if errs := validateJSON(data, f.typ); len(errs) > 0 {
+				t.Errorf("%v", schemaErrors(match, errs))
+			}
+		}
+	}
+}
+
+// TestJSONSchema tests the generated JSON Schema
+func TestJSONSchema(t *testing.T) {
+	schema := configSchemas["config"]()
+
+	if schema["additionalProperties"] != false {
+		t.Error("Expected unknown top-level properties to be rejected")
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if ref := properties["endpoints"].(map[string]interface{})["items"]; !reflect.DeepEqual(ref, map[string]interface{}{"$ref": "#/$defs/Endpoint"}) {
+		t.Errorf("Expected endpoints to reference the Endpoint definition, got %v", ref)
+	}
+
+	endpoint := schema["$defs"].(map[string]interface{})["Endpoint"].(map[string]interface{})
+	fields := endpoint["properties"].(map[string]interface{})
+	if !reflect.DeepEqual(fields["status_code"], map[string]interface{}{"type": "integer"}) {
+		t.Errorf("Expected status_code to be an integer, got %v", fields["status_code"])
+	}
+	if !reflect.DeepEqual(fields["response"], map[string]interface{}{}) {
+		t.Errorf("Expected response to accept any value, got %v", fields["response"])
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SearchConfig answers full-text searches over the rows of a dataset file or
+// the items of a resource, for testing search UIs without a search backend
+type SearchConfig struct {
+	File        string             `json:"file,omitempty"`          // CSV or JSON file searched, like a dataset
+	Resource    string             `json:"resource,omitempty"`      // name of a resource searched instead of a file
+	Fields      map[string]float64 `json:"fields,omitempty"`        // searched fields and their weights (default: all fields, weight 1)
+	Filters     []string           `json:"filters,omitempty"`       // fields that query parameters filter by (default: any field)
+	PageSize    int                `json:"page_size,omitempty"`     // results per page (default: 10)
+	MaxPageSize int                `json:"max_page_size,omitempty"` // largest per_page accepted (default: 100)
+}
+
+// searchParams are the query parameters that aren't field filters
+var searchParams = []string{"q", "page", "per_page"}
+
+// searchHit is an item matching a search
+type searchHit struct {
+	Score float64                `json:"score"`
+	Item  map[string]interface{} `json:"item"`
+}
+
+// searcher searches the rows of a dataset file or the items of a resource
+type searcher struct {
+	config    SearchConfig
+	data      *dataset
+	resources *resourceStore
+}
+
+// newSearcher checks a search configuration and loads its file
+func newSearcher(config SearchConfig, resources *resourceStore) (*searcher, error) {
+	if (config.File == "") == (config.Resource == "") {
+		return nil, fmt.Errorf("either file or resource is required")
+	}
+	for field, weight := range config.Fields {
+		if weight <= 0 {
+			return nil, fmt.Errorf("weight of field %s must be positive", field)
+		}
+	}
+	if config.PageSize < 0 || config.MaxPageSize < 0 {
+		return nil, fmt.Errorf("page sizes must not be negative")
+	}
+	if config.PageSize == 0 {
+		config.PageSize = 10
+	}
+	if config.MaxPageSize == 0 {
+		config.MaxPageSize = max(100, config.PageSize)
+	}
+	if config.PageSize > config.MaxPageSize {
+		return nil, fmt.Errorf("page_size must not exceed max_page_size")
+	}
+
+	s := &searcher{config: config, resources: resources}
+	if config.File != "" {
+		if err := validateDatasetFile(config.File); err != nil {
+			return nil, err
+		}
+		s.data = &dataset{config: Dataset{File: config.File}}
+		if _, err := s.data.load(); err != nil {
+			return nil, err
+		}
+	} else if _, ok := resources.visibleItems(config.Resource); !ok {
+		return nil, fmt.Errorf("unknown resource %q", config.Resource)
+	}
+	return s, nil
+}
+
+// visibleItems returns copies of the items of a resource that aren't
+// soft-deleted
+func (rs *resourceStore) visibleItems(name string) ([]resourceItem, bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	c, ok := rs.collections[name]
+	if !ok {
+		return nil, false
+	}
+	visible := c.visible(c.items, false)
+	items := make([]resourceItem, 0, len(visible))
+	for _, item := range visible {
+		items = append(items, copyItem(item))
+	}
+	return items, true
+}
+
+// rows returns the searched rows
+func (s *searcher) rows() ([]map[string]interface{}, error) {
+	if s.data != nil {
+		data, err := s.data.load()
+		if err != nil {
+			return nil, err
+		}
+		return data.rows, nil
+	}
+	items, ok := s.resources.visibleItems(s.config.Resource)
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %q", s.config.Resource)
+	}
+	return items, nil
+}
+
+// searchTokens splits text into lowercase words
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchText returns the text of a field value. Lists are searched by their
+// values; objects aren't searched.
+func searchText(value interface{}) string {
+	switch value := value.(type) {
+	case nil, map[string]interface{}:
+		return ""
+	case []interface{}:
+		parts := make([]string, 0, len(value))
+		for _, element := range value {
+			parts = append(parts, searchText(element))
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprint(value)
+}
+
+// score rates how well a row matches the search terms. Every term must
+// match a field: a whole word counts 3, the start of a word 2 and part of a
+// word 1, multiplied by the weight of the field. It returns 0 if a term
+// doesn't match.
+func (s *searcher) score(row map[string]interface{}, terms []string) float64 {
+	fields := s.config.Fields
+	if len(fields) == 0 {
+		fields = make(map[string]float64, len(row))
+		for field := range row {
+			fields[field] = 1
+		}
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	tokens := make([][]string, len(names))
+	for i, field := range names {
+		tokens[i] = searchTokens(searchText(fieldValue(row, field)))
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		termScore := 0.0
+		for i, field := range names {
+			match := 0
+			for _, token := range tokens[i] {
+				switch {
+				case token == term:
+					match = 3
+				case strings.HasPrefix(token, term):
+					match = max(match, 2)
+				case strings.Contains(token, term):
+					match = max(match, 1)
+				}
+				if match == 3 {
+					break
+				}
+			}
+			termScore += float64(match) * fields[field]
+		}
+		if termScore == 0 {
+			return 0
+		}
+		total += termScore
+	}
+	return total
+}
+
+// matchesFilters reports whether a row has the values of the filter
+// parameters of a search. Repeated parameters accept any of their values.
+func (s *searcher) matchesFilters(row map[string]interface{}, filters map[string][]string) bool {
+	for field, values := range filters {
+		value := fieldValue(row, field)
+		if value == nil {
+			return false
+		}
+		text := fmt.Sprint(value)
+		if !slices.ContainsFunc(values, func(expected string) bool { return strings.EqualFold(text, expected) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// respond returns the encoded page of results of a search and its status.
+// Results are ordered by score, and rows with the same score keep the order
+// of the file or resource, so that the same search always gives the same
+// page.
+func (s *searcher) respond(r *http.Request) ([]byte, int) {
+	fail := func(status int, err error) ([]byte, int) {
+		body, _ := encodeResponse(map[string]string{"error": err.Error()})
+		return body, status
+	}
+
+	query := r.URL.Query()
+	page, perPage := 1, s.config.PageSize
+	for name, target := range map[string]*int{"page": &page, "per_page": &perPage} {
+		if !query.Has(name) {
+			continue
+		}
+		n, err := strconv.Atoi(query.Get(name))
+		if err != nil || n < 1 {
+			return fail(http.StatusBadRequest, fmt.Errorf("invalid %s: %q", name, query.Get(name)))
+		}
+		*target = n
+	}
+	if perPage > s.config.MaxPageSize {
+		return fail(http.StatusBadRequest, fmt.Errorf("per_page must not exceed %d", s.config.MaxPageSize))
+	}
+
+	filters := make(map[string][]string)
+	for name, values := range query {
+		if slices.Contains(searchParams, name) || (len(s.config.Filters) > 0 && !slices.Contains(s.config.Filters, name)) {
+			continue
+		}
+		filters[name] = values
+	}
+
+	rows, err := s.rows()
+	if err != nil {
+		return fail(http.StatusInternalServerError, err)
+	}
+
+	terms := searchTokens(query.Get("q"))
+	hits := make([]searchHit, 0)
+	for _, row := range rows {
+		if !s.matchesFilters(row, filters) {
+			continue
+		}
+		score := 0.0
+		if len(terms) > 0 {
+			if score = s.score(row, terms); score == 0 {
+				continue
+			}
+		}
+		hits = append(hits, searchHit{Score: score, Item: row})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	total := len(hits)
+	start := min((page-1)*perPage, total)
+	end := min(start+perPage, total)
+	body, err := encodeResponse(map[string]interface{}{
+		"query":    query.Get("q"),
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+		"pages":    (total + perPage - 1) / perPage,
+		"results":  hits[start:end],
+	})
+	if err != nil {
+		return fail(http.StatusInternalServerError, err)
+	}
+	return body, http.StatusOK
+}
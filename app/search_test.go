@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSearchEndpoint tests ranked searches over datasets and resources
+func TestSearchEndpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "products.csv")
+	os.WriteFile(file, []byte("id,name,description,category\n"+
+		"1,Red Shirt,Cotton shirt in red,apparel\n"+
+		"2,Shirtwaist Dress,A dress styled like a shirt,apparel\n"+
+		"3,Red Mug,Ceramic mug,kitchen\n"+
+		"4,T-Shirt Print,Poster of a shirt,art\n"+
+		"5,Overshirt,Heavy red overshirt,apparel\n"), 0644)
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/api/search", Method: "GET", StatusCode: 200, Search: &SearchConfig{File: file, Fields: map[string]float64{"name": 2, "description": 1}, PageSize: 2}},
+			{Path: "/api/users/search", Method: "GET", StatusCode: 200, Search: &SearchConfig{Resource: "users", Filters: []string{"role"}}},
+		},
+	}
+	err := server.resources.configure([]Resource{{Name: "users", Path: "/api/users", SoftDelete: true, Seed: []map[string]interface{}{
+		{"id": float64(1), "name": "Alice Smith", "role": "admin"},
+		{"id": float64(2), "name": "Bob Smithers", "role": "user"},
+		{"id": float64(3), "name": "Carol Smith", "role": "user"},
+	}}})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	type response struct {
+		Total   int         `json:"total"`
+		Page    int         `json:"page"`
+		PerPage int         `json:"per_page"`
+		Pages   int         `json:"pages"`
+		Results []searchHit `json:"results"`
+		Error   string      `json:"error"`
+	}
+	search := func(url string) (int, response) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		var result response
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid response for %s: %s", url, w.Body.String())
+		}
+		return w.Code, result
+	}
+	ids := func(result response) []string {
+		var ids []string
+		for _, hit := range result.Results {
+			ids = append(ids, hit.Item["id"].(string))
+		}
+		return ids
+	}
+
+	// Whole words rank above prefixes and parts of words, names above
+	// descriptions, and equal scores keep the file order
+	code, result := search("/api/search?q=shirt&per_page=10")
+	if code != 200 || result.Total != 4 || !equalStrings(ids(result), []string{"1", "4", "2", "5"}) {
+		t.Fatalf("Unexpected ranking %d %+v", code, result)
+	}
+	if result.Results[1].Score != 9 || result.Results[2].Score != 7 || result.Results[3].Score != 3 {
+		t.Errorf("Unexpected scores %+v", result.Results)
+	}
+
+	// All terms must match, and filters and paging apply
+	if _, result := search("/api/search?q=red+shirt"); !equalStrings(ids(result), []string{"1", "5"}) {
+		t.Errorf("Expected items matching all terms, got %v", ids(result))
+	}
+	_, result = search("/api/search?q=shirt&category=Apparel&page=2")
+	if result.Total != 3 || result.Page != 2 || result.Pages != 2 || !equalStrings(ids(result), []string{"5"}) {
+		t.Errorf("Unexpected filtered page %+v", result)
+	}
+	if _, result := search("/api/search?category=kitchen&category=art"); !equalStrings(ids(result), []string{"3", "4"}) || result.Results[0].Score != 0 {
+		t.Errorf("Expected filters without terms to keep the file order, got %+v", result.Results)
+	}
+	if _, result := search("/api/search?q=shirt&page=9"); result.Total != 4 || len(result.Results) != 0 {
+		t.Errorf("Expected an empty page past the results, got %+v", result)
+	}
+	for _, url := range []string{"/api/search?page=0", "/api/search?per_page=x", "/api/search?per_page=101"} {
+		if code, result := search(url); code != 400 || result.Error == "" {
+			t.Errorf("Expected %s to be rejected, got %d", url, code)
+		}
+	}
+
+	// Resources are searched as they are, without soft-deleted items, and
+	// only the configured filters apply
+	server.resources.collections["users"].softDelete(0)
+	_, result = search("/api/users/search?q=smith&cache=1")
+	if result.Total != 2 || result.Results[0].Item["name"] != "Carol Smith" {
+		t.Errorf("Unexpected resource search %+v", result)
+	}
+	if _, result := search("/api/users/search?q=smith&role=user"); result.Total != 2 {
+		t.Errorf("Expected the role filter to apply, got %+v", result)
+	}
+
+	for _, config := range []SearchConfig{{}, {File: file, Resource: "users"}, {Resource: "missing"}, {File: "data.txt"}, {File: file, PageSize: 50, MaxPageSize: 20}} {
+		if _, err := newSearcher(config, server.resources); err == nil {
+			t.Errorf("Expected %+v to be rejected", config)
+		}
+	}
+}
+
+// equalStrings reports whether two lists of strings are equal
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
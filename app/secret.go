@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretKey marks a secret reference such as {"$secret": "API_KEY"} in
+// configuration and plugin files
+const secretKey = "$secret"
+
+// secretMask replaces secrets found inside other values
+const secretMask = "******"
+
+// lookupSecret returns the value of a secret reference: an environment
+// variable, or the content of a file for references starting with "file:"
+func lookupSecret(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret %s: %v", ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("secret %s is not set", ref)
+	}
+	return value, nil
+}
+
+// secretStore remembers the secrets resolved in loaded files, so that admin
+// APIs and saved files never contain their values
+type secretStore struct {
+	mutex sync.RWMutex
+	refs  map[string]string // secret value to reference
+}
+
+// newSecretStore creates an empty secret store
+func newSecretStore() *secretStore {
+	return &secretStore{refs: make(map[string]string)}
+}
+
+// resolve replaces the secret references of a JSON document with their
+// values, using lookup. Documents without references are returned as is.
+func (s *secretStore) resolve(data []byte, lookup func(string) (string, error)) ([]byte, error) {
+	if !bytes.Contains(data, []byte(`"`+secretKey+`"`)) {
+		return data, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var resolveValue func(value interface{}) (interface{}, error)
+	resolveValue = func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if ref, ok := v[secretKey].(string); ok && len(v) == 1 {
+				secret, err := lookup(ref)
+				if err != nil {
+					return nil, err
+				}
+				s.add(ref, secret)
+				return secret, nil
+			}
+			for key, item := range v {
+				resolved, err := resolveValue(item)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = resolved
+			}
+		case []interface{}:
+			for i, item := range v {
+				resolved, err := resolveValue(item)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = resolved
+			}
+		}
+		return value, nil
+	}
+
+	resolved, err := resolveValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resolved)
+}
+
+// add remembers a resolved secret. Empty values can't be told apart from
+// other values and are not hidden.
+func (s *secretStore) add(ref, value string) {
+	if value == "" {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refs[value] = ref
+}
+
+// secrets returns the known secret values, longest first so that secrets
+// containing others are replaced first
+func (s *secretStore) secrets() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	values := make([]string, 0, len(s.refs))
+	for value := range s.refs {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return values
+}
+
+// redactJSON hides secrets in an encoded JSON document: strings that are a
+// secret become its reference again, and secrets inside other strings are
+// masked
+func (s *secretStore) redactJSON(data []byte) []byte {
+	values := s.secrets()
+	if len(values) == 0 {
+		return data
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// Whole strings are marked first, so that masking secrets inside other
+	// strings doesn't touch the references put back
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		encoded[i], _ = json.Marshal(value)
+		data = bytes.ReplaceAll(data, encoded[i], secretSentinel(i))
+	}
+	for i := range values {
+		data = bytes.ReplaceAll(data, encoded[i][1:len(encoded[i])-1], []byte(secretMask))
+	}
+	for i, value := range values {
+		reference, _ := json.Marshal(map[string]string{secretKey: s.refs[value]})
+		data = bytes.ReplaceAll(data, secretSentinel(i), reference)
+	}
+	return data
+}
+
+// secretSentinel marks a redacted string with bytes that encoded JSON can't
+// contain
+func secretSentinel(i int) []byte {
+	return append(append([]byte{1}, bytes.Repeat([]byte{0}, i+1)...), 1)
+}
+
+// redactBytes masks secrets in raw data such as recorded bodies
+func (s *secretStore) redactBytes(data []byte) []byte {
+	for _, value := range s.secrets() {
+		data = bytes.ReplaceAll(data, []byte(value), []byte(secretMask))
+	}
+	return data
+}
+
+// redactEntry returns a copy of a history entry with secrets masked
+func (s *secretStore) redactEntry(entry historyEntry) historyEntry {
+	if len(s.secrets()) == 0 {
+		return entry
+	}
+
+	entry.URL = string(s.redactBytes([]byte(entry.URL)))
+	entry.Path = string(s.redactBytes([]byte(entry.Path)))
+	entry.RequestBody = s.redactBytes(entry.RequestBody)
+	entry.ResponseBody = s.redactBytes(entry.ResponseBody)
+	for _, header := range []*http.Header{&entry.RequestHeaders, &entry.ResponseHeaders} {
+		redacted := make(http.Header, len(*header))
+		for key, values := range *header {
+			for _, value := range values {
+				redacted[key] = append(redacted[key], string(s.redactBytes([]byte(value))))
+			}
+		}
+		*header = redacted
+	}
+	return entry
+}
+
+// ignoreSecret resolves secret references to empty values, for reading
+// files without their secrets
+func ignoreSecret(string) (string, error) {
+	return "", nil
+}
+
+// writeRedactedJSON writes a value as a JSON response with secrets hidden
+func (ms *MockServer) writeRedactedJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Write(append(ms.secrets.redactJSON(data), '\n'))
+}
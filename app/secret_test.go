@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSecretValues tests resolving secret references and hiding their values
+func TestSecretValues(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "client-secret")
+	os.WriteFile(keyFile, []byte("file-secret-456\n"), 0644)
+	t.Setenv("OAUTH_SIGNING_KEY", "env-secret-123")
+
+	pluginsDir := filepath.Join(dir, "plugins")
+	os.Mkdir(pluginsDir, 0755)
+	plugin := `{
+  "name": "oauth",
+  "enabled": true,
+  "endpoints": [{
+    "path": "/oauth/keys",
+    "method": "GET",
+    "headers": {"X-Client-Secret": {"$secret": "file:` + keyFile + `"}},
+    "response": {"keys": [{"k": {"$secret": "OAUTH_SIGNING_KEY"}}], "note": "key env-secret-123"}
+  }]
+}`
+	pluginFile := filepath.Join(pluginsDir, "oauth.json")
+	os.WriteFile(pluginFile, []byte(plugin), 0644)
+	if errs := validateJSON([]byte(plugin), reflect.TypeOf(Plugin{})); len(errs) > 0 {
+		t.Fatalf("Expected secret references to be valid, got %v", errs)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000"}
+	server.pluginsDir = pluginsDir
+	server.LoadPlugins()
+	server.SetupRoutes()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/oauth/keys", nil))
+	if !strings.Contains(w.Body.String(), `"k":"env-secret-123"`) || w.Header().Get("X-Client-Secret") != "file-secret-456" {
+		t.Fatalf("Expected the endpoint to serve the secrets, got %v %s", w.Header(), w.Body.String())
+	}
+
+	for _, path := range []string{"/_admin/plugins", "/_admin/plugins/oauth", "/_admin/requests/export?format=jsonl"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body := w.Body.String()
+		if strings.Contains(body, "env-secret-123") || strings.Contains(body, "file-secret-456") {
+			t.Errorf("Expected %s to hide the secrets, got %s", path, body)
+		}
+		if path == "/_admin/plugins/oauth" && !strings.Contains(body, `{"$secret":"OAUTH_SIGNING_KEY"}`) {
+			t.Errorf("Expected %s to show the secret reference, got %s", path, body)
+		}
+	}
+
+	if err := server.savePlugin("oauth", server.plugins["oauth"]); err != nil {
+		t.Fatalf("Failed to save plugin: %v", err)
+	}
+	saved, _ := os.ReadFile(pluginFile)
+	if strings.Contains(string(saved), "secret-") || !strings.Contains(string(saved), `{"$secret":"OAUTH_SIGNING_KEY"}`) {
+		t.Errorf("Expected the saved plugin to keep the references, got %s", saved)
+	}
+
+	if _, err := newSecretStore().resolve([]byte(`{"token": {"$secret": "NMOCK_MISSING_SECRET"}}`), lookupSecret); err == nil || !strings.Contains(err.Error(), "NMOCK_MISSING_SECRET is not set") {
+		t.Errorf("Expected an error for a missing secret, got %v", err)
+	}
+}
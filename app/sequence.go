@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Behaviors of a response sequence after its last response
+const (
+	SequenceStick = "stick" // keep answering the last response
+	SequenceLoop  = "loop"  // start over with the first response
+)
+
+// responseSequence answers consecutive calls of an endpoint with its
+// responses in turn
+type responseSequence struct {
+	mutex     sync.Mutex
+	mode      string
+	responses []encodedResponse
+	calls     int
+}
+
+// newResponseSequence encodes the responses of a sequence
+func newResponseSequence(responses []MappedResponse, mode string) (*responseSequence, error) {
+	switch mode {
+	case "":
+		mode = SequenceStick
+	case SequenceStick, SequenceLoop:
+	default:
+		return nil, fmt.Errorf("unknown sequence %q, expected %q or %q", mode, SequenceStick, SequenceLoop)
+	}
+
+	seq := &responseSequence{mode: mode, responses: make([]encodedResponse, 0, len(responses))}
+	for i, response := range responses {
+		if err := validateStatusCode(response.StatusCode); err != nil {
+			return nil, fmt.Errorf("response %d: %v", i+1, err)
+		}
+		body, err := encodeResponse(response.Response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode response %d: %v", i+1, err)
+		}
+		seq.responses = append(seq.responses, encodedResponse{statusCode: response.StatusCode, body: body})
+	}
+	return seq, nil
+}
+
+// next returns the response of the next call
+func (s *responseSequence) next() encodedResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	index := s.position()
+	s.calls++
+	return s.responses[index]
+}
+
+// peek returns the response of the next call without counting a call
+func (s *responseSequence) peek() encodedResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.responses[s.position()]
+}
+
+// position returns the index of the response of the next call. The caller
+// must hold the mutex.
+func (s *responseSequence) position() int {
+	if s.calls < len(s.responses) {
+		return s.calls
+	}
+	if s.mode == SequenceLoop {
+		return s.calls % len(s.responses)
+	}
+	return len(s.responses) - 1
+}
+
+// reset starts the sequence over
+func (s *responseSequence) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls = 0
+}
+
+// snapshot returns the calls answered so far and the 1-based number of the
+// next response
+func (s *responseSequence) snapshot() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return map[string]int{"calls": s.calls, "next": s.position() + 1}
+}
+
+// sameAs reports whether two sequences answer the same responses
+func (s *responseSequence) sameAs(other *responseSequence) bool {
+	if s.mode != other.mode || len(s.responses) != len(other.responses) {
+		return false
+	}
+	for i, response := range s.responses {
+		if response.statusCode != other.responses[i].statusCode || !bytes.Equal(response.body, other.responses[i].body) {
+			return false
+		}
+	}
+	return true
+}
+
+// sequenceFor returns the response sequence of a route. The position of an
+// unchanged sequence is kept when routes are set up again, e.g. on reload,
+// and a new sequence starts at the position restored from a state file.
+func (ms *MockServer) sequenceFor(routeKey string, responses []MappedResponse, mode string) (*responseSequence, error) {
+	seq, err := newResponseSequence(responses, mode)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := ms.sequences[routeKey]; ok && existing.sameAs(seq) {
+		return existing, nil
+	}
+	if calls, restored := ms.restoredSequences[routeKey]; restored {
+		seq.calls = calls
+		delete(ms.restoredSequences, routeKey)
+	}
+	ms.sequences[routeKey] = seq
+	return seq, nil
+}
+
+// pruneSequences drops the sequences of endpoints that were removed or no
+// longer have responses, so that their positions aren't listed or saved in
+// state snapshots. Must be called with ms.mutex held.
+func (ms *MockServer) pruneSequences() {
+	sequenced := ms.routeKeys(func(ep *Endpoint) bool { return len(ep.Responses) > 0 })
+	for routeKey := range ms.sequences {
+		if !sequenced[routeKey] {
+			delete(ms.sequences, routeKey)
+		}
+	}
+}
+
+// setupSequenceAPI registers the admin API of response sequences
+func (ms *MockServer) setupSequenceAPI() {
+	// Show the position of every response sequence
+	ms.router.HandleFunc("/_admin/sequences", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		result := make(map[string]interface{}, len(ms.sequences))
+		for routeKey, seq := range ms.sequences {
+			result[routeKey] = seq.snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Start sequences over, all of them or the one of a route
+	ms.router.HandleFunc("/_admin/sequences", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if route := r.URL.Query().Get("route"); route != "" {
+			seq, ok := ms.sequences[route]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("No response sequence for %s", route)})
+				return
+			}
+			seq.reset()
+		} else {
+			for _, seq := range ms.sequences {
+				seq.reset()
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Response sequences reset"})
+	}).Methods("DELETE")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestResponseSequence tests answering consecutive calls with responses in turn
+func TestResponseSequence(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/jobs/1", Method: "GET", StatusCode: 200, Responses: []MappedResponse{
+				{StatusCode: 202, Response: map[string]interface{}{"status": "pending"}},
+				{StatusCode: 202, Response: map[string]interface{}{"status": "processing"}},
+				{Response: map[string]interface{}{"status": "done"}},
+			}},
+			{Path: "/lights", Method: "GET", Sequence: SequenceLoop, Responses: []MappedResponse{
+				{Response: "red"}, {Response: "green"},
+			}},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path string) (int, string) {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	expected := []struct {
+		status int
+		body   string
+	}{
+		{202, `{"status":"pending"}`},
+		{202, `{"status":"processing"}`},
+		{200, `{"status":"done"}`},
+		{200, `{"status":"done"}`},
+	}
+	for i, want := range expected {
+		if status, body := call("GET", "/jobs/1"); status != want.status || body != want.body+"\n" {
+			t.Errorf("Call %d: expected %d %s, got %d %s", i+1, want.status, want.body, status, body)
+		}
+	}
+
+	for i, want := range []string{"red", "green", "red"} {
+		if _, body := call("GET", "/lights"); body != want {
+			t.Errorf("Call %d: expected %s, got %s", i+1, want, body)
+		}
+	}
+
+	// Reloading routes keeps the position of unchanged sequences
+	server.SetupRoutes()
+	if _, body := call("GET", "/lights"); body != "green" {
+		t.Errorf("Expected the sequence to continue after a reload, got %s", body)
+	}
+
+	var positions map[string]map[string]int
+	_, body := call("GET", "/_admin/sequences")
+	if err := json.Unmarshal([]byte(body), &positions); err != nil {
+		t.Fatalf("Invalid sequences response: %v", err)
+	}
+	if positions["GET /jobs/1"]["calls"] != 4 || positions["GET /jobs/1"]["next"] != 3 || positions["GET /lights"]["next"] != 1 {
+		t.Errorf("Unexpected sequence positions %v", positions)
+	}
+
+	if status, _ := call("DELETE", "/_admin/sequences?route=GET%20/jobs/1"); status != 200 {
+		t.Errorf("Expected the sequence to be reset, got %d", status)
+	}
+	if _, body := call("GET", "/jobs/1"); body != `{"status":"pending"}`+"\n" {
+		t.Errorf("Expected the first response after a reset, got %s", body)
+	}
+	if _, body := call("GET", "/lights"); body != "red" {
+		t.Errorf("Expected other sequences to continue, got %s", body)
+	}
+	if status, _ := call("DELETE", "/_admin/sequences?route=GET%20/missing"); status != 404 {
+		t.Errorf("Expected 404 for an unknown route, got %d", status)
+	}
+
+	// Removed endpoints are no longer listed or saved in snapshots
+	server.config.Endpoints = server.config.Endpoints[1:]
+	server.SetupRoutes()
+	positions = nil
+	_, body = call("GET", "/_admin/sequences")
+	if err := json.Unmarshal([]byte(body), &positions); err != nil || len(positions) != 1 || positions["GET /lights"] == nil {
+		t.Errorf("Expected only the remaining sequence, got %s", body)
+	}
+	if state := server.captureState(); len(state.Sequences) != 1 {
+		t.Errorf("Expected only the remaining sequence in the snapshot, got %v", state.Sequences)
+	}
+}
+
+// TestNewResponseSequence tests rejecting invalid sequences
+func TestNewResponseSequence(t *testing.T) {
+	if _, err := newResponseSequence([]MappedResponse{{Response: "a"}}, "bounce"); err == nil {
+		t.Error("Expected an error for an unknown sequence mode")
+	}
+	if _, err := newResponseSequence([]MappedResponse{{StatusCode: 42, Response: "a"}}, ""); err == nil {
+		t.Error("Expected an error for an invalid status code")
+	}
+}
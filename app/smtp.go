@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SMTPConfig represents the SMTP listener capturing sent mail
+type SMTPConfig struct {
+	Port        string `json:"port"`                   // port of the SMTP listener
+	MaxMessages int    `json:"max_messages,omitempty"` // messages kept in the mailbox (default: 1000)
+}
+
+const (
+	// mailboxLimit is the default number of messages kept in the mailbox
+	mailboxLimit = 1000
+
+	// smtpMaxSize is the largest message accepted, in bytes
+	smtpMaxSize = 10 << 20
+
+	// smtpTimeout is how long a connection may stay idle between commands
+	smtpTimeout = 5 * time.Minute
+)
+
+// mailMessage is a message captured by the SMTP listener
+type mailMessage struct {
+	ID          int                 `json:"id"`
+	ReceivedAt  time.Time           `json:"received_at"`
+	From        string              `json:"from"` // envelope sender (MAIL FROM)
+	To          []string            `json:"to"`   // envelope recipients (RCPT TO)
+	Subject     string              `json:"subject"`
+	Headers     map[string][]string `json:"headers"`
+	Text        string              `json:"text,omitempty"`
+	HTML        string              `json:"html,omitempty"`
+	Attachments []mailAttachment    `json:"attachments,omitempty"`
+	Raw         string              `json:"raw,omitempty"`
+}
+
+// mailAttachment describes an attachment of a captured message
+type mailAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// mailFilter selects messages by case-insensitive substrings
+type mailFilter struct {
+	from    string
+	to      string
+	subject string
+	query   string // searched in the subject and bodies
+}
+
+// matches reports whether a message satisfies every set field of the filter
+func (f mailFilter) matches(message mailMessage) bool {
+	contains := func(value, search string) bool {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(search))
+	}
+
+	if f.from != "" && !contains(message.From, f.from) && !contains(strings.Join(message.Headers["From"], ","), f.from) {
+		return false
+	}
+	if f.to != "" && !contains(strings.Join(message.To, ","), f.to) {
+		return false
+	}
+	if f.subject != "" && !contains(message.Subject, f.subject) {
+		return false
+	}
+	if f.query != "" && !contains(message.Subject, f.query) && !contains(message.Text, f.query) && !contains(message.HTML, f.query) {
+		return false
+	}
+	return true
+}
+
+// mailbox stores captured messages and wakes up waiting readers
+type mailbox struct {
+	mutex    sync.Mutex
+	nextID   int
+	limit    int
+	messages []mailMessage
+	changed  chan struct{} // closed and replaced whenever a message arrives
+}
+
+// newMailbox creates an empty mailbox
+func newMailbox() *mailbox {
+	return &mailbox{
+		limit:   mailboxLimit,
+		changed: make(chan struct{}),
+	}
+}
+
+// setLimit changes the number of messages kept
+func (mb *mailbox) setLimit(limit int) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	if limit <= 0 {
+		limit = mailboxLimit
+	}
+	mb.limit = limit
+}
+
+// add stores a message
+func (mb *mailbox) add(message mailMessage) int {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	mb.nextID++
+	message.ID = mb.nextID
+	mb.messages = append(mb.messages, message)
+	if len(mb.messages) > mb.limit {
+		mb.messages = mb.messages[len(mb.messages)-mb.limit:]
+	}
+
+	close(mb.changed)
+	mb.changed = make(chan struct{})
+	return message.ID
+}
+
+// get returns a message by ID
+func (mb *mailbox) get(id int) (mailMessage, bool) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	for _, message := range mb.messages {
+		if message.ID == id {
+			return message, true
+		}
+	}
+	return mailMessage{}, false
+}
+
+// wait returns the messages matching a filter once at least count have been
+// received, or what has been received when the timeout or context ends
+func (mb *mailbox) wait(r *http.Request, filter mailFilter, count int, timeout time.Duration) ([]mailMessage, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		mb.mutex.Lock()
+		messages := []mailMessage{}
+		for _, message := range mb.messages {
+			if filter.matches(message) {
+				message.Raw = ""
+				messages = append(messages, message)
+			}
+		}
+		changed := mb.changed
+		mb.mutex.Unlock()
+
+		if len(messages) >= count {
+			return messages, true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return messages, false
+		case <-r.Context().Done():
+			return messages, false
+		}
+	}
+}
+
+// snapshot returns a copy of the stored messages
+func (mb *mailbox) snapshot() []mailMessage {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	return append([]mailMessage(nil), mb.messages...)
+}
+
+// restore replaces the stored messages, continuing with the IDs after them
+func (mb *mailbox) restore(messages []mailMessage) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	mb.messages = append([]mailMessage(nil), messages...)
+	if len(mb.messages) > mb.limit {
+		mb.messages = mb.messages[len(mb.messages)-mb.limit:]
+	}
+	for _, message := range mb.messages {
+		mb.nextID = max(mb.nextID, message.ID)
+	}
+	close(mb.changed)
+	mb.changed = make(chan struct{})
+}
+
+// clear removes all messages
+func (mb *mailbox) clear() {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+	mb.messages = nil
+}
+
+// parseMail parses a raw message received with DATA. Messages that are not
+// valid RFC 5322 are kept with their raw content as text.
+func parseMail(raw []byte) mailMessage {
+	message := mailMessage{Raw: string(raw), Headers: map[string][]string{}}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		message.Text = string(raw)
+		return message
+	}
+
+	message.Headers = parsed.Header
+	decoder := new(mime.WordDecoder)
+	message.Subject = parsed.Header.Get("Subject")
+	if subject, err := decoder.DecodeHeader(message.Subject); err == nil {
+		message.Subject = subject
+	}
+
+	header := textproto.MIMEHeader(parsed.Header)
+	if err := parseMailPart(header, parsed.Body, &message); err != nil {
+		log.Printf("SMTP message body could not be fully parsed: %v", err)
+	}
+	return message
+}
+
+// parseMailPart reads a MIME part into the text, HTML and attachments of a
+// message, descending into multipart parts
+func parseMailPart(header textproto.MIMEHeader, body io.Reader, message *mailMessage) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := parseMailPart(part.Header, part, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	switch {
+	case disposition == "attachment" || filename != "" || !strings.HasPrefix(mediaType, "text/"):
+		message.Attachments = append(message.Attachments, mailAttachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Size:        len(data),
+		})
+	case mediaType == "text/html":
+		message.HTML += string(data)
+	default:
+		message.Text += string(data)
+	}
+	return nil
+}
+
+// decodeTransferEncoding decodes a base64 or quoted-printable body
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// smtpAddress extracts the address of a MAIL FROM or RCPT TO argument such
+// as "FROM:<alice@example.com> SIZE=100"
+func smtpAddress(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(arg, "<") {
+		end := strings.Index(arg, ">")
+		if end < 0 {
+			return "", false
+		}
+		return arg[1:end], true
+	}
+	address, _, _ := strings.Cut(arg, " ")
+	return address, true
+}
+
+// startSMTP runs the SMTP listener until it fails
+func (ms *MockServer) startSMTP(config SMTPConfig) {
+	ms.mailbox.setLimit(config.MaxMessages)
+
+	listener, err := net.Listen("tcp", ":"+config.Port)
+	if err != nil {
+		log.Printf("Failed to start SMTP listener: %v", err)
+		return
+	}
+	log.Printf("SMTP mock available at: localhost:%s", config.Port)
+	ms.serveSMTP(listener)
+}
+
+// serveSMTP accepts SMTP connections until the listener is closed
+func (ms *MockServer) serveSMTP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go ms.handleSMTP(conn)
+	}
+}
+
+// handleSMTP runs an SMTP session. Any sender, recipient and credentials
+// are accepted and every message is stored in the mailbox.
+func (ms *MockServer) handleSMTP(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+
+	var from string
+	var to []string
+	started := false // MAIL was accepted; the sender may be empty for bounces
+	reset := func() {
+		from = ""
+		to = nil
+		started = false
+	}
+
+	text.PrintfLine("220 nmock ESMTP ready")
+	for {
+		conn.SetDeadline(time.Now().Add(smtpTimeout))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			text.PrintfLine("250 nmock")
+		case "EHLO":
+			text.PrintfLine("250-nmock")
+			text.PrintfLine("250-8BITMIME")
+			text.PrintfLine("250-AUTH PLAIN LOGIN")
+			text.PrintfLine("250 SIZE %d", smtpMaxSize)
+		case "AUTH":
+			if !smtpAuth(text, arg) {
+				return
+			}
+		case "MAIL":
+			address, ok := smtpAddress(arg, "FROM:")
+			if !ok {
+				text.PrintfLine("501 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			reset()
+			from = address
+			started = true
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			address, ok := smtpAddress(arg, "TO:")
+			switch {
+			case !ok:
+				text.PrintfLine("501 Syntax: RCPT TO:<address>")
+			case !started:
+				text.PrintfLine("503 Need MAIL command")
+			default:
+				to = append(to, address)
+				text.PrintfLine("250 OK")
+			}
+		case "DATA":
+			if len(to) == 0 {
+				text.PrintfLine("503 Need RCPT command")
+				continue
+			}
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			raw, err := io.ReadAll(io.LimitReader(text.DotReader(), smtpMaxSize+1))
+			if err != nil {
+				return
+			}
+			if len(raw) > smtpMaxSize {
+				// Drain the rest of the message before answering
+				io.Copy(io.Discard, text.DotReader())
+				text.PrintfLine("552 Message exceeds %d bytes", smtpMaxSize)
+				reset()
+				continue
+			}
+
+			message := parseMail(raw)
+			message.ReceivedAt = time.Now()
+			message.From = from
+			message.To = to
+			id := ms.mailbox.add(message)
+			log.Printf("SMTP %s -> %s - captured [mailbox]", from, strings.Join(to, ", "))
+			text.PrintfLine("250 OK: queued as %d", id)
+			reset()
+		case "RSET":
+			reset()
+			text.PrintfLine("250 OK")
+		case "NOOP":
+			text.PrintfLine("250 OK")
+		case "VRFY":
+			text.PrintfLine("252 Cannot verify user")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// smtpAuth accepts AUTH PLAIN and AUTH LOGIN with any credentials. It
+// returns false if the connection was lost.
+func smtpAuth(text *textproto.Conn, arg string) bool {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			text.PrintfLine("334 ")
+			if _, err := text.ReadLine(); err != nil {
+				return false
+			}
+		}
+	case "LOGIN":
+		steps := []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} // "Username:" and "Password:"
+		if initial != "" {
+			steps = steps[1:]
+		}
+		for _, prompt := range steps {
+			text.PrintfLine("334 %s", prompt)
+			if _, err := text.ReadLine(); err != nil {
+				return false
+			}
+		}
+	default:
+		text.PrintfLine("504 Unrecognized authentication type")
+		return true
+	}
+	text.PrintfLine("235 Authentication successful")
+	return true
+}
+
+// setupMailboxAPI registers the admin API of messages captured over SMTP
+func (ms *MockServer) setupMailboxAPI() {
+	// Search messages, optionally waiting for them
+	ms.router.HandleFunc("/_admin/mailbox", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := mailFilter{
+			from:    query.Get("from"),
+			to:      query.Get("to"),
+			subject: query.Get("subject"),
+			query:   query.Get("q"),
+		}
+
+		count := 1
+		if value, err := strconv.Atoi(query.Get("count")); err == nil && value > 0 {
+			count = value
+		}
+		waitMs, _ := strconv.Atoi(query.Get("wait"))
+
+		messages, ok := ms.mailbox.wait(r, filter, count, time.Duration(waitMs)*time.Millisecond)
+		if waitMs <= 0 {
+			ok = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count":    len(messages),
+			"messages": messages,
+		})
+	}).Methods("GET")
+
+	// Get a message including its raw content
+	ms.router.HandleFunc("/_admin/mailbox/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		message, ok := ms.mailbox.get(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Message %s not found", mux.Vars(r)["id"])})
+			return
+		}
+		json.NewEncoder(w).Encode(message)
+	}).Methods("GET")
+
+	// Clear the mailbox
+	ms.router.HandleFunc("/_admin/mailbox", func(w http.ResponseWriter, r *http.Request) {
+		ms.mailbox.clear()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Mailbox cleared"})
+	}).Methods("DELETE")
+}
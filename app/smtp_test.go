@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// TestSMTPMailbox tests capturing mail over SMTP and searching the mailbox
+func TestSMTPMailbox(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.SetupRoutes()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go server.serveSMTP(listener)
+	address := listener.Addr().String()
+
+	welcome := "From: Shop <shop@example.com>\r\n" +
+		"To: alice@example.com\r\n" +
+		"Subject: =?UTF-8?Q?Welcome_=E2=9C=93?=\r\n" +
+		"\r\n" +
+		"Your code is 123456\r\n"
+	auth := smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+	if err := smtp.SendMail(address, auth, "shop@example.com", []string{"alice@example.com"}, []byte(welcome)); err != nil {
+		t.Fatalf("Failed to send mail: %v", err)
+	}
+
+	invoice := "From: billing@example.com\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Invoice\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Total: 42 =E2=82=AC\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Total: 42</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0xLjQ=\r\n" +
+		"--outer--\r\n"
+	if err := smtp.SendMail(address, nil, "billing@example.com", []string{"bob@example.com", "carol@example.com"}, []byte(invoice)); err != nil {
+		t.Fatalf("Failed to send mail: %v", err)
+	}
+
+	type mailboxResult struct {
+		Count    int           `json:"count"`
+		Messages []mailMessage `json:"messages"`
+	}
+	search := func(query string) mailboxResult {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/mailbox"+query, nil))
+		if w.Code != 200 {
+			t.Fatalf("Expected status 200 for %q, got %d", query, w.Code)
+		}
+		var result mailboxResult
+		json.NewDecoder(w.Body).Decode(&result)
+		return result
+	}
+
+	if result := search(""); result.Count != 2 {
+		t.Fatalf("Expected 2 messages, got %d", result.Count)
+	}
+
+	result := search("?to=alice")
+	if result.Count != 1 {
+		t.Fatalf("Expected 1 message to alice, got %d", result.Count)
+	}
+	message := result.Messages[0]
+	if message.From != "shop@example.com" || message.Subject != "Welcome ✓" ||
+		strings.TrimSpace(message.Text) != "Your code is 123456" || message.Raw != "" {
+		t.Errorf("Unexpected message: %+v", message)
+	}
+
+	result = search("?q=total&from=billing")
+	if result.Count != 1 {
+		t.Fatalf("Expected 1 invoice, got %d", result.Count)
+	}
+	message = result.Messages[0]
+	if strings.TrimSpace(message.Text) != "Total: 42 €" || strings.TrimSpace(message.HTML) != "<p>Total: 42</p>" {
+		t.Errorf("Unexpected bodies: text %q, html %q", message.Text, message.HTML)
+	}
+	if len(message.To) != 2 || message.To[1] != "carol@example.com" {
+		t.Errorf("Expected both envelope recipients, got %v", message.To)
+	}
+	if len(message.Attachments) != 1 || message.Attachments[0].Filename != "invoice.pdf" ||
+		message.Attachments[0].ContentType != "application/pdf" || message.Attachments[0].Size != 8 {
+		t.Errorf("Unexpected attachments: %+v", message.Attachments)
+	}
+
+	if result := search("?subject=missing"); result.Count != 0 {
+		t.Errorf("Expected no messages, got %d", result.Count)
+	}
+
+	// A single message includes its raw content, with LF line endings
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/mailbox/1", nil))
+	var full mailMessage
+	json.NewDecoder(w.Body).Decode(&full)
+	if w.Code != 200 || full.Raw != strings.ReplaceAll(welcome, "\r\n", "\n") {
+		t.Errorf("Expected raw message, got status %d and %q", w.Code, full.Raw)
+	}
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/mailbox/99", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	// Waiting times out when too few messages match
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/_admin/mailbox?to=alice&count=2&wait=50", nil))
+	if w.Code != 408 {
+		t.Errorf("Expected status 408, got %d", w.Code)
+	}
+
+	// Clearing empties the mailbox
+	server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/_admin/mailbox", nil))
+	if result := search(""); result.Count != 0 {
+		t.Errorf("Expected empty mailbox, got %d messages", result.Count)
+	}
+}
+
+// TestSMTPCommandOrder tests that commands out of sequence are rejected
+func TestSMTPCommandOrder(t *testing.T) {
+	server := NewMockServer("")
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.handleSMTP(conn)
+
+	text := textproto.NewConn(client)
+	expect := func(command string, code int) {
+		t.Helper()
+		if command != "" {
+			text.PrintfLine("%s", command)
+		}
+		if _, _, err := text.ReadResponse(code); err != nil {
+			t.Errorf("%q: %v", command, err)
+		}
+	}
+
+	expect("", 220)
+	expect("HELO test", 250)
+	expect("RCPT TO:<alice@example.com>", 503)
+	expect("DATA", 503)
+	expect("MAIL FROM:<>", 250)
+	expect("RCPT TO:<alice@example.com>", 250)
+	expect("RSET", 250)
+	expect("DATA", 503)
+	expect("QUIT", 221)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// deletedField returns the field marking soft-deleted items of a resource
+func (r Resource) deletedField() string {
+	if r.DeletedField == "" {
+		return "deleted_at"
+	}
+	return r.DeletedField
+}
+
+// includeDeleted reports whether a request asks for soft-deleted items
+func includeDeleted(r *http.Request) bool {
+	return r.URL.Query().Get("include_deleted") == "true"
+}
+
+// isDeleted reports whether an item has been soft-deleted
+func (c *collection) isDeleted(item resourceItem) bool {
+	return c.config.SoftDelete && item[c.config.deletedField()] != nil
+}
+
+// findVisible returns the index of the item with an id like find, but
+// treats soft-deleted items as missing unless they are included
+func (c *collection) findVisible(id string, includeDeleted bool) int {
+	i := c.find(id)
+	if i >= 0 && !includeDeleted && c.isDeleted(c.items[i]) {
+		return -1
+	}
+	return i
+}
+
+// visible returns the items that aren't soft-deleted, or all of them if
+// deleted items are included
+func (c *collection) visible(items []resourceItem, includeDeleted bool) []resourceItem {
+	if !c.config.SoftDelete || includeDeleted {
+		return items
+	}
+	result := []resourceItem{}
+	for _, item := range items {
+		if !c.isDeleted(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// softDelete marks an item as deleted with the current time, keeping it
+// for a restore
+func (c *collection) softDelete(index int) {
+	item := copyItem(c.items[index])
+	item[c.config.deletedField()] = time.Now().UTC().Format(time.RFC3339)
+	c.items[index] = item
+}
+
+// restore removes the deleted mark of an item
+func (c *collection) restore(index int) resourceItem {
+	item := copyItem(c.items[index])
+	delete(item, c.config.deletedField())
+	c.items[index] = item
+	return item
+}
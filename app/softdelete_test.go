@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResourceSoftDelete tests marking items as deleted and restoring them
+func TestResourceSoftDelete(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	err := server.resources.configure([]Resource{
+		{Name: "users", Path: "/api/users", SoftDelete: true, Seed: []map[string]interface{}{
+			{"id": float64(1), "name": "Alice"},
+			{"id": float64(2), "name": "Bob"},
+		}},
+		{Name: "orders", Path: "/api/orders", Parent: &ResourceParent{Resource: "users", Field: "user_id"}, Seed: []map[string]interface{}{
+			{"id": float64(1), "user_id": float64(1)},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure resources: %v", err)
+	}
+	server.SetupRoutes()
+
+	call := func(method, path string) (int, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(`{"name": "x"}`)))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	if code, _ := call("DELETE", "/api/users/1"); code != 204 {
+		t.Fatalf("Expected the item to be deleted, got %d", code)
+	}
+
+	// Deleted items are hidden unless included
+	if _, body := call("GET", "/api/users"); body != `[{"id":2,"name":"Bob"}]` {
+		t.Errorf("Expected the deleted item to be excluded, got %s", body)
+	}
+	if _, body := call("GET", "/api/users?include_deleted=true"); !strings.Contains(body, `"deleted_at":"`) || !strings.Contains(body, "Bob") {
+		t.Errorf("Expected the deleted item to be included, got %s", body)
+	}
+	for _, request := range [][2]string{{"GET", "/api/users/1"}, {"PATCH", "/api/users/1"}, {"DELETE", "/api/users/1"}, {"GET", "/api/users/1/orders"}} {
+		if code, _ := call(request[0], request[1]); code != 404 {
+			t.Errorf("%s %s: expected the deleted item to be missing, got %d", request[0], request[1], code)
+		}
+	}
+	if code, _ := call("GET", "/api/users/1?include_deleted=true"); code != 200 {
+		t.Errorf("Expected the deleted item to be readable when included, got %d", code)
+	}
+	if code, _ := call("POST", "/api/users"); code != 201 {
+		t.Errorf("Expected new items to get the next id, got %d", code)
+	}
+
+	// Restoring brings back the item and its children
+	if code, body := call("POST", "/api/users/1/restore"); code != 200 || body != `{"id":1,"name":"Alice"}` {
+		t.Errorf("Expected the item to be restored, got %d %s", code, body)
+	}
+	if code, _ := call("POST", "/api/users/1/restore"); code != 409 {
+		t.Errorf("Expected restoring an item that isn't deleted to fail, got %d", code)
+	}
+	if code, body := call("GET", "/api/users/1/orders"); code != 200 || !strings.Contains(body, `"user_id":1`) {
+		t.Errorf("Expected the children of the restored item, got %d %s", code, body)
+	}
+
+	// Permanent deletion removes the item and its children
+	call("DELETE", "/api/users/1")
+	if code, _ := call("DELETE", "/api/users/1?permanent=true"); code != 204 {
+		t.Errorf("Expected the deleted item to be removed permanently, got %d", code)
+	}
+	if code, _ := call("POST", "/api/users/1/restore"); code != 404 {
+		t.Errorf("Expected a removed item not to be restored, got %d", code)
+	}
+	if _, body := call("GET", "/api/orders"); body != "[]" {
+		t.Errorf("Expected the children to be removed, got %s", body)
+	}
+
+	if validateResources([]Resource{{Name: "a", Path: "/a", SoftDelete: true, DeletedField: "id"}}) == nil {
+		t.Error("Expected the id field as deleted field to be rejected")
+	}
+}
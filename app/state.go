@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// StateConfig represents periodic snapshots of runtime state to disk
+type StateConfig struct {
+	File     string `json:"file,omitempty"`     // snapshot file (default: nmock-state.json)
+	Interval int    `json:"interval,omitempty"` // milliseconds between snapshots (default: 60000)
+}
+
+// runtimeState is the runtime data that is not part of the configuration
+// files and would otherwise be lost on restart
+type runtimeState struct {
+	SavedAt         time.Time                 `json:"saved_at"`
+	Endpoints       []Endpoint                `json:"endpoints,omitempty"`
+	Inbox           map[string][]inboxEntry   `json:"inbox,omitempty"`
+	History         []historyEntry            `json:"history,omitempty"`
+	Resources       map[string][]resourceItem `json:"resources,omitempty"`
+	Sequences       map[string]int            `json:"sequences,omitempty"`        // calls answered, by route
+	DisabledTags    []string                  `json:"disabled_tags,omitempty"`    // tag filters switched off
+	EndpointToggles map[string]bool           `json:"endpoint_toggles,omitempty"` // endpoint IDs switched on or off
+	Mailbox         []mailMessage             `json:"mailbox,omitempty"`
+}
+
+// stateFile returns the snapshot file of a state configuration
+func (sc StateConfig) stateFile() string {
+	if sc.File == "" {
+		return "nmock-state.json"
+	}
+	return sc.File
+}
+
+// captureState collects the current runtime state
+func (ms *MockServer) captureState() runtimeState {
+	ms.mutex.RLock()
+	endpoints := append([]Endpoint{}, ms.runtimeEndpoints...)
+	sequences := make(map[string]int, len(ms.sequences))
+	for route, seq := range ms.sequences {
+		if calls := seq.snapshot()["calls"]; calls > 0 {
+			sequences[route] = calls
+		}
+	}
+	tags := make([]string, 0, len(ms.disabledTags))
+	for tag := range ms.disabledTags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	toggles := maps.Clone(ms.endpointToggles)
+	ms.mutex.RUnlock()
+
+	return runtimeState{
+		SavedAt:         time.Now(),
+		Endpoints:       endpoints,
+		Inbox:           ms.inbox.snapshot(),
+		History:         ms.history.list(),
+		Resources:       ms.resources.snapshot(),
+		Sequences:       sequences,
+		DisabledTags:    tags,
+		EndpointToggles: toggles,
+		Mailbox:         ms.mailbox.snapshot(),
+	}
+}
+
+// saveState writes a snapshot of the runtime state
+func (ms *MockServer) saveState(file string) error {
+	data, err := json.Marshal(ms.captureState())
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+// restoreState loads a snapshot of the runtime state if one exists
+func (ms *MockServer) restoreState(file string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	var state runtimeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse state file: %v", err)
+	}
+
+	// Toggles apply when the routes are set up, and sequences continue
+	// where they were once their routes are set up
+	ms.mutex.Lock()
+	ms.runtimeEndpoints = state.Endpoints
+	ms.restoredSequences = state.Sequences
+	for _, tag := range state.DisabledTags {
+		ms.disabledTags[tag] = true
+	}
+	maps.Copy(ms.endpointToggles, state.EndpointToggles)
+	ms.mutex.Unlock()
+
+	ms.inbox.restore(state.Inbox)
+	ms.history.restore(state.History)
+	ms.resources.restore(state.Resources)
+	ms.mailbox.restore(state.Mailbox)
+	log.Printf("Restored runtime state saved at %s from %s", state.SavedAt.Format(time.RFC3339), file)
+	return nil
+}
+
+// runStateSnapshots saves the runtime state periodically
+func (ms *MockServer) runStateSnapshots(config StateConfig) {
+	interval := time.Duration(config.Interval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ms.saveState(config.stateFile()); err != nil {
+			log.Printf("Failed to save runtime state: %v", err)
+		}
+	}
+}
+
+// setupStateAPI registers the runtime state admin API
+func (ms *MockServer) setupStateAPI() {
+	// Save a snapshot immediately
+	ms.router.HandleFunc("/_admin/state/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		var config StateConfig
+		if ms.config.State != nil {
+			config = *ms.config.State
+		}
+		ms.mutex.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := ms.saveState(config.stateFile()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "State saved", "file": config.stateFile()})
+	}).Methods("POST")
+}
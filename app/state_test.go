@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStateSnapshotRestore tests saving runtime state and restoring it
+func TestStateSnapshotRestore(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	config := func() *Config {
+		return &Config{Port: "9000", PluginsDir: "plugins", State: &StateConfig{File: stateFile}, Endpoints: []Endpoint{
+			{Path: "/api/job", Method: "GET", StatusCode: 200, Responses: []MappedResponse{{Response: "pending"}, {Response: "running"}, {Response: "done"}}},
+			{ID: "legacy", Path: "/api/legacy", Method: "GET", StatusCode: 200, Response: "old"},
+			{Path: "/api/beta", Method: "GET", StatusCode: 200, Response: "beta", Tags: map[string]string{"beta": ""}},
+		}}
+	}
+	server := NewMockServer("")
+	server.config = config()
+	server.SetupRoutes()
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/job", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/_admin/endpoints/legacy/toggle", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/_admin/tags/beta/toggle", nil))
+	server.mailbox.add(mailMessage{Subject: "Welcome"})
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/_inbox/github", strings.NewReader(`{"action":"opened"}`)))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/missing", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/_admin/state/snapshot", nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected snapshot to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	restored := NewMockServer("")
+	if err := restored.restoreState(stateFile); err != nil {
+		t.Fatalf("Failed to restore state: %v", err)
+	}
+
+	channels := restored.inbox.snapshot()
+	if len(channels["github"]) != 1 || channels["github"][0].Body != `{"action":"opened"}` {
+		t.Errorf("Expected inbox to be restored, got %+v", channels)
+	}
+	if id := restored.inbox.add("github", inboxEntry{}); id != 2 {
+		t.Errorf("Expected IDs to continue after restore, got %d", id)
+	}
+
+	history := restored.history.list()
+	if len(history) != 3 || history[2].Path != "/api/missing" || history[2].StatusCode != 404 {
+		t.Errorf("Expected request history to be restored, got %+v", history)
+	}
+
+	// Sequences continue and toggles apply once the routes are set up
+	restored.config = config()
+	restored.SetupRoutes()
+	for path, expected := range map[string]string{"/api/job": "running", "/api/legacy": "", "/api/beta": ""} {
+		w := httptest.NewRecorder()
+		restored.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if (expected == "" && w.Code != 404) || (expected != "" && w.Body.String() != expected) {
+			t.Errorf("Expected %s to answer %q after restore, got %d %s", path, expected, w.Code, w.Body.String())
+		}
+	}
+	if message, ok := restored.mailbox.get(1); !ok || message.Subject != "Welcome" {
+		t.Errorf("Expected the mailbox to be restored, got %+v", message)
+	}
+	if id := restored.mailbox.add(mailMessage{}); id != 2 {
+		t.Errorf("Expected mailbox IDs to continue after restore, got %d", id)
+	}
+
+	// A missing snapshot file is not an error
+	if err := NewMockServer("").restoreState(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Expected missing state file to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatsDConfig pushes request metrics to a StatsD or DogStatsD server
+type StatsDConfig struct {
+	Address string            `json:"address"`          // host:port of the UDP listener
+	Prefix  string            `json:"prefix,omitempty"` // prepended to metric names, e.g. "nmock."
+	Format  string            `json:"format,omitempty"` // "dogstatsd" (default) or "statsd", which has no tags
+	Tags    map[string]string `json:"tags,omitempty"`   // tags added to all metrics
+}
+
+// statsdClient sends a counter and a timer for every recorded request
+type statsdClient struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	config StatsDConfig
+	tags   string // formatted server-wide tags
+}
+
+// newStatsDClient creates a client that sends nothing until configured
+func newStatsDClient() *statsdClient {
+	return &statsdClient{}
+}
+
+// configure connects to the configured server, replacing the previous
+// connection. A nil config stops sending metrics.
+func (s *statsdClient) configure(config *StatsDConfig) error {
+	var conn net.Conn
+	if config != nil {
+		if config.Format != "" && config.Format != "dogstatsd" && config.Format != "statsd" {
+			return fmt.Errorf("invalid statsd format %q, expected dogstatsd or statsd", config.Format)
+		}
+		var err error
+		if conn, err = net.Dial("udp", config.Address); err != nil {
+			return fmt.Errorf("invalid statsd address: %v", err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	if config != nil {
+		s.config = *config
+		s.tags = formatTags(config.Tags)
+	}
+	return nil
+}
+
+// formatTags formats tags in DogStatsD syntax, sorted by name
+func formatTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, sanitizeTag(name)+":"+sanitizeTag(tags[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// sanitizeTag replaces the characters that separate metrics and tags
+func sanitizeTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// observe sends the metrics of a recorded request. Tags of the endpoint
+// are added to the server-wide tags.
+func (s *statsdClient) observe(entry historyEntry, endpointTags string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return
+	}
+
+	suffix := ""
+	if s.config.Format != "statsd" {
+		route := entry.Route
+		if _, path, found := strings.Cut(route, " "); found {
+			route = path
+		}
+		tags := []string{
+			"method:" + sanitizeTag(entry.Method),
+			"status:" + strconv.Itoa(entry.StatusCode),
+		}
+		if route != "" {
+			tags = append(tags, "route:"+sanitizeTag(route))
+		}
+		if entry.Source != "" {
+			tags = append(tags, "source:"+sanitizeTag(entry.Source))
+		}
+		if entry.EndpointID != "" {
+			tags = append(tags, "endpoint_id:"+sanitizeTag(entry.EndpointID))
+		}
+		for _, extra := range []string{s.tags, endpointTags} {
+			if extra != "" {
+				tags = append(tags, extra)
+			}
+		}
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+
+	// Both metrics go into one datagram, separated by a newline
+	packet := fmt.Sprintf("%srequests:1|c%s\n%srequest_duration:%.3f|ms%s",
+		s.config.Prefix, suffix, s.config.Prefix, float64(entry.Duration.Microseconds())/1000, suffix)
+
+	// Metrics are best effort: a missing listener must not slow down or
+	// flood the log of the mock
+	s.conn.Write([]byte(packet))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestStatsDMetrics tests pushing request metrics with tags
+func TestStatsDMetrics(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/api/users/{id}", Method: "GET", StatusCode: 200, Response: "ok", Tags: map[string]string{"team": "identity"}}},
+	}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true, Tags: map[string]string{"team": "payments", "tier": "1"},
+		Endpoints: []Endpoint{{ID: "create-invoice", Path: "/api/invoices", Method: "POST", StatusCode: 201, Response: "ok", Tags: map[string]string{"tier": "0"}}}}
+	if err := server.statsd.configure(&StatsDConfig{Address: listener.LocalAddr().String(), Prefix: "nmock.", Tags: map[string]string{"env": "ci"}}); err != nil {
+		t.Fatalf("Failed to configure statsd: %v", err)
+	}
+	server.SetupRoutes()
+
+	receive := func() string {
+		t.Helper()
+		buf := make([]byte, 2048)
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to receive metrics: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	tests := []struct {
+		method, path string
+		expected     string
+	}{
+		{"GET", "/api/users/1", `^nmock\.requests:1\|c\|#method:GET,status:200,route:/api/users/\{id\},source:main,endpoint_id:[0-9a-f]{12},env:ci,team:identity\n` +
+			`nmock\.request_duration:[0-9.]+\|ms\|#method:GET,status:200,route:/api/users/\{id\},source:main,endpoint_id:[0-9a-f]{12},env:ci,team:identity$`},
+		{"POST", "/api/invoices", `^nmock\.requests:1\|c\|#method:POST,status:201,route:/api/invoices,source:billing,endpoint_id:create-invoice,env:ci,team:payments,tier:0\n`},
+		{"GET", "/missing", `^nmock\.requests:1\|c\|#method:GET,status:404,env:ci\n`},
+	}
+	for _, test := range tests {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(test.method, test.path, nil))
+		if packet := receive(); !regexp.MustCompile(test.expected).MatchString(packet) {
+			t.Errorf("Expected metrics matching %s, got %q", test.expected, packet)
+		}
+	}
+
+	// Plain StatsD has no tags
+	server.statsd.configure(&StatsDConfig{Address: listener.LocalAddr().String(), Format: "statsd"})
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users/1", nil))
+	if packet := receive(); !regexp.MustCompile(`^requests:1\|c\nrequest_duration:[0-9.]+\|ms$`).MatchString(packet) {
+		t.Errorf("Expected metrics without tags, got %q", packet)
+	}
+
+	if err := server.statsd.configure(&StatsDConfig{Address: "localhost:8125", Format: "graphite"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	server.statsd.configure(nil)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// validateStatusCode checks that a status code can be sent. Codes don't
+// need to be registered, but must have three digits.
+func validateStatusCode(code int) error {
+	if code != 0 && (code < 100 || code > 999) {
+		return fmt.Errorf("status code %d must be between 100 and 999", code)
+	}
+	return nil
+}
+
+// writeWithReason writes a response whose status line has a custom reason
+// phrase. net/http always sends its own phrase, so the response is written
+// to the hijacked connection, which is closed afterwards. This only works
+// for HTTP/1.x connections.
+func writeWithReason(w http.ResponseWriter, r *http.Request, statusCode int, reason string, body []byte) error {
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fmt.Errorf("reason phrases require HTTP/1.x: %v", err)
+	}
+	defer conn.Close()
+
+	header := w.Header().Clone()
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	header.Set("Connection", "close")
+	resp := &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + reason,
+		StatusCode:    statusCode,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+		Close:         true,
+	}
+	if err := resp.Write(buffered); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
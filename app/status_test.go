@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStatusCodes tests unregistered status codes and custom reason phrases
+func TestStatusCodes(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/unknown", Method: "GET", StatusCode: 520, Response: "origin error"},
+			{Path: "/reason", Method: "GET", StatusCode: 299, Reason: "Partially Fine", Response: "ok", Headers: map[string]string{"X-Upstream": "legacy"}},
+			{Path: "/invalid", Method: "GET", StatusCode: 1000, Response: "ok"},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// statusLine requests a path and returns the status line and body
+	statusLine := func(path string) (string, *http.Response, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		reader := bufio.NewReader(conn)
+		line, _ := reader.ReadString('\n')
+		resp, err := http.ReadResponse(bufio.NewReader(io.MultiReader(strings.NewReader(line), reader)), nil)
+		if err != nil {
+			t.Fatalf("Failed to read response for %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return strings.TrimSpace(line), resp, string(body)
+	}
+
+	if line, _, body := statusLine("/unknown"); !strings.HasPrefix(line, "HTTP/1.1 520 ") || body != "origin error" {
+		t.Errorf("Expected status 520, got %q %q", line, body)
+	}
+	line, resp, body := statusLine("/reason")
+	if line != "HTTP/1.1 299 Partially Fine" || body != "ok" || resp.Header.Get("X-Upstream") != "legacy" {
+		t.Errorf("Expected the custom reason phrase, got %q %q %v", line, body, resp.Header)
+	}
+	if line, _, _ := statusLine("/invalid"); !strings.HasPrefix(line, "HTTP/1.1 500 ") {
+		t.Errorf("Expected status 500 for an invalid code, got %q", line)
+	}
+}
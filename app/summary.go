@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// routeConflict is a route hidden by a route with the same method and path
+// in a group matched before it
+type routeConflict struct {
+	route      string // "METHOD /path"
+	source     string
+	winner     string // source of the route that answers instead
+	overridden bool   // replaced on purpose by an overlay plugin
+}
+
+// eachSource calls fn for every group with its source, in matching order
+func (rs *routeSnapshot) eachSource(fn func(source string, group *routeGroup)) {
+	fn("runtime", rs.runtime)
+	fn("main", rs.main)
+	for _, name := range rs.pluginOrder {
+		fn(name, rs.plugins[name])
+	}
+}
+
+// summary formats a table of the routes per source with their methods and
+// conflicts, followed by the conflicting routes and those replaced by
+// overlay plugins
+func (rs *routeSnapshot) summary() string {
+	var buf bytes.Buffer
+	table := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SOURCE\tROUTES\tMETHODS\tCONFLICTS")
+
+	owners := make(map[string]string) // route key to the source answering it
+	var conflicts []routeConflict
+	total, sources := 0, 0
+	rs.eachSource(func(source string, group *routeGroup) {
+		if len(group.routes) == 0 {
+			return
+		}
+		methods := make(map[string]bool)
+		count := 0
+		for _, route := range group.routes {
+			methods[route.method] = true
+			if winner, exists := owners[route.key()]; exists {
+				overridden := rs.overrides(winner, source)
+				conflicts = append(conflicts, routeConflict{route: route.key(), source: source, winner: winner, overridden: overridden})
+				if !overridden {
+					count++
+				}
+				continue
+			}
+			owners[route.key()] = source
+		}
+
+		names := make([]string, 0, len(methods))
+		for method := range methods {
+			names = append(names, method)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(table, "%s\t%d\t%s\t%d\n", source, len(group.routes), strings.Join(names, ","), count)
+		total += len(group.routes)
+		sources++
+	})
+	table.Flush()
+
+	header := fmt.Sprintf("Mounted %d routes from %d sources:\n", total, sources)
+	for _, conflict := range conflicts {
+		if conflict.overridden {
+			fmt.Fprintf(&buf, "Override: %s from %s is replaced by %s\n", conflict.route, conflict.source, conflict.winner)
+			continue
+		}
+		fmt.Fprintf(&buf, "Conflict: %s from %s is hidden by %s\n", conflict.route, conflict.source, conflict.winner)
+	}
+	return header + buf.String()
+}
+
+// logRouteSummary logs the route summary unless it is turned off
+func (ms *MockServer) logRouteSummary() {
+	if ms.settings.NoRouteSummary {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(ms.routes.snapshot.Load().summary(), "\n"), "\n") {
+		log.Print(line)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRouteSummary tests the summary of mounted routes per source
+func TestRouteSummary(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/api/users", Method: "GET"},
+		{Path: "/api/users", Method: "POST"},
+	}}
+	server.plugins["payments"] = &Plugin{Name: "payments", Enabled: true, Endpoints: []Endpoint{
+		{Path: "/api/users", Method: "GET"},
+		{Path: "/api/payments", Method: "DELETE"},
+	}}
+	server.plugins["legacy"] = &Plugin{Name: "legacy", Enabled: false, Endpoints: []Endpoint{{Path: "/old", Method: "GET"}}}
+	server.settings.NoRouteSummary = true
+	server.SetupRoutes()
+
+	summary := server.routes.snapshot.Load().summary()
+	lines := strings.Split(strings.TrimSpace(summary), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a header, 3 table lines and a conflict, got:\n%s", summary)
+	}
+	if lines[0] != "Mounted 4 routes from 2 sources:" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "main 2 GET,POST 0" {
+		t.Errorf("Unexpected line for main: %q", lines[2])
+	}
+	if fields := strings.Fields(lines[3]); strings.Join(fields, " ") != "payments 2 DELETE,GET 1" {
+		t.Errorf("Unexpected line for payments: %q", lines[3])
+	}
+	if lines[4] != "Conflict: GET /api/users from payments is hidden by main" {
+		t.Errorf("Unexpected conflict %q", lines[4])
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// matchTag reports whether tags contain a filter given as a tag name, a tag
+// value or "name:value"
+func matchTag(tags map[string]string, filter string) bool {
+	if name, value, found := strings.Cut(filter, ":"); found {
+		actual, exists := tags[name]
+		return exists && actual == value
+	}
+	for name, value := range tags {
+		if name == filter || value == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointTagMap returns the tags of an endpoint: the tags of its plugin,
+// overridden by its own
+func (ms *MockServer) endpointTagMap(ep Endpoint, source string) map[string]string {
+	tags := make(map[string]string)
+	if plugin, exists := ms.plugins[source]; exists {
+		for name, value := range plugin.Tags {
+			tags[name] = value
+		}
+	}
+	for name, value := range ep.Tags {
+		tags[name] = value
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// tagDisabled reports whether an endpoint carries a tag that was switched
+// off. Must be called with ms.mutex held.
+func (ms *MockServer) tagDisabled(ep Endpoint, source string) bool {
+	if len(ms.disabledTags) == 0 {
+		return false
+	}
+	tags := ms.endpointTagMap(ep, source)
+	for tag := range ms.disabledTags {
+		if matchTag(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// countTagged returns the number of endpoints carrying a tag. Must be called
+// with ms.mutex held.
+func (ms *MockServer) countTagged(tag string) int {
+	count := 0
+	countIn := func(endpoints []Endpoint, source string) {
+		for _, ep := range endpoints {
+			if matchTag(ms.endpointTagMap(ep, source), tag) {
+				count++
+			}
+		}
+	}
+	countIn(ms.runtimeEndpoints, "runtime")
+	countIn(ms.config.Endpoints, "main")
+	for name, plugin := range ms.plugins {
+		countIn(plugin.allEndpoints(), name)
+	}
+	return count
+}
+
+// setupTagsAPI registers the admin API switching endpoints by tag
+func (ms *MockServer) setupTagsAPI() {
+	// Switch all endpoints carrying a tag off or back on
+	ms.router.HandleFunc("/_admin/tags/{tag}/toggle", func(w http.ResponseWriter, r *http.Request) {
+		tag := mux.Vars(r)["tag"]
+
+		ms.mutex.Lock()
+		enabled := ms.disabledTags[tag]
+		if enabled {
+			delete(ms.disabledTags, tag)
+		} else {
+			ms.disabledTags[tag] = true
+		}
+		count := ms.countTagged(tag)
+		ms.mutex.Unlock()
+
+		// The new routes replace the old ones at once
+		ms.SetupRoutes()
+
+		state := map[bool]string{true: "enabled", false: "disabled"}[enabled]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tag":       tag,
+			"enabled":   enabled,
+			"endpoints": count,
+		})
+		log.Printf("Endpoints tagged %s %s (%d endpoints)", tag, state, count)
+	}).Methods("POST")
+
+	// Tags whose endpoints are switched off
+	ms.router.HandleFunc("/_admin/tags/disabled", func(w http.ResponseWriter, r *http.Request) {
+		ms.mutex.RLock()
+		tags := make([]string, 0, len(ms.disabledTags))
+		for tag := range ms.disabledTags {
+			tags = append(tags, tag)
+		}
+		ms.mutex.RUnlock()
+
+		sort.Strings(tags)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tags)
+	}).Methods("GET")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMatchTag tests tag filters
+func TestMatchTag(t *testing.T) {
+	tags := map[string]string{"team": "payments", "beta": ""}
+	for filter, expected := range map[string]bool{
+		"payments":      true,
+		"team":          true,
+		"beta":          true,
+		"team:payments": true,
+		"team:billing":  false,
+		"billing":       false,
+	} {
+		if matchTag(tags, filter) != expected {
+			t.Errorf("Expected filter %q to match %t", filter, expected)
+		}
+	}
+	if matchTag(nil, "payments") {
+		t.Error("Expected no tags to match nothing")
+	}
+}
+
+// TestTagFilters tests filtering admin queries by tag
+func TestTagFilters(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/api/users", Method: "GET", Response: "users"},
+	}}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true, Tags: map[string]string{"team": "payments"}, Endpoints: []Endpoint{
+		{Path: "/api/invoices", Method: "GET", Response: "invoices", RateLimit: &RateLimit{Requests: 10, Window: 1000}},
+		{Path: "/api/refunds", Method: "POST", Tags: map[string]string{"team": "risk"}},
+	}}
+	server.SetupRoutes()
+
+	for _, path := range []string{"/api/users", "/api/invoices", "/api/invoices"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+
+	var routes []routeInfo
+	json.Unmarshal([]byte(get("/_admin/routes?tag=payments")), &routes)
+	if len(routes) != 1 || routes[0].Path != "/api/invoices" || routes[0].Tags["team"] != "payments" || routes[0].Hits != 2 {
+		t.Errorf("Expected only the invoices route, got %+v", routes)
+	}
+	json.Unmarshal([]byte(get("/_admin/routes?tag=team")), &routes)
+	if len(routes) != 2 {
+		t.Errorf("Expected both billing routes for the tag name, got %+v", routes)
+	}
+
+	lines := strings.Split(strings.TrimSpace(get("/_admin/requests/export?format=jsonl&tag=team:payments")), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"tags":{"team":"payments"}`) {
+		t.Errorf("Expected the 2 invoice requests, got %v", lines)
+	}
+
+	var limits map[string]interface{}
+	json.Unmarshal([]byte(get("/_admin/ratelimits?tag=risk")), &limits)
+	if len(limits) != 0 {
+		t.Errorf("Expected no rate limits for the risk tag, got %v", limits)
+	}
+	json.Unmarshal([]byte(get("/_admin/ratelimits?tag=payments")), &limits)
+	if _, exists := limits["GET /api/invoices"]; !exists || len(limits) != 1 {
+		t.Errorf("Expected the invoices rate limit, got %v", limits)
+	}
+}
+
+// TestToggleTag tests switching all endpoints with a tag off and back on
+func TestToggleTag(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", Endpoints: []Endpoint{
+		{Path: "/v1/users", Method: "GET", Response: "v1", Tags: map[string]string{"v1-deprecated": ""}},
+		{Path: "/v2/users", Method: "GET", Response: "v2"},
+	}}
+	server.plugins["orders"] = &Plugin{Name: "orders", Enabled: true, Tags: map[string]string{"v1-deprecated": ""}, Endpoints: []Endpoint{
+		{Path: "/v1/orders", Method: "GET", Response: "orders"},
+	}}
+	server.SetupRoutes()
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := call("POST", "/_admin/tags/v1-deprecated/toggle")
+	var result struct {
+		Enabled   bool `json:"enabled"`
+		Endpoints int  `json:"endpoints"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Enabled || result.Endpoints != 2 {
+		t.Fatalf("Expected 2 endpoints to be disabled, got %s", w.Body.String())
+	}
+	for path, expected := range map[string]int{"/v1/users": 404, "/v1/orders": 404, "/v2/users": 200} {
+		if code := call("GET", path).Code; code != expected {
+			t.Errorf("Expected %s to return %d, got %d", path, expected, code)
+		}
+	}
+
+	// Runtime endpoints with the tag stay off too
+	body := strings.NewReader(`{"path": "/v1/items", "method": "GET", "tags": {"v1-deprecated": ""}}`)
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/_admin/endpoints", body))
+	if code := call("GET", "/v1/items").Code; code != 404 {
+		t.Errorf("Expected the tagged runtime endpoint to be disabled, got %d", code)
+	}
+	if body := call("GET", "/_admin/tags/disabled").Body.String(); strings.TrimSpace(body) != `["v1-deprecated"]` {
+		t.Errorf("Unexpected disabled tags %s", body)
+	}
+
+	call("POST", "/_admin/tags/v1-deprecated/toggle")
+	for _, path := range []string{"/v1/users", "/v1/orders", "/v1/items"} {
+		if code := call("GET", path).Code; code != 200 {
+			t.Errorf("Expected %s to be enabled again, got %d", path, code)
+		}
+	}
+}
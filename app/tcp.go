@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPMock represents a raw TCP listener answering scripted exchanges
+type TCPMock struct {
+	Port      string        `json:"port"`
+	Encoding  string        `json:"encoding,omitempty"` // text (default), hex or base64
+	Exchanges []TCPExchange `json:"exchanges"`
+}
+
+// TCPExchange represents bytes expected from the client and the reply sent
+// once they are received. An exchange without expect is sent on connect.
+type TCPExchange struct {
+	Expect  string `json:"expect,omitempty"`
+	Respond string `json:"respond,omitempty"`
+	Delay   int    `json:"delay,omitempty"` // milliseconds before responding
+	Close   bool   `json:"close,omitempty"` // close the connection after responding
+}
+
+// tcpExchange is a TCPExchange with decoded bytes
+type tcpExchange struct {
+	expect  []byte
+	respond []byte
+	delay   time.Duration
+	close   bool
+}
+
+// tcpListener is a running TCP mock
+type tcpListener struct {
+	listener  net.Listener
+	source    string
+	mutex     sync.RWMutex
+	exchanges []tcpExchange
+}
+
+// decodeTCPData decodes exchange data using the given encoding
+func decodeTCPData(data, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "text":
+		return []byte(data), nil
+	case "hex":
+		return hex.DecodeString(data)
+	case "base64":
+		return base64.StdEncoding.DecodeString(data)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// compileTCPExchanges decodes the exchanges of a TCP mock
+func compileTCPExchanges(mock TCPMock) ([]tcpExchange, error) {
+	exchanges := make([]tcpExchange, 0, len(mock.Exchanges))
+	for i, exchange := range mock.Exchanges {
+		expect, err := decodeTCPData(exchange.Expect, mock.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("exchange %d: invalid expect: %v", i, err)
+		}
+		respond, err := decodeTCPData(exchange.Respond, mock.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("exchange %d: invalid respond: %v", i, err)
+		}
+		exchanges = append(exchanges, tcpExchange{
+			expect:  expect,
+			respond: respond,
+			delay:   time.Duration(exchange.Delay) * time.Millisecond,
+			close:   exchange.Close,
+		})
+	}
+	return exchanges, nil
+}
+
+// syncTCPListeners starts, updates and stops TCP listeners to match the
+// enabled plugins. Must be called with ms.mutex held.
+func (ms *MockServer) syncTCPListeners() {
+	wanted := make(map[string]bool)
+
+	for pluginName, plugin := range ms.plugins {
+		if !plugin.Enabled {
+			continue
+		}
+		for _, mock := range plugin.TCP {
+			if wanted[mock.Port] {
+				log.Printf("TCP port %s is already used by another mock, skipping plugin %s", mock.Port, pluginName)
+				continue
+			}
+
+			exchanges, err := compileTCPExchanges(mock)
+			if err != nil {
+				log.Printf("Invalid TCP mock on port %s in plugin %s: %v", mock.Port, pluginName, err)
+				continue
+			}
+
+			if existing, ok := ms.tcpListeners[mock.Port]; ok {
+				existing.mutex.Lock()
+				existing.exchanges = exchanges
+				existing.source = pluginName
+				existing.mutex.Unlock()
+				wanted[mock.Port] = true
+				continue
+			}
+
+			listener, err := net.Listen("tcp", ":"+mock.Port)
+			if err != nil {
+				log.Printf("Failed to start TCP mock on port %s: %v", mock.Port, err)
+				continue
+			}
+			tl := &tcpListener{listener: listener, source: pluginName, exchanges: exchanges}
+			ms.tcpListeners[mock.Port] = tl
+			wanted[mock.Port] = true
+			log.Printf("TCP mock listening on %s [%s]", listener.Addr(), pluginName)
+			go tl.serve()
+		}
+	}
+
+	for port, tl := range ms.tcpListeners {
+		if !wanted[port] {
+			tl.listener.Close()
+			delete(ms.tcpListeners, port)
+			log.Printf("TCP mock on port %s stopped", port)
+		}
+	}
+}
+
+// serve accepts connections until the listener is closed
+func (tl *tcpListener) serve() {
+	for {
+		conn, err := tl.listener.Accept()
+		if err != nil {
+			return
+		}
+		go tl.handle(conn)
+	}
+}
+
+// handle runs the exchanges for a single connection. Received bytes are
+// buffered and the first exchange whose expected bytes appear in the buffer
+// is answered, consuming the buffer up to the end of the match.
+func (tl *tcpListener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	tl.mutex.RLock()
+	exchanges := tl.exchanges
+	source := tl.source
+	tl.mutex.RUnlock()
+
+	respond := func(exchange tcpExchange) bool {
+		if exchange.delay > 0 {
+			time.Sleep(exchange.delay)
+		}
+		if _, err := conn.Write(exchange.respond); err != nil {
+			return false
+		}
+		return !exchange.close
+	}
+
+	for _, exchange := range exchanges {
+		if len(exchange.expect) == 0 && !respond(exchange) {
+			return
+		}
+	}
+
+	var buffer []byte
+	chunk := make([]byte, 4096)
+	for {
+		n, err := conn.Read(chunk)
+		if err != nil {
+			return
+		}
+		buffer = append(buffer, chunk[:n]...)
+
+		for matched := true; matched; {
+			matched = false
+			for _, exchange := range exchanges {
+				if len(exchange.expect) == 0 {
+					continue
+				}
+				i := bytes.Index(buffer, exchange.expect)
+				if i < 0 {
+					continue
+				}
+				buffer = buffer[i+len(exchange.expect):]
+				log.Printf("TCP %s - %d bytes matched [%s]", conn.LocalAddr(), len(exchange.expect), source)
+				if !respond(exchange) {
+					return
+				}
+				matched = true
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTCPMock tests scripted exchanges on a raw TCP listener
+func TestTCPMock(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins"}
+	server.plugins["redis"] = &Plugin{
+		Name:    "redis",
+		Enabled: true,
+		TCP: []TCPMock{
+			{
+				Port: "0",
+				Exchanges: []TCPExchange{
+					{Respond: "+READY\r\n"},
+					{Expect: "PING\r\n", Respond: "+PONG\r\n"},
+					{Expect: "QUIT\r\n", Respond: "+OK\r\n", Close: true},
+				},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	listener := server.tcpListeners["0"]
+	if listener == nil {
+		t.Fatal("Expected TCP listener to be started")
+	}
+
+	conn, err := net.Dial("tcp", listener.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	expectLine := func(expected string) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read %q: %v", expected, err)
+		}
+		if line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	}
+
+	expectLine("+READY\r\n")
+	conn.Write([]byte("PI"))
+	conn.Write([]byte("NG\r\nPING\r\n"))
+	expectLine("+PONG\r\n")
+	expectLine("+PONG\r\n")
+	conn.Write([]byte("QUIT\r\n"))
+	expectLine("+OK\r\n")
+	if _, err := reader.ReadByte(); err == nil {
+		t.Error("Expected connection to be closed after QUIT")
+	}
+
+	// Disabling the plugin stops the listener
+	server.plugins["redis"].Enabled = false
+	server.SetupRoutes()
+	if len(server.tcpListeners) != 0 {
+		t.Error("Expected TCP listener to be stopped")
+	}
+	if _, err := net.Dial("tcp", listener.listener.Addr().String()); err == nil {
+		t.Error("Expected connections to be refused after stopping")
+	}
+}
+
+// TestDecodeTCPData tests exchange data encodings
+func TestDecodeTCPData(t *testing.T) {
+	tests := []struct {
+		data     string
+		encoding string
+		expected string
+	}{
+		{"hello", "", "hello"},
+		{"68656c6c6f", "hex", "hello"},
+		{"aGVsbG8=", "base64", "hello"},
+	}
+
+	for _, test := range tests {
+		data, err := decodeTCPData(test.data, test.encoding)
+		if err != nil || string(data) != test.expected {
+			t.Errorf("Expected %q, got %q (%v)", test.expected, data, err)
+		}
+	}
+
+	if _, err := decodeTCPData("zz", "hex"); err == nil {
+		t.Error("Expected invalid hex to fail")
+	}
+}
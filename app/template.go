@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// responseTemplateFuncs are the functions available to response templates
+var responseTemplateFuncs = template.FuncMap{
+	// xml escapes a value for XML text and attributes
+	"xml": func(value string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(value))
+		return buf.String()
+	},
+	// json encodes a value as JSON, e.g. an object of the request body
+	"json": func(value interface{}) string {
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	},
+	// default returns a fallback for empty values
+	"default": func(fallback string, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// responseTemplates renders response bodies as Go templates with the
+// request data. Bodies are parsed once: an endpoint has a bounded set of
+// bodies, from its response, variants and response map.
+type responseTemplates struct {
+	cache    sync.Map     // body to *template.Template, or error if it doesn't parse
+	rendered *renderCache // rendered bodies, with template_cache
+}
+
+// render executes a body as a template. In JSON bodies, each string is a
+// template whose result is encoded as a JSON string, so request values
+// with quotes keep the body valid. Bodies that are not valid templates or
+// fail to execute are returned unchanged along with the error.
+func (rt *responseTemplates) render(r *http.Request, body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte("{{")) {
+		return body, nil
+	}
+	data := newRequestData(r)
+	isJSON := isJSONBody(body)
+
+	var key string
+	if rt.rendered != nil {
+		texts := func() []string {
+			if isJSON {
+				return jsonTemplateStrings(body)
+			}
+			return []string{string(body)}
+		}
+		if cacheKey, cacheable := rt.rendered.key(r, data, body, texts); cacheable {
+			if cached, found := rt.rendered.get(cacheKey); found {
+				return cached, nil
+			}
+			key = cacheKey
+		}
+	}
+
+	var rendered []byte
+	var err error
+	if isJSON {
+		rendered, err = rt.renderJSON(data, body)
+	} else {
+		var text string
+		if text, err = rt.execute(data, string(body)); err == nil {
+			rendered = []byte(text)
+		}
+	}
+	if err != nil {
+		return body, err
+	}
+	if key != "" {
+		rt.rendered.put(key, rendered)
+	}
+	return rendered, nil
+}
+
+// isJSONBody reports whether a body is a JSON object or array, whose
+// strings are rendered one by one
+func isJSONBody(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed)
+}
+
+// jsonTemplateStrings returns the strings of a JSON body that are
+// templates, keys included
+func jsonTemplateStrings(body []byte) []string {
+	var texts []string
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return texts
+		}
+		if text, ok := token.(string); ok && strings.Contains(text, "{{") {
+			texts = append(texts, text)
+		}
+	}
+}
+
+// renderJSON renders the strings of a JSON body and keeps everything else,
+// including the order of fields, as it is
+func (rt *responseTemplates) renderJSON(data requestData, body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(body))
+	for i := 0; i < len(body); i++ {
+		if body[i] != '"' {
+			out.WriteByte(body[i])
+			continue
+		}
+		end := i + 1
+		for body[end] != '"' {
+			if body[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		token := body[i : end+1]
+		i = end
+
+		var value string
+		if !bytes.Contains(token, []byte("{{")) || json.Unmarshal(token, &value) != nil {
+			out.Write(token)
+			continue
+		}
+		rendered, err := rt.execute(data, value)
+		if err != nil {
+			return body, err
+		}
+		encoder := json.NewEncoder(&out)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(rendered)
+		out.Truncate(out.Len() - 1) // the newline written by Encode
+	}
+	return out.Bytes(), nil
+}
+
+// execute parses a template, or takes it from the cache, and executes it
+func (rt *responseTemplates) execute(data requestData, text string) (string, error) {
+	cached, ok := rt.cache.Load(text)
+	if !ok {
+		tmpl, err := template.New("response").Funcs(responseTemplateFuncs).Parse(text)
+		if err != nil {
+			cached = err
+		} else {
+			cached = tmpl
+		}
+		rt.cache.Store(text, cached)
+	}
+	if err, isErr := cached.(error); isErr {
+		return text, err
+	}
+
+	var buf strings.Builder
+	if err := cached.(*template.Template).Execute(&buf, data); err != nil {
+		return text, err
+	}
+	return buf.String(), nil
+}
+
+// Body returns the request body. The body stays readable.
+func (d requestData) Body() string {
+	if d.request == nil {
+		return ""
+	}
+	data, _ := io.ReadAll(d.request.Body)
+	d.request.Body = io.NopCloser(bytes.NewReader(data))
+	return string(data)
+}
+
+// BodyField returns a field of a JSON request body, with dots separating
+// the names of nested fields (e.g. "user.id"), or an empty string
+func (d requestData) BodyField(field string) string {
+	if d.request == nil {
+		return ""
+	}
+	return bodyField(d.request, field)
+}
+
+// JSON returns the decoded JSON request body, or nil. Fields of objects
+// are accessed like map keys, e.g. {{.JSON.user.name}}.
+func (d requestData) JSON() interface{} {
+	decoder := json.NewDecoder(strings.NewReader(d.Body()))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil
+	}
+	return value
+}
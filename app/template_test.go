@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestResponseTemplate tests rendering XML responses with request values
+func TestResponseTemplate(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins", Endpoints: []Endpoint{
+		{
+			Path:             "/orders/{region}",
+			Method:           "POST",
+			StatusCode:       200,
+			ContentType:      "text/xml",
+			ResponseTemplate: true,
+			Response: `<OrderResponse region="{{.Vars.region}}">` +
+				`<Customer>{{.XPath "//Customer" | xml}}</Customer>` +
+				`<Items>{{.XPath "count(//Item)"}}</Items>` +
+				`</OrderResponse>`,
+			ResponseMap: &ResponseMap{Key: "xpath://Item[1]/@sku", Responses: map[string]MappedResponse{
+				"X9": {StatusCode: 409, Response: `<Fault>{{.XPath "//Item[1]/@sku"}} is out of stock</Fault>`},
+			}},
+		},
+		{Path: "/static", Method: "GET", StatusCode: 200, Response: "{{.Path}}"},
+		{Path: "/broken", Method: "GET", StatusCode: 200, ResponseTemplate: true, Response: "{{.Missing"},
+	}}
+	server.SetupRoutes()
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := call("POST", "/orders/eu", testSOAPRequest)
+	expected := `<OrderResponse region="eu"><Customer>Alice &amp; Co</Customer><Items>3</Items></OrderResponse>`
+	if w.Code != 200 || w.Body.String() != expected {
+		t.Errorf("Expected %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+
+	// Mapped responses are templates as well
+	w = call("POST", "/orders/eu", `<PlaceOrder><Item sku="X9"/></PlaceOrder>`)
+	if w.Code != 409 || w.Body.String() != "<Fault>X9 is out of stock</Fault>" {
+		t.Errorf("Unexpected mapped response: %d %s", w.Code, w.Body.String())
+	}
+
+	// Without response_template the body is sent as is
+	if w := call("GET", "/static", ""); w.Body.String() != "{{.Path}}" {
+		t.Errorf("Expected the body unchanged, got %s", w.Body.String())
+	}
+
+	// Invalid templates are sent as they are
+	if w := call("GET", "/broken", ""); w.Code != 200 || w.Body.String() != "{{.Missing" {
+		t.Errorf("Expected the invalid template unchanged, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestJSONResponseTemplate tests rendering JSON responses with values of the
+// path, query, headers and body
+func TestJSONResponseTemplate(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: "plugins", Endpoints: []Endpoint{
+		{
+			Path:             "/users/{id}",
+			Method:           "PUT",
+			StatusCode:       200,
+			ResponseTemplate: true,
+			Response: map[string]interface{}{
+				"id":      "{{.PathParams.id}}",
+				"name":    `{{.BodyField "profile.name"}}`,
+				"tenant":  `{{.Headers.Get "X-Tenant" | default "public"}}`,
+				"page":    `{{.Query.Get "page"}}`,
+				"roles":   `{{json .JSON.roles}}`,
+				"summary": "{{.JSON.profile.name}} ({{.Method}})",
+			},
+		},
+		{
+			Path:             "/echo",
+			Method:           "POST",
+			StatusCode:       200,
+			ResponseTemplate: true,
+			Response:         `{"z": 1, "echo": "{{.Body}}", "a": [true, "{{.Method}}"]}`,
+		},
+	}}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("PUT", "/users/42?page=2", strings.NewReader(`{"profile": {"name": "Ann \"The\" <Admin>"}, "roles": ["a", "b"]}`))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Expected a valid JSON response, got %v: %s", err, w.Body.String())
+	}
+	expected := map[string]string{
+		"id":      "42",
+		"name":    `Ann "The" <Admin>`,
+		"tenant":  "public",
+		"page":    "2",
+		"roles":   `["a","b"]`,
+		"summary": `Ann "The" <Admin> (PUT)`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// JSON strings keep their order and the rest of the document
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/echo", strings.NewReader(`say "hi"`)))
+	if expected := `{"z": 1, "echo": "say \"hi\"", "a": [true, "POST"]}`; w.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, w.Body.String())
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TLSConfig serves HTTPS with a certificate from files or a self-signed
+// certificate generated on startup
+type TLSConfig struct {
+	CertFile string   `json:"cert_file,omitempty"` // PEM certificate, including intermediates
+	KeyFile  string   `json:"key_file,omitempty"`  // PEM private key
+	Auto     bool     `json:"auto,omitempty"`      // generate a self-signed certificate instead of reading files
+	Hosts    []string `json:"hosts,omitempty"`     // names and addresses of the generated certificate (default: localhost, 127.0.0.1, ::1)
+}
+
+// defaultTLSHosts are the names of generated certificates without hosts
+var defaultTLSHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// validateTLS checks the TLS setting of a configuration
+func validateTLS(config *TLSConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Auto {
+		if config.CertFile != "" || config.KeyFile != "" {
+			return fmt.Errorf("tls auto can't be combined with cert_file and key_file")
+		}
+		return nil
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return fmt.Errorf("tls requires cert_file and key_file, or auto")
+	}
+	if len(config.Hosts) > 0 {
+		return fmt.Errorf("tls hosts only apply to auto certificates")
+	}
+	return nil
+}
+
+// tlsCertificates holds the certificate served by the HTTPS listener. The
+// listener asks for it on every handshake, so a reload can replace it
+// without restarting the listener.
+type tlsCertificates struct {
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	autoHosts   []string // hosts of the generated certificate, if it is one
+}
+
+// newTLSCertificates creates an empty certificate holder
+func newTLSCertificates() *tlsCertificates {
+	return &tlsCertificates{}
+}
+
+// configure loads or generates the certificate of a TLS setting. A
+// generated certificate is kept while its hosts don't change.
+func (tc *tlsCertificates) configure(config *TLSConfig) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	if config == nil {
+		tc.certificate, tc.autoHosts = nil, nil
+		return nil
+	}
+
+	if !config.Auto {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid tls certificate: %v", err)
+		}
+		tc.certificate, tc.autoHosts = &certificate, nil
+		return nil
+	}
+
+	hosts := config.Hosts
+	if len(hosts) == 0 {
+		hosts = defaultTLSHosts
+	}
+	if tc.certificate != nil && tc.autoHosts != nil && slices.Equal(tc.autoHosts, hosts) {
+		return nil
+	}
+	certificate, err := generateCertificate(hosts, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to generate tls certificate: %v", err)
+	}
+	tc.certificate, tc.autoHosts = certificate, slices.Clone(hosts)
+	log.Printf("Generated a self-signed certificate for %v (SHA-256 fingerprint %s)", hosts, certificateFingerprint(certificate))
+	return nil
+}
+
+// get returns the current certificate for TLS handshakes
+func (tc *tlsCertificates) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.certificate == nil {
+		return nil, fmt.Errorf("no tls certificate configured")
+	}
+	return tc.certificate, nil
+}
+
+// pem returns the current certificate chain in PEM format, or nil
+func (tc *tlsCertificates) pem() []byte {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.certificate == nil {
+		return nil
+	}
+	var encoded []byte
+	for _, der := range tc.certificate.Certificate {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return encoded
+}
+
+// generateCertificate creates a self-signed certificate for hosts, valid
+// for a year from now
+func generateCertificate(hosts []string, now time.Time) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"nmock"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // lets clients trust it as their own root
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of a certificate
+func certificateFingerprint(certificate *tls.Certificate) string {
+	sum := sha256.Sum256(certificate.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// setupTLSAPI registers the admin API of the served certificate
+func (ms *MockServer) setupTLSAPI() {
+	// Download the certificate, e.g. to trust a generated one in clients
+	ms.router.HandleFunc("/_admin/tls/cert", func(w http.ResponseWriter, r *http.Request) {
+		encoded := ms.tls.pem()
+		if encoded == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"error":"TLS is not enabled"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(encoded)
+	}).Methods("GET")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTLSListener tests serving HTTPS with a generated certificate that
+// clients trust through the admin API
+func TestTLSListener(t *testing.T) {
+	port := freePort(t)
+	server := NewMockServer("")
+	server.settings = settings{TLSAuto: true}
+	config := &Config{Port: port}
+	server.settings.apply(config)
+	if err := server.tls.configure(config.TLS); err != nil {
+		t.Fatalf("Failed to generate a certificate: %v", err)
+	}
+	server.config = config
+	server.SetupRoutes()
+	if err := server.listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer server.shutdown(context.Background())
+
+	// Plain HTTP isn't answered
+	plain := &http.Client{Timeout: time.Second}
+	if resp, err := plain.Get("http://127.0.0.1:" + port + "/health"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("Expected plain HTTP to be refused")
+		}
+	}
+
+	// Download the certificate without verifying it, then trust it
+	insecure := &http.Client{Timeout: time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := insecure.Get("https://127.0.0.1:" + port + "/_admin/tls/cert")
+	if err != nil {
+		t.Fatalf("Failed to download the certificate: %v", err)
+	}
+	encoded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if block, _ := pem.Decode(encoded); block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("Expected a PEM certificate, got %q", encoded)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(encoded)
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}
+	client := &http.Client{Timeout: time.Second, Transport: transport}
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		resp, err := client.Get("https://" + host + ":" + port + "/health")
+		if err != nil {
+			t.Fatalf("Expected %s to be trusted: %v", host, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+			t.Errorf("Expected 200 over HTTP/2 from %s, got %d over %s", host, resp.StatusCode, resp.Proto)
+		}
+	}
+
+	// A reload with the same hosts keeps the certificate
+	before := server.tls.pem()
+	if err := server.tls.configure(&TLSConfig{Auto: true}); err != nil {
+		t.Fatal(err)
+	}
+	if string(server.tls.pem()) != string(before) {
+		t.Error("Expected the generated certificate to be kept")
+	}
+
+	// Switching TLS off serves plain HTTP on the same port
+	server.config = &Config{Port: port}
+	server.reloadListener()
+	resp, err = plain.Get("http://127.0.0.1:" + port + "/health")
+	if err != nil {
+		t.Fatalf("Expected plain HTTP after switching TLS off: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestTLSConfig tests certificate files and invalid TLS settings
+func TestTLSConfig(t *testing.T) {
+	certificate, err := generateCertificate([]string{"api.test"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+
+	certificates := newTLSCertificates()
+	if err := certificates.configure(&TLSConfig{CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Fatalf("Failed to load the certificate files: %v", err)
+	}
+	served, err := certificates.get(nil)
+	if err != nil || served.Leaf == nil || served.Leaf.DNSNames[0] != "api.test" {
+		t.Errorf("Expected the certificate of the files, got %v", err)
+	}
+	if err := certificates.configure(&TLSConfig{CertFile: keyFile, KeyFile: certFile}); err == nil {
+		t.Error("Expected swapped files to be rejected")
+	}
+
+	for _, config := range []*TLSConfig{
+		{CertFile: certFile},
+		{Auto: true, CertFile: certFile, KeyFile: keyFile},
+		{CertFile: certFile, KeyFile: keyFile, Hosts: []string{"api.test"}},
+	} {
+		if validateTLS(config) == nil {
+			t.Errorf("Expected %+v to be invalid", config)
+		}
+	}
+
+	// The --tls-auto flag replaces certificate files but keeps auto hosts
+	config := &Config{TLS: &TLSConfig{CertFile: certFile, KeyFile: keyFile}}
+	settings{TLSAuto: true}.apply(config)
+	if !config.TLS.Auto || config.TLS.CertFile != "" || validateTLS(config.TLS) != nil {
+		t.Errorf("Expected a valid auto setting, got %+v", config.TLS)
+	}
+	config = &Config{TLS: &TLSConfig{Auto: true, Hosts: []string{"api.test"}}}
+	settings{TLSAuto: true}.apply(config)
+	if len(config.TLS.Hosts) != 1 {
+		t.Errorf("Expected the hosts to be kept, got %+v", config.TLS)
+	}
+}
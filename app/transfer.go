@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Transfer encoding modes for endpoint responses
+const (
+	TransferContentLength = "content-length"
+	TransferChunked       = "chunked"
+)
+
+// encodeResponse encodes a response body. Strings are written as-is and
+// everything else is encoded as JSON.
+func encodeResponse(response interface{}) ([]byte, error) {
+	if response == nil {
+		return nil, nil
+	}
+	if responseStr, ok := response.(string); ok {
+		return []byte(responseStr), nil
+	}
+
+	pe := encoderPool.Get().(*pooledEncoder)
+	defer func() {
+		if pe.buf.Cap() <= maxPooledBuffer {
+			encoderPool.Put(pe)
+		}
+	}()
+	pe.buf.Reset()
+	if err := pe.encoder.Encode(response); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(pe.buf.Bytes()), nil
+}
+
+// validateTransferEncoding checks the transfer_encoding value of an endpoint
+func validateTransferEncoding(mode string) error {
+	switch mode {
+	case "", TransferContentLength, TransferChunked:
+		return nil
+	}
+	return fmt.Errorf("unsupported transfer_encoding %q", mode)
+}
+
+// Chunk represents a piece of a streamed response body
+type Chunk struct {
+	Data  interface{} `json:"data"`
+	Delay int         `json:"delay,omitempty"` // delay before sending the chunk, in milliseconds
+}
+
+// streamPart is a prepared chunk ready to be written
+type streamPart struct {
+	data  []byte
+	delay time.Duration
+}
+
+// streamParts prepares the chunks of an endpoint, either from its explicit
+// chunks or by splitting the response body into chunk_size pieces. It returns
+// nil when the endpoint is not streamed.
+func streamParts(ep Endpoint) ([]streamPart, error) {
+	if len(ep.Chunks) > 0 {
+		parts := make([]streamPart, 0, len(ep.Chunks))
+		for i, chunk := range ep.Chunks {
+			data, err := encodeResponse(chunk.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode chunk %d: %v", i, err)
+			}
+			parts = append(parts, streamPart{data: data, delay: time.Duration(chunk.Delay) * time.Millisecond})
+		}
+		return parts, nil
+	}
+
+	if ep.ChunkSize > 0 {
+		body, err := encodeResponse(ep.Response)
+		if err != nil {
+			return nil, err
+		}
+		var parts []streamPart
+		for offset := 0; offset < len(body); offset += ep.ChunkSize {
+			end := min(offset+ep.ChunkSize, len(body))
+			part := streamPart{data: body[offset:end]}
+			if offset > 0 {
+				part.delay = time.Duration(ep.ChunkDelay) * time.Millisecond
+			}
+			parts = append(parts, part)
+		}
+		return parts, nil
+	}
+
+	return nil, nil
+}
+
+// writeStream writes the status code and then each part with its delay,
+// flushing after every part. It stops early if the client goes away.
+func writeStream(w http.ResponseWriter, r *http.Request, statusCode int, parts []streamPart) {
+	w.Header().Del("Content-Length")
+	w.WriteHeader(statusCode)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for _, part := range parts {
+		if part.delay > 0 {
+			select {
+			case <-time.After(part.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// writeBody writes the status code and body using the requested transfer
+// encoding. Without a mode, net/http decides based on the body size.
+func writeBody(w http.ResponseWriter, statusCode int, body []byte, mode string) {
+	switch mode {
+	case TransferContentLength:
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(statusCode)
+		w.Write(body)
+	case TransferChunked:
+		// Flushing before any body is written makes net/http switch to
+		// chunked encoding since the length is not known yet
+		w.Header().Del("Content-Length")
+		w.WriteHeader(statusCode)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		w.Write(body)
+	default:
+		w.WriteHeader(statusCode)
+		w.Write(body)
+	}
+}
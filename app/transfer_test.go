@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChunkedStreaming tests that chunks are flushed individually with delays
+func TestChunkedStreaming(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{
+				Path:   "/progress",
+				Method: "GET",
+				Chunks: []Chunk{
+					{Data: map[string]int{"progress": 50}},
+					{Data: map[string]int{"progress": 100}, Delay: 150},
+				},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/progress")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	first, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read first chunk: %v", err)
+	}
+	if first != "{\"progress\":50}\n" {
+		t.Errorf("Expected first chunk '{\"progress\":50}', got '%s'", first)
+	}
+	if elapsed := time.Since(start); elapsed >= 150*time.Millisecond {
+		t.Errorf("Expected first chunk before the delay, got it after %v", elapsed)
+	}
+
+	second, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read second chunk: %v", err)
+	}
+	if second != "{\"progress\":100}\n" {
+		t.Errorf("Expected second chunk '{\"progress\":100}', got '%s'", second)
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("Expected second chunk after the delay, got it after %v", elapsed)
+	}
+}
+
+// TestStreamPartsChunkSize tests splitting a response into fixed size chunks
+func TestStreamPartsChunkSize(t *testing.T) {
+	parts, err := streamParts(Endpoint{Response: "abcdefg", ChunkSize: 3, ChunkDelay: 10})
+	if err != nil {
+		t.Fatalf("Failed to prepare chunks: %v", err)
+	}
+
+	expected := []string{"abc", "def", "g"}
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %d", len(expected), len(parts))
+	}
+	for i, part := range parts {
+		if string(part.data) != expected[i] {
+			t.Errorf("Expected chunk %d to be '%s', got '%s'", i, expected[i], part.data)
+		}
+	}
+	if parts[0].delay != 0 || parts[1].delay != 10*time.Millisecond {
+		t.Errorf("Expected no delay before the first chunk and 10ms afterwards, got %v and %v", parts[0].delay, parts[1].delay)
+	}
+}
+
+// TestTransferEncoding tests forcing Content-Length or chunked responses
+func TestTransferEncoding(t *testing.T) {
+	largeBody := strings.Repeat("x", 8192)
+
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/length", Method: "GET", Response: largeBody, TransferEncoding: TransferContentLength},
+			{Path: "/chunked", Method: "GET", Response: "small", TransferEncoding: TransferChunked},
+		},
+	}
+	server.SetupRoutes()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/length")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.ContentLength != int64(len(largeBody)) {
+		t.Errorf("Expected Content-Length %d, got %d", len(largeBody), resp.ContentLength)
+	}
+	if len(resp.TransferEncoding) != 0 {
+		t.Errorf("Expected no transfer encoding, got %v", resp.TransferEncoding)
+	}
+	if string(body) != largeBody {
+		t.Error("Expected full body to be received")
+	}
+
+	resp, err = http.Get(ts.URL + "/chunked")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Expected chunked transfer encoding, got %v", resp.TransferEncoding)
+	}
+	if string(body) != "small" {
+		t.Errorf("Expected body 'small', got '%s'", body)
+	}
+}
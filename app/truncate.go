@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// TruncateConfig makes an endpoint close the connection after part of the
+// body, while announcing the full length
+type TruncateConfig struct {
+	Bytes   int `json:"bytes,omitempty"`   // number of body bytes sent
+	Percent int `json:"percent,omitempty"` // share of the body sent, from 0 to 99
+}
+
+// validateTruncate checks the truncate setting of an endpoint
+func validateTruncate(config *TruncateConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Bytes != 0 && config.Percent != 0 {
+		return fmt.Errorf("bytes and percent can't be combined")
+	}
+	if config.Bytes < 0 || config.Percent < 0 || config.Percent > 99 {
+		return fmt.Errorf("bytes must be positive and percent between 0 and 99")
+	}
+	return nil
+}
+
+// length returns the number of bytes sent of a body
+func (config *TruncateConfig) length(size int) int {
+	if config.Percent > 0 {
+		return size * config.Percent / 100
+	}
+	return min(config.Bytes, size)
+}
+
+// writeTruncated writes the headers of a complete response and the first
+// bytes of the body, then closes the connection. It returns the number of
+// body bytes sent.
+func writeTruncated(w http.ResponseWriter, statusCode int, body []byte, config *TruncateConfig) int {
+	sent := config.length(len(body))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	w.Write(body[:sent])
+
+	// HTTP/2 connections can't be hijacked, so the stream is reset instead
+	controller := http.NewResponseController(w)
+	controller.Flush()
+	conn, buffered, err := controller.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	buffered.Flush()
+	conn.Close()
+	return sent
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTruncatedResponse tests closing the connection after part of the body
+func TestTruncatedResponse(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{Path: "/bytes", Method: "GET", Response: "0123456789", Truncate: &TruncateConfig{Bytes: 4}},
+			{Path: "/percent", Method: "GET", Response: "0123456789", Truncate: &TruncateConfig{Percent: 50}},
+		},
+	}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for path, expected := range map[string]string{"/bytes": "0123", "/percent": "01234"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.ContentLength != 10 || string(body) != expected || err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected %s to send %q of 10 bytes, got %q of %d (%v)", path, expected, body, resp.ContentLength, err)
+		}
+	}
+
+	for _, config := range []TruncateConfig{{Bytes: 1, Percent: 1}, {Percent: 100}, {Bytes: -1}} {
+		if err := validateTruncate(&config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used by the terminal UI
+const (
+	ansiClear       = "\x1b[H\x1b[2J"
+	ansiAltScreen   = "\x1b[?1049h\x1b[?25l"
+	ansiMainScreen  = "\x1b[?25h\x1b[?1049l"
+	ansiBold        = "\x1b[1m"
+	ansiReverse     = "\x1b[7m"
+	ansiDim         = "\x1b[2m"
+	ansiGreen       = "\x1b[32m"
+	ansiYellow      = "\x1b[33m"
+	ansiRed         = "\x1b[31m"
+	ansiReset       = "\x1b[0m"
+	tuiTrafficLines = 15
+	tuiHitLines     = 10
+)
+
+// tuiModel is the state displayed by the terminal UI
+type tuiModel struct {
+	server   string
+	plugins  []tuiPlugin
+	selected int
+	requests []exportRecord
+	status   string
+	width    int
+}
+
+// tuiPlugin is a plugin row of the terminal UI
+type tuiPlugin struct {
+	Name      string
+	Enabled   bool
+	Endpoints int
+}
+
+// runTUI implements the tui command and returns the exit code
+func runTUI(args []string) int {
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	serverURL := flags.String("url", "http://localhost:9000", "URL of the running nmock server")
+	interval := flags.Int("interval", 1000, "Refresh interval in milliseconds")
+	token := adminTokenFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "tui: standard input is not a terminal")
+		return 2
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tui: %v\n", err)
+		return 2
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print(ansiAltScreen)
+	defer fmt.Print(ansiMainScreen)
+
+	rc := &replClient{
+		baseURL: strings.TrimSuffix(*serverURL, "/"),
+		token:   *token,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		out:     io.Discard,
+	}
+	model := &tuiModel{server: rc.baseURL}
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, key := range tuiKeys(buf[:n]) {
+				keys <- key
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(max(*interval, 100)) * time.Millisecond)
+	defer ticker.Stop()
+
+	refresh := func() {
+		model.refresh(rc)
+		if width, _, err := term.GetSize(fd); err == nil {
+			model.width = width
+		}
+		fmt.Print(ansiClear + strings.ReplaceAll(model.render(), "\n", "\r\n"))
+	}
+	refresh()
+
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return 0
+			}
+			switch model.handleKey(key) {
+			case "quit":
+				return 0
+			case "toggle":
+				plugin := model.plugins[model.selected]
+				if err := rc.call("POST", "/_admin/plugins/"+url.PathEscape(plugin.Name)+"/toggle", nil, nil); err != nil {
+					model.status = "Error: " + err.Error()
+				} else {
+					model.status = fmt.Sprintf("Toggled %s", plugin.Name)
+				}
+			}
+			refresh()
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// tuiKeys converts terminal input to key codes, mapping arrow keys to k/j
+func tuiKeys(input []byte) []byte {
+	var keys []byte
+	for i := 0; i < len(input); i++ {
+		if input[i] == 0x1b && i+2 < len(input) && input[i+1] == '[' {
+			switch input[i+2] {
+			case 'A':
+				keys = append(keys, 'k')
+			case 'B':
+				keys = append(keys, 'j')
+			}
+			i += 2
+			continue
+		}
+		keys = append(keys, input[i])
+	}
+	return keys
+}
+
+// handleKey updates the selection and returns the action of a key, if any
+func (m *tuiModel) handleKey(key byte) string {
+	switch key {
+	case 'q', 3: // q or Ctrl-C
+		return "quit"
+	case 'j':
+		if m.selected < len(m.plugins)-1 {
+			m.selected++
+		}
+	case 'k':
+		if m.selected > 0 {
+			m.selected--
+		}
+	case ' ', '\r', 't':
+		if m.selected < len(m.plugins) {
+			return "toggle"
+		}
+	}
+	return ""
+}
+
+// refresh fetches plugins and traffic from the server
+func (m *tuiModel) refresh(rc *replClient) {
+	var plugins map[string]*Plugin
+	if err := rc.call("GET", "/_admin/plugins", nil, &plugins); err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.plugins = m.plugins[:0]
+	for name, plugin := range plugins {
+		m.plugins = append(m.plugins, tuiPlugin{Name: name, Enabled: plugin.Enabled, Endpoints: len(plugin.allEndpoints())})
+	}
+	sort.Slice(m.plugins, func(i, j int) bool { return m.plugins[i].Name < m.plugins[j].Name })
+	m.selected = min(m.selected, max(len(m.plugins)-1, 0))
+
+	var buf bytes.Buffer
+	if err := rc.call("GET", "/_admin/requests/export?format=jsonl", nil, &buf); err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.requests = m.requests[:0]
+	decoder := json.NewDecoder(&buf)
+	for {
+		var record exportRecord
+		if err := decoder.Decode(&record); err != nil {
+			break
+		}
+		m.requests = append(m.requests, record)
+	}
+}
+
+// render draws the screen
+func (m *tuiModel) render() string {
+	var b strings.Builder
+	width := m.width
+	if width <= 0 {
+		width = 80
+	}
+	line := func(format string, args ...interface{}) {
+		text := fmt.Sprintf(format, args...)
+		b.WriteString(text)
+		b.WriteString(ansiReset + "\n")
+	}
+
+	line("%snmock%s %s — %d requests", ansiBold, ansiReset, m.server, len(m.requests))
+	line("")
+
+	// Live traffic, newest first
+	line("%sRecent requests%s", ansiBold, ansiReset)
+	if len(m.requests) == 0 {
+		line("%s  no requests yet%s", ansiDim, ansiReset)
+	}
+	for i := len(m.requests) - 1; i >= 0 && i >= len(m.requests)-tuiTrafficLines; i-- {
+		record := m.requests[i]
+		started := record.StartedAt
+		if t, err := time.Parse(time.RFC3339Nano, record.StartedAt); err == nil {
+			started = t.Local().Format("15:04:05")
+		}
+		text := fmt.Sprintf("  %s %s%3d%s %-7s %s", started, statusColor(record.StatusCode), record.StatusCode, ansiReset, record.Method, record.URL)
+		line("%s", truncate(text, width+len(statusColor(record.StatusCode))+len(ansiReset)))
+	}
+	line("")
+
+	// Hit counts per endpoint
+	line("%sEndpoint hits%s", ansiBold, ansiReset)
+	hits := make(map[string]int)
+	for _, record := range m.requests {
+		route := record.Route
+		if route == "" {
+			route = "(unmatched)"
+		}
+		hits[route]++
+	}
+	routes := make([]string, 0, len(hits))
+	for route := range hits {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if hits[routes[i]] != hits[routes[j]] {
+			return hits[routes[i]] > hits[routes[j]]
+		}
+		return routes[i] < routes[j]
+	})
+	for i, route := range routes {
+		if i == tuiHitLines {
+			break
+		}
+		line("  %6d  %s", hits[route], truncate(route, width-10))
+	}
+	line("")
+
+	// Plugins with the selection highlighted
+	line("%sPlugins%s", ansiBold, ansiReset)
+	if len(m.plugins) == 0 {
+		line("%s  no plugins%s", ansiDim, ansiReset)
+	}
+	for i, plugin := range m.plugins {
+		state := ansiRed + "disabled"
+		if plugin.Enabled {
+			state = ansiGreen + "enabled "
+		}
+		text := fmt.Sprintf("  %-24s %s%s %3d endpoints", plugin.Name, state, ansiReset, plugin.Endpoints)
+		if i == m.selected {
+			text = ansiReverse + text
+		}
+		line("%s", text)
+	}
+	line("")
+
+	if m.status != "" {
+		line("%s", m.status)
+	}
+	line("%s↑/↓ or j/k select · space toggle plugin · q quit%s", ansiDim, ansiReset)
+	return b.String()
+}
+
+// statusColor returns the color of a status code
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return ansiRed
+	case status >= 400:
+		return ansiYellow
+	default:
+		return ansiGreen
+	}
+}
+
+// truncate shortens text to at most a number of bytes without splitting characters
+func truncate(text string, length int) string {
+	if length <= 0 || len(text) <= length {
+		return text
+	}
+	for length > 0 && !utf8.RuneStart(text[length]) {
+		length--
+	}
+	return text[:length]
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTUIModel tests fetching, rendering and key handling of the terminal UI
+func TestTUIModel(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints:  []Endpoint{{Path: "/api/users", Method: "GET", Response: []interface{}{}}},
+	}
+	server.plugins["billing"] = &Plugin{Name: "billing", Enabled: true}
+	server.plugins["auth"] = &Plugin{Name: "auth", Enabled: false}
+	server.SetupRoutes()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, path := range []string{"/api/users", "/api/users", "/api/missing"} {
+		resp, _ := http.Get(ts.URL + path)
+		resp.Body.Close()
+	}
+
+	model := &tuiModel{server: ts.URL}
+	model.refresh(&replClient{baseURL: ts.URL, client: ts.Client(), out: io.Discard})
+
+	if len(model.plugins) != 2 || model.plugins[0].Name != "auth" || len(model.requests) != 3 {
+		t.Fatalf("Unexpected model: %+v", model)
+	}
+
+	screen := model.render()
+	for _, expected := range []string{"3 requests", "GET     " + ts.URL + "/api/missing", "     2  GET /api/users", "     1  (unmatched)", "billing"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("Expected screen to contain %q:\n%s", expected, screen)
+		}
+	}
+
+	if action := model.handleKey('j'); action != "" || model.selected != 1 {
+		t.Errorf("Expected j to move the selection, got %q at %d", action, model.selected)
+	}
+	model.handleKey('j')
+	if model.selected != 1 {
+		t.Errorf("Expected the selection to stop at the last plugin, got %d", model.selected)
+	}
+	if action := model.handleKey(' '); action != "toggle" {
+		t.Errorf("Expected space to toggle, got %q", action)
+	}
+	if action := model.handleKey('q'); action != "quit" {
+		t.Errorf("Expected q to quit, got %q", action)
+	}
+
+	if keys := string(tuiKeys([]byte("\x1b[A\x1b[Bq"))); keys != "kjq" {
+		t.Errorf("Expected arrow keys to map to k/j, got %q", keys)
+	}
+}
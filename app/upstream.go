@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// UpstreamConfig is the latency and error model of a fake service shared by
+// the endpoints that reference it, so that they degrade together
+type UpstreamConfig struct {
+	Delay         int         `json:"delay,omitempty"`          // milliseconds added to every response
+	Jitter        int         `json:"jitter,omitempty"`         // random milliseconds added on top of delay, up to this many
+	ErrorRate     float64     `json:"error_rate,omitempty"`     // share of requests answered with an error, from 0 to 1
+	ErrorStatus   int         `json:"error_status,omitempty"`   // status of errors (default: 503)
+	ErrorResponse interface{} `json:"error_response,omitempty"` // body of errors (default: an error object naming the upstream)
+	MaxConcurrent int         `json:"max_concurrent,omitempty"` // requests served at once by all endpoints; others wait for a slot
+
+	Rules    []UpstreamRule `json:"rules,omitempty"`    // models by time of day or load; the first matching rule applies
+	Timezone string         `json:"timezone,omitempty"` // IANA time zone of the rules' hours and days (default: local time)
+}
+
+// upstreamModel is the part of an upstream's model that can be changed at
+// runtime through the admin API
+type upstreamModel struct {
+	Delay     int     `json:"delay"`
+	Jitter    int     `json:"jitter"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// validateUpstreams checks the upstreams of a configuration and the
+// references of its endpoints
+func validateUpstreams(config *Config) error {
+	for name, upstream := range config.Upstreams {
+		if err := upstream.validate(); err != nil {
+			return fmt.Errorf("upstream %q: %v", name, err)
+		}
+	}
+	for _, ep := range config.Endpoints {
+		if _, found := config.Upstreams[ep.Upstream]; ep.Upstream != "" && !found {
+			return fmt.Errorf("unknown upstream %q referenced by %s %s", ep.Upstream, ep.Method, ep.Path)
+		}
+	}
+	return nil
+}
+
+// validate checks the model of an upstream
+func (uc UpstreamConfig) validate() error {
+	if err := (upstreamModel{Delay: uc.Delay, Jitter: uc.Jitter, ErrorRate: uc.ErrorRate}).validate(); err != nil {
+		return err
+	}
+	if uc.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	if uc.ErrorStatus != 0 {
+		if err := validateStatusCode(uc.ErrorStatus); err != nil {
+			return err
+		}
+	}
+	if uc.Timezone != "" {
+		if _, err := time.LoadLocation(uc.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+	for i, rule := range uc.Rules {
+		if _, err := rule.compile(); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a latency and error model
+func (um upstreamModel) validate() error {
+	if um.Delay < 0 || um.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must not be negative")
+	}
+	if um.ErrorRate < 0 || um.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1, got %v", um.ErrorRate)
+	}
+	return nil
+}
+
+// upstream applies the model of a fake service to its endpoints' requests
+type upstream struct {
+	name        string
+	config      UpstreamConfig
+	errorStatus int
+	errorBody   []byte
+	slots       chan struct{} // nil without max_concurrent
+	rules       []upstreamRule
+	location    *time.Location
+	rate        rateCounter
+	now         func() time.Time
+
+	mutex    sync.Mutex
+	override *upstreamModel // model set through the admin API
+
+	requests, errors, active, waiting atomic.Int64
+}
+
+// newUpstream creates an upstream from a validated configuration
+func newUpstream(name string, config UpstreamConfig) *upstream {
+	u := &upstream{name: name, config: config, errorStatus: config.ErrorStatus, now: time.Now}
+	u.location = time.Local
+	if config.Timezone != "" {
+		u.location, _ = time.LoadLocation(config.Timezone)
+	}
+	for _, rule := range config.Rules {
+		compiled, _ := rule.compile()
+		u.rules = append(u.rules, compiled)
+	}
+	if u.errorStatus == 0 {
+		u.errorStatus = http.StatusServiceUnavailable
+	}
+	errorResponse := config.ErrorResponse
+	if errorResponse == nil {
+		errorResponse = map[string]string{"error": fmt.Sprintf("Upstream %s unavailable", name)}
+	}
+	u.errorBody, _ = encodeResponse(errorResponse)
+	if config.MaxConcurrent > 0 {
+		u.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	return u
+}
+
+// model returns the model in effect: the one set through the admin API,
+// the one of the first matching rule or the configured one
+func (u *upstream) model() upstreamModel {
+	model, _ := u.activeModel()
+	return model
+}
+
+// activeModel returns the model in effect and the 1-based number of the
+// rule it comes from, or 0
+func (u *upstream) activeModel() (upstreamModel, int) {
+	u.mutex.Lock()
+	override := u.override
+	u.mutex.Unlock()
+	if override != nil {
+		return *override, 0
+	}
+
+	if len(u.rules) > 0 {
+		now := u.now()
+		rate := u.rate.rate(now)
+		local := now.In(u.location)
+		for i, rule := range u.rules {
+			if rule.matches(local, rate) {
+				return rule.model, i + 1
+			}
+		}
+	}
+	return upstreamModel{Delay: u.config.Delay, Jitter: u.config.Jitter, ErrorRate: u.config.ErrorRate}, 0
+}
+
+// setOverride replaces the model until it is reset with nil
+func (u *upstream) setOverride(model *upstreamModel) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.override = model
+}
+
+// acquire waits for a slot when the concurrency is limited. The returned
+// function releases it.
+func (u *upstream) acquire() func() {
+	u.requests.Add(1)
+	u.rate.add(u.now())
+	if u.slots != nil {
+		u.waiting.Add(1)
+		u.slots <- struct{}{}
+		u.waiting.Add(-1)
+	}
+	u.active.Add(1)
+	return func() {
+		u.active.Add(-1)
+		if u.slots != nil {
+			<-u.slots
+		}
+	}
+}
+
+// delay returns the latency of a request, drawing its jitter from the
+// random numbers of the request
+func (u *upstream) delay(model upstreamModel, random *rand.Rand) time.Duration {
+	delay := model.Delay
+	if model.Jitter > 0 {
+		delay += random.IntN(model.Jitter + 1)
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// fails decides whether a request is answered with an error
+func (u *upstream) fails(model upstreamModel, random *rand.Rand) bool {
+	if model.ErrorRate > 0 && random.Float64() < model.ErrorRate {
+		u.errors.Add(1)
+		return true
+	}
+	return false
+}
+
+// writeError answers a request with the error of the upstream
+func (u *upstream) writeError(w http.ResponseWriter) {
+	if len(w.Header()["Content-Type"]) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(u.errorStatus)
+	w.Write(u.errorBody)
+}
+
+// status returns the model and the counts of an upstream for the admin API
+func (u *upstream) status() map[string]interface{} {
+	u.mutex.Lock()
+	degraded := u.override != nil
+	u.mutex.Unlock()
+	model, rule := u.activeModel()
+	status := map[string]interface{}{
+		"model":          model,
+		"degraded":       degraded,
+		"rate":           u.rate.rate(u.now()),
+		"max_concurrent": u.config.MaxConcurrent,
+		"requests":       u.requests.Load(),
+		"errors":         u.errors.Load(),
+		"active":         u.active.Load(),
+		"waiting":        u.waiting.Load(),
+	}
+	if rule > 0 {
+		status["rule"] = rule
+	}
+	return status
+}
+
+// upstreamSet holds the upstreams of the configuration
+type upstreamSet struct {
+	mutex     sync.RWMutex
+	upstreams map[string]*upstream
+}
+
+// newUpstreamSet creates a set without upstreams
+func newUpstreamSet() *upstreamSet {
+	return &upstreamSet{upstreams: make(map[string]*upstream)}
+}
+
+// configure replaces the upstreams. Unchanged upstreams keep their counts
+// and runtime model, so a reload doesn't end a degradation.
+func (us *upstreamSet) configure(configs map[string]UpstreamConfig) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	upstreams := make(map[string]*upstream, len(configs))
+	for name, config := range configs {
+		if existing, ok := us.upstreams[name]; ok && reflect.DeepEqual(existing.config, config) {
+			upstreams[name] = existing
+		} else {
+			upstreams[name] = newUpstream(name, config)
+		}
+	}
+	us.upstreams = upstreams
+}
+
+// get returns an upstream by name
+func (us *upstreamSet) get(name string) (*upstream, bool) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+	u, ok := us.upstreams[name]
+	return u, ok
+}
+
+// setupUpstreamAPI registers the admin API of upstreams
+func (ms *MockServer) setupUpstreamAPI() {
+	// Show the model in effect and the counts of every upstream
+	ms.router.HandleFunc("/_admin/upstreams", func(w http.ResponseWriter, r *http.Request) {
+		ms.upstreams.mutex.RLock()
+		names := make([]string, 0, len(ms.upstreams.upstreams))
+		for name := range ms.upstreams.upstreams {
+			names = append(names, name)
+		}
+		ms.upstreams.mutex.RUnlock()
+		sort.Strings(names)
+
+		result := make(map[string]interface{}, len(names))
+		for _, name := range names {
+			if u, ok := ms.upstreams.get(name); ok {
+				result[name] = u.status()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// Degrade an upstream, changing all its endpoints at once
+	ms.router.HandleFunc("/_admin/upstreams/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		name := mux.Vars(r)["name"]
+		u, ok := ms.upstreams.get(name)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Upstream not found"})
+			return
+		}
+
+		var model upstreamModel
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&model); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Invalid model: %v", err)})
+			return
+		}
+		if err := model.validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		u.setOverride(&model)
+		json.NewEncoder(w).Encode(u.status())
+		log.Printf("Upstream %s degraded via admin API: delay %dms, jitter %dms, error rate %v", name, model.Delay, model.Jitter, model.ErrorRate)
+	}).Methods("POST")
+
+	// Restore the configured model of an upstream
+	ms.router.HandleFunc("/_admin/upstreams/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		name := mux.Vars(r)["name"]
+		u, ok := ms.upstreams.get(name)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Upstream not found"})
+			return
+		}
+
+		u.setOverride(nil)
+		json.NewEncoder(w).Encode(u.status())
+		log.Printf("Upstream %s restored via admin API", name)
+	}).Methods("DELETE")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestUpstream tests endpoints sharing the latency and errors of an upstream
+func TestUpstream(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Upstreams: map[string]UpstreamConfig{
+			"inventory": {Delay: 30, ErrorStatus: 502},
+		},
+		Endpoints: []Endpoint{
+			{Path: "/stock", Method: "GET", StatusCode: 200, Response: "stock", Upstream: "inventory"},
+			{Path: "/prices", Method: "GET", StatusCode: 200, Response: "prices", Upstream: "inventory"},
+			{Path: "/health/ready", Method: "GET", StatusCode: 200, Response: "ok"},
+		},
+	}
+	server.upstreams.configure(server.config.Upstreams)
+	server.SetupRoutes()
+
+	call := func(method, path, body string) (*httptest.ResponseRecorder, time.Duration) {
+		w := httptest.NewRecorder()
+		started := time.Now()
+		server.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w, time.Since(started)
+	}
+
+	if w, took := call("GET", "/stock", ""); w.Body.String() != "stock" || took < 30*time.Millisecond {
+		t.Errorf("Expected the response after the upstream delay, got %s after %v", w.Body.String(), took)
+	}
+
+	// Degrading the upstream affects all its endpoints, but no others
+	if w, _ := call("POST", "/_admin/upstreams/inventory", `{"error_rate": 1}`); w.Code != 200 {
+		t.Fatalf("Failed to degrade the upstream: %d %s", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/stock", "/prices"} {
+		if w, _ := call("GET", path, ""); w.Code != 502 || !strings.Contains(w.Body.String(), "Upstream inventory unavailable") {
+			t.Errorf("Expected the upstream error for %s, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+	if w, _ := call("GET", "/health/ready", ""); w.Code != 200 {
+		t.Errorf("Expected other endpoints to be unaffected, got %d", w.Code)
+	}
+
+	var status map[string]map[string]interface{}
+	w, _ := call("GET", "/_admin/upstreams", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid upstreams response: %v", err)
+	}
+	if inventory := status["inventory"]; inventory["degraded"] != true || inventory["requests"] != 3.0 || inventory["errors"] != 2.0 {
+		t.Errorf("Unexpected upstream status %v", inventory)
+	}
+
+	// Restoring the configured model ends the errors
+	if w, _ := call("DELETE", "/_admin/upstreams/inventory", ""); w.Code != 200 {
+		t.Fatalf("Failed to restore the upstream: %d", w.Code)
+	}
+	if w, _ := call("GET", "/prices", ""); w.Code != 200 || w.Body.String() != "prices" {
+		t.Errorf("Expected the response after restoring, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w, _ := call("POST", "/_admin/upstreams/inventory", `{"error_rate": 2}`); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid model, got %d", w.Code)
+	}
+	if w, _ := call("POST", "/_admin/upstreams/billing", `{}`); w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown upstream, got %d", w.Code)
+	}
+}
+
+// TestUpstreamConcurrency tests queueing requests of all endpoints of an upstream
+func TestUpstreamConcurrency(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Upstreams: map[string]UpstreamConfig{
+			"db": {Delay: 50, MaxConcurrent: 1},
+		},
+		Endpoints: []Endpoint{
+			{Path: "/a", Method: "GET", StatusCode: 200, Response: "a", Upstream: "db"},
+			{Path: "/b", Method: "GET", StatusCode: 200, Response: "b", Upstream: "db"},
+		},
+	}
+	server.upstreams.configure(server.config.Upstreams)
+	server.SetupRoutes()
+
+	// With one slot, requests to different endpoints are served one by one
+	started := time.Now()
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a", "/b", "/a"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}(path)
+	}
+	wg.Wait()
+	if took := time.Since(started); took < 150*time.Millisecond {
+		t.Errorf("Expected queued requests to take at least 150ms, took %v", took)
+	}
+}
+
+// TestValidateUpstreams tests checking upstreams and references to them
+func TestValidateUpstreams(t *testing.T) {
+	tests := []struct {
+		config *Config
+		valid  bool
+	}{
+		{&Config{Upstreams: map[string]UpstreamConfig{"a": {Delay: 10, Jitter: 5, ErrorRate: 0.5}}, Endpoints: []Endpoint{{Path: "/", Method: "GET", Upstream: "a"}}}, true},
+		{&Config{Endpoints: []Endpoint{{Path: "/", Method: "GET", Upstream: "a"}}}, false},
+		{&Config{Upstreams: map[string]UpstreamConfig{"a": {ErrorRate: 1.5}}}, false},
+		{&Config{Upstreams: map[string]UpstreamConfig{"a": {Delay: -1}}}, false},
+		{&Config{Upstreams: map[string]UpstreamConfig{"a": {ErrorStatus: 42}}}, false},
+	}
+	for i, test := range tests {
+		if err := validateUpstreams(test.config); (err == nil) != test.valid {
+			t.Errorf("Test %d: expected valid=%v, got %v", i+1, test.valid, err)
+		}
+	}
+
+	if err := validateUpstreams(&Config{}); err != nil {
+		t.Errorf("Expected no error without upstreams, got %v", err)
+	}
+	if (upstreamModel{ErrorRate: 1}).validate() != nil || (upstreamModel{Jitter: -1}).validate() == nil {
+		t.Error("Unexpected result validating runtime models")
+	}
+	if u := newUpstream("x", UpstreamConfig{}); u.errorStatus != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 as the default error status, got %d", u.errorStatus)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// automaticVerb returns the handler of a HEAD or OPTIONS request that no
+// endpoint defines, if automatic handling is enabled: HEAD answers like the
+// GET endpoint without a body and OPTIONS lists the methods of the path.
+// CORS preflight requests are answered for routes with CORS in any case.
+func (rs *routeSnapshot) automaticVerb(r *http.Request) (http.Handler, map[string]string) {
+	if isPreflight(r) {
+		probe := r.Clone(r.Context())
+		probe.Method = strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		route, _, _ := rs.match(probe)
+		if route == nil && probe.Method == http.MethodHead && rs.autoHead {
+			probe.Method = http.MethodGet
+			route, _, _ = rs.match(probe)
+		}
+		if route != nil && route.cors != nil {
+			return route.cors.preflight(rs.pathMethods(r)), nil
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodHead && rs.autoHead:
+		probe := r.Clone(r.Context())
+		probe.Method = http.MethodGet
+		if route, vars, _ := rs.match(probe); route != nil {
+			return headHandler(route.handler), vars
+		}
+
+	case r.Method == http.MethodOptions && rs.autoOptions:
+		return optionsHandler(rs.pathMethods(r)), nil
+	}
+	return nil, nil
+}
+
+// pathMethods returns the methods of a request path for an Allow header,
+// starting with OPTIONS and the common methods
+func (rs *routeSnapshot) pathMethods(r *http.Request) []string {
+	methods := make(map[string]bool)
+	rs.each(func(route *endpointRoute) bool {
+		if route.matchesPath(r) {
+			methods[route.method] = true
+		}
+		return true
+	})
+	if rs.autoHead && methods[http.MethodGet] {
+		methods[http.MethodHead] = true
+	}
+
+	allow := []string{http.MethodOptions}
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"} {
+		if methods[method] {
+			allow = append(allow, method)
+		}
+	}
+	var extra []string
+	for method := range methods {
+		if !slices.Contains(allow, method) {
+			extra = append(extra, method)
+		}
+	}
+	slices.Sort(extra)
+	return append(allow, extra...)
+}
+
+// automaticHeadKey marks HEAD requests answered by a GET endpoint in the
+// request context
+type automaticHeadKey struct{}
+
+// headHandler answers HEAD requests with the headers of the GET response
+func headHandler(get http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), automaticHeadKey{}, true))
+		get.ServeHTTP(headResponseWriter{w}, r)
+	})
+}
+
+// isAutomaticHead reports whether a HEAD request is answered by a GET
+// endpoint, which then leaves its state, such as the position of a response
+// sequence or idempotency keys, as it is
+func isAutomaticHead(r *http.Request) bool {
+	automatic, _ := r.Context().Value(automaticHeadKey{}).(bool)
+	return automatic
+}
+
+// headResponseWriter discards the response body
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// Flush passes flushes of streamed responses through
+func (w headResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// optionsHandler answers OPTIONS requests with the allowed methods, including
+// the headers needed for CORS preflight requests
+func optionsHandler(allow []string) http.Handler {
+	allowHeader := strings.Join(allow, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allowHeader)
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			origin = "*"
+		} else {
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", allowHeader)
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			w.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("%s %s - %d [auto]", r.Method, r.URL.Path, http.StatusNoContent)
+	})
+}
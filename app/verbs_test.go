@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAutoHead tests automatic HEAD handling for GET endpoints
+func TestAutoHead(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		AutoHead:   true,
+		Endpoints: []Endpoint{
+			{
+				Path:       "/api/users",
+				Method:     "GET",
+				StatusCode: 200,
+				Headers:    map[string]string{"X-Total-Count": "2"},
+				Response:   []string{"john", "jane"},
+			},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("HEAD", "/api/users", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if w.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("Expected X-Total-Count header '2', got '%s'", w.Header().Get("X-Total-Count"))
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got '%s'", w.Body.String())
+	}
+}
+
+// TestAutoHeadState tests answering HEAD requests for GET endpoints without
+// advancing sequences or using up idempotency keys, and passing flushes through
+func TestAutoHeadState(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		AutoHead:   true,
+		Endpoints: []Endpoint{
+			{Path: "/api/jobs", Method: "GET", Idempotency: &IdempotencyConfig{TTL: 60000}, Responses: []MappedResponse{
+				{StatusCode: 202, Response: "pending"},
+				{StatusCode: 200, Response: "done"},
+			}},
+			{Path: "/api/events", Method: "GET", StatusCode: 200, Chunks: []Chunk{{Data: "a"}, {Data: "b"}}},
+		},
+	}
+	server.SetupRoutes()
+
+	call := func(method, path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := call("HEAD", "/api/jobs", "a"); w.Code != 202 || w.Body.Len() != 0 {
+			t.Errorf("Expected the next response of the sequence without a body, got %d %q", w.Code, w.Body.String())
+		}
+	}
+	if calls := server.sequences["GET /api/jobs"].snapshot()["calls"]; calls != 0 {
+		t.Errorf("Expected HEAD requests not to advance the sequence, got %d calls", calls)
+	}
+	if _, used := server.idempotency["GET /api/jobs"].keys["a"]; used {
+		t.Error("Expected HEAD requests not to use up the idempotency key")
+	}
+	if w := call("GET", "/api/jobs", "a"); w.Code != 202 {
+		t.Errorf("Expected the first response of the sequence, got %d", w.Code)
+	}
+	if w := call("GET", "/api/jobs", "b"); w.Code != 200 {
+		t.Errorf("Expected the second response of the sequence, got %d", w.Code)
+	}
+
+	if w := call("HEAD", "/api/events", ""); !w.Flushed || w.Body.Len() != 0 {
+		t.Errorf("Expected the streamed response to be flushed without a body, got %q", w.Body.String())
+	}
+	recorder := httptest.NewRecorder()
+	if http.NewResponseController(headResponseWriter{recorder}).Flush() != nil || !recorder.Flushed {
+		t.Error("Expected the writer to be unwrapped by response controllers")
+	}
+}
+
+// TestAutoOptions tests automatic OPTIONS handling
+func TestAutoOptions(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:        "9000",
+		PluginsDir:  "plugins",
+		AutoHead:    true,
+		AutoOptions: true,
+		Endpoints: []Endpoint{
+			{Path: "/api/users", Method: "GET", Response: "list"},
+			{Path: "/api/users", Method: "POST", StatusCode: 201, Response: "created"},
+		},
+	}
+	server.SetupRoutes()
+
+	req := httptest.NewRequest("OPTIONS", "/api/users", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != 204 {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+
+	if allow := w.Header().Get("Allow"); allow != "OPTIONS, GET, HEAD, POST" {
+		t.Errorf("Expected Allow 'OPTIONS, GET, HEAD, POST', got '%s'", allow)
+	}
+
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "http://localhost:3000" {
+		t.Errorf("Expected Access-Control-Allow-Origin 'http://localhost:3000', got '%s'", origin)
+	}
+
+	if headers := w.Header().Get("Access-Control-Allow-Headers"); headers != "Content-Type" {
+		t.Errorf("Expected Access-Control-Allow-Headers 'Content-Type', got '%s'", headers)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// verifyNearMisses is the number of near misses reported per verification
+const verifyNearMisses = 5
+
+// Verification is an assertion on the recorded requests, e.g. that
+// POST /api/orders was called exactly twice with a body containing a SKU.
+// It matches requests like an expectation and can also check their query
+// and body.
+type Verification struct {
+	Expectation
+	Times        *int              `json:"times,omitempty"`         // exact number of calls, instead of min_calls and max_calls
+	Query        map[string]string `json:"query,omitempty"`         // required query parameters; an empty value accepts any value
+	BodyContains string            `json:"body_contains,omitempty"` // text the body must contain
+	BodyPattern  string            `json:"body_pattern,omitempty"`  // regular expression the body must match
+	BodyJSON     interface{}       `json:"body_json,omitempty"`     // JSON the body must contain; objects may have more fields
+
+	pattern *regexp.Regexp
+}
+
+// verificationResult is the outcome of a verification
+type verificationResult struct {
+	Verification string     `json:"verification"`
+	Passed       bool       `json:"passed"`
+	Expected     string     `json:"expected"`
+	Calls        int        `json:"calls"`
+	Message      string     `json:"message"`
+	Requests     []int      `json:"requests"`              // IDs of the matching requests
+	NearMisses   []nearMiss `json:"near_misses,omitempty"` // requests to the same method and path that didn't match
+}
+
+// nearMiss is a request that matched the method and path of a verification
+// but not the rest
+type nearMiss struct {
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// compile checks a verification and prepares its body pattern
+func (v *Verification) compile() error {
+	if err := v.Expectation.validate(); err != nil {
+		return err
+	}
+	if v.Times != nil {
+		if v.MinCalls != nil || v.MaxCalls != nil {
+			return fmt.Errorf("times can't be combined with min_calls or max_calls")
+		}
+		if *v.Times < 0 {
+			return fmt.Errorf("times must not be negative")
+		}
+		v.MinCalls, v.MaxCalls = v.Times, v.Times
+	}
+	if v.BodyPattern != "" {
+		pattern, err := regexp.Compile(v.BodyPattern)
+		if err != nil {
+			return fmt.Errorf("invalid body_pattern: %v", err)
+		}
+		v.pattern = pattern
+	}
+	return nil
+}
+
+// String describes a verification by its name or by what it matches
+func (v Verification) String() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	description := v.Expectation.String()
+	if v.BodyContains != "" {
+		description += fmt.Sprintf(" with body containing %q", v.BodyContains)
+	}
+	if v.BodyPattern != "" {
+		description += fmt.Sprintf(" with body matching %q", v.BodyPattern)
+	}
+	if v.BodyJSON != nil {
+		data, _ := json.Marshal(v.BodyJSON)
+		description += " with body " + string(data)
+	}
+	return description
+}
+
+// times describes a number of calls
+func times(n int) string {
+	if n == 1 {
+		return "1 time"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// expected describes the number of calls required
+func (v Verification) expected() string {
+	switch {
+	case v.MinCalls != nil && v.MaxCalls != nil && *v.MinCalls == *v.MaxCalls:
+		if *v.MinCalls == 0 {
+			return "never"
+		}
+		return "exactly " + times(*v.MinCalls)
+	case v.MinCalls != nil && v.MaxCalls != nil:
+		return fmt.Sprintf("between %d and %s", *v.MinCalls, times(*v.MaxCalls))
+	case v.MaxCalls != nil:
+		return "at most " + times(*v.MaxCalls)
+	case v.MinCalls != nil:
+		return "at least " + times(*v.MinCalls)
+	}
+	return "at least 1 time"
+}
+
+// mismatch returns why a request with the method and path of the
+// verification doesn't match it, or an empty string if it does
+func (v Verification) mismatch(entry historyEntry) string {
+	for key, value := range v.Headers {
+		values, exists := entry.RequestHeaders[http.CanonicalHeaderKey(key)]
+		if !exists {
+			return fmt.Sprintf("header %s is missing", key)
+		}
+		if value != "" && !slices.Contains(values, value) {
+			return fmt.Sprintf("header %s is %q", key, strings.Join(values, ", "))
+		}
+	}
+
+	if len(v.Query) > 0 {
+		var query url.Values
+		if parsed, err := url.Parse(entry.URL); err == nil {
+			query = parsed.Query()
+		}
+		for key, value := range v.Query {
+			if !query.Has(key) {
+				return fmt.Sprintf("query parameter %s is missing", key)
+			}
+			if value != "" && !slices.Contains(query[key], value) {
+				return fmt.Sprintf("query parameter %s is %q", key, query.Get(key))
+			}
+		}
+	}
+
+	if v.BodyContains != "" && !bytes.Contains(entry.RequestBody, []byte(v.BodyContains)) {
+		return fmt.Sprintf("body doesn't contain %q", v.BodyContains)
+	}
+	if v.pattern != nil && !v.pattern.Match(entry.RequestBody) {
+		return fmt.Sprintf("body doesn't match %q", v.BodyPattern)
+	}
+	if v.BodyJSON != nil {
+		var body interface{}
+		if err := json.Unmarshal(entry.RequestBody, &body); err != nil {
+			return "body isn't JSON"
+		}
+		if path := jsonMismatch(v.BodyJSON, body, "$"); path != "" {
+			return fmt.Sprintf("body differs at %s", path)
+		}
+	}
+	return ""
+}
+
+// jsonMismatch compares decoded JSON values. Objects may have fields that
+// aren't expected, other values must be equal. It returns the path of the
+// first difference, or an empty string.
+func jsonMismatch(expected, actual interface{}, path string) string {
+	expectedObject, ok := expected.(map[string]interface{})
+	if !ok {
+		if !reflect.DeepEqual(expected, actual) {
+			return path
+		}
+		return ""
+	}
+	actualObject, ok := actual.(map[string]interface{})
+	if !ok {
+		return path
+	}
+	for key, value := range expectedObject {
+		if mismatch := jsonMismatch(value, actualObject[key], path+"."+key); mismatch != "" {
+			return mismatch
+		}
+	}
+	return ""
+}
+
+// verify checks a verification against recorded requests
+func (v Verification) verify(entries []historyEntry) verificationResult {
+	result := verificationResult{Verification: v.String(), Expected: v.expected(), Requests: []int{}}
+
+	route := Expectation{Method: v.Method, Path: v.Path, Endpoint: v.Endpoint}
+	for _, entry := range entries {
+		if !route.matches(entry) {
+			continue
+		}
+		if reason := v.mismatch(entry); reason != "" {
+			if len(result.NearMisses) < verifyNearMisses {
+				result.NearMisses = append(result.NearMisses, nearMiss{ID: entry.ID, Method: entry.Method, URL: entry.URL, Reason: reason})
+			}
+			continue
+		}
+		result.Calls++
+		result.Requests = append(result.Requests, entry.ID)
+	}
+
+	result.Passed = v.Expectation.status(result.Calls) == ExpectationMet
+	status := "passed"
+	if !result.Passed {
+		status = "failed"
+	}
+	result.Message = fmt.Sprintf("%s %s: expected %s, called %s", v, status, result.Expected, times(result.Calls))
+	if result.Passed {
+		result.NearMisses = nil
+	}
+	return result
+}
+
+// decodeVerifications reads a single verification or a list of them
+func decodeVerifications(r *http.Request) ([]Verification, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid verification: %v", err)
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '[' {
+		raw = append(append([]byte{'['}, raw...), ']')
+	}
+
+	var verifications []Verification
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&verifications); err != nil {
+		return nil, fmt.Errorf("invalid verification: %v", err)
+	}
+	if len(verifications) == 0 {
+		return nil, fmt.Errorf("no verification given")
+	}
+	for i := range verifications {
+		if err := verifications[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid verification %d (%s): %v", i, verifications[i], err)
+		}
+	}
+	return verifications, nil
+}
+
+// setupVerifyAPI registers the API verifying the recorded requests
+func (ms *MockServer) setupVerifyAPI() {
+	// Check verifications against the request history. Failed
+	// verifications answer 422, so that test scripts can fail on the status.
+	ms.router.HandleFunc("/_admin/verify", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		verifications, err := decodeVerifications(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		// Bodies are matched as received, but secrets in URLs aren't shown
+		entries := ms.history.list()
+		passed := true
+		results := make([]verificationResult, 0, len(verifications))
+		for _, v := range verifications {
+			result := v.verify(entries)
+			for i := range result.NearMisses {
+				result.NearMisses[i].URL = string(ms.secrets.redactBytes([]byte(result.NearMisses[i].URL)))
+			}
+			passed = passed && result.Passed
+			results = append(results, result)
+		}
+
+		if !passed {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"passed": passed, "verifications": results})
+	}).Methods("POST")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestVerifyAPI tests verifying recorded requests with counts, query and
+// body matchers
+func TestVerifyAPI(t *testing.T) {
+	server := NewMockServer("")
+	server.config = &Config{
+		Port:       "9000",
+		PluginsDir: "plugins",
+		Endpoints: []Endpoint{
+			{ID: "create-order", Path: "/api/orders", Method: "POST", StatusCode: 201, Response: map[string]interface{}{"id": 1}},
+		},
+	}
+	server.SetupRoutes()
+
+	for _, body := range []string{
+		`{"sku": "A-1", "quantity": 2, "customer": {"id": 7, "tier": "gold"}}`,
+		`{"sku": "A-1", "quantity": 1, "customer": {"id": 8}}`,
+		`{"sku": "B-2", "quantity": 1}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/orders?source=web", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	verify := func(body string) (int, struct {
+		Passed        bool                 `json:"passed"`
+		Verifications []verificationResult `json:"verifications"`
+	}) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("POST", "/_admin/verify", strings.NewReader(body)))
+		var result struct {
+			Passed        bool                 `json:"passed"`
+			Verifications []verificationResult `json:"verifications"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	code, result := verify(`{"method": "POST", "path": "/api/orders", "body_contains": "A-1", "times": 2}`)
+	if code != 200 || !result.Passed || len(result.Verifications) != 1 {
+		t.Fatalf("Expected the verification to pass, got %d %+v", code, result)
+	}
+	if v := result.Verifications[0]; v.Calls != 2 || len(v.Requests) != 2 || v.Requests[0] != 1 ||
+		v.Message != `POST /api/orders with body containing "A-1" passed: expected exactly 2 times, called 2 times` {
+		t.Errorf("Unexpected result %+v", v)
+	}
+
+	tests := []struct {
+		verification string
+		passed       bool
+		calls        int
+	}{
+		{`{"endpoint": "create-order", "min_calls": 3}`, true, 3},
+		{`{"path": "/api/orders", "body_json": {"customer": {"tier": "gold"}}}`, true, 1},
+		{`{"path": "/api/orders", "body_json": {"sku": "A-1", "quantity": 1}, "times": 1}`, true, 1},
+		{`{"path": "/api/orders", "body_pattern": "\"sku\": \"[AB]-\\d\"", "times": 3}`, true, 3},
+		{`{"path": "/api/orders", "query": {"source": "web"}, "headers": {"Content-Type": ""}, "times": 3}`, true, 3},
+		{`{"path": "/api/orders", "query": {"source": "app"}}`, false, 0},
+		{`{"method": "GET", "path": "/api/orders", "max_calls": 0}`, true, 0},
+		{`{"path": "/api/orders", "body_contains": "B-2", "times": 2}`, false, 1},
+	}
+	for _, test := range tests {
+		code, result := verify(test.verification)
+		if len(result.Verifications) != 1 {
+			t.Errorf("%s: unexpected response %d %+v", test.verification, code, result)
+			continue
+		}
+		v := result.Verifications[0]
+		if v.Passed != test.passed || result.Passed != test.passed || v.Calls != test.calls || (code == 200) != test.passed {
+			t.Errorf("%s: expected passed=%v with %d calls, got %d %+v", test.verification, test.passed, test.calls, code, v)
+		}
+	}
+
+	// Failures explain why requests to the route didn't match
+	code, result = verify(`[{"path": "/api/orders", "times": 3}, {"name": "gold order twice", "path": "/api/orders", "body_json": {"customer": {"tier": "gold"}}, "times": 2}]`)
+	if code != 422 || result.Passed || len(result.Verifications) != 2 || !result.Verifications[0].Passed {
+		t.Fatalf("Expected the second verification to fail, got %d %+v", code, result)
+	}
+	failed := result.Verifications[1]
+	if failed.Message != "gold order twice failed: expected exactly 2 times, called 1 time" || len(failed.NearMisses) != 2 ||
+		failed.NearMisses[0].ID != 2 || failed.NearMisses[0].Reason != "body differs at $.customer.tier" || failed.NearMisses[1].Reason != "body differs at $.customer" {
+		t.Errorf("Unexpected failure details %+v", failed)
+	}
+
+	for _, invalid := range []string{`{"times": 1}`, `{"path": "/a", "times": 1, "min_calls": 1}`, `{"path": "/a", "body_pattern": "("}`, `{"path": "/a", "bodycontains": "x"}`, `[]`} {
+		if code, _ := verify(invalid); code != 400 {
+			t.Errorf("%s: expected an invalid verification to be rejected, got %d", invalid, code)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Namespaces of the SOAP bindings and envelopes
+const (
+	wsdlSOAP11Namespace = "http://schemas.xmlsoap.org/wsdl/soap/"
+	wsdlSOAP12Namespace = "http://schemas.xmlsoap.org/wsdl/soap12/"
+	soap11Envelope      = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Envelope      = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// wsdlMaxDepth limits the nesting of sample elements, e.g. for recursive types
+const wsdlMaxDepth = 10
+
+// wsdlDefinitions is the subset of a WSDL 1.1 document used by the importer
+type wsdlDefinitions struct {
+	Name            string         `xml:"name,attr"`
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Schemas         []xsdSchema    `xml:"types>schema"`
+	Messages        []wsdlMessage  `xml:"message"`
+	PortTypes       []wsdlPortType `xml:"portType"`
+	Bindings        []wsdlBinding  `xml:"binding"`
+	Services        []wsdlService  `xml:"service"`
+}
+
+type wsdlMessage struct {
+	Name  string `xml:"name,attr"`
+	Parts []struct {
+		Name    string `xml:"name,attr"`
+		Element string `xml:"element,attr"`
+		Type    string `xml:"type,attr"`
+	} `xml:"part"`
+}
+
+type wsdlPortType struct {
+	Name       string `xml:"name,attr"`
+	Operations []struct {
+		Name   string `xml:"name,attr"`
+		Output struct {
+			Message string `xml:"message,attr"`
+		} `xml:"output"`
+	} `xml:"operation"`
+}
+
+type wsdlBinding struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+	SOAP struct {
+		XMLName xml.Name
+		Style   string `xml:"style,attr"`
+	} `xml:"binding"`
+	Operations []struct {
+		Name      string `xml:"name,attr"`
+		Operation struct {
+			SOAPAction string `xml:"soapAction,attr"`
+			Style      string `xml:"style,attr"`
+		} `xml:"operation"`
+		Output struct {
+			Body struct {
+				Namespace string `xml:"namespace,attr"`
+			} `xml:"body"`
+		} `xml:"output"`
+	} `xml:"operation"`
+}
+
+type wsdlService struct {
+	Name  string `xml:"name,attr"`
+	Ports []struct {
+		Name    string `xml:"name,attr"`
+		Binding string `xml:"binding,attr"`
+		Address struct {
+			Location string `xml:"location,attr"`
+		} `xml:"address"`
+	} `xml:"port"`
+}
+
+// xsdSchema is the subset of an XML schema used to build sample messages
+type xsdSchema struct {
+	TargetNamespace    string           `xml:"targetNamespace,attr"`
+	ElementFormDefault string           `xml:"elementFormDefault,attr"`
+	Elements           []xsdElement     `xml:"element"`
+	ComplexTypes       []xsdComplexType `xml:"complexType"`
+	SimpleTypes        []xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+	SimpleType  *xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdComplexType struct {
+	Name     string       `xml:"name,attr"`
+	Sequence []xsdElement `xml:"sequence>element"`
+	All      []xsdElement `xml:"all>element"`
+	Choice   []xsdElement `xml:"choice>element"`
+	Content  *struct {
+		Extension struct {
+			Base     string       `xml:"base,attr"`
+			Sequence []xsdElement `xml:"sequence>element"`
+		} `xml:"extension"`
+	} `xml:"complexContent"`
+	SimpleContent *struct {
+		Extension struct {
+			Base string `xml:"base,attr"`
+		} `xml:"extension"`
+	} `xml:"simpleContent"`
+}
+
+type xsdSimpleType struct {
+	Name        string `xml:"name,attr"`
+	Restriction struct {
+		Base         string `xml:"base,attr"`
+		Enumerations []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"enumeration"`
+	} `xml:"restriction"`
+}
+
+// xsdIndex looks up global schema components by local name
+type xsdIndex struct {
+	elements     map[string]xsdElement
+	complexTypes map[string]xsdComplexType
+	simpleTypes  map[string]xsdSimpleType
+	schemas      map[string]*xsdSchema // schema declaring each global component
+}
+
+// newXSDIndex indexes the global components of the schemas
+func newXSDIndex(schemas []xsdSchema) *xsdIndex {
+	index := &xsdIndex{
+		elements:     make(map[string]xsdElement),
+		complexTypes: make(map[string]xsdComplexType),
+		simpleTypes:  make(map[string]xsdSimpleType),
+		schemas:      make(map[string]*xsdSchema),
+	}
+	for i := range schemas {
+		schema := &schemas[i]
+		for _, element := range schema.Elements {
+			index.elements[element.Name] = element
+			index.schemas["element:"+element.Name] = schema
+		}
+		for _, complexType := range schema.ComplexTypes {
+			index.complexTypes[complexType.Name] = complexType
+			index.schemas["type:"+complexType.Name] = schema
+		}
+		for _, simpleType := range schema.SimpleTypes {
+			index.simpleTypes[simpleType.Name] = simpleType
+		}
+	}
+	return index
+}
+
+// localName strips the namespace prefix of a qualified name
+func localName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// sampleValue returns a sample value of a built-in or simple type
+func (index *xsdIndex) sampleValue(typeName string) string {
+	name := localName(typeName)
+	if simpleType, ok := index.simpleTypes[name]; ok {
+		if len(simpleType.Restriction.Enumerations) > 0 {
+			return simpleType.Restriction.Enumerations[0].Value
+		}
+		if localName(simpleType.Restriction.Base) != name {
+			return index.sampleValue(simpleType.Restriction.Base)
+		}
+	}
+
+	switch name {
+	case "boolean":
+		return "true"
+	case "int", "integer", "long", "short", "byte", "unsignedInt", "unsignedLong",
+		"unsignedShort", "unsignedByte", "positiveInteger", "nonNegativeInteger":
+		return "1"
+	case "negativeInteger", "nonPositiveInteger":
+		return "-1"
+	case "decimal", "double", "float":
+		return "1.5"
+	case "date":
+		return "2024-01-01"
+	case "dateTime":
+		return "2024-01-01T00:00:00Z"
+	case "time":
+		return "12:00:00"
+	case "duration":
+		return "P1D"
+	case "base64Binary":
+		return "AA=="
+	case "hexBinary":
+		return "00"
+	case "anyURI":
+		return "http://example.com"
+	}
+	return "string"
+}
+
+// xmlSample writes indented sample XML for schema elements
+type xmlSample struct {
+	index     *xsdIndex
+	buffer    bytes.Buffer
+	expanding map[string]bool // named types being written, to cut recursion
+}
+
+// element writes a sample of an element. Global elements, and local ones of
+// schemas with qualified element forms, are in the schema's namespace.
+func (s *xmlSample) element(element xsdElement, schema *xsdSchema, global bool, parentNamespace string, depth int) {
+	if element.Ref != "" {
+		name := localName(element.Ref)
+		if referenced, ok := s.index.elements[name]; ok {
+			s.element(referenced, s.index.schemas["element:"+name], true, parentNamespace, depth)
+		}
+		return
+	}
+
+	namespace := ""
+	if schema != nil && (global || schema.ElementFormDefault == "qualified") {
+		namespace = schema.TargetNamespace
+	}
+	indent := strings.Repeat("  ", depth)
+	s.buffer.WriteString(indent + "<" + element.Name)
+	if namespace != parentNamespace {
+		fmt.Fprintf(&s.buffer, " xmlns=%q", namespace)
+	}
+
+	// Simple content is written inline, complex content on its own lines
+	complexType := element.ComplexType
+	if complexType == nil && element.Type != "" {
+		typeName := localName(element.Type)
+		if named, ok := s.index.complexTypes[typeName]; ok {
+			if s.expanding[typeName] {
+				s.buffer.WriteString("/>\n")
+				return
+			}
+			s.expanding[typeName] = true
+			defer delete(s.expanding, typeName)
+			complexType = &named
+			schema = s.index.schemas["type:"+typeName]
+		}
+	}
+	switch {
+	case complexType != nil && complexType.SimpleContent != nil:
+		s.buffer.WriteString(">")
+		xml.EscapeText(&s.buffer, []byte(s.index.sampleValue(complexType.SimpleContent.Extension.Base)))
+	case complexType != nil:
+		children := s.index.children(*complexType, 0)
+		if len(children) == 0 || depth >= wsdlMaxDepth {
+			s.buffer.WriteString("/>\n")
+			return
+		}
+		s.buffer.WriteString(">\n")
+		for _, child := range children {
+			s.element(child, schema, false, namespace, depth+1)
+		}
+		s.buffer.WriteString(indent)
+	case element.SimpleType != nil:
+		s.buffer.WriteString(">")
+		value := s.index.sampleValue(element.SimpleType.Restriction.Base)
+		if len(element.SimpleType.Restriction.Enumerations) > 0 {
+			value = element.SimpleType.Restriction.Enumerations[0].Value
+		}
+		xml.EscapeText(&s.buffer, []byte(value))
+	default:
+		s.buffer.WriteString(">")
+		xml.EscapeText(&s.buffer, []byte(s.index.sampleValue(element.Type)))
+	}
+	s.buffer.WriteString("</" + element.Name + ">\n")
+}
+
+// children returns the child elements of a complex type, including those of
+// the types it extends. Only the first alternative of a choice is used.
+func (index *xsdIndex) children(complexType xsdComplexType, depth int) []xsdElement {
+	var children []xsdElement
+	if complexType.Content != nil && depth < wsdlMaxDepth {
+		if base, ok := index.complexTypes[localName(complexType.Content.Extension.Base)]; ok {
+			children = append(children, index.children(base, depth+1)...)
+		}
+		children = append(children, complexType.Content.Extension.Sequence...)
+	}
+	children = append(children, complexType.Sequence...)
+	children = append(children, complexType.All...)
+	if len(complexType.Choice) > 0 {
+		children = append(children, complexType.Choice[0])
+	}
+	return children
+}
+
+// SOAPAction returns the action of a SOAP request, taken from the
+// SOAPAction header (SOAP 1.1) or the Content-Type action (SOAP 1.2)
+func (d requestData) SOAPAction() string {
+	if action := d.Headers.Get("SOAPAction"); action != "" {
+		return strings.Trim(action, `"`)
+	}
+	_, params, _ := mime.ParseMediaType(d.Headers.Get("Content-Type"))
+	return params["action"]
+}
+
+// soapEnvelope wraps sample body content in a SOAP envelope
+func soapEnvelope(namespace, body string) string {
+	return "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		fmt.Sprintf("<soap:Envelope xmlns:soap=%q>\n", namespace) +
+		"  <soap:Body>\n" + body + "  </soap:Body>\n" +
+		"</soap:Envelope>\n"
+}
+
+// soapFault returns the envelope of a fault caused by the client
+func soapFault(namespace, message string) string {
+	var text bytes.Buffer
+	xml.EscapeText(&text, []byte(message))
+	if namespace == soap12Envelope {
+		return soapEnvelope(namespace, "    <soap:Fault>\n"+
+			"      <soap:Code><soap:Value>soap:Sender</soap:Value></soap:Code>\n"+
+			"      <soap:Reason><soap:Text xml:lang=\"en\">"+text.String()+"</soap:Text></soap:Reason>\n"+
+			"    </soap:Fault>\n")
+	}
+	return soapEnvelope(namespace, "    <soap:Fault>\n"+
+		"      <faultcode>soap:Client</faultcode>\n"+
+		"      <faultstring>"+text.String()+"</faultstring>\n"+
+		"    </soap:Fault>\n")
+}
+
+// wsdlOperation is an operation of a SOAP port with its sample response
+type wsdlOperation struct {
+	name     string
+	action   string
+	response string
+}
+
+// importWSDL generates a plugin with one endpoint per SOAP port of a WSDL
+// 1.1 document. Operations of a port are told apart by their SOAP action
+// and answer with a sample envelope derived from the schema. Problems that
+// don't prevent the import are returned as warnings.
+func importWSDL(data []byte, name string) (*Plugin, []string, error) {
+	var definitions wsdlDefinitions
+	if err := xml.Unmarshal(data, &definitions); err != nil {
+		return nil, nil, fmt.Errorf("invalid WSDL: %v", err)
+	}
+	if name == "" {
+		name = definitions.Name
+	}
+	if name == "" && len(definitions.Services) > 0 {
+		name = definitions.Services[0].Name
+	}
+
+	index := newXSDIndex(definitions.Schemas)
+	messages := make(map[string]wsdlMessage, len(definitions.Messages))
+	for _, message := range definitions.Messages {
+		messages[message.Name] = message
+	}
+	portTypes := make(map[string]wsdlPortType, len(definitions.PortTypes))
+	for _, portType := range definitions.PortTypes {
+		portTypes[portType.Name] = portType
+	}
+	bindings := make(map[string]wsdlBinding, len(definitions.Bindings))
+	for _, binding := range definitions.Bindings {
+		bindings[binding.Name] = binding
+	}
+
+	plugin := &Plugin{Name: name, Description: "Imported from WSDL", Enabled: true, Endpoints: []Endpoint{}}
+	var warnings []string
+	paths := make(map[string]string) // endpoint path to the port serving it
+	for _, service := range definitions.Services {
+		for _, port := range service.Ports {
+			binding, ok := bindings[localName(port.Binding)]
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("port %s: unknown binding %s", port.Name, port.Binding))
+				continue
+			}
+			envelope := soap11Envelope
+			contentType := "text/xml"
+			switch binding.SOAP.XMLName.Space {
+			case wsdlSOAP11Namespace:
+			case wsdlSOAP12Namespace:
+				envelope = soap12Envelope
+				contentType = "application/soap+xml"
+			default:
+				// HTTP bindings and the like are not SOAP
+				continue
+			}
+
+			path := "/"
+			if location, err := url.Parse(port.Address.Location); err == nil && location.Path != "" {
+				path = location.Path
+			}
+			if other, exists := paths[path]; exists {
+				warnings = append(warnings, fmt.Sprintf("port %s: %s is already served by port %s", port.Name, path, other))
+				continue
+			}
+			paths[path] = port.Name
+
+			portType := portTypes[localName(binding.Type)]
+			outputs := make(map[string]string, len(portType.Operations))
+			for _, operation := range portType.Operations {
+				outputs[operation.Name] = localName(operation.Output.Message)
+			}
+
+			var operations []wsdlOperation
+			for _, operation := range binding.Operations {
+				style := operation.Operation.Style
+				if style == "" {
+					style = binding.SOAP.Style
+				}
+				namespace := operation.Output.Body.Namespace
+				if namespace == "" {
+					namespace = definitions.TargetNamespace
+				}
+				body := index.sampleBody(messages[outputs[operation.Name]], operation.Name, style, namespace)
+				operations = append(operations, wsdlOperation{
+					name:     operation.Name,
+					action:   operation.Operation.SOAPAction,
+					response: soapEnvelope(envelope, body),
+				})
+			}
+			endpoint, skipped := soapEndpoint(path, contentType, envelope, operations)
+			for _, operation := range skipped {
+				warnings = append(warnings, fmt.Sprintf("port %s: operation %s has no SOAP action and can't be told apart", port.Name, operation))
+			}
+			plugin.Endpoints = append(plugin.Endpoints, endpoint)
+		}
+	}
+	if len(plugin.Endpoints) == 0 {
+		return nil, warnings, fmt.Errorf("no SOAP ports found in WSDL")
+	}
+	return plugin, warnings, nil
+}
+
+// sampleBody returns the sample body content of an output message. Document
+// style parts reference elements, RPC style parts are wrapped in an element
+// named after the operation.
+func (index *xsdIndex) sampleBody(message wsdlMessage, operation, style, namespace string) string {
+	sample := &xmlSample{index: index, expanding: make(map[string]bool)}
+	if style == "rpc" {
+		fmt.Fprintf(&sample.buffer, "    <%sResponse xmlns=%q>\n", operation, namespace)
+		for _, part := range message.Parts {
+			sample.element(xsdElement{Name: part.Name, Type: part.Type}, nil, false, namespace, 3)
+		}
+		fmt.Fprintf(&sample.buffer, "    </%sResponse>\n", operation)
+		return sample.buffer.String()
+	}
+
+	for _, part := range message.Parts {
+		if part.Element != "" {
+			sample.element(xsdElement{Ref: part.Element}, nil, false, "", 2)
+		}
+	}
+	return sample.buffer.String()
+}
+
+// soapEndpoint returns the endpoint of a SOAP port. A single operation is
+// always answered; several are selected by SOAP action, and unknown actions
+// get a fault. Operations without an action are returned as skipped.
+func soapEndpoint(path, contentType, envelope string, operations []wsdlOperation) (Endpoint, []string) {
+	endpoint := Endpoint{
+		Path:        path,
+		Method:      "POST",
+		StatusCode:  200,
+		ContentType: contentType,
+	}
+	if len(operations) == 1 {
+		endpoint.Response = operations[0].response
+		return endpoint, nil
+	}
+
+	var skipped []string
+	endpoint.StatusCode = 500
+	endpoint.Response = soapFault(envelope, "Unknown SOAP action")
+	endpoint.ResponseMap = &ResponseMap{Key: "{{.SOAPAction}}", Responses: make(map[string]MappedResponse)}
+	for _, operation := range operations {
+		if operation.action == "" {
+			skipped = append(skipped, operation.name)
+			continue
+		}
+		endpoint.ResponseMap.Responses[operation.action] = MappedResponse{StatusCode: 200, Response: operation.response}
+	}
+	sort.Strings(skipped)
+	return endpoint, skipped
+}
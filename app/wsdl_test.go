@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testWSDL describes a document/literal service with SOAP 1.1 and 1.2 ports
+const testWSDL = `<?xml version="1.0" encoding="utf-8"?>
+<wsdl:definitions name="Orders" targetNamespace="http://example.com/orders"
+    xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/"
+    xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+    xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/"
+    xmlns:xs="http://www.w3.org/2001/XMLSchema"
+    xmlns:tns="http://example.com/orders">
+  <wsdl:types>
+    <xs:schema targetNamespace="http://example.com/orders" elementFormDefault="qualified">
+      <xs:simpleType name="Status">
+        <xs:restriction base="xs:string">
+          <xs:enumeration value="SHIPPED"/>
+          <xs:enumeration value="PENDING"/>
+        </xs:restriction>
+      </xs:simpleType>
+      <xs:complexType name="Order">
+        <xs:sequence>
+          <xs:element name="Id" type="xs:int"/>
+          <xs:element name="Status" type="tns:Status"/>
+          <xs:element name="Total" type="xs:decimal"/>
+          <xs:element name="Parent" type="tns:Order" minOccurs="0"/>
+        </xs:sequence>
+      </xs:complexType>
+      <xs:element name="GetOrder">
+        <xs:complexType><xs:sequence><xs:element name="Id" type="xs:int"/></xs:sequence></xs:complexType>
+      </xs:element>
+      <xs:element name="GetOrderResponse">
+        <xs:complexType><xs:sequence><xs:element name="Order" type="tns:Order"/></xs:sequence></xs:complexType>
+      </xs:element>
+      <xs:element name="CancelOrderResponse">
+        <xs:complexType><xs:sequence><xs:element name="Cancelled" type="xs:boolean"/></xs:sequence></xs:complexType>
+      </xs:element>
+    </xs:schema>
+  </wsdl:types>
+  <wsdl:message name="GetOrderIn"><wsdl:part name="parameters" element="tns:GetOrder"/></wsdl:message>
+  <wsdl:message name="GetOrderOut"><wsdl:part name="parameters" element="tns:GetOrderResponse"/></wsdl:message>
+  <wsdl:message name="CancelOrderOut"><wsdl:part name="parameters" element="tns:CancelOrderResponse"/></wsdl:message>
+  <wsdl:portType name="OrdersPort">
+    <wsdl:operation name="GetOrder">
+      <wsdl:input message="tns:GetOrderIn"/><wsdl:output message="tns:GetOrderOut"/>
+    </wsdl:operation>
+    <wsdl:operation name="CancelOrder">
+      <wsdl:input message="tns:GetOrderIn"/><wsdl:output message="tns:CancelOrderOut"/>
+    </wsdl:operation>
+  </wsdl:portType>
+  <wsdl:binding name="OrdersSoap" type="tns:OrdersPort">
+    <soap:binding transport="http://schemas.xmlsoap.org/soap/http" style="document"/>
+    <wsdl:operation name="GetOrder">
+      <soap:operation soapAction="http://example.com/orders/GetOrder"/>
+      <wsdl:input><soap:body use="literal"/></wsdl:input><wsdl:output><soap:body use="literal"/></wsdl:output>
+    </wsdl:operation>
+    <wsdl:operation name="CancelOrder">
+      <soap:operation soapAction="http://example.com/orders/CancelOrder"/>
+      <wsdl:input><soap:body use="literal"/></wsdl:input><wsdl:output><soap:body use="literal"/></wsdl:output>
+    </wsdl:operation>
+  </wsdl:binding>
+  <wsdl:binding name="OrdersSoap12" type="tns:OrdersPort">
+    <soap12:binding transport="http://schemas.xmlsoap.org/soap/http" style="document"/>
+    <wsdl:operation name="GetOrder">
+      <soap12:operation soapAction="http://example.com/orders/GetOrder"/>
+    </wsdl:operation>
+    <wsdl:operation name="CancelOrder">
+      <soap12:operation soapAction="http://example.com/orders/CancelOrder"/>
+    </wsdl:operation>
+  </wsdl:binding>
+  <wsdl:service name="OrdersService">
+    <wsdl:port name="OrdersSoap" binding="tns:OrdersSoap">
+      <soap:address location="http://legacy.example.com/services/orders.asmx"/>
+    </wsdl:port>
+    <wsdl:port name="OrdersSoap12" binding="tns:OrdersSoap12">
+      <soap12:address location="http://legacy.example.com/services/orders12.asmx"/>
+    </wsdl:port>
+    <wsdl:port name="OrdersSoapCopy" binding="tns:OrdersSoap">
+      <soap:address location="http://other.example.com/services/orders.asmx"/>
+    </wsdl:port>
+  </wsdl:service>
+</wsdl:definitions>`
+
+// TestImportWSDL tests generating SOAP endpoints from a WSDL document
+func TestImportWSDL(t *testing.T) {
+	plugin, warnings, err := importWSDL([]byte(testWSDL), "")
+	if err != nil {
+		t.Fatalf("Failed to import WSDL: %v", err)
+	}
+	if plugin.Name != "Orders" || len(plugin.Endpoints) != 2 {
+		t.Fatalf("Expected plugin Orders with 2 endpoints, got %s with %d", plugin.Name, len(plugin.Endpoints))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "already served by port OrdersSoap") {
+		t.Errorf("Expected a warning about the duplicate port, got %v", warnings)
+	}
+
+	expected := `    <GetOrderResponse xmlns="http://example.com/orders">
+      <Order>
+        <Id>1</Id>
+        <Status>SHIPPED</Status>
+        <Total>1.5</Total>
+        <Parent/>
+      </Order>
+`
+	getOrder := plugin.Endpoints[0].ResponseMap.Responses["http://example.com/orders/GetOrder"].Response.(string)
+	if !strings.Contains(getOrder, expected) {
+		t.Errorf("Unexpected sample envelope:\n%s", getOrder)
+	}
+
+	server := NewMockServer("")
+	server.config = &Config{Port: "9000", PluginsDir: t.TempDir()}
+	server.plugins[plugin.Name] = plugin
+	server.SetupRoutes()
+
+	call := func(path, contentType, action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader("<soap:Envelope/>"))
+		req.Header.Set("Content-Type", contentType)
+		if action != "" {
+			req.Header.Set("SOAPAction", action)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("/services/orders.asmx", "text/xml", `"http://example.com/orders/CancelOrder"`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "<Cancelled>true</Cancelled>") ||
+		!strings.Contains(w.Body.String(), soap11Envelope) || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/xml") {
+		t.Errorf("Unexpected SOAP 1.1 response: %d %s\n%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// SOAP 1.2 passes the action as a Content-Type parameter
+	w = call("/services/orders12.asmx", `application/soap+xml; charset=utf-8; action="http://example.com/orders/GetOrder"`, "")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "<GetOrderResponse") || !strings.Contains(w.Body.String(), soap12Envelope) {
+		t.Errorf("Unexpected SOAP 1.2 response: %d\n%s", w.Code, w.Body.String())
+	}
+
+	w = call("/services/orders.asmx", "text/xml", "http://example.com/orders/Unknown")
+	if w.Code != 500 || !strings.Contains(w.Body.String(), "<faultstring>Unknown SOAP action</faultstring>") {
+		t.Errorf("Expected a fault for an unknown action, got %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+// TestImportWSDLRPC tests RPC style operations and ports with one operation
+func TestImportWSDLRPC(t *testing.T) {
+	wsdl := `<definitions name="Calc" targetNamespace="urn:calc" xmlns="http://schemas.xmlsoap.org/wsdl/"
+    xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/" xmlns:tns="urn:calc" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <message name="AddResponse"><part name="sum" type="xsd:int"/></message>
+  <portType name="CalcPort"><operation name="Add"><output message="tns:AddResponse"/></operation></portType>
+  <binding name="CalcBinding" type="tns:CalcPort">
+    <soap:binding style="rpc" transport="http://schemas.xmlsoap.org/soap/http"/>
+    <operation name="Add"><soap:operation soapAction=""/><output><soap:body use="literal" namespace="urn:calc:rpc"/></output></operation>
+  </binding>
+  <service name="CalcService"><port name="CalcPort" binding="tns:CalcBinding"><soap:address location="http://localhost/calc"/></port></service>
+</definitions>`
+
+	plugin, warnings, err := importWSDL([]byte(wsdl), "calculator")
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("Failed to import WSDL: %v %v", err, warnings)
+	}
+	endpoint := plugin.Endpoints[0]
+	if plugin.Name != "calculator" || endpoint.Path != "/calc" || endpoint.ResponseMap != nil || endpoint.StatusCode != 200 {
+		t.Fatalf("Unexpected endpoint: %+v", endpoint)
+	}
+	expected := "    <AddResponse xmlns=\"urn:calc:rpc\">\n      <sum xmlns=\"\">1</sum>\n    </AddResponse>\n"
+	if !strings.Contains(endpoint.Response.(string), expected) {
+		t.Errorf("Unexpected sample envelope:\n%s", endpoint.Response)
+	}
+
+	if _, _, err := importWSDL([]byte(`<definitions/>`), ""); err == nil {
+		t.Error("Expected an error for a WSDL without SOAP ports")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is an element, attribute or text node of a parsed XML document.
+// Names are compared without namespace prefixes.
+type xmlNode struct {
+	kind     xmlNodeKind
+	name     string
+	value    string // attribute value or text
+	attrs    []*xmlNode
+	children []*xmlNode // elements and text nodes in document order
+	parent   *xmlNode
+}
+
+type xmlNodeKind int
+
+const (
+	xmlDocument xmlNodeKind = iota
+	xmlElement
+	xmlAttribute
+	xmlText
+)
+
+// parseXMLDocument parses an XML document into a tree of nodes
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	root := &xmlNode{kind: xmlDocument}
+	current := root
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			element := &xmlNode{kind: xmlElement, name: token.Name.Local, parent: current}
+			for _, attr := range token.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				element.attrs = append(element.attrs, &xmlNode{kind: xmlAttribute, name: attr.Name.Local, value: attr.Value, parent: element})
+			}
+			current.children = append(current.children, element)
+			current = element
+		case xml.EndElement:
+			if current.parent != nil {
+				current = current.parent
+			}
+		case xml.CharData:
+			if current != root {
+				current.children = append(current.children, &xmlNode{kind: xmlText, value: string(token), parent: current})
+			}
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// text returns the string value of a node: the trimmed text of an element
+// and its descendants, or the value of an attribute or text node
+func (n *xmlNode) text() string {
+	if n.kind == xmlAttribute || n.kind == xmlText {
+		return n.value
+	}
+	var text strings.Builder
+	var collect func(node *xmlNode)
+	collect = func(node *xmlNode) {
+		for _, child := range node.children {
+			if child.kind == xmlText {
+				text.WriteString(child.value)
+			} else {
+				collect(child)
+			}
+		}
+	}
+	collect(n)
+	return strings.TrimSpace(text.String())
+}
+
+// xpathStep is one step of a location path
+type xpathStep struct {
+	descendant bool   // preceded by "//"
+	test       string // element name, "*", "@name", "@*", "text()", "." or ".."
+	predicates []xpathPredicate
+}
+
+// xpathPredicate filters the nodes selected by a step: by position when
+// position is set, otherwise by the existence or value of a relative path
+type xpathPredicate struct {
+	position int // 1-based, -1 for last()
+	path     *xpathExpr
+	value    *string
+}
+
+// xpathExpr is a compiled XPath expression. The supported subset covers
+// absolute and relative location paths with "/" and "//", element names
+// (namespace prefixes are ignored), "*", "@attr", "text()", "." and "..",
+// predicates such as [2], [last()], [@id], [Code='A'] and [@type="x"], and
+// count() of a path.
+type xpathExpr struct {
+	absolute bool
+	count    bool
+	steps    []xpathStep
+}
+
+// compileXPath parses an XPath expression
+func compileXPath(expr string) (*xpathExpr, error) {
+	expr = strings.TrimSpace(expr)
+	if inner, ok := strings.CutPrefix(expr, "count("); ok && strings.HasSuffix(inner, ")") {
+		x, err := compileXPath(strings.TrimSuffix(inner, ")"))
+		if err != nil {
+			return nil, err
+		}
+		x.count = true
+		return x, nil
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("empty XPath expression")
+	}
+
+	x := &xpathExpr{absolute: strings.HasPrefix(expr, "/")}
+	rest := expr
+	for rest != "" {
+		step := xpathStep{}
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			step.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		case len(x.steps) > 0:
+			return nil, fmt.Errorf("invalid XPath expression %q", expr)
+		}
+
+		// The test runs up to the next predicate or separator
+		end := strings.IndexAny(rest, "[/")
+		if end < 0 {
+			end = len(rest)
+		}
+		step.test = strings.TrimSpace(rest[:end])
+		rest = rest[end:]
+		if step.test == "" {
+			return nil, fmt.Errorf("invalid XPath expression %q", expr)
+		}
+		if name := strings.TrimPrefix(step.test, "@"); strings.ContainsAny(name, " ()=") && step.test != "text()" {
+			return nil, fmt.Errorf("unsupported XPath step %q", step.test)
+		}
+
+		for strings.HasPrefix(rest, "[") {
+			end := xpathPredicateEnd(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed predicate in %q", expr)
+			}
+			predicate, err := compileXPathPredicate(rest[1:end])
+			if err != nil {
+				return nil, err
+			}
+			step.predicates = append(step.predicates, predicate)
+			rest = rest[end+1:]
+		}
+		x.steps = append(x.steps, step)
+	}
+	return x, nil
+}
+
+// xpathPredicateEnd returns the index of the bracket closing the predicate
+// at the start of s, skipping quoted literals and nested predicates
+func xpathPredicateEnd(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// compileXPathPredicate parses the content of a predicate
+func compileXPathPredicate(s string) (xpathPredicate, error) {
+	s = strings.TrimSpace(s)
+	if s == "last()" {
+		return xpathPredicate{position: -1}, nil
+	}
+	if position, err := strconv.Atoi(s); err == nil {
+		if position < 1 {
+			return xpathPredicate{}, fmt.Errorf("invalid XPath position %d", position)
+		}
+		return xpathPredicate{position: position}, nil
+	}
+
+	var value *string
+	if path, literal, ok := strings.Cut(s, "="); ok {
+		literal = strings.TrimSpace(literal)
+		if len(literal) < 2 || (literal[0] != '\'' && literal[0] != '"') || literal[len(literal)-1] != literal[0] {
+			return xpathPredicate{}, fmt.Errorf("invalid XPath literal %s", literal)
+		}
+		literal = literal[1 : len(literal)-1]
+		value = &literal
+		s = strings.TrimSpace(path)
+	}
+	path, err := compileXPath(s)
+	if err != nil {
+		return xpathPredicate{}, err
+	}
+	return xpathPredicate{path: path, value: value}, nil
+}
+
+// evaluate returns the string value of the first selected node, or the
+// number of selected nodes for count()
+func (x *xpathExpr) evaluate(root *xmlNode) (string, bool) {
+	nodes := x.selectNodes(root)
+	if x.count {
+		return strconv.Itoa(len(nodes)), true
+	}
+	if len(nodes) == 0 {
+		return "", false
+	}
+	return nodes[0].text(), true
+}
+
+// selectNodes returns the nodes selected from a context node
+func (x *xpathExpr) selectNodes(context *xmlNode) []*xmlNode {
+	if x.absolute {
+		for context.parent != nil {
+			context = context.parent
+		}
+	}
+	nodes := []*xmlNode{context}
+	for _, step := range x.steps {
+		var next []*xmlNode
+		seen := make(map[*xmlNode]bool)
+		for _, node := range nodes {
+			contexts := []*xmlNode{node}
+			if step.descendant {
+				contexts = descendantsOrSelf(node)
+			}
+			for _, context := range contexts {
+				for _, selected := range step.apply(context) {
+					if !seen[selected] {
+						seen[selected] = true
+						next = append(next, selected)
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// apply selects the nodes of a step from one context node and filters them
+// with the predicates
+func (step xpathStep) apply(context *xmlNode) []*xmlNode {
+	var candidates []*xmlNode
+	switch {
+	case step.test == ".":
+		candidates = []*xmlNode{context}
+	case step.test == "..":
+		if context.parent != nil {
+			candidates = []*xmlNode{context.parent}
+		}
+	case step.test == "text()":
+		for _, child := range context.children {
+			if child.kind == xmlText {
+				candidates = append(candidates, child)
+			}
+		}
+	case strings.HasPrefix(step.test, "@"):
+		name := step.test[1:]
+		for _, attr := range context.attrs {
+			if name == "*" || attr.name == localName(name) {
+				candidates = append(candidates, attr)
+			}
+		}
+	default:
+		for _, child := range context.children {
+			if child.kind == xmlElement && (step.test == "*" || child.name == localName(step.test)) {
+				candidates = append(candidates, child)
+			}
+		}
+	}
+
+	for _, predicate := range step.predicates {
+		var filtered []*xmlNode
+		for i, candidate := range candidates {
+			if predicate.matches(candidate, i+1, len(candidates)) {
+				filtered = append(filtered, candidate)
+			}
+		}
+		candidates = filtered
+	}
+	return candidates
+}
+
+// matches reports whether a node at a position satisfies a predicate
+func (p xpathPredicate) matches(node *xmlNode, position, size int) bool {
+	switch {
+	case p.position == -1:
+		return position == size
+	case p.position > 0:
+		return position == p.position
+	}
+	for _, selected := range p.path.selectNodes(node) {
+		if p.value == nil || selected.text() == *p.value {
+			return true
+		}
+	}
+	return false
+}
+
+// descendantsOrSelf returns a node and all its descendant elements in
+// document order
+func descendantsOrSelf(node *xmlNode) []*xmlNode {
+	nodes := []*xmlNode{node}
+	for _, child := range node.children {
+		if child.kind == xmlElement {
+			nodes = append(nodes, descendantsOrSelf(child)...)
+		}
+	}
+	return nodes
+}
+
+// bodyXPath evaluates an XPath expression against an XML request body. The
+// body stays readable.
+func bodyXPath(r *http.Request, x *xpathExpr) string {
+	data, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	root, err := parseXMLDocument(data)
+	if err != nil {
+		return ""
+	}
+	value, _ := x.evaluate(root)
+	return value
+}
+
+// XPath returns the value selected by an XPath expression in the XML
+// request body, or an empty string
+func (d requestData) XPath(expr string) string {
+	if d.request == nil {
+		return ""
+	}
+	x, err := compileXPath(expr)
+	if err != nil {
+		return ""
+	}
+	return bodyXPath(d.request, x)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testSOAPRequest is a SOAP request with namespaces, attributes and lists
+const testSOAPRequest = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:o="http://example.com/orders">
+  <soap:Body>
+    <o:PlaceOrder channel="web">
+      <o:Customer id="42">Alice &amp; Co</o:Customer>
+      <o:Item sku="A1"><o:Qty>2</o:Qty></o:Item>
+      <o:Item sku="B2"><o:Qty>5</o:Qty></o:Item>
+      <o:Item sku="C3"><o:Qty>1</o:Qty></o:Item>
+    </o:PlaceOrder>
+  </soap:Body>
+</soap:Envelope>`
+
+// TestXPath tests evaluating the supported XPath subset
+func TestXPath(t *testing.T) {
+	root, err := parseXMLDocument([]byte(testSOAPRequest))
+	if err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+		found    bool
+	}{
+		{"/Envelope/Body/PlaceOrder/Customer", "Alice & Co", true},
+		{"/soap:Envelope/soap:Body/o:PlaceOrder/@channel", "web", true},
+		{"//Customer/@id", "42", true},
+		{"//Item[2]/@sku", "B2", true},
+		{"//Item[last()]/Qty", "1", true},
+		{"//Item[@sku='B2']/Qty", "5", true},
+		{`//Item[Qty="1"]/@sku`, "C3", true},
+		{"//Qty[.='5']/../@sku", "B2", true},
+		{"//PlaceOrder/*[1]/text()", "Alice & Co", true},
+		{"count(//Item)", "3", true},
+		{"count(//Missing)", "0", true},
+		{"//Item[4]", "", false},
+		{"//Missing", "", false},
+	}
+	for _, test := range tests {
+		x, err := compileXPath(test.expr)
+		if err != nil {
+			t.Errorf("Failed to compile %s: %v", test.expr, err)
+			continue
+		}
+		value, found := x.evaluate(root)
+		if value != test.expected || found != test.found {
+			t.Errorf("%s: expected %q (%v), got %q (%v)", test.expr, test.expected, test.found, value, found)
+		}
+	}
+
+	for _, expr := range []string{"", "//Item[", "//Item[0]", "//Item[sku=B2]", "//sum(Qty)", "Item//"} {
+		if _, err := compileXPath(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+// TestXPathKey tests keys taken from an XML request body
+func TestXPathKey(t *testing.T) {
+	key, err := compileKey("xpath://Customer/@id")
+	if err != nil {
+		t.Fatalf("Failed to compile key: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(testSOAPRequest))
+	if value := key(req); value != "42" {
+		t.Errorf("Expected key 42, got %q", value)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != testSOAPRequest {
+		t.Error("Expected the body to stay readable")
+	}
+
+	if value := key(httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 42}`))); value != "" {
+		t.Errorf("Expected an empty key for a JSON body, got %q", value)
+	}
+	if _, err := compileKey("xpath://Item["); err == nil {
+		t.Error("Expected an invalid XPath key to be rejected")
+	}
+}